@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -13,10 +14,80 @@ type Config struct {
 	AWSAccessKeyID     string
 	AWSSecretAccessKey string
 	AWSS3Bucket        string
+	AWSS3Endpoint      string // S3 compatible endpoint (e.g. MinIO), path style addressing
+	StorageBackend     string
+	LocalStoragePath   string
+	LocalURLSigningKey string // HMAC key for presigned /uploads URLs; random per start when empty
+	DatabasePath       string
 	Port               string
 	MaxFileSize        int64
 	FFmpegPath         string
+	FFprobePath        string
 	EnableVideoProcessing bool
+	EnableHLS          bool
+	HLSRenditions      []string
+	HLSSegmentDuration int
+	EnableDASH         bool
+	DASHSegmentDuration int
+	SpoolPath          string
+	ProcessingWorkers  int
+	JobMaxAttempts     int
+	JobRetryBackoff    int // seconds, doubled after every failed attempt
+	ConvertTimeoutRatio int // seconds of conversion allowed per second of video
+	ConvertTimeoutMin  int // minutes
+	WebhookURL         string
+	WebhookSecret      string
+	WebhookEvents      []string
+	WebhookMaxAttempts int
+	WebhookRetryBackoff int // seconds, doubled after every failed attempt
+	WebhookTimeout     int // seconds
+	TusUploadPath      string
+	TusMaxSize         int64
+	TusExpiration      int // hours an unfinished upload is kept after its last chunk
+	S3PartSize         int64
+	S3UploadConcurrency int
+	StreamMaxSize      int64
+	DirectUploadMaxSize int64
+	DirectUploadExpiry int // minutes presigned upload requests stay valid
+	CacheControlVideo  string
+	CacheControlImage  string
+	CacheControlDefault string
+	ThumbnailSizes     []string
+	ThumbnailPosition  int // percent of the duration the poster is captured at
+	EnableTrickplay    bool
+	TrickplayInterval  int // seconds covered by each sprite tile
+	TrickplayWidth     int
+	TrickplayColumns   int
+	TrickplayRows      int
+	TrickplayFormat    string // jpg or webp
+	EnablePreview      bool
+	PreviewFormat      string // mp4, webp or gif
+	PreviewSegments    int
+	PreviewSegmentDuration int // seconds
+	PreviewWidth       int
+	PreviewFPS         int
+	EnableImageProcessing bool
+	ImageSizes         []string // responsive widths in pixels
+	ImageFormats       []string // webp, avif, jpg
+	ImageQuality       int      // 1-100
+	AllowedContainers  []string // containers uploads may use, recognized by their magic bytes
+	AllowedVideoCodecs []string
+	AllowedAudioCodecs []string
+	AuthEnabled        bool
+	AdminAPIKey        string   // registered as an admin key on startup
+	CORSAllowedOrigins []string // "*" allows every origin
+	JWTJWKSURL         string   // JWKS URL or file path; enables JWT bearer tokens when set
+	JWTIssuer          string
+	JWTAudience        string
+	JWTScopeClaim      string   // claim holding the token scopes, dots reach into nested claims
+	JWTScopeMap        []string // token-scope=permission pairs; empty grants upload, read and delete as named
+	JWTTenantClaim     string   // claim naming the tenant of the caller; empty puts every token in the default tenant
+	JWTJWKSCacheTTL    int      // minutes
+	JWTClockSkew       int      // seconds
+	PlaybackSigningKey string   // HMAC key for playback tokens; enables signed playback URLs when set
+	PlaybackTokenTTL   int      // minutes
+	PlaybackTokenMaxTTL int     // minutes
+	TrustedProxies     []string // proxies whose X-Forwarded-For is trusted for the client IP
 }
 
 var AppConfig *Config
@@ -32,17 +103,87 @@ func LoadConfig() {
 		AWSAccessKeyID:     getEnv("AWS_ACCESS_KEY_ID", ""),
 		AWSSecretAccessKey: getEnv("AWS_SECRET_ACCESS_KEY", ""),
 		AWSS3Bucket:        getEnv("AWS_S3_BUCKET", ""),
+		AWSS3Endpoint:      getEnv("AWS_S3_ENDPOINT", ""),
+		StorageBackend:     getEnv("STORAGE_BACKEND", ""),
+		LocalStoragePath:   getEnv("LOCAL_STORAGE_PATH", "uploads"),
+		LocalURLSigningKey: getEnv("LOCAL_URL_SIGNING_KEY", ""),
+		DatabasePath:       getEnv("DATABASE_PATH", "data/media.db"),
 		Port:               getEnv("PORT", "8080"),
 		MaxFileSize:        parseFileSize(getEnv("MAX_FILE_SIZE", "500MB")), // Increased to 500MB
 		FFmpegPath:         getEnv("FFMPEG_PATH", "/usr/bin/ffmpeg"),
+		FFprobePath:        getEnv("FFPROBE_PATH", "/usr/bin/ffprobe"),
 		EnableVideoProcessing: getEnvBool("ENABLE_VIDEO_PROCESSING", true),
+		EnableHLS:          getEnvBool("ENABLE_HLS", true),
+		HLSRenditions:      getEnvList("HLS_RENDITIONS", "240p,360p,480p,720p,1080p"),
+		HLSSegmentDuration: getEnvInt("HLS_SEGMENT_DURATION", 6),
+		EnableDASH:         getEnvBool("ENABLE_DASH", false),
+		DASHSegmentDuration: getEnvInt("DASH_SEGMENT_DURATION", 4),
+		SpoolPath:          getEnv("SPOOL_PATH", "data/spool"),
+		ProcessingWorkers:  getEnvInt("PROCESSING_WORKERS", 2),
+		JobMaxAttempts:     getEnvInt("JOB_MAX_ATTEMPTS", 3),
+		JobRetryBackoff:    getEnvInt("JOB_RETRY_BACKOFF", 30),
+		ConvertTimeoutRatio: getEnvInt("CONVERT_TIMEOUT_RATIO", 4),
+		ConvertTimeoutMin:  getEnvInt("CONVERT_TIMEOUT_MIN", 5),
+		WebhookURL:         getEnv("WEBHOOK_URL", ""),
+		WebhookSecret:      getEnv("WEBHOOK_SECRET", ""),
+		WebhookEvents:      getEnvList("WEBHOOK_EVENTS", ""),
+		WebhookMaxAttempts: getEnvInt("WEBHOOK_MAX_ATTEMPTS", 5),
+		WebhookRetryBackoff: getEnvInt("WEBHOOK_RETRY_BACKOFF", 10),
+		WebhookTimeout:     getEnvInt("WEBHOOK_TIMEOUT", 10),
+		TusUploadPath:      getEnv("TUS_UPLOAD_PATH", "data/tus"),
+		TusMaxSize:         parseFileSize(getEnv("TUS_MAX_SIZE", "5GB")),
+		TusExpiration:      getEnvInt("TUS_EXPIRATION", 24),
+		S3PartSize:         parseFileSize(getEnv("S3_PART_SIZE", "16MB")),
+		S3UploadConcurrency: getEnvInt("S3_UPLOAD_CONCURRENCY", 4),
+		StreamMaxSize:      parseFileSize(getEnv("STREAM_MAX_SIZE", "50GB")),
+		DirectUploadMaxSize: parseFileSize(getEnv("DIRECT_UPLOAD_MAX_SIZE", "50GB")),
+		DirectUploadExpiry: getEnvInt("DIRECT_UPLOAD_EXPIRY", 60),
+		CacheControlVideo:  getEnv("CACHE_CONTROL_VIDEO", "public, max-age=86400"),
+		CacheControlImage:  getEnv("CACHE_CONTROL_IMAGE", "public, max-age=604800"),
+		CacheControlDefault: getEnv("CACHE_CONTROL_DEFAULT", "public, max-age=3600"),
+		ThumbnailSizes:     getEnvList("THUMBNAIL_SIZES", "small,medium,large"),
+		ThumbnailPosition:  getEnvInt("THUMBNAIL_POSITION", 10),
+		EnableTrickplay:    getEnvBool("ENABLE_TRICKPLAY", true),
+		TrickplayInterval:  getEnvInt("TRICKPLAY_INTERVAL", 10),
+		TrickplayWidth:     getEnvInt("TRICKPLAY_WIDTH", 160),
+		TrickplayColumns:   getEnvInt("TRICKPLAY_COLUMNS", 10),
+		TrickplayRows:      getEnvInt("TRICKPLAY_ROWS", 10),
+		TrickplayFormat:    getEnv("TRICKPLAY_FORMAT", "jpg"),
+		EnablePreview:      getEnvBool("ENABLE_PREVIEW", true),
+		PreviewFormat:      getEnv("PREVIEW_FORMAT", "mp4"),
+		PreviewSegments:    getEnvInt("PREVIEW_SEGMENTS", 5),
+		PreviewSegmentDuration: getEnvInt("PREVIEW_SEGMENT_DURATION", 1),
+		PreviewWidth:       getEnvInt("PREVIEW_WIDTH", 320),
+		PreviewFPS:         getEnvInt("PREVIEW_FPS", 12),
+		EnableImageProcessing: getEnvBool("ENABLE_IMAGE_PROCESSING", true),
+		ImageSizes:         getEnvList("IMAGE_SIZES", "320,640,1024,1920"),
+		ImageFormats:       getEnvList("IMAGE_FORMATS", "webp,avif"),
+		ImageQuality:       getEnvInt("IMAGE_QUALITY", 80),
+		AllowedContainers:  getEnvList("ALLOWED_CONTAINERS", "jpeg,png,gif,webp,avif,bmp,mp4,mov,3gp,mkv,webm,avi,flv,wmv"),
+		AllowedVideoCodecs: getEnvList("ALLOWED_VIDEO_CODECS", "h264,hevc,vp8,vp9,av1,mpeg4,mpeg2video,prores,vc1,wmv3,flv1,h263,mjpeg"),
+		AllowedAudioCodecs: getEnvList("ALLOWED_AUDIO_CODECS", "aac,mp3,opus,vorbis,ac3,eac3,flac,alac,mp2,wmav2,pcm_s16le,pcm_s24le"),
+		AuthEnabled:        getEnvBool("AUTH_ENABLED", true),
+		AdminAPIKey:        getEnv("ADMIN_API_KEY", ""),
+		CORSAllowedOrigins: getEnvList("CORS_ALLOWED_ORIGINS", "*"),
+		JWTJWKSURL:         getEnv("JWT_JWKS_URL", ""),
+		JWTIssuer:          getEnv("JWT_ISSUER", ""),
+		JWTAudience:        getEnv("JWT_AUDIENCE", ""),
+		JWTScopeClaim:      getEnv("JWT_SCOPE_CLAIM", "scope"),
+		JWTScopeMap:        getEnvList("JWT_SCOPE_MAP", ""),
+		JWTTenantClaim:     getEnv("JWT_TENANT_CLAIM", ""),
+		JWTJWKSCacheTTL:    getEnvInt("JWT_JWKS_CACHE_TTL", 60),
+		JWTClockSkew:       getEnvInt("JWT_CLOCK_SKEW", 60),
+		PlaybackSigningKey: getEnv("PLAYBACK_SIGNING_KEY", ""),
+		PlaybackTokenTTL:   getEnvInt("PLAYBACK_TOKEN_TTL", 60),
+		PlaybackTokenMaxTTL: getEnvInt("PLAYBACK_TOKEN_MAX_TTL", 1440),
+		TrustedProxies:     getEnvList("TRUSTED_PROXIES", ""),
 	}
 
 	// Validate required fields - but don't fail, just warn
 	if AppConfig.AWSAccessKeyID == "" || AppConfig.AWSSecretAccessKey == "" || AppConfig.AWSS3Bucket == "" {
 		log.Println("⚠️  AWS credentials not configured. Running in local mode.")
 		log.Println("   Set AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and AWS_S3_BUCKET for S3 functionality")
-		log.Println("   Use /api/v1/upload-local for testing without S3")
+		log.Printf("   Media will be stored in ./%s", AppConfig.LocalStoragePath)
 	} else {
 		log.Println("✅ AWS credentials configured")
 	}
@@ -65,6 +206,27 @@ func getEnvBool(key string, defaultValue bool) bool {
 	return defaultValue
 }
 
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+		log.Printf("⚠️  Invalid value for %s: %q, using default %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+// getEnvList reads a comma separated list, trimming blanks and empty items
+func getEnvList(key, defaultValue string) []string {
+	var items []string
+	for _, item := range strings.Split(getEnv(key, defaultValue), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func parseFileSize(sizeStr string) int64 {
 	if len(sizeStr) < 2 {
 		return 500 * 1024 * 1024 // Default 500MB
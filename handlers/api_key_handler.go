@@ -0,0 +1,407 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"api-s3/config"
+	"api-s3/models"
+	"api-s3/repository"
+	"api-s3/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyTouchInterval limits how often the last use of a key is written
+const apiKeyTouchInterval = time.Minute
+
+// apiKeyContextKey holds the authenticated API key in the request context
+type apiKeyContextKey struct{}
+
+// tokenContextKey holds the claims of a verified bearer token in the request context
+type tokenContextKey struct{}
+
+// APIKeyHandler authenticates requests and manages API keys
+type APIKeyHandler struct {
+	repo   repository.Repository
+	tokens *services.JWTVerifier
+}
+
+// NewAPIKeyHandler creates a new APIKeyHandler instance. JWT bearer tokens
+// are only accepted when tokens is not nil.
+func NewAPIKeyHandler(repo repository.Repository, tokens *services.JWTVerifier) *APIKeyHandler {
+	return &APIKeyHandler{repo: repo, tokens: tokens}
+}
+
+// RequireScope returns a middleware rejecting requests without an API key or
+// JWT granting scope. Credentials are read from an "Authorization: Bearer"
+// header or, for API keys, the X-API-Key header; GET and HEAD requests may
+// also pass them in the api_key or access_token query parameter, for players
+// and EventSource which cannot set headers. Nothing is checked when
+// AUTH_ENABLED is false.
+func (h *APIKeyHandler) RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !config.AppConfig.AuthEnabled {
+			c.Next()
+			return
+		}
+
+		credential := requestCredential(c)
+		if credential == "" {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": "API key required",
+			})
+			return
+		}
+
+		var ok bool
+		if h.tokens != nil && services.IsJWT(credential) {
+			ok = h.authenticateToken(c, credential, scope)
+		} else {
+			ok = h.authenticateKey(c, credential, scope)
+		}
+		if ok {
+			c.Next()
+		}
+	}
+}
+
+// authenticateKey checks an API key, answering the request when it is refused
+func (h *APIKeyHandler) authenticateKey(c *gin.Context, secret, scope string) bool {
+	key, err := h.repo.GetAPIKeyByHash(services.HashAPIKey(secret))
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && key.Revoked()) {
+		c.Header("WWW-Authenticate", "Bearer")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "Invalid API key",
+		})
+		return false
+	}
+	if err != nil {
+		log.Printf("❌ Error loading API key: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to verify API key",
+		})
+		return false
+	}
+	if !key.HasScope(scope) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("API key lacks the %s scope", scope),
+		})
+		return false
+	}
+
+	if now := time.Now(); key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyTouchInterval {
+		if err := h.repo.TouchAPIKey(key.ID, now); err != nil {
+			log.Printf("⚠️ Failed to record use of API key %s: %v", key.ID, err)
+		}
+	}
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), apiKeyContextKey{}, key))
+	return true
+}
+
+// authenticateToken checks a JWT bearer token, answering the request when it
+// is refused
+func (h *APIKeyHandler) authenticateToken(c *gin.Context, token, scope string) bool {
+	claims, err := h.tokens.Verify(c.Request.Context(), token)
+	var rejected *services.TokenError
+	if errors.As(err, &rejected) {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "Invalid token: " + rejected.Reason,
+		})
+		return false
+	}
+	if err != nil {
+		log.Printf("❌ Error verifying token: %v", err)
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"success": false,
+			"message": "Failed to verify token",
+		})
+		return false
+	}
+	if !claims.HasScope(scope) {
+		c.Header("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Token lacks the %s scope", scope),
+		})
+		return false
+	}
+
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), tokenContextKey{}, claims))
+	return true
+}
+
+// requestCredential returns the API key or token sent with a request, if any
+func requestCredential(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	if scheme, credential, ok := strings.Cut(c.GetHeader("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(credential)
+	}
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+		if key := c.Query("api_key"); key != "" {
+			return key
+		}
+		return c.Query("access_token")
+	}
+	return ""
+}
+
+// apiKeyFrom returns the API key a request was authenticated with, or nil
+func apiKeyFrom(ctx context.Context) *models.APIKey {
+	key, _ := ctx.Value(apiKeyContextKey{}).(*models.APIKey)
+	return key
+}
+
+// tokenFrom returns the claims of the bearer token a request was
+// authenticated with, or nil
+func tokenFrom(ctx context.Context) *models.TokenClaims {
+	claims, _ := ctx.Value(tokenContextKey{}).(*models.TokenClaims)
+	return claims
+}
+
+// callerTenant returns the tenant whose media a request may reach, or ""
+// for every tenant: admin keys and requests made without authentication
+func callerTenant(ctx context.Context) string {
+	if key := apiKeyFrom(ctx); key != nil {
+		if key.HasScope(models.ScopeAdmin) {
+			return ""
+		}
+		return key.TenantID
+	}
+	if claims := tokenFrom(ctx); claims != nil {
+		return claims.TenantID
+	}
+	return ""
+}
+
+// canReach reports whether a request may reach the media of a tenant
+func canReach(ctx context.Context, tenantID string) bool {
+	caller := callerTenant(ctx)
+	return caller == "" || caller == tenantID
+}
+
+// ownerTenant returns the tenant the uploads of a request belong to
+func ownerTenant(ctx context.Context) string {
+	if key := apiKeyFrom(ctx); key != nil {
+		return key.TenantID
+	}
+	if claims := tokenFrom(ctx); claims != nil {
+		return claims.TenantID
+	}
+	return models.DefaultTenantID
+}
+
+// CreateKey creates an API key. The key is only returned in this response.
+func (h *APIKeyHandler) CreateKey(c *gin.Context) {
+	var req models.APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIKeyResponse{
+			Success: false,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIKeyResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	tenantID := strings.TrimSpace(req.TenantID)
+	if tenantID == "" {
+		tenantID = models.DefaultTenantID
+	}
+	if _, err := h.repo.GetTenant(tenantID); err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			log.Printf("❌ Error loading tenant: %v", err)
+			c.JSON(http.StatusInternalServerError, models.APIKeyResponse{
+				Success: false,
+				Message: "Failed to load tenant",
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, models.APIKeyResponse{
+			Success: false,
+			Message: fmt.Sprintf("Unknown tenant: %s", tenantID),
+		})
+		return
+	}
+
+	key, err := services.NewAPIKey(strings.TrimSpace(req.Name), tenantID, scopes)
+	if err == nil {
+		err = h.repo.CreateAPIKey(key)
+	}
+	if err != nil {
+		log.Printf("❌ Error creating API key: %v", err)
+		c.JSON(http.StatusInternalServerError, models.APIKeyResponse{
+			Success: false,
+			Message: "Failed to create API key",
+		})
+		return
+	}
+
+	log.Printf("🔑 API key created: %s (%s) %v for tenant %s", key.Name, key.Prefix, key.Scopes, key.TenantID)
+	c.JSON(http.StatusCreated, models.APIKeyResponse{
+		Success: true,
+		Message: "API key created successfully. Store the key now, it cannot be retrieved again",
+		APIKey:  key,
+	})
+}
+
+// ListKeys returns every API key, revoked ones included, without secrets
+func (h *APIKeyHandler) ListKeys(c *gin.Context) {
+	keys, err := h.repo.ListAPIKeys()
+	if err != nil {
+		log.Printf("❌ Error listing API keys: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to list API keys",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"message":  "API keys retrieved successfully",
+		"api_keys": keys,
+	})
+}
+
+// GetKey returns a single API key without its secret
+func (h *APIKeyHandler) GetKey(c *gin.Context) {
+	key, ok := h.findKey(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIKeyResponse{
+		Success: true,
+		Message: "API key retrieved successfully",
+		APIKey:  key,
+	})
+}
+
+// RotateKey replaces the secret of an API key, keeping its ID and scopes.
+// The old secret stops working immediately.
+func (h *APIKeyHandler) RotateKey(c *gin.Context) {
+	key, ok := h.findKey(c)
+	if !ok {
+		return
+	}
+	if key.Revoked() {
+		c.JSON(http.StatusConflict, models.APIKeyResponse{
+			Success: false,
+			Message: "API key has been revoked",
+		})
+		return
+	}
+
+	err := services.RotateAPIKey(key)
+	if err == nil {
+		err = h.repo.UpdateAPIKey(key)
+	}
+	if err != nil {
+		log.Printf("❌ Error rotating API key: %v", err)
+		c.JSON(http.StatusInternalServerError, models.APIKeyResponse{
+			Success: false,
+			Message: "Failed to rotate API key",
+		})
+		return
+	}
+
+	log.Printf("🔄 API key rotated: %s (%s)", key.Name, key.Prefix)
+	c.JSON(http.StatusOK, models.APIKeyResponse{
+		Success: true,
+		Message: "API key rotated successfully. Store the key now, it cannot be retrieved again",
+		APIKey:  key,
+	})
+}
+
+// RevokeKey permanently disables an API key. The record is kept so media
+// uploaded with it still name their key.
+func (h *APIKeyHandler) RevokeKey(c *gin.Context) {
+	key, ok := h.findKey(c)
+	if !ok {
+		return
+	}
+
+	if !key.Revoked() {
+		now := time.Now()
+		key.RevokedAt = &now
+		if err := h.repo.UpdateAPIKey(key); err != nil {
+			log.Printf("❌ Error revoking API key: %v", err)
+			c.JSON(http.StatusInternalServerError, models.APIKeyResponse{
+				Success: false,
+				Message: "Failed to revoke API key",
+			})
+			return
+		}
+		log.Printf("🚫 API key revoked: %s (%s)", key.Name, key.Prefix)
+	}
+
+	c.JSON(http.StatusOK, models.APIKeyResponse{
+		Success: true,
+		Message: "API key revoked successfully",
+		APIKey:  key,
+	})
+}
+
+// findKey loads the API key named in the URL, writing the error response
+// when it cannot be found
+func (h *APIKeyHandler) findKey(c *gin.Context) (*models.APIKey, bool) {
+	key, err := h.repo.GetAPIKey(c.Param("id"))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "API key not found",
+		})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("❌ Error loading API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to load API key",
+		})
+		return nil, false
+	}
+	return key, true
+}
+
+// normalizeScopes validates requested scopes and drops duplicates
+func normalizeScopes(requested []string) ([]string, error) {
+	var scopes []string
+	seen := map[string]bool{}
+	for _, scope := range requested {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if !models.IsAPIKeyScope(scope) {
+			return nil, fmt.Errorf("Unsupported scope: %s (supported: %s)", scope, strings.Join(models.APIKeyScopes, ", "))
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, errors.New("At least one scope is required")
+	}
+	return scopes, nil
+}
@@ -1,19 +1,24 @@
 package handlers
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"mime/multipart"
 	"net/http"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"api-s3/config"
 	"api-s3/models"
+	"api-s3/repository"
 	"api-s3/services"
 
 	"github.com/gin-gonic/gin"
@@ -22,21 +27,27 @@ import (
 
 // MediaHandler handles media-related HTTP requests
 type MediaHandler struct {
-	s3Service    *services.S3Service
+	storage      services.Storage
 	videoService *services.VideoService
+	repo         repository.MediaRepository
+	queue        *services.JobQueue
+	events       *services.EventBroker
 }
 
 // NewMediaHandler creates a new MediaHandler instance
-func NewMediaHandler(s3Service *services.S3Service, videoService *services.VideoService) *MediaHandler {
+func NewMediaHandler(storage services.Storage, videoService *services.VideoService, repo repository.MediaRepository, queue *services.JobQueue, events *services.EventBroker) *MediaHandler {
 	return &MediaHandler{
-		s3Service:    s3Service,
+		storage:      storage,
 		videoService: videoService,
+		repo:         repo,
+		queue:        queue,
+		events:       events,
 	}
 }
 
-// UploadMedia handles file upload to S3
+// UploadMedia handles file upload to the configured storage
 func (h *MediaHandler) UploadMedia(c *gin.Context) {
-	log.Println("📤 Starting S3 file upload...")
+	log.Println("📤 Starting file upload...")
 	
 	// Get uploaded file
 	file, err := c.FormFile("file")
@@ -52,40 +63,46 @@ func (h *MediaHandler) UploadMedia(c *gin.Context) {
 	log.Printf("📁 File received: %s, Size: %d bytes, Type: %s", 
 		file.Filename, file.Size, file.Header.Get("Content-Type"))
 
+	tenant, ok := h.uploadTenant(c)
+	if !ok {
+		return
+	}
+
 	// Validate file size
-	if file.Size > config.AppConfig.MaxFileSize {
-		log.Printf("❌ File too large: %d > %d", file.Size, config.AppConfig.MaxFileSize)
+	maxSize := tenant.SizeLimit(config.AppConfig.MaxFileSize)
+	if file.Size > maxSize {
+		log.Printf("❌ File too large: %d > %d", file.Size, maxSize)
 		c.JSON(http.StatusBadRequest, models.UploadResponse{
 			Success: false,
-			Message: fmt.Sprintf("File size exceeds maximum allowed size of %d bytes", config.AppConfig.MaxFileSize),
+			Message: fmt.Sprintf("File size exceeds maximum allowed size of %d bytes", maxSize),
 		})
 		return
 	}
 
-	// Validate file type
-	contentType := file.Header.Get("Content-Type")
-	mediaType, err := h.validateFileType(contentType, file.Filename)
+	// The declared type is only a hint, the content decides
+	format, err := h.verifyFormFile(c.Request.Context(), file)
 	if err != nil {
-		log.Printf("❌ Invalid file type: %v", err)
-		c.JSON(http.StatusBadRequest, models.UploadResponse{
-			Success: false,
-			Message: err.Error(),
-		})
+		rejectUpload(c, err)
+		return
+	}
+	if err := services.CheckTenantFormat(tenant, format); err != nil {
+		rejectUpload(c, err)
 		return
 	}
+	mediaType, contentType := format.MediaType, format.MimeType
 
-	log.Printf("✅ File validation passed: %s", mediaType)
+	log.Printf("✅ File validation passed: %s (%s)", mediaType, format.Container)
 
 	// Generate unique ID for media
 	mediaID := uuid.New().String()
 	log.Printf("🆔 Generated media ID: %s", mediaID)
 
-	// Check if S3 service is available
-	if h.s3Service == nil {
-		log.Printf("❌ S3 service not available, falling back to local upload")
+	// Check if storage is available
+	if h.storage == nil {
+		log.Printf("❌ Storage not available")
 		c.JSON(http.StatusServiceUnavailable, models.UploadResponse{
 			Success: false,
-			Message: "S3 service not available. Please use /upload-local endpoint for local uploads.",
+			Message: "Storage not available",
 		})
 		return
 	}
@@ -94,44 +111,21 @@ func (h *MediaHandler) UploadMedia(c *gin.Context) {
 	if mediaType == models.MediaTypeVideo {
 		if config.AppConfig.EnableVideoProcessing {
 			log.Printf("🎬 Video processing enabled, starting background processing...")
-			
-			// Start background processing
-			go func() {
-				if err := h.processVideoInBackground(mediaID, file, c); err != nil {
-					log.Printf("❌ Background video processing failed: %v", err)
-				}
-			}()
-			
-			// Return immediately with processing status
-			c.JSON(http.StatusAccepted, models.UploadResponse{
-				Success: true,
-				Message: "Video upload started. Processing in background. Check progress at /api/v1/media/" + mediaID + "/progress",
-				Media: &models.Media{
-					ID:           mediaID,
-					Filename:     file.Filename,
-					OriginalName: file.Filename,
-					MediaType:    mediaType,
-					MimeType:     contentType,
-					Size:         file.Size,
-					URL:          "", // Will be updated when processing completes
-					CreatedAt:    time.Now(),
-					UpdatedAt:    time.Now(),
-				},
-			})
+			h.queueFormFile(c, file, tenant.ID, mediaID, mediaType, contentType)
 			return
 		} else {
 			log.Printf("🎬 Video processing disabled, uploading original video file...")
 			
 			// Upload original video file directly without processing
-			key := fmt.Sprintf("media/%s/%s", mediaID, file.Filename)
-			log.Printf("☁️ Uploading original video to S3: %s", key)
+			key := services.MediaKey(tenant.ID, mediaID, file.Filename)
+			log.Printf("☁️ Uploading original video to storage: %s", key)
 			
-			uploadedURL, err := h.s3Service.UploadFile(file, key)
+			uploadedURL, err := h.uploadFormFile(c.Request.Context(), file, key, contentType)
 			if err != nil {
-				log.Printf("❌ S3 upload failed: %v", err)
+				log.Printf("❌ Storage upload failed: %v", err)
 				c.JSON(http.StatusInternalServerError, models.UploadResponse{
 					Success: false,
-					Message: "Failed to upload video to S3",
+					Message: "Failed to upload video to storage",
 				})
 				return
 			}
@@ -139,16 +133,22 @@ func (h *MediaHandler) UploadMedia(c *gin.Context) {
 			// Create media object for original video
 			media := &models.Media{
 				ID:           mediaID,
+				TenantID:     tenant.ID,
 				Filename:     file.Filename,
 				OriginalName: file.Filename,
 				MediaType:    mediaType,
 				MimeType:     contentType,
 				Size:         file.Size,
 				URL:          uploadedURL,
+				StorageKey:   key,
 				CreatedAt:    time.Now(),
 				UpdatedAt:    time.Now(),
 			}
 			
+			if !h.saveMedia(c, media) {
+				return
+			}
+			
 			log.Printf("✅ Original video upload completed successfully: %s", media.URL)
 			
 			// Add upload information headers
@@ -163,16 +163,22 @@ func (h *MediaHandler) UploadMedia(c *gin.Context) {
 			return
 		}
 	} else {
-		// For non-video files, upload directly
-		key := fmt.Sprintf("media/%s/%s", mediaID, file.Filename)
-		log.Printf("☁️ Uploading to S3: %s", key)
+		if processingEnabled(mediaType) {
+			log.Printf("🖼️ Image processing enabled, starting background processing...")
+			h.queueFormFile(c, file, tenant.ID, mediaID, mediaType, contentType)
+			return
+		}
+
+		// For other files, upload directly
+		key := services.MediaKey(tenant.ID, mediaID, file.Filename)
+		log.Printf("☁️ Uploading to storage: %s", key)
 		
-		uploadedURL, err := h.s3Service.UploadFile(file, key)
+		uploadedURL, err := h.uploadFormFile(c.Request.Context(), file, key, contentType)
 		if err != nil {
-			log.Printf("❌ S3 upload failed: %v", err)
+			log.Printf("❌ Storage upload failed: %v", err)
 			c.JSON(http.StatusInternalServerError, models.UploadResponse{
 				Success: false,
-				Message: "Failed to upload file to S3",
+				Message: "Failed to upload file to storage",
 			})
 			return
 		}
@@ -180,16 +186,22 @@ func (h *MediaHandler) UploadMedia(c *gin.Context) {
 		// Create media object for non-video files
 		media := &models.Media{
 			ID:           mediaID,
+			TenantID:     tenant.ID,
 			Filename:     file.Filename,
 			OriginalName: file.Filename,
 			MediaType:    mediaType,
 			MimeType:     contentType,
 			Size:         file.Size,
 			URL:          uploadedURL,
+			StorageKey:   key,
 			CreatedAt:    time.Now(),
 			UpdatedAt:    time.Now(),
 		}
 		
+		if !h.saveMedia(c, media) {
+			return
+		}
+		
 		log.Printf("✅ Upload completed successfully: %s", media.URL)
 		
 		// Add upload information headers
@@ -205,122 +217,9 @@ func (h *MediaHandler) UploadMedia(c *gin.Context) {
 	}
 }
 
-// processVideoInBackground processes video in background - FAST CONVERT ONLY
-func (h *MediaHandler) processVideoInBackground(mediaID string, file *multipart.FileHeader, c *gin.Context) error {
-	log.Printf("🎬 Starting fast video conversion for: %s", mediaID)
-	
-	// Check if file is already MP4 - skip processing for speed
-	if strings.HasSuffix(strings.ToLower(file.Filename), ".mp4") {
-		log.Printf("✅ File is already MP4, uploading directly for speed")
-		
-		// Upload original MP4 file directly
-		key := fmt.Sprintf("media/%s/%s", mediaID, file.Filename)
-		log.Printf("☁️ Uploading original MP4 to S3: %s", key)
-		
-		uploadedURL, err := h.s3Service.UploadFile(file, key)
-		if err != nil {
-			log.Printf("❌ S3 upload failed: %v", err)
-			return err
-		}
-		
-		log.Printf("✅ Original MP4 upload completed: %s", uploadedURL)
-		return nil
-	}
-	
-	// Create temp directory for processing with unique timestamp
-	timestamp := time.Now().Unix()
-	tempDir := fmt.Sprintf("temp_%s_%d", mediaID, timestamp)
-	if err := os.MkdirAll(tempDir, 0755); err != nil {
-		log.Printf("❌ Failed to create temp directory: %v", err)
-		return err
-	}
-	defer os.RemoveAll(tempDir)
-	
-	// Save uploaded file to temp directory with unique name
-	uniqueFilename := fmt.Sprintf("%s_%d_%s", mediaID, timestamp, file.Filename)
-	tempInputPath := filepath.Join(tempDir, uniqueFilename)
-	if err := c.SaveUploadedFile(file, tempInputPath); err != nil {
-		log.Printf("❌ Failed to save temp file: %v", err)
-		return err
-	}
-	
-	// Fast convert-only output
-	outputFilename := fmt.Sprintf("%s_converted.mp4", mediaID)
-	outputPath := filepath.Join(tempDir, outputFilename)
-	
-	log.Printf("🎬 Converting to MP4 (fast mode)...")
-	
-	// FAST FFmpeg command - convert only, no scaling
-	cmd := exec.Command("ffmpeg",
-		"-i", tempInputPath,
-		"-c:v", "libx264",           // H.264 video codec
-		"-preset", "fast",           // Fast preset (not slow)
-		"-crf", "23",                // Good quality, fast encoding
-		"-c:a", "aac",               // AAC audio codec
-		"-b:a", "128k",              // Standard audio bitrate
-		"-movflags", "+faststart",   // Optimize for web streaming
-		"-pix_fmt", "yuv420p",       // Standard pixel format
-		"-threads", "0",             // Use all CPU threads
-		"-f", "mp4",                 // Force MP4 format
-		"-y",                        // Overwrite output file
-		outputPath,
-	)
-	
-	// Shorter timeout for fast processing
-	timeout := 3 * time.Minute
-	if file.Size > 100*1024*1024 { // 100MB
-		timeout = 5 * time.Minute
-		log.Printf("⏱️ Large file detected, extending timeout to 5 minutes")
-	} else if file.Size > 50*1024*1024 { // 50MB
-		timeout = 4 * time.Minute
-		log.Printf("⏱️ Medium file detected, extending timeout to 4 minutes")
-	}
-	
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-	cmd = exec.CommandContext(ctx, cmd.Path, cmd.Args[1:]...)
-	
-	log.Printf("⏱️ Starting fast FFmpeg conversion (timeout: %v)...", timeout)
-	log.Printf("📊 Input file size: %d bytes (%d MB)", file.Size, file.Size/(1024*1024))
-	
-	// Capture FFmpeg output for debugging
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			log.Printf("❌ FFmpeg conversion timed out")
-			return fmt.Errorf("FFmpeg conversion timed out")
-		}
-		log.Printf("❌ FFmpeg error output: %s", string(output))
-		return fmt.Errorf("FFmpeg failed: %v", err)
-	}
-	
-	log.Printf("✅ Fast FFmpeg conversion completed successfully")
-	
-	// Upload converted video to S3
-	key := fmt.Sprintf("media/%s/%s", mediaID, outputFilename)
-	log.Printf("☁️ Uploading converted video to S3: %s", key)
-	
-	// Open converted file and upload
-	convertedFile, err := os.Open(outputPath)
-	if err != nil {
-		log.Printf("❌ Failed to open converted file: %v", err)
-		return err
-	}
-	defer convertedFile.Close()
-	
-	uploadedURL, err := h.s3Service.UploadFileFromReader(convertedFile, outputFilename, "video/mp4", "media/"+mediaID)
-	if err != nil {
-		log.Printf("❌ S3 upload failed: %v", err)
-		return err
-	}
-	
-	log.Printf("✅ Fast video conversion completed: %s", uploadedURL)
-	return nil
-}
-
-// UploadMediaDirect handles file upload to S3 without video optimization
+// UploadMediaDirect handles file upload to storage without video optimization
 func (h *MediaHandler) UploadMediaDirect(c *gin.Context) {
-	log.Println("📤 Starting direct S3 file upload (no optimization)...")
+	log.Println("📤 Starting direct file upload (no optimization)...")
 	
 	// Get uploaded file
 	file, err := c.FormFile("file")
@@ -336,54 +235,60 @@ func (h *MediaHandler) UploadMediaDirect(c *gin.Context) {
 	log.Printf("📁 File received: %s, Size: %d bytes, Type: %s", 
 		file.Filename, file.Size, file.Header.Get("Content-Type"))
 
+	tenant, ok := h.uploadTenant(c)
+	if !ok {
+		return
+	}
+
 	// Validate file size
-	if file.Size > config.AppConfig.MaxFileSize {
-		log.Printf("❌ File too large: %d > %d", file.Size, config.AppConfig.MaxFileSize)
+	maxSize := tenant.SizeLimit(config.AppConfig.MaxFileSize)
+	if file.Size > maxSize {
+		log.Printf("❌ File too large: %d > %d", file.Size, maxSize)
 		c.JSON(http.StatusBadRequest, models.UploadResponse{
 			Success: false,
-			Message: fmt.Sprintf("File size exceeds maximum allowed size of %d bytes", config.AppConfig.MaxFileSize),
+			Message: fmt.Sprintf("File size exceeds maximum allowed size of %d bytes", maxSize),
 		})
 		return
 	}
 
-	// Validate file type
-	contentType := file.Header.Get("Content-Type")
-	mediaType, err := h.validateFileType(contentType, file.Filename)
+	// The declared type is only a hint, the content decides
+	format, err := h.verifyFormFile(c.Request.Context(), file)
 	if err != nil {
-		log.Printf("❌ Invalid file type: %v", err)
-		c.JSON(http.StatusBadRequest, models.UploadResponse{
-			Success: false,
-			Message: err.Error(),
-		})
+		rejectUpload(c, err)
+		return
+	}
+	if err := services.CheckTenantFormat(tenant, format); err != nil {
+		rejectUpload(c, err)
 		return
 	}
+	mediaType, contentType := format.MediaType, format.MimeType
 
-	log.Printf("✅ File validation passed: %s", mediaType)
+	log.Printf("✅ File validation passed: %s (%s)", mediaType, format.Container)
 
 	// Generate unique ID for media
 	mediaID := uuid.New().String()
 	log.Printf("🆔 Generated media ID: %s", mediaID)
 
-	// Check if S3 service is available
-	if h.s3Service == nil {
-		log.Printf("❌ S3 service not available")
+	// Check if storage is available
+	if h.storage == nil {
+		log.Printf("❌ Storage not available")
 		c.JSON(http.StatusServiceUnavailable, models.UploadResponse{
 			Success: false,
-			Message: "S3 service not available",
+			Message: "Storage not available",
 		})
 		return
 	}
 
-	// Upload directly to S3 without any processing
-	key := fmt.Sprintf("media/%s/%s", mediaID, file.Filename)
-	log.Printf("☁️ Uploading directly to S3: %s", key)
+	// Upload directly to storage without any processing
+	key := services.MediaKey(tenant.ID, mediaID, file.Filename)
+	log.Printf("☁️ Uploading directly to storage: %s", key)
 	
-	uploadedURL, err := h.s3Service.UploadFile(file, key)
+	uploadedURL, err := h.uploadFormFile(c.Request.Context(), file, key, contentType)
 	if err != nil {
-		log.Printf("❌ S3 upload failed: %v", err)
+		log.Printf("❌ Storage upload failed: %v", err)
 		c.JSON(http.StatusInternalServerError, models.UploadResponse{
 			Success: false,
-			Message: "Failed to upload file to S3",
+			Message: "Failed to upload file to storage",
 		})
 		return
 	}
@@ -391,16 +296,22 @@ func (h *MediaHandler) UploadMediaDirect(c *gin.Context) {
 	// Create media object
 	media := &models.Media{
 		ID:           mediaID,
+		TenantID:     tenant.ID,
 		Filename:     file.Filename,
 		OriginalName: file.Filename,
 		MediaType:    mediaType,
 		MimeType:     contentType,
 		Size:         file.Size,
 		URL:          uploadedURL,
+		StorageKey:   key,
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
 	
+	if !h.saveMedia(c, media) {
+		return
+	}
+	
 	log.Printf("✅ Direct upload completed successfully: %s", media.URL)
 	
 	c.JSON(http.StatusOK, models.UploadResponse{
@@ -410,7 +321,7 @@ func (h *MediaHandler) UploadMediaDirect(c *gin.Context) {
 	})
 }
 
-// UploadMediaLarge handles large file upload to S3 without any size restrictions
+// UploadMediaLarge handles large file upload to storage without any size restrictions
 func (h *MediaHandler) UploadMediaLarge(c *gin.Context) {
 	log.Println("📤 Starting large file upload (no size limit)...")
 	
@@ -428,44 +339,58 @@ func (h *MediaHandler) UploadMediaLarge(c *gin.Context) {
 	log.Printf("📁 Large file received: %s, Size: %d bytes (%d MB), Type: %s", 
 		file.Filename, file.Size, file.Size/(1024*1024), file.Header.Get("Content-Type"))
 
-	// Validate file type (skip size validation for large files)
-	contentType := file.Header.Get("Content-Type")
-	mediaType, err := h.validateFileType(contentType, file.Filename)
-	if err != nil {
-		log.Printf("❌ Invalid file type: %v", err)
+	// Only the limit of the tenant applies to large files
+	tenant, ok := h.uploadTenant(c)
+	if !ok {
+		return
+	}
+	if tenant.MaxFileSize > 0 && file.Size > tenant.MaxFileSize {
+		log.Printf("❌ File too large for tenant %s: %d > %d", tenant.ID, file.Size, tenant.MaxFileSize)
 		c.JSON(http.StatusBadRequest, models.UploadResponse{
 			Success: false,
-			Message: err.Error(),
+			Message: fmt.Sprintf("File size exceeds maximum allowed size of %d bytes", tenant.MaxFileSize),
 		})
 		return
 	}
 
-	log.Printf("✅ Large file validation passed: %s", mediaType)
+	// The declared type is only a hint, the content decides
+	format, err := h.verifyFormFile(c.Request.Context(), file)
+	if err != nil {
+		rejectUpload(c, err)
+		return
+	}
+	if err := services.CheckTenantFormat(tenant, format); err != nil {
+		rejectUpload(c, err)
+		return
+	}
+	mediaType, contentType := format.MediaType, format.MimeType
+
+	log.Printf("✅ Large file validation passed: %s (%s)", mediaType, format.Container)
 
 	// Generate unique ID for media
 	mediaID := uuid.New().String()
 	log.Printf("🆔 Generated media ID: %s", mediaID)
 
-	// Check if S3 service is available
-	if h.s3Service == nil {
-		log.Printf("❌ S3 service not available")
+	// Check if storage is available
+	if h.storage == nil {
+		log.Printf("❌ Storage not available")
 		c.JSON(http.StatusServiceUnavailable, models.UploadResponse{
 			Success: false,
-			Message: "S3 service not available",
+			Message: "Storage not available",
 		})
 		return
 	}
 
-	// Upload directly to S3 without any processing
-	key := fmt.Sprintf("media/%s/%s", mediaID, file.Filename)
-	log.Printf("☁️ Uploading large file to S3: %s", key)
+	// Upload directly to storage without any processing
+	key := services.MediaKey(tenant.ID, mediaID, file.Filename)
+	log.Printf("☁️ Uploading large file to storage: %s", key)
 	
-	uploadedURL, err := h.s3Service.UploadFile(file, key)
+	uploadedURL, err := h.uploadFormFile(c.Request.Context(), file, key, contentType)
 	if err != nil {
-		log.Printf("❌ S3 upload failed: %v", err)
+		log.Printf("❌ Storage upload failed: %v", err)
 		c.JSON(http.StatusInternalServerError, models.UploadResponse{
 			Success: false,
-			Message: "Failed to upload large file to S3",
+			Message: "Failed to upload large file to storage",
 		})
 		return
 	}
@@ -473,16 +398,22 @@ func (h *MediaHandler) UploadMediaLarge(c *gin.Context) {
 	// Create media object
 	media := &models.Media{
 		ID:           mediaID,
+		TenantID:     tenant.ID,
 		Filename:     file.Filename,
 		OriginalName: file.Filename,
 		MediaType:    mediaType,
 		MimeType:     contentType,
 		Size:         file.Size,
 		URL:          uploadedURL,
+		StorageKey:   key,
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
 	
+	if !h.saveMedia(c, media) {
+		return
+	}
+	
 	log.Printf("✅ Large file upload completed successfully: %s", media.URL)
 	
 	c.JSON(http.StatusOK, models.UploadResponse{
@@ -492,310 +423,477 @@ func (h *MediaHandler) UploadMediaLarge(c *gin.Context) {
 	})
 }
 
-// GetProcessingProgress returns the progress of video processing
-func (h *MediaHandler) GetProcessingProgress(c *gin.Context) {
-	mediaID := c.Param("id")
-	log.Printf("📊 Getting processing progress for: %s", mediaID)
-	
-	// List objects in the media directory to find any processed video
-	objects, err := h.s3Service.ListObjects("media/" + mediaID)
-	if err != nil {
-		log.Printf("❌ Error listing objects: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"message": "Error checking processing status",
+// UploadMediaStream stores the request body in storage while it is being
+// received, without buffering the upload on the server first. The body is
+// either the raw file, named by the filename query parameter, or a
+// multipart form whose "file" part is streamed.
+func (h *MediaHandler) UploadMediaStream(c *gin.Context) {
+	log.Println("📤 Starting streaming upload...")
+
+	// Check if storage is available
+	if h.storage == nil {
+		log.Printf("❌ Storage not available")
+		c.JSON(http.StatusServiceUnavailable, models.UploadResponse{
+			Success: false,
+			Message: "Storage not available",
 		})
 		return
 	}
-	
-	// Check if any MP4 file exists (processed video)
-	var hasProcessedVideo bool
-	for _, objKey := range objects {
-		if strings.HasSuffix(objKey, ".mp4") {
-			hasProcessedVideo = true
-			log.Printf("✅ Found processed video: %s", objKey)
-			break
-		}
-	}
-	
-	if hasProcessedVideo {
-		// Processing completed
-		c.JSON(http.StatusOK, gin.H{
-			"success": true,
-			"media_id": mediaID,
-			"status": "completed",
-			"progress": 100,
-			"message": "Video processing completed successfully!",
-		})
-	} else {
-		// Check if there are any temp files (processing in progress)
-		var hasTempFiles bool
-		for _, objKey := range objects {
-			if strings.Contains(objKey, ".tmp") || strings.Contains(objKey, "temp") {
-				hasTempFiles = true
-				break
-			}
-		}
-		
-		// Calculate progress based on time elapsed (rough estimate)
-		// For large files like 198MB, processing can take 5-15 minutes
-		progress := 25 // Start at 25% for large files
-		message := "Video is being processed with FFmpeg..."
-		
-		if hasTempFiles {
-			progress = 50
-			message = "FFmpeg is actively processing your video..."
-		}
-		
-		// Still processing
-		c.JSON(http.StatusOK, gin.H{
-			"success": true,
-			"media_id": mediaID,
-			"status": "processing",
-			"progress": progress,
-			"message": message,
-		})
-	}
-}
 
-// GetMediaInfo returns information about a specific media file
-func (h *MediaHandler) GetMediaInfo(c *gin.Context) {
-	mediaID := c.Param("id")
-	log.Printf("📋 Getting media info for: %s", mediaID)
-	
-	// List objects in the media directory to find the file
-	objects, err := h.s3Service.ListObjects("media/" + mediaID)
-	if err != nil {
-		log.Printf("❌ Error listing objects: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"message": "Error retrieving media info",
-		})
-		return
+	// Streams can outlast the server wide read timeout
+	if err := http.NewResponseController(c.Writer).SetReadDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("⚠️ Could not lift read deadline: %v", err)
 	}
-	
-	if len(objects) == 0 {
-		c.JSON(http.StatusNotFound, gin.H{
-			"success": false,
-			"message": "Media not found",
-		})
+	tenant, ok := h.uploadTenant(c)
+	if !ok {
 		return
 	}
-	
-	// Find the processed video file
-	var mediaURL string
-	var filename string
-	var mimeType string
-	
-	// First try to find any MP4 file (processed video)
-	for _, objKey := range objects {
-		if strings.HasSuffix(objKey, ".mp4") {
-			// This is the processed video
-			url, err := h.s3Service.GeneratePresignedURL(objKey, 24*time.Hour)
-			if err != nil {
-				log.Printf("❌ Error generating presigned URL: %v", err)
-				continue
-			}
-			mediaURL = url
-			filename = filepath.Base(objKey)
-			mimeType = "video/mp4"
-			log.Printf("✅ Found processed video: %s", objKey)
-			break
-		}
-	}
-	
-	// If no MP4 found, try any other video file
-	if mediaURL == "" {
-		for _, objKey := range objects {
-			if strings.Contains(objKey, ".mp4") || strings.Contains(objKey, ".mov") || 
-			   strings.Contains(objKey, ".avi") || strings.Contains(objKey, ".mkv") {
-				url, err := h.s3Service.GeneratePresignedURL(objKey, 24*time.Hour)
-				if err != nil {
-					log.Printf("❌ Error generating presigned URL: %v", err)
-					continue
-				}
-				mediaURL = url
-				filename = filepath.Base(objKey)
-				mimeType = "video/mp4" // Default to video
-				log.Printf("✅ Found video file: %s", objKey)
-				break
-			}
-		}
-	}
-	
-	media := &models.Media{
-		ID:           mediaID,
-		Filename:     filename,
-		OriginalName: filename,
-		MediaType:    models.MediaTypeVideo,
-		MimeType:     mimeType,
-		Size:         0, // We don't have size info from listing
-		URL:          mediaURL,
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
-	}
-	
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "Media info retrieved successfully",
-		"media":   media,
-	})
-}
+	maxSize := tenant.SizeLimit(config.AppConfig.StreamMaxSize)
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize)
 
-// UploadMediaLocal handles file upload to local storage (for testing without S3)
-func (h *MediaHandler) UploadMediaLocal(c *gin.Context) {
-	log.Println("📤 Starting local file upload...")
-	
-	// Get uploaded file
-	file, err := c.FormFile("file")
+	reader, filename, declared, err := streamSource(c)
 	if err != nil {
-		log.Printf("❌ No file uploaded: %v", err)
+		log.Printf("❌ Invalid streaming upload: %v", err)
 		c.JSON(http.StatusBadRequest, models.UploadResponse{
 			Success: false,
-			Message: "No file uploaded",
+			Message: err.Error(),
 		})
 		return
 	}
 
-	log.Printf("📁 File received: %s, Size: %d bytes, Type: %s", 
-		file.Filename, file.Size, file.Header.Get("Content-Type"))
+	log.Printf("📁 Streaming upload received: %s, declared type: %s", filename, declared)
 
-	// Validate file size
-	if file.Size > config.AppConfig.MaxFileSize {
-		log.Printf("❌ File too large: %d > %d", file.Size, config.AppConfig.MaxFileSize)
-		c.JSON(http.StatusBadRequest, models.UploadResponse{
+	// The declared type is only a hint, the content decides. Only the start
+	// of the stream can be checked before it is stored; videos are copied to
+	// the spool on the way and confirmed by FFprobe before they are accepted
+	buffered := bufio.NewReaderSize(reader, services.SniffSize)
+	head, err := buffered.Peek(services.SniffSize)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		log.Printf("❌ Streaming upload too large: %v", err)
+		c.JSON(http.StatusRequestEntityTooLarge, models.UploadResponse{
 			Success: false,
-			Message: fmt.Sprintf("File size exceeds maximum allowed size of %d bytes", config.AppConfig.MaxFileSize),
+			Message: fmt.Sprintf("File size exceeds maximum allowed size of %d bytes", maxSize),
 		})
 		return
 	}
-
-	// Validate file type
-	contentType := file.Header.Get("Content-Type")
-	mediaType, err := h.validateFileType(contentType, file.Filename)
-	if err != nil {
-		log.Printf("❌ Invalid file type: %v", err)
+	if err != nil && err != io.EOF {
+		log.Printf("❌ Failed to read streaming upload: %v", err)
 		c.JSON(http.StatusBadRequest, models.UploadResponse{
 			Success: false,
-			Message: err.Error(),
+			Message: "Failed to read upload",
 		})
 		return
 	}
-
-	log.Printf("✅ File validation passed: %s", mediaType)
+	format, err := services.CheckContent(head)
+	if err == nil {
+		err = services.CheckTenantFormat(tenant, format)
+	}
+	if err != nil {
+		rejectUpload(c, err)
+		return
+	}
+	reader = buffered
+	mediaType, contentType := format.MediaType, format.MimeType
 
 	// Generate unique ID for media
 	mediaID := uuid.New().String()
-	log.Printf("🆔 Generated media ID: %s", mediaID)
+	key := services.MediaKey(tenant.ID, mediaID, filename)
+	log.Printf("☁️ Streaming %s to storage: %s", filename, key)
 
-	// Create uploads directory
-	uploadDir := "uploads"
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		log.Printf("❌ Failed to create uploads directory: %v", err)
-		c.JSON(http.StatusInternalServerError, models.UploadResponse{
-			Success: false,
-			Message: "Failed to create uploads directory",
-		})
-		return
+	var spool *os.File
+	if mediaType == models.MediaTypeVideo {
+		if spool, err = services.CreateSpoolFile(mediaID, filename); err != nil {
+			log.Printf("❌ Failed to spool upload: %v", err)
+			c.JSON(http.StatusInternalServerError, models.UploadResponse{
+				Success: false,
+				Message: "Failed to store upload for processing",
+			})
+			return
+		}
+		reader = io.TeeReader(reader, spool)
 	}
 
-	// Save file locally
-	filename := fmt.Sprintf("%s_%s", mediaID, file.Filename)
-	filePath := filepath.Join(uploadDir, filename)
-	
-	log.Printf("💾 Saving file to: %s", filePath)
-	if err := c.SaveUploadedFile(file, filePath); err != nil {
-		log.Printf("❌ Failed to save file: %v", err)
-		c.JSON(http.StatusInternalServerError, models.UploadResponse{
-			Success: false,
-			Message: "Failed to save uploaded file",
-		})
-		return
+	started := time.Now()
+	size, err := services.PutStream(c.Request.Context(), h.storage, key, reader, contentType, func(part services.PartProgress) {
+		log.Printf("📦 Part %d stored (%d MB), %d MB uploaded", part.PartNumber, part.PartSize/(1024*1024), part.BytesUploaded/(1024*1024))
+	})
+	if spool != nil {
+		if closeErr := spool.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("failed to close spool file: %w", closeErr)
+		}
 	}
-
-	// Verify file was saved
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		log.Printf("❌ File not found after save: %s", filePath)
-		c.JSON(http.StatusInternalServerError, models.UploadResponse{
-			Success: false,
-			Message: "File was not saved properly",
-		})
+	if err != nil {
+		services.RemoveSpool(mediaID)
+		switch {
+		case errors.As(err, &tooLarge):
+			log.Printf("❌ Streaming upload too large: %v", err)
+			c.JSON(http.StatusRequestEntityTooLarge, models.UploadResponse{
+				Success: false,
+				Message: fmt.Sprintf("File size exceeds maximum allowed size of %d bytes", maxSize),
+			})
+		case c.Request.Context().Err() != nil:
+			log.Printf("⚠️ Client disconnected during streaming upload of %s, upload aborted", key)
+		default:
+			log.Printf("❌ Streaming upload failed: %v", err)
+			c.JSON(http.StatusInternalServerError, models.UploadResponse{
+				Success: false,
+				Message: "Failed to upload file to storage",
+			})
+		}
 		return
 	}
+	log.Printf("✅ Streamed %d bytes in %v", size, time.Since(started).Round(time.Millisecond))
 
-	log.Printf("✅ File saved successfully: %s", filePath)
+	inputPath := ""
+	if spool != nil {
+		if _, err := services.VerifyFile(c.Request.Context(), config.AppConfig.FFprobePath, spool.Name()); err != nil {
+			services.RemoveSpool(mediaID)
+			if err := h.storage.Delete(c.Request.Context(), key); err != nil {
+				log.Printf("⚠️ Failed to delete rejected upload %s: %v", key, err)
+			}
+			rejectUpload(c, err)
+			return
+		}
+		inputPath = spool.Name()
+	}
 
-	// Create media object
 	media := &models.Media{
 		ID:           mediaID,
+		TenantID:     tenant.ID,
 		Filename:     filename,
-		OriginalName: file.Filename,
+		OriginalName: filename,
 		MediaType:    mediaType,
 		MimeType:     contentType,
-		Size:         file.Size,
-		URL:          fmt.Sprintf("/uploads/%s", filename),
+		Size:         size,
+		URL:          h.storage.URL(key),
+		StorageKey:   key,
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
+	if !h.saveMedia(c, media) {
+		services.RemoveSpool(mediaID)
+		return
+	}
 
-	log.Printf("✅ Upload completed successfully: %s", media.URL)
-
-	c.JSON(http.StatusOK, models.UploadResponse{
-		Success: true,
-		Message: "File uploaded successfully (local mode)",
-		Media:   media,
-	})
-}
-
-// DeleteMedia handles media deletion
-func (h *MediaHandler) DeleteMedia(c *gin.Context) {
-	mediaID := c.Param("id")
-	log.Printf("🗑️ Deleting media: %s", mediaID)
-
-	if h.s3Service != nil {
-		// Delete from S3
-		if err := h.s3Service.DeleteFile(mediaID); err != nil {
-			log.Printf("❌ Failed to delete from S3: %v", err)
-			c.JSON(http.StatusInternalServerError, models.DeleteResponse{
-				Success: false,
-				Message: "Failed to delete file from S3",
-			})
-			return
-		}
-	} else {
-		// Delete from local storage
-		filePath := filepath.Join("uploads", mediaID)
-		if err := os.Remove(filePath); err != nil {
-			log.Printf("❌ Failed to delete local file: %v", err)
-			c.JSON(http.StatusInternalServerError, models.DeleteResponse{
+	// Images were not spooled, so the processor downloads the stored original
+	if processingEnabled(mediaType) {
+		if _, err := h.queue.Enqueue(mediaID, inputPath); err != nil {
+			log.Printf("❌ Failed to create processing job: %v", err)
+			services.RemoveSpool(mediaID)
+			c.JSON(http.StatusInternalServerError, models.UploadResponse{
 				Success: false,
-				Message: "Failed to delete local file",
+				Message: "File stored but failed to create processing job",
+				Media:   media,
 			})
 			return
 		}
+		c.JSON(http.StatusAccepted, models.UploadResponse{
+			Success: true,
+			Message: processingMessage(mediaType, mediaID),
+			Media:   media,
+		})
+		return
 	}
+	services.RemoveSpool(mediaID)
 
-	log.Printf("✅ Media deleted successfully: %s", mediaID)
-	c.JSON(http.StatusOK, models.DeleteResponse{
+	c.JSON(http.StatusOK, models.UploadResponse{
 		Success: true,
-		Message: "Media deleted successfully",
+		Message: "File uploaded successfully",
+		Media:   media,
 	})
 }
 
-// GetVideoStream returns video streaming information
-func (h *MediaHandler) GetVideoStream(c *gin.Context) {
+// GetProcessingProgress returns the progress of video processing
+func (h *MediaHandler) GetProcessingProgress(c *gin.Context) {
 	mediaID := c.Param("id")
-	log.Printf("🎥 Getting video stream info: %s", mediaID)
-
-	if h.videoService == nil {
-		c.JSON(http.StatusServiceUnavailable, models.VideoStreamResponse{
-			Success: false,
-			Message: "Video service not available",
+	log.Printf("📊 Getting processing progress for: %s", mediaID)
+	
+	media, ok := h.findMedia(c, mediaID)
+	if !ok {
+		return
+	}
+	
+	job, err := h.repo.GetLatestJob(mediaID)
+	if errors.Is(err, repository.ErrNotFound) {
+		// Uploaded without background processing
+		c.JSON(http.StatusOK, gin.H{
+			"success":  true,
+			"media_id": media.ID,
+			"status":   models.JobStatusCompleted,
+			"progress": 100,
+			"message":  "Media is ready",
 		})
 		return
 	}
-
-	variants, err := h.videoService.GetVideoVariants(mediaID)
+	if err != nil {
+		log.Printf("❌ Error loading processing job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Error checking processing status",
+		})
+		return
+	}
+	
+	message := "Video is being processed with FFmpeg..."
+	switch job.Status {
+	case models.JobStatusPending:
+		message = "Video is queued for processing"
+	case models.JobStatusCompleted:
+		message = "Video processing completed successfully!"
+	case models.JobStatusFailed:
+		message = "Video processing failed"
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"success":           true,
+		"media_id":          media.ID,
+		"job_id":            job.ID,
+		"status":            job.Status,
+		"progress":          job.Progress,
+		"stage":             job.Stage,
+		"eta_seconds":       job.ETASeconds,
+		"attempts":          job.Attempts,
+		"max_attempts":      job.MaxAttempts,
+		"processing_mode":   job.ProcessingMode,
+		"processing_reason": job.ProcessingReason,
+		"error":             job.Error,
+		"message":           message,
+	})
+}
+
+// StreamEvents pushes the state transitions of a media item and its
+// processing job to the client as Server-Sent Events. The current state is
+// sent first so clients never miss a transition that happened before they
+// connected.
+func (h *MediaHandler) StreamEvents(c *gin.Context) {
+	mediaID := c.Param("id")
+	log.Printf("📡 Streaming events for: %s", mediaID)
+	
+	if h.events == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"success": false,
+			"message": "Event stream not available",
+		})
+		return
+	}
+	
+	media, ok := h.findMedia(c, mediaID)
+	if !ok {
+		return
+	}
+	
+	// Subscribe before reading the current state so nothing falls in between
+	events, unsubscribe := h.events.Subscribe(mediaID)
+	defer unsubscribe()
+	
+	snapshot := models.MediaEvent{
+		Type:      models.EventMediaUploaded,
+		MediaID:   mediaID,
+		Media:     media,
+		Timestamp: time.Now(),
+	}
+	job, err := h.repo.GetLatestJob(mediaID)
+	if err == nil {
+		snapshot.Job = job
+		snapshot.Type = jobEventType(job.Status)
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		log.Printf("⚠️ Failed to load processing job: %v", err)
+	}
+	
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Disable proxy buffering (nginx)
+	c.Status(http.StatusOK)
+	
+	c.SSEvent(snapshot.Type, snapshot)
+	c.Writer.Flush()
+	
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+	
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			log.Printf("📡 Event stream closed for: %s", mediaID)
+			return
+		case event := <-events:
+			c.SSEvent(event.Type, event)
+			c.Writer.Flush()
+		case <-keepAlive.C:
+			// Comment line keeps idle connections from being closed by proxies
+			c.Writer.WriteString(": keep-alive\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
+
+// GetMediaInfo returns information about a specific media file
+func (h *MediaHandler) GetMediaInfo(c *gin.Context) {
+	mediaID := c.Param("id")
+	log.Printf("📋 Getting media info for: %s", mediaID)
+	
+	media, ok := h.findMedia(c, mediaID)
+	if !ok {
+		return
+	}
+	
+	// Hand out temporary URLs so private buckets can be read directly. With
+	// signed playback videos are only played through playback tokens.
+	if signedPlayback(media) {
+		hideAssetURLs(media)
+	} else {
+		h.presignAssetURLs(c.Request.Context(), media)
+	}
+	
+	response := gin.H{
+		"success": true,
+		"message": "Media info retrieved successfully",
+		"media":   media,
+	}
+	if media.MediaType == models.MediaTypeImage {
+		variants, err := h.repo.GetImageVariants(mediaID)
+		if err != nil {
+			log.Printf("❌ Error getting image variants: %v", err)
+		} else {
+			for i := range variants {
+				variants[i].URL = h.presignURL(c.Request.Context(), variants[i].StorageKey, variants[i].URL)
+			}
+			response["variants"] = variants
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// presignAssetURLs replaces the URLs of the original, the thumbnails and the
+// preview of a media item with temporary ones, which work without credentials
+// for private buckets and the local /uploads route alike
+func (h *MediaHandler) presignAssetURLs(ctx context.Context, media *models.Media) {
+	media.URL = h.presignURL(ctx, media.StorageKey, media.URL)
+	for i := range media.Thumbnails {
+		media.Thumbnails[i].URL = h.presignURL(ctx, media.Thumbnails[i].StorageKey, media.Thumbnails[i].URL)
+	}
+	if thumbnail := services.SelectThumbnail(media.Thumbnails, services.DefaultThumbnailSize); thumbnail != nil {
+		media.ThumbnailURL = thumbnail.URL
+	}
+	if media.Preview != nil {
+		media.Preview.URL = h.presignURL(ctx, media.Preview.StorageKey, media.Preview.URL)
+	}
+}
+
+// presignURL returns a temporary URL of key valid for a day, or fallback
+// when there is no key or signing fails
+func (h *MediaHandler) presignURL(ctx context.Context, key, fallback string) string {
+	if key == "" {
+		return fallback
+	}
+	url, err := h.storage.PresignGet(ctx, key, 24*time.Hour)
+	if err != nil {
+		log.Printf("❌ Error generating presigned URL: %v", err)
+		return fallback
+	}
+	return url
+}
+
+// ListMedia returns stored media, newest first
+func (h *MediaHandler) ListMedia(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	
+	list, err := h.repo.ListMedia(callerTenant(c.Request.Context()), limit, offset)
+	if err != nil {
+		log.Printf("❌ Error listing media: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Error listing media",
+		})
+		return
+	}
+	for i := range list {
+		if signedPlayback(&list[i]) {
+			hideAssetURLs(&list[i])
+		} else {
+			h.presignAssetURLs(c.Request.Context(), &list[i])
+		}
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Media listed successfully",
+		"media":   list,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+// UploadMediaLocal is kept for backwards compatibility. Uploads always go to
+// the configured storage, which is the local filesystem when S3 is not set up.
+func (h *MediaHandler) UploadMediaLocal(c *gin.Context) {
+	log.Println("📤 /upload-local is deprecated, using the configured storage")
+	h.UploadMedia(c)
+}
+
+// DeleteMedia handles media deletion
+func (h *MediaHandler) DeleteMedia(c *gin.Context) {
+	mediaID := c.Param("id")
+	log.Printf("🗑️ Deleting media: %s", mediaID)
+
+	media, ok := h.findMedia(c, mediaID)
+	if !ok {
+		return
+	}
+
+	// Delete the original and every derived asset (variants, HLS, DASH)
+	deleted, err := services.DeletePrefix(c.Request.Context(), h.storage, services.MediaPrefix(media.TenantID, mediaID))
+	if err != nil {
+		log.Printf("❌ Failed to delete from storage: %v", err)
+		c.JSON(http.StatusInternalServerError, models.DeleteResponse{
+			Success: false,
+			Message: "Failed to delete media from storage",
+		})
+		return
+	}
+
+	// Drop an upload that is still waiting to be processed; its job goes with the record
+	if err := services.RemoveSpool(mediaID); err != nil {
+		log.Printf("⚠️ Failed to remove spooled upload: %v", err)
+	}
+
+	if err := h.repo.DeleteMedia(mediaID); err != nil && !errors.Is(err, repository.ErrNotFound) {
+		log.Printf("❌ Failed to delete media record: %v", err)
+		c.JSON(http.StatusInternalServerError, models.DeleteResponse{
+			Success: false,
+			Message: "Failed to delete media record",
+		})
+		return
+	}
+
+	h.events.Publish(models.EventMediaDeleted, mediaID, nil, nil)
+	log.Printf("✅ Media deleted successfully: %s (%d objects)", mediaID, deleted)
+	c.JSON(http.StatusOK, models.DeleteResponse{
+		Success: true,
+		Message: "Media deleted successfully",
+	})
+}
+
+// GetVideoStream returns video streaming information
+func (h *MediaHandler) GetVideoStream(c *gin.Context) {
+	mediaID := c.Param("id")
+	log.Printf("🎥 Getting video stream info: %s", mediaID)
+
+	media, ok := h.findMedia(c, mediaID)
+	if !ok {
+		return
+	}
+
+	variants, err := h.repo.GetVariants(mediaID)
 	if err != nil {
 		log.Printf("❌ Failed to get video variants: %v", err)
 		c.JSON(http.StatusInternalServerError, models.VideoStreamResponse{
@@ -805,172 +903,601 @@ func (h *MediaHandler) GetVideoStream(c *gin.Context) {
 		return
 	}
 
+	if signedPlayback(media) {
+		hideAssetURLs(media)
+		for i := range variants {
+			variants[i].URL = ""
+		}
+	}
+
 	c.JSON(http.StatusOK, models.VideoStreamResponse{
-		Success:  true,
-		Message:  "Video streaming information retrieved",
-		Variants: variants,
+		Success:   true,
+		Message:   "Video streaming information retrieved",
+		Variants:  variants,
+		MasterURL: media.MasterURL,
+		DashURL:   media.DashURL,
+		Trickplay: media.Trickplay,
 	})
 }
 
-// StreamVideo streams video at specific quality
+// StreamVideo streams a progressive version of a video in the requested
+// quality: the matching MP4 variant, the closest one when that quality was
+// not produced, or the uploaded file when there are no variants yet. The
+// quality served is reported in X-Video-Quality.
 func (h *MediaHandler) StreamVideo(c *gin.Context) {
 	mediaID := c.Param("id")
-	log.Printf("🎬 Streaming best quality video: %s", mediaID)
+	requested := c.Param("quality")
+	if requested == "" {
+		requested = string(models.QualityAuto)
+	}
+	log.Printf("🎬 Streaming video %s in %s", mediaID, requested)
 
-	if h.s3Service == nil {
-		log.Printf("❌ S3 service not available")
-		c.JSON(http.StatusServiceUnavailable, gin.H{
+	quality, height, err := services.ParseVideoQuality(requested)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"message": "S3 service not available",
+			"message": err.Error(),
 		})
 		return
 	}
 
-	// Try to find the best quality video
-	bestQualityKey := fmt.Sprintf("videos/best_quality/%s_best_quality.mp4", mediaID)
-	log.Printf("🔍 Looking for best quality video: %s", bestQualityKey)
-	
-	if exists, _ := h.s3Service.FileExists(bestQualityKey); exists {
-		log.Printf("✅ Found best quality video: %s", bestQualityKey)
-		if err := h.s3Service.StreamFile(c.Writer, c.Request, bestQualityKey); err != nil {
-			// Handle broken pipe errors gracefully
-			if strings.Contains(err.Error(), "broken pipe") || 
-			   strings.Contains(err.Error(), "connection reset") ||
-			   strings.Contains(err.Error(), "write: broken pipe") {
-				log.Printf("📺 Client disconnected during streaming (normal): %v", err)
-				return
-			}
-			
-			log.Printf("❌ Failed to stream video: %v", err)
-			if !c.Writer.Written() {
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"success": false,
-					"message": "Failed to stream video",
-				})
+	media, ok := h.findMedia(c, mediaID)
+	if !ok {
+		return
+	}
+	if media.MediaType != models.MediaTypeVideo {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Video not found",
+		})
+		return
+	}
+
+	h.streamVideo(c, media, requested, quality, height, nil)
+}
+
+// streamVideo streams the variant of media closest to quality. With playback
+// claims only the renditions they allow are considered, and the uploaded
+// original is never served in their place when they are restricted.
+func (h *MediaHandler) streamVideo(c *gin.Context, media *models.Media, requested string, quality models.VideoQuality, height int, claims *models.PlaybackClaims) {
+	mediaID := media.ID
+	key, served := media.StorageKey, "original"
+	variants, err := h.repo.GetVariants(mediaID)
+	if err != nil {
+		log.Printf("⚠️ Failed to load variants: %v", err)
+	}
+	if claims != nil && len(claims.Renditions) > 0 {
+		var allowed []models.VideoVariant
+		for _, variant := range variants {
+			if claims.AllowsRendition(variant.Quality) {
+				allowed = append(allowed, variant)
 			}
+		}
+		variants, key = allowed, ""
+	}
+	if variant := services.SelectVariant(variants, quality, height); variant != nil {
+		key, served = variant.StorageKey, string(variant.Quality)
+	}
+
+	if key == "" && claims != nil && len(claims.Renditions) > 0 {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "No rendition allowed by the playback token is available",
+		})
+		return
+	}
+	if key == "" {
+		log.Printf("❌ Video not found for: %s", mediaID)
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Video not found",
+		})
+		return
+	}
+	if served != requested {
+		log.Printf("📺 %s not available for %s, serving %s", requested, mediaID, served)
+	}
+	c.Header("X-Video-Quality", served)
+
+	if err := services.StreamObject(c.Writer, c.Request, h.storage, key, cacheScope(c.Request.Context())); err != nil {
+		// Handle broken pipe errors gracefully
+		if services.IsClientDisconnect(err) {
+			log.Printf("📺 Client disconnected during streaming (normal): %v", err)
 			return
 		}
-		log.Printf("✅ Video streamed successfully: %s", bestQualityKey)
+
+		if errors.Is(err, services.ErrObjectNotFound) {
+			log.Printf("❌ Video file missing from storage: %s", key)
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "Video not found",
+			})
+			return
+		}
+
+		log.Printf("❌ Failed to stream video: %v", err)
+		if !c.Writer.Written() {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to stream video",
+			})
+		}
 		return
 	}
-	
-	// Fallback to converted video
-	convertedKey := fmt.Sprintf("media/%s/%s_converted.mp4", mediaID, mediaID)
-	log.Printf("🔍 Looking for converted video: %s", convertedKey)
-	
-	if exists, _ := h.s3Service.FileExists(convertedKey); exists {
-		log.Printf("✅ Found converted video: %s", convertedKey)
-		if err := h.s3Service.StreamFile(c.Writer, c.Request, convertedKey); err != nil {
-			// Handle broken pipe errors gracefully
-			if strings.Contains(err.Error(), "broken pipe") || 
-			   strings.Contains(err.Error(), "connection reset") ||
-			   strings.Contains(err.Error(), "write: broken pipe") {
-				log.Printf("📺 Client disconnected during streaming (normal): %v", err)
-				return
-			}
-			
-			log.Printf("❌ Failed to stream video: %v", err)
-			if !c.Writer.Written() {
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"success": false,
-					"message": "Failed to stream video",
-				})
-			}
+	log.Printf("✅ Video streamed successfully: %s", key)
+}
+
+// presignedContextKey marks a request authorized by a presigned /uploads URL
+type presignedContextKey struct{}
+
+// AllowPresigned lets requests for local storage files that carry a valid
+// presigned signature through without credentials, and hands every other
+// request to auth. Expired or forged signatures are refused.
+func (h *MediaHandler) AllowPresigned(auth gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		local, ok := h.storage.(*services.LocalStorage)
+		if !ok || c.Query("signature") == "" {
+			auth(c)
+			return
+		}
+
+		if !local.VerifyPresigned(storedFileKey(c), c.Request.URL.Query()) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": "Invalid or expired URL signature",
+			})
 			return
 		}
-		log.Printf("✅ Video streamed successfully: %s", convertedKey)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), presignedContextKey{}, true))
+		c.Next()
+	}
+}
+
+// storedFileKey returns the storage key of an /uploads request
+func storedFileKey(c *gin.Context) string {
+	return strings.TrimPrefix(path.Clean("/"+c.Param("path")), "/")
+}
+
+// ServeStoredFile serves a file of the local storage backend under the
+// /uploads URLs it hands out. Files are only served to callers who may read
+// the media item they belong to, or with a presigned URL.
+func (h *MediaHandler) ServeStoredFile(c *gin.Context) {
+	key := storedFileKey(c)
+	mediaID, ok := services.MediaIDOfKey(key)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "File not found",
+		})
 		return
 	}
-	
-	// Try to find original video file
-	originalKey := fmt.Sprintf("media/%s/", mediaID)
-	log.Printf("🔍 Looking for original video in: %s", originalKey)
-	
-	// List objects in the media directory
-	objects, err := h.s3Service.ListObjects(originalKey)
-	if err != nil {
-		log.Printf("❌ Failed to list objects: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
+
+	media, ok := h.findMedia(c, mediaID)
+	if !ok {
+		return
+	}
+	if !strings.HasPrefix(key, services.MediaPrefix(media.TenantID, media.ID)) {
+		c.JSON(http.StatusNotFound, gin.H{
 			"success": false,
-			"message": "Failed to find video file",
+			"message": "File not found",
 		})
 		return
 	}
-	
-	// Look for any video file
-	for _, obj := range objects {
-		if strings.HasSuffix(strings.ToLower(obj), ".mp4") {
-			log.Printf("✅ Found original video: %s", obj)
-			if err := h.s3Service.StreamFile(c.Writer, c.Request, obj); err != nil {
-				// Handle broken pipe errors gracefully
-				if strings.Contains(err.Error(), "broken pipe") || 
-				   strings.Contains(err.Error(), "connection reset") ||
-				   strings.Contains(err.Error(), "write: broken pipe") {
-					log.Printf("📺 Client disconnected during streaming (normal): %v", err)
-					return
-				}
-				
-				log.Printf("❌ Failed to stream video: %v", err)
-				if !c.Writer.Written() {
-					c.JSON(http.StatusInternalServerError, gin.H{
-						"success": false,
-						"message": "Failed to stream video",
-					})
-				}
-				return
-			}
-			log.Printf("✅ Original video streamed successfully: %s", obj)
+
+	if err := services.StreamObject(c.Writer, c.Request, h.storage, key, cacheScope(c.Request.Context())); err != nil {
+		if services.IsClientDisconnect(err) {
+			log.Printf("📺 Client disconnected during streaming (normal): %v", err)
+			return
+		}
+		if errors.Is(err, services.ErrObjectNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "File not found",
+			})
 			return
 		}
+
+		log.Printf("❌ Failed to serve %s: %v", key, err)
+		if !c.Writer.Written() {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "Failed to serve file",
+			})
+		}
 	}
-	
-	// Video not found
-	log.Printf("❌ Video not found for: %s", mediaID)
-	c.JSON(http.StatusNotFound, gin.H{
-		"success": false,
-		"message": "Video not found",
-	})
 }
 
-// GetThumbnail returns video thumbnail
+// GetThumbnail redirects to a temporary URL of a video poster. The size is
+// chosen with ?size=small|medium|large (default medium); when that size was
+// not generated the closest one is served.
 func (h *MediaHandler) GetThumbnail(c *gin.Context) {
 	mediaID := c.Param("id")
 	log.Printf("🖼️ Getting thumbnail: %s", mediaID)
 
-	if h.videoService == nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
+	size := models.ThumbnailSize(strings.ToLower(c.DefaultQuery("size", string(services.DefaultThumbnailSize))))
+	if _, ok := services.ThumbnailSizes[size]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"message": "Video service not available",
+			"message": fmt.Sprintf("Invalid thumbnail size: %s", size),
 		})
 		return
 	}
 
-	// This would typically serve the thumbnail image
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "Thumbnail retrieved",
-		"url":     fmt.Sprintf("/media/%s/thumbnail", mediaID),
-	})
+	media, ok := h.findMedia(c, mediaID)
+	if !ok {
+		return
+	}
+
+	thumbnail := services.SelectThumbnail(media.Thumbnails, size)
+	if thumbnail == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Thumbnail not available",
+		})
+		return
+	}
+
+	url, err := h.storage.PresignGet(c.Request.Context(), thumbnail.StorageKey, time.Hour)
+	if err != nil {
+		log.Printf("❌ Error generating presigned URL: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to get thumbnail",
+		})
+		return
+	}
+	c.Redirect(http.StatusTemporaryRedirect, url)
 }
 
-// validateFileType validates the uploaded file type
-func (h *MediaHandler) validateFileType(contentType, filename string) (models.MediaType, error) {
-	// Check content type
+// declaredMediaType guesses the media type from the Content-Type and file
+// name a client declared, or returns "" when neither is recognised. It is only
+// a hint for uploads whose content has not arrived yet: every upload is
+// accepted or rejected by its content.
+func declaredMediaType(contentType, filename string) models.MediaType {
 	switch {
 	case strings.HasPrefix(contentType, "image/"):
-		return models.MediaTypeImage, nil
+		return models.MediaTypeImage
 	case strings.HasPrefix(contentType, "video/"):
-		return models.MediaTypeVideo, nil
+		return models.MediaTypeVideo
 	}
 
 	// Check file extension as fallback
 	ext := strings.ToLower(filepath.Ext(filename))
 	switch ext {
 	case ".jpg", ".jpeg", ".png", ".gif", ".bmp", ".webp":
-		return models.MediaTypeImage, nil
+		return models.MediaTypeImage
 	case ".mp4", ".avi", ".mov", ".wmv", ".flv", ".webm", ".mkv":
-		return models.MediaTypeVideo, nil
+		return models.MediaTypeVideo
+	}
+	return ""
+}
+
+// streamSource returns the file carried by a streaming upload request along
+// with its name and content type, without reading it
+func streamSource(c *gin.Context) (io.Reader, string, string, error) {
+	if c.ContentType() != "multipart/form-data" {
+		filename := filepath.Base(c.Query("filename"))
+		if filename == "." || filename == "/" {
+			return nil, "", "", errors.New("filename query parameter is required")
+		}
+		return c.Request.Body, filename, c.ContentType(), nil
 	}
 
-	return "", fmt.Errorf("unsupported file type: %s", contentType)
-}
\ No newline at end of file
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, "", "", fmt.Errorf("invalid multipart body: %v", err)
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, "", "", errors.New("No file uploaded")
+		}
+		if err != nil {
+			return nil, "", "", fmt.Errorf("invalid multipart body: %v", err)
+		}
+		if part.FormName() == "file" && part.FileName() != "" {
+			return part, filepath.Base(part.FileName()), part.Header.Get("Content-Type"), nil
+		}
+		part.Close()
+	}
+}
+
+// queueFormFile spools a multipart upload, records the media item and queues
+// its processing job, answering the request with 202 once it is queued
+func (h *MediaHandler) queueFormFile(c *gin.Context, file *multipart.FileHeader, tenantID, mediaID string, mediaType models.MediaType, contentType string) {
+	// Spool the upload to disk so processing survives the request and restarts
+	inputPath, err := h.spoolFormFile(file, mediaID)
+	if err != nil {
+		log.Printf("❌ Failed to spool upload: %v", err)
+		c.JSON(http.StatusInternalServerError, models.UploadResponse{
+			Success: false,
+			Message: "Failed to store upload for processing",
+		})
+		return
+	}
+
+	media := &models.Media{
+		ID:           mediaID,
+		TenantID:     tenantID,
+		Filename:     file.Filename,
+		OriginalName: file.Filename,
+		MediaType:    mediaType,
+		MimeType:     contentType,
+		Size:         file.Size,
+		URL:          "", // Will be updated when processing completes
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	if !h.saveMedia(c, media) {
+		services.RemoveSpool(mediaID)
+		return
+	}
+	if _, err := h.queue.Enqueue(mediaID, inputPath); err != nil {
+		log.Printf("❌ Failed to create processing job: %v", err)
+		h.repo.DeleteMedia(mediaID)
+		services.RemoveSpool(mediaID)
+		c.JSON(http.StatusInternalServerError, models.UploadResponse{
+			Success: false,
+			Message: "Failed to create processing job",
+		})
+		return
+	}
+
+	// Return immediately with processing status
+	c.JSON(http.StatusAccepted, models.UploadResponse{
+		Success: true,
+		Message: processingMessage(mediaType, mediaID),
+		Media:   media,
+	})
+}
+
+// spoolFormFile copies a multipart upload to the processing spool
+func (h *MediaHandler) spoolFormFile(file *multipart.FileHeader, mediaID string) (string, error) {
+	src, err := file.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %v", err)
+	}
+	defer src.Close()
+
+	return services.SpoolUpload(src, mediaID, file.Filename)
+}
+
+// uploadFormFile stores a multipart upload under key and returns its URL
+func (h *MediaHandler) uploadFormFile(ctx context.Context, file *multipart.FileHeader, key, contentType string) (string, error) {
+	src, err := file.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %v", err)
+	}
+	defer src.Close()
+
+	if err := h.storage.Put(ctx, key, src, contentType); err != nil {
+		return "", err
+	}
+	return h.storage.URL(key), nil
+}
+
+// verifyFormFile checks the content of a multipart upload. Videos are handed
+// to FFprobe, which needs them on disk, so uploads gin kept in memory are
+// copied to a temporary file first.
+func (h *MediaHandler) verifyFormFile(ctx context.Context, file *multipart.FileHeader) (*services.ContentFormat, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %v", err)
+	}
+	defer src.Close()
+
+	head := make([]byte, services.SniffSize)
+	n, err := src.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+	format, err := services.CheckContent(head[:n])
+	if err != nil || format.MediaType != models.MediaTypeVideo {
+		return format, err
+	}
+
+	if f, ok := src.(*os.File); ok {
+		return services.VerifyFile(ctx, config.AppConfig.FFprobePath, f.Name())
+	}
+	tmp, err := os.CreateTemp("", "verify_*"+filepath.Ext(file.Filename))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, io.NewSectionReader(src, 0, file.Size))
+	tmp.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy file: %v", err)
+	}
+	return services.VerifyFile(ctx, config.AppConfig.FFprobePath, tmp.Name())
+}
+
+// rejectUpload answers an upload whose content failed verification: 400 with
+// the reason when it was rejected, 500 when it could not be checked
+func rejectUpload(c *gin.Context, err error) {
+	var rejected *services.ContentError
+	if errors.As(err, &rejected) {
+		log.Printf("❌ Upload rejected: %v", err)
+		c.JSON(http.StatusBadRequest, models.UploadResponse{
+			Success: false,
+			Message: "File rejected: " + rejected.Reason,
+		})
+		return
+	}
+	log.Printf("❌ Failed to verify upload: %v", err)
+	c.JSON(http.StatusInternalServerError, models.UploadResponse{
+		Success: false,
+		Message: "Failed to verify file content",
+	})
+}
+
+// saveMedia persists a new media record, answering the request on failure
+func (h *MediaHandler) saveMedia(c *gin.Context, media *models.Media) bool {
+	if err := h.createMedia(c.Request.Context(), media); err != nil {
+		log.Printf("❌ Failed to save media record: %v", err)
+		c.JSON(http.StatusInternalServerError, models.UploadResponse{
+			Success: false,
+			Message: "Failed to save media record",
+		})
+		return false
+	}
+	return true
+}
+
+// createMedia persists a new media record, noting the API key the request
+// was authenticated with, and announces the upload
+func (h *MediaHandler) createMedia(ctx context.Context, media *models.Media) error {
+	if key := apiKeyFrom(ctx); key != nil {
+		media.APIKeyID = key.ID
+	}
+	if err := h.repo.CreateMedia(media); err != nil {
+		return err
+	}
+	h.events.Publish(models.EventMediaUploaded, media.ID, media, nil)
+	return nil
+}
+
+// ingestFile hands a complete upload on local disk to the same pipeline as
+// UploadMedia: videos and images are queued for processing when it is
+// enabled for them, anything else is stored as is. The file is moved or copied away from path.
+func (h *MediaHandler) ingestFile(ctx context.Context, tenantID, path, filename, contentType string, size int64, mediaType models.MediaType) (*models.Media, error) {
+	if h.storage == nil {
+		return nil, errors.New("storage not available")
+	}
+
+	mediaID := uuid.New().String()
+	media := &models.Media{
+		ID:           mediaID,
+		TenantID:     tenantID,
+		Filename:     filename,
+		OriginalName: filename,
+		MediaType:    mediaType,
+		MimeType:     contentType,
+		Size:         size,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	if processingEnabled(mediaType) {
+		inputPath, err := services.SpoolFile(path, mediaID, filename)
+		if err != nil {
+			return nil, err
+		}
+		if err := h.createMedia(ctx, media); err != nil {
+			services.RemoveSpool(mediaID)
+			return nil, fmt.Errorf("failed to save media record: %v", err)
+		}
+		if _, err := h.queue.Enqueue(mediaID, inputPath); err != nil {
+			h.repo.DeleteMedia(mediaID)
+			services.RemoveSpool(mediaID)
+			return nil, fmt.Errorf("failed to create processing job: %v", err)
+		}
+		return media, nil
+	}
+
+	key := services.MediaKey(tenantID, mediaID, filename)
+	log.Printf("☁️ Uploading to storage: %s", key)
+	uploadedURL, err := services.UploadLocalFile(ctx, h.storage, path, key, contentType)
+	if err != nil {
+		return nil, err
+	}
+	media.URL = uploadedURL
+	media.StorageKey = key
+	if err := h.createMedia(ctx, media); err != nil {
+		return nil, fmt.Errorf("failed to save media record: %v", err)
+	}
+	return media, nil
+}
+
+// uploadTenant loads the tenant new uploads of a request belong to,
+// answering 403/500 when it cannot be found
+func (h *MediaHandler) uploadTenant(c *gin.Context) (*models.Tenant, bool) {
+	tenantID := ownerTenant(c.Request.Context())
+	tenant, err := h.repo.GetTenant(tenantID)
+	if errors.Is(err, repository.ErrNotFound) {
+		log.Printf("❌ Upload for unknown tenant: %s", tenantID)
+		c.JSON(http.StatusForbidden, models.UploadResponse{
+			Success: false,
+			Message: fmt.Sprintf("Unknown tenant: %s", tenantID),
+		})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("❌ Error loading tenant: %v", err)
+		c.JSON(http.StatusInternalServerError, models.UploadResponse{
+			Success: false,
+			Message: "Failed to load tenant",
+		})
+		return nil, false
+	}
+	return tenant, true
+}
+
+// checkTenantFormat rejects content the tenant owning an upload does not
+// accept. Rejections are returned as *services.ContentError.
+func (h *MediaHandler) checkTenantFormat(tenantID string, format *services.ContentFormat) error {
+	tenant, err := h.repo.GetTenant(tenantID)
+	if err != nil {
+		return fmt.Errorf("failed to load tenant %s: %v", tenantID, err)
+	}
+	return services.CheckTenantFormat(tenant, format)
+}
+
+// processingEnabled reports whether uploads of mediaType go through the job queue
+func processingEnabled(mediaType models.MediaType) bool {
+	switch mediaType {
+	case models.MediaTypeVideo:
+		return config.AppConfig.EnableVideoProcessing
+	case models.MediaTypeImage:
+		return config.AppConfig.EnableImageProcessing
+	}
+	return false
+}
+
+// processingMessage is the upload response message of a queued media item
+func processingMessage(mediaType models.MediaType, mediaID string) string {
+	kind := "Video"
+	if mediaType == models.MediaTypeImage {
+		kind = "Image"
+	}
+	return kind + " uploaded. Processing in background. Check progress at /api/v1/media/" + mediaID + "/progress"
+}
+
+// findMedia loads a media record, answering 404/500 when it cannot be found
+// or belongs to another tenant than the caller
+func (h *MediaHandler) findMedia(c *gin.Context, mediaID string) (*models.Media, bool) {
+	media, err := h.repo.GetMedia(mediaID)
+	// Media of other tenants are reported missing rather than forbidden
+	if err == nil && !canReach(c.Request.Context(), media.TenantID) {
+		err = repository.ErrNotFound
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Media not found",
+		})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("❌ Error loading media: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Error retrieving media info",
+		})
+		return nil, false
+	}
+	return media, true
+}
+
+// jobEventType maps a job status to the event announcing it
+func jobEventType(status string) string {
+	switch status {
+	case models.JobStatusPending:
+		return models.EventProcessingQueued
+	case models.JobStatusCompleted:
+		return models.EventProcessingCompleted
+	case models.JobStatusFailed:
+		return models.EventProcessingFailed
+	}
+	return models.EventProcessingProgress
+}
@@ -0,0 +1,463 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"api-s3/config"
+	"api-s3/models"
+	"api-s3/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// playbackContextKey holds the claims of a verified playback token in the
+// request context
+type playbackContextKey struct{}
+
+// PlaybackHandler mints signed playback tokens and serves the streams they
+// grant, so players never need an API key
+type PlaybackHandler struct {
+	media  *MediaHandler
+	signer *services.PlaybackSigner
+}
+
+// NewPlaybackHandler creates a new PlaybackHandler instance. A nil signer
+// disables signed playback.
+func NewPlaybackHandler(media *MediaHandler, signer *services.PlaybackSigner) *PlaybackHandler {
+	return &PlaybackHandler{media: media, signer: signer}
+}
+
+// CreateToken mints a playback token for a video, optionally bound to the
+// IP address of the caller and restricted to some renditions
+func (h *PlaybackHandler) CreateToken(c *gin.Context) {
+	if h.signer == nil {
+		c.JSON(http.StatusNotImplemented, models.PlaybackResponse{
+			Success: false,
+			Message: "Signed playback is disabled; set PLAYBACK_SIGNING_KEY",
+		})
+		return
+	}
+
+	var req models.PlaybackRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.PlaybackResponse{
+				Success: false,
+				Message: "Invalid request: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	ttl := time.Duration(config.AppConfig.PlaybackTokenTTL) * time.Minute
+	maxTTL := time.Duration(config.AppConfig.PlaybackTokenMaxTTL) * time.Minute
+	if req.ExpiresIn != 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+	if ttl <= 0 || ttl > maxTTL {
+		c.JSON(http.StatusBadRequest, models.PlaybackResponse{
+			Success: false,
+			Message: fmt.Sprintf("expires_in must be between 1 and %d seconds", int(maxTTL.Seconds())),
+		})
+		return
+	}
+
+	renditions := []string{}
+	for _, rendition := range req.Renditions {
+		rendition = strings.ToLower(strings.TrimSpace(rendition))
+		quality := models.VideoQuality(rendition)
+		// Only ladder qualities name a rendition a token can be limited to
+		if _, ok := services.RenditionLadder[quality]; !ok {
+			c.JSON(http.StatusBadRequest, models.PlaybackResponse{
+				Success: false,
+				Message: fmt.Sprintf("Unknown rendition %q", rendition),
+			})
+			return
+		}
+		renditions = append(renditions, rendition)
+	}
+
+	media, ok := h.media.findMedia(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if media.MediaType != models.MediaTypeVideo {
+		c.JSON(http.StatusBadRequest, models.PlaybackResponse{
+			Success: false,
+			Message: "Playback tokens are only issued for videos",
+		})
+		return
+	}
+
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	claims := &models.PlaybackClaims{
+		MediaID:    media.ID,
+		ExpiresAt:  expiresAt.Unix(),
+		Renditions: renditions,
+	}
+	if req.BindIP {
+		claims.IP = c.ClientIP()
+	}
+	token, err := h.signer.Sign(claims)
+	if err != nil {
+		log.Printf("❌ Error signing playback token: %v", err)
+		c.JSON(http.StatusInternalServerError, models.PlaybackResponse{
+			Success: false,
+			Message: "Failed to create playback token",
+		})
+		return
+	}
+
+	log.Printf("🎟️ Playback token issued for %s until %s", media.ID, expiresAt.Format(time.RFC3339))
+	base := "/api/v1/playback/" + token
+	response := models.PlaybackResponse{
+		Success:   true,
+		Message:   "Playback token created successfully",
+		Token:     token,
+		ExpiresAt: expiresAt,
+		StreamURL: base + "/stream",
+		HLSURL:    base + "/hls/" + services.HLSMasterPlaylist,
+	}
+	if media.DashURL != "" {
+		response.DashURL = base + "/dash/" + services.DASHManifest
+	}
+	if media.Trickplay != nil {
+		response.TrickplayURL = base + "/trickplay/" + services.TrickplayPlaylist
+	}
+	if media.Preview != nil {
+		response.PreviewURL = base + "/preview"
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// RequireToken verifies the playback token in the URL, answering the request
+// when it is refused
+func (h *PlaybackHandler) RequireToken(c *gin.Context) {
+	if h.signer == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Signed playback is disabled",
+		})
+		return
+	}
+
+	claims, err := h.signer.Verify(c.Param("token"), c.ClientIP())
+	if err != nil {
+		var rejected *services.TokenError
+		errors.As(err, &rejected)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "Invalid playback token: " + rejected.Reason,
+		})
+		return
+	}
+
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), playbackContextKey{}, claims))
+	c.Next()
+}
+
+// Stream streams the video a playback token grants in the requested quality,
+// like MediaHandler.StreamVideo but limited to the renditions of the token
+func (h *PlaybackHandler) Stream(c *gin.Context) {
+	claims := playbackFrom(c.Request.Context())
+	requested := c.Param("quality")
+	if requested == "" {
+		requested = string(models.QualityAuto)
+	}
+	log.Printf("🎬 Streaming video %s in %s with a playback token", claims.MediaID, requested)
+
+	quality, height, err := services.ParseVideoQuality(requested)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	media, ok := h.media.findMedia(c, claims.MediaID)
+	if !ok {
+		return
+	}
+	h.media.streamVideo(c, media, requested, quality, height, claims)
+}
+
+// ServeHLS serves the HLS output of the video a playback token grants. The
+// master playlist only lists the renditions the token allows, and playlists
+// and segments of other renditions are refused. Playlists refer to their
+// files relatively, so players keep the token in every request.
+func (h *PlaybackHandler) ServeHLS(c *gin.Context) {
+	claims := playbackFrom(c.Request.Context())
+	name := strings.TrimPrefix(path.Clean("/"+c.Param("path")), "/")
+
+	media, ok := h.media.findMedia(c, claims.MediaID)
+	if !ok {
+		return
+	}
+	if media.MasterURL == "" {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "HLS stream not found",
+		})
+		return
+	}
+
+	key := path.Join(services.HLSPrefix(media.TenantID, media.ID), name)
+	if name == services.HLSMasterPlaylist {
+		if len(claims.Renditions) > 0 {
+			h.serveMasterPlaylist(c, key, claims)
+			return
+		}
+	} else if quality, _, ok := strings.Cut(name, "/"); !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "HLS file not found",
+		})
+		return
+	} else if !claims.AllowsRendition(models.VideoQuality(quality)) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("The playback token does not allow %s", quality),
+		})
+		return
+	}
+
+	if err := services.StreamObject(c.Writer, c.Request, h.media.storage, key, services.CacheNoStore); err != nil {
+		h.streamError(c, key, err)
+	}
+}
+
+// serveMasterPlaylist serves the master playlist without the renditions the
+// token does not allow
+func (h *PlaybackHandler) serveMasterPlaylist(c *gin.Context, key string, claims *models.PlaybackClaims) {
+	playlist, ok := h.readObject(c, key)
+	if !ok {
+		return
+	}
+	c.Header("Cache-Control", "private, no-store")
+	c.Data(http.StatusOK, services.HLSPlaylistMimeType, services.FilterMasterPlaylist(playlist, claims))
+}
+
+// ServeDASH serves the DASH output of the video a playback token grants. For
+// tokens limited to some renditions the manifest only lists those and the
+// audio, and segments of other representations are refused; which rendition
+// a representation carries is read from the manifest on every request.
+func (h *PlaybackHandler) ServeDASH(c *gin.Context) {
+	claims := playbackFrom(c.Request.Context())
+	name := strings.TrimPrefix(path.Clean("/"+c.Param("path")), "/")
+
+	media, ok := h.media.findMedia(c, claims.MediaID)
+	if !ok {
+		return
+	}
+	if media.DashURL == "" {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "DASH stream not found",
+		})
+		return
+	}
+
+	prefix := services.DASHPrefix(media.TenantID, media.ID)
+	key := path.Join(prefix, name)
+	if len(claims.Renditions) > 0 {
+		allowed, ok := h.allowedRepresentations(c, media, claims)
+		if !ok {
+			return
+		}
+		manifest, ok := h.readObject(c, path.Join(prefix, services.DASHManifest))
+		if !ok {
+			return
+		}
+
+		if name == services.DASHManifest {
+			c.Header("Cache-Control", "private, no-store")
+			c.Data(http.StatusOK, services.DASHManifestMimeType, services.FilterDASHManifest(manifest, allowed))
+			return
+		}
+		id, ok := services.DASHSegmentRepresentation(name)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "File not found",
+			})
+			return
+		}
+		if representation, ok := services.FindDASHRepresentation(manifest, id); !ok || !allowed(representation) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": "The playback token does not allow this representation",
+			})
+			return
+		}
+	}
+
+	if err := services.StreamObject(c.Writer, c.Request, h.media.storage, key, services.CacheNoStore); err != nil {
+		h.streamError(c, key, err)
+	}
+}
+
+// allowedRepresentations returns which DASH representations a token limited
+// to some renditions may play: the audio, and the video of the MP4 renditions
+// it allows, matched by frame size since DASH copies them
+func (h *PlaybackHandler) allowedRepresentations(c *gin.Context, media *models.Media, claims *models.PlaybackClaims) (func(services.DASHRepresentation) bool, bool) {
+	variants, err := h.media.repo.GetVariants(media.ID)
+	if err != nil {
+		log.Printf("❌ Failed to get video variants: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to serve file",
+		})
+		return nil, false
+	}
+
+	qualities := make(map[[2]int]models.VideoQuality)
+	for _, variant := range variants {
+		if variant.Format == models.FormatMP4 {
+			qualities[[2]int{variant.Width, variant.Height}] = variant.Quality
+		}
+	}
+	return func(representation services.DASHRepresentation) bool {
+		if representation.Height == 0 {
+			return true
+		}
+		quality, ok := qualities[[2]int{representation.Width, representation.Height}]
+		return ok && claims.AllowsRendition(quality)
+	}, true
+}
+
+// ServeTrickplay serves the trickplay track and sprite sheets of the video a
+// playback token grants. The track refers to the sheets relatively, so they
+// are requested with the same token.
+func (h *PlaybackHandler) ServeTrickplay(c *gin.Context) {
+	claims := playbackFrom(c.Request.Context())
+	name := strings.TrimPrefix(path.Clean("/"+c.Param("path")), "/")
+
+	media, ok := h.media.findMedia(c, claims.MediaID)
+	if !ok {
+		return
+	}
+	if media.Trickplay == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Trickplay not available",
+		})
+		return
+	}
+
+	key := path.Join(services.TrickplayPrefix(media.TenantID, media.ID), name)
+	if err := services.StreamObject(c.Writer, c.Request, h.media.storage, key, services.CacheNoStore); err != nil {
+		h.streamError(c, key, err)
+	}
+}
+
+// ServePreview serves the animated preview of the video a playback token grants
+func (h *PlaybackHandler) ServePreview(c *gin.Context) {
+	claims := playbackFrom(c.Request.Context())
+
+	media, ok := h.media.findMedia(c, claims.MediaID)
+	if !ok {
+		return
+	}
+	if media.Preview == nil || media.Preview.StorageKey == "" {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Preview not available",
+		})
+		return
+	}
+
+	key := media.Preview.StorageKey
+	if err := services.StreamObject(c.Writer, c.Request, h.media.storage, key, services.CacheNoStore); err != nil {
+		h.streamError(c, key, err)
+	}
+}
+
+// readObject reads a small stored file such as a playlist or manifest,
+// answering the request when it cannot be read
+func (h *PlaybackHandler) readObject(c *gin.Context, key string) ([]byte, bool) {
+	body, _, err := h.media.storage.Get(c.Request.Context(), key)
+	if err != nil {
+		h.streamError(c, key, err)
+		return nil, false
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		h.streamError(c, key, err)
+		return nil, false
+	}
+	return data, true
+}
+
+// streamError answers a request whose file could not be served
+func (h *PlaybackHandler) streamError(c *gin.Context, key string, err error) {
+	if services.IsClientDisconnect(err) {
+		log.Printf("📺 Client disconnected during streaming (normal): %v", err)
+		return
+	}
+	if errors.Is(err, services.ErrObjectNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "File not found",
+		})
+		return
+	}
+
+	log.Printf("❌ Failed to serve %s: %v", key, err)
+	if !c.Writer.Written() {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to serve file",
+		})
+	}
+}
+
+// signedPlayback reports whether a media item may only be played through
+// playback tokens, which is the case for videos once signing is enabled
+func signedPlayback(media *models.Media) bool {
+	return media.MediaType == models.MediaTypeVideo && config.AppConfig.PlaybackSigningKey != ""
+}
+
+// hideAssetURLs drops the storage URLs of every file of a media item, so
+// they cannot be used to play it without a playback token. Playback tokens
+// grant the streams, DASH, trickplay and preview in their place.
+func hideAssetURLs(media *models.Media) {
+	media.URL = ""
+	media.ThumbnailURL = ""
+	media.MasterURL = ""
+	media.DashURL = ""
+	for i := range media.Thumbnails {
+		media.Thumbnails[i].URL = ""
+	}
+	media.Trickplay = nil
+	media.Preview = nil
+}
+
+// cacheScope returns who may cache what a request is served: nobody for
+// playback token URLs, only the client for authenticated requests and
+// presigned URLs, and shared caches too for anonymous ones
+func cacheScope(ctx context.Context) services.CacheScope {
+	switch {
+	case playbackFrom(ctx) != nil:
+		return services.CacheNoStore
+	case apiKeyFrom(ctx) != nil, tokenFrom(ctx) != nil, ctx.Value(presignedContextKey{}) != nil:
+		return services.CachePrivate
+	}
+	return services.CachePublic
+}
+
+// playbackFrom returns the claims of the playback token a request carries
+func playbackFrom(ctx context.Context) *models.PlaybackClaims {
+	claims, _ := ctx.Value(playbackContextKey{}).(*models.PlaybackClaims)
+	return claims
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"api-s3/config"
+	"api-s3/models"
+	"api-s3/repository"
+	"api-s3/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TenantHandler manages the tenants media are isolated by
+type TenantHandler struct {
+	repo repository.TenantRepository
+}
+
+// NewTenantHandler creates a new TenantHandler instance
+func NewTenantHandler(repo repository.TenantRepository) *TenantHandler {
+	return &TenantHandler{repo: repo}
+}
+
+// CreateTenant registers a tenant. Its ID becomes part of the storage keys of
+// its media and cannot be changed afterwards.
+func (h *TenantHandler) CreateTenant(c *gin.Context) {
+	var req models.TenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.TenantResponse{
+			Success: false,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	if !models.IsTenantID(req.ID) {
+		c.JSON(http.StatusBadRequest, models.TenantResponse{
+			Success: false,
+			Message: "ID must be 1-63 lowercase letters, digits, - or _, starting with a letter or digit",
+		})
+		return
+	}
+	if _, err := h.repo.GetTenant(req.ID); err == nil {
+		c.JSON(http.StatusConflict, models.TenantResponse{
+			Success: false,
+			Message: "Tenant already exists",
+		})
+		return
+	}
+
+	tenant := &models.Tenant{
+		ID:        req.ID,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := applyTenantRequest(tenant, &req); err != nil {
+		c.JSON(http.StatusBadRequest, models.TenantResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err := h.repo.CreateTenant(tenant); err != nil {
+		log.Printf("❌ Error creating tenant: %v", err)
+		c.JSON(http.StatusInternalServerError, models.TenantResponse{
+			Success: false,
+			Message: "Failed to create tenant",
+		})
+		return
+	}
+
+	log.Printf("🏢 Tenant created: %s (%s)", tenant.ID, tenant.Name)
+	c.JSON(http.StatusCreated, models.TenantResponse{
+		Success: true,
+		Message: "Tenant created successfully",
+		Tenant:  tenant,
+	})
+}
+
+// ListTenants returns every tenant
+func (h *TenantHandler) ListTenants(c *gin.Context) {
+	tenants, err := h.repo.ListTenants()
+	if err != nil {
+		log.Printf("❌ Error listing tenants: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to list tenants",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Tenants retrieved successfully",
+		"tenants": tenants,
+	})
+}
+
+// GetTenant returns a single tenant
+func (h *TenantHandler) GetTenant(c *gin.Context) {
+	tenant, ok := h.findTenant(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TenantResponse{
+		Success: true,
+		Message: "Tenant retrieved successfully",
+		Tenant:  tenant,
+	})
+}
+
+// UpdateTenant replaces the name and limits of a tenant. Media already
+// processed keep their renditions.
+func (h *TenantHandler) UpdateTenant(c *gin.Context) {
+	tenant, ok := h.findTenant(c)
+	if !ok {
+		return
+	}
+
+	var req models.TenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.TenantResponse{
+			Success: false,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+	if err := applyTenantRequest(tenant, &req); err != nil {
+		c.JSON(http.StatusBadRequest, models.TenantResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err := h.repo.UpdateTenant(tenant); err != nil {
+		log.Printf("❌ Error updating tenant: %v", err)
+		c.JSON(http.StatusInternalServerError, models.TenantResponse{
+			Success: false,
+			Message: "Failed to update tenant",
+		})
+		return
+	}
+
+	log.Printf("🏢 Tenant updated: %s (%s)", tenant.ID, tenant.Name)
+	c.JSON(http.StatusOK, models.TenantResponse{
+		Success: true,
+		Message: "Tenant updated successfully",
+		Tenant:  tenant,
+	})
+}
+
+// findTenant loads the tenant named in the URL, writing the error response
+// when it cannot be found
+func (h *TenantHandler) findTenant(c *gin.Context) (*models.Tenant, bool) {
+	tenant, err := h.repo.GetTenant(c.Param("id"))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Tenant not found",
+		})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("❌ Error loading tenant: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to load tenant",
+		})
+		return nil, false
+	}
+	return tenant, true
+}
+
+// applyTenantRequest validates a tenant request and copies it onto tenant.
+// Tenants can only narrow the server limits: containers must be among
+// ALLOWED_CONTAINERS and renditions among the known qualities.
+func applyTenantRequest(tenant *models.Tenant, req *models.TenantRequest) error {
+	if req.MaxFileSize < 0 {
+		return errors.New("max_file_size cannot be negative")
+	}
+
+	containers := []string{}
+	for _, container := range req.AllowedContainers {
+		container = strings.ToLower(strings.TrimSpace(container))
+		if !services.IsAllowedContainer(container) {
+			return fmt.Errorf("container %q is not allowed (allowed: %s)",
+				container, strings.Join(config.AppConfig.AllowedContainers, ", "))
+		}
+		containers = append(containers, container)
+	}
+
+	renditions := []string{}
+	for _, rendition := range req.EncodingProfile.Renditions {
+		rendition = strings.ToLower(strings.TrimSpace(rendition))
+		if _, ok := services.RenditionLadder[models.VideoQuality(rendition)]; !ok {
+			return fmt.Errorf("unknown rendition %q", rendition)
+		}
+		renditions = append(renditions, rendition)
+	}
+
+	tenant.Name = strings.TrimSpace(req.Name)
+	tenant.MaxFileSize = req.MaxFileSize
+	tenant.AllowedContainers = containers
+	tenant.EncodingProfile.Renditions = renditions
+	return nil
+}
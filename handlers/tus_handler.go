@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"api-s3/config"
+	"api-s3/models"
+	"api-s3/repository"
+	"api-s3/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TusVersion is the only tus protocol version served
+const TusVersion = "1.0.0"
+
+const tusExtensions = "creation,termination,expiration"
+
+// TusHandler implements the tus 1.0 resumable upload protocol. Completed
+// uploads go through the same pipeline as UploadMedia.
+type TusHandler struct {
+	media *MediaHandler
+	store *services.TusStore
+}
+
+// NewTusHandler creates a new TusHandler instance
+func NewTusHandler(media *MediaHandler, store *services.TusStore) *TusHandler {
+	return &TusHandler{
+		media: media,
+		store: store,
+	}
+}
+
+// Resumable is the middleware of the tus routes: it announces the protocol
+// version and rejects requests for any other version
+func (h *TusHandler) Resumable(c *gin.Context) {
+	c.Header("Tus-Resumable", TusVersion)
+	if c.Request.Method != http.MethodOptions && c.GetHeader("Tus-Resumable") != TusVersion {
+		c.Header("Tus-Version", TusVersion)
+		tusError(c, http.StatusPreconditionFailed, "Unsupported tus version")
+		return
+	}
+	c.Next()
+}
+
+// Options describes the capabilities of the server
+func (h *TusHandler) Options(c *gin.Context) {
+	c.Header("Tus-Version", TusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(config.AppConfig.TusMaxSize, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// CreateUpload starts a new upload. The file name and type are taken from the
+// filename and filetype metadata and validated like a regular upload.
+func (h *TusHandler) CreateUpload(c *gin.Context) {
+	if c.GetHeader("Upload-Defer-Length") != "" {
+		tusError(c, http.StatusBadRequest, "Upload-Defer-Length is not supported")
+		return
+	}
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		tusError(c, http.StatusBadRequest, "Invalid Upload-Length")
+		return
+	}
+	tenant, ok := h.media.uploadTenant(c)
+	if !ok {
+		return
+	}
+	if maxSize := tenant.SizeLimit(config.AppConfig.TusMaxSize); length > maxSize {
+		tusError(c, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("File size exceeds maximum allowed size of %d bytes", maxSize))
+		return
+	}
+
+	rawMetadata := c.GetHeader("Upload-Metadata")
+	metadata, err := services.ParseTusMetadata(rawMetadata)
+	if err != nil {
+		tusError(c, http.StatusBadRequest, "Invalid Upload-Metadata: "+err.Error())
+		return
+	}
+
+	filename := firstNonEmpty(metadata["filename"], metadata["name"])
+	if filename == "" {
+		tusError(c, http.StatusBadRequest, "filename metadata is required")
+		return
+	}
+	filename = filepath.Base(filename)
+	contentType := firstNonEmpty(metadata["filetype"], metadata["type"])
+
+	upload := &models.Upload{
+		Filename:  filename,
+		MimeType:  contentType,
+		MediaType: declaredMediaType(contentType, filename),
+		Length:    length,
+		Metadata:  rawMetadata,
+		TenantID:  tenant.ID,
+	}
+	if err := h.store.Create(upload); err != nil {
+		log.Printf("❌ Failed to create upload: %v", err)
+		tusError(c, http.StatusInternalServerError, "Failed to create upload")
+		return
+	}
+
+	log.Printf("📤 Resumable upload created: %s (%s, %d bytes)", upload.ID, filename, length)
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+upload.ID)
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+
+	if upload.Complete() {
+		// Nothing to send, so there will be no PATCH to finish it
+		if !h.finish(c, upload) {
+			return
+		}
+	}
+	c.Status(http.StatusCreated)
+}
+
+// GetUploadOffset reports how many bytes of an upload have been received
+func (h *TusHandler) GetUploadOffset(c *gin.Context) {
+	upload, ok := h.findUpload(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.Metadata != "" {
+		c.Header("Upload-Metadata", upload.Metadata)
+	}
+	if upload.MediaID != "" {
+		c.Header("X-Media-ID", upload.MediaID)
+	} else {
+		c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+	c.Status(http.StatusOK)
+}
+
+// PatchUpload appends a chunk at Upload-Offset. The chunk completing the
+// upload creates the media item, whose ID is returned in X-Media-ID.
+func (h *TusHandler) PatchUpload(c *gin.Context) {
+	if c.ContentType() != "application/offset+octet-stream" {
+		tusError(c, http.StatusUnsupportedMediaType, "Content-Type must be application/offset+octet-stream")
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		tusError(c, http.StatusBadRequest, "Invalid Upload-Offset")
+		return
+	}
+
+	unlock, err := h.store.Lock(c.Param("id"))
+	if err != nil {
+		tusError(c, http.StatusLocked, err.Error())
+		return
+	}
+	defer unlock()
+
+	upload, ok := h.findUpload(c)
+	if !ok {
+		return
+	}
+	if offset != upload.Offset {
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		tusError(c, http.StatusConflict, services.ErrOffsetMismatch.Error())
+		return
+	}
+
+	if !upload.Complete() {
+		written, err := h.store.Append(upload, offset, c.Request.Body)
+		if err != nil {
+			log.Printf("⚠️ Upload %s interrupted after %d bytes: %v", upload.ID, written, err)
+			c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+			tusError(c, http.StatusInternalServerError, "Failed to store chunk")
+			return
+		}
+	}
+
+	// A complete upload without media is finished here, which also retries a
+	// previously failed hand-off when the client resends the final offset
+	if upload.Complete() && upload.MediaID == "" {
+		if !h.finish(c, upload) {
+			return
+		}
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	if upload.MediaID != "" {
+		c.Header("X-Media-ID", upload.MediaID)
+	} else {
+		c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteUpload terminates an upload and discards the received data
+func (h *TusHandler) DeleteUpload(c *gin.Context) {
+	unlock, err := h.store.Lock(c.Param("id"))
+	if err != nil {
+		tusError(c, http.StatusLocked, err.Error())
+		return
+	}
+	defer unlock()
+
+	// Uploads of other tenants are reported missing like media
+	if upload, err := h.store.Get(c.Param("id")); err == nil && !canReach(c.Request.Context(), upload.TenantID) {
+		tusError(c, http.StatusNotFound, "Upload not found")
+		return
+	}
+
+	err = h.store.Terminate(c.Param("id"))
+	if errors.Is(err, repository.ErrNotFound) {
+		tusError(c, http.StatusNotFound, "Upload not found")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to terminate upload: %v", err)
+		tusError(c, http.StatusInternalServerError, "Failed to terminate upload")
+		return
+	}
+
+	log.Printf("🗑️ Resumable upload terminated: %s", c.Param("id"))
+	c.Status(http.StatusNoContent)
+}
+
+// finish hands a complete upload to the media pipeline, answering the
+// request on failure
+func (h *TusHandler) finish(c *gin.Context, upload *models.Upload) bool {
+	log.Printf("✅ Resumable upload complete: %s (%d bytes)", upload.ID, upload.Length)
+
+	// The filetype metadata is only a hint, the content decides
+	format, err := services.VerifyFile(c.Request.Context(), config.AppConfig.FFprobePath, h.store.Path(upload.ID))
+	if err == nil {
+		err = h.media.checkTenantFormat(upload.TenantID, format)
+	}
+	if err != nil {
+		var rejected *services.ContentError
+		if errors.As(err, &rejected) {
+			log.Printf("❌ Upload %s rejected: %v", upload.ID, err)
+			if err := h.store.Terminate(upload.ID); err != nil {
+				log.Printf("⚠️ Failed to discard rejected upload %s: %v", upload.ID, err)
+			}
+			tusError(c, http.StatusBadRequest, "File rejected: "+rejected.Reason)
+			return false
+		}
+		log.Printf("❌ Failed to verify upload %s: %v", upload.ID, err)
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		tusError(c, http.StatusInternalServerError, "Failed to verify upload")
+		return false
+	}
+
+	media, err := h.media.ingestFile(c.Request.Context(), upload.TenantID, h.store.Path(upload.ID),
+		upload.Filename, format.MimeType, upload.Length, format.MediaType)
+	if err != nil {
+		log.Printf("❌ Failed to process upload %s: %v", upload.ID, err)
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		tusError(c, http.StatusInternalServerError, "Failed to process upload")
+		return false
+	}
+
+	if err := h.store.Complete(upload, media.ID); err != nil {
+		log.Printf("⚠️ Failed to record media of upload %s: %v", upload.ID, err)
+	}
+	log.Printf("🆔 Upload %s stored as media %s", upload.ID, media.ID)
+	return true
+}
+
+// findUpload loads the upload named in the URL, answering 404 when it does
+// not exist or belongs to another tenant and 410 when it expired before
+// completion
+func (h *TusHandler) findUpload(c *gin.Context) (*models.Upload, bool) {
+	upload, err := h.store.Get(c.Param("id"))
+	if err == nil && !canReach(c.Request.Context(), upload.TenantID) {
+		err = repository.ErrNotFound
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		tusError(c, http.StatusNotFound, "Upload not found")
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("❌ Error loading upload: %v", err)
+		tusError(c, http.StatusInternalServerError, "Failed to load upload")
+		return nil, false
+	}
+	if upload.MediaID == "" && time.Now().After(upload.ExpiresAt) {
+		tusError(c, http.StatusGone, "Upload expired")
+		return nil, false
+	}
+	return upload, true
+}
+
+// tusError aborts a tus request; HEAD responses must not carry a body
+func tusError(c *gin.Context, status int, message string) {
+	if c.Request.Method == http.MethodHead {
+		c.AbortWithStatus(status)
+		return
+	}
+	c.AbortWithStatusJSON(status, gin.H{
+		"success": false,
+		"message": message,
+	})
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,457 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"api-s3/config"
+	"api-s3/models"
+	"api-s3/repository"
+	"api-s3/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// UploadSessionHandler lets clients upload straight to storage with
+// presigned requests, so the file never passes through this server
+type UploadSessionHandler struct {
+	media    *MediaHandler
+	sessions repository.UploadSessionRepository
+}
+
+// NewUploadSessionHandler creates a new UploadSessionHandler instance
+func NewUploadSessionHandler(media *MediaHandler, sessions repository.UploadSessionRepository) *UploadSessionHandler {
+	return &UploadSessionHandler{
+		media:    media,
+		sessions: sessions,
+	}
+}
+
+// CreateSession validates the file like a regular upload and returns the
+// presigned request(s) the client uploads it with
+func (h *UploadSessionHandler) CreateSession(c *gin.Context) {
+	store, ok := h.directStorage(c)
+	if !ok {
+		return
+	}
+
+	var req models.UploadSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.UploadSessionResponse{
+			Success: false,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	filename := filepath.Base(req.Filename)
+	contentType := req.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	tenant, ok := h.media.uploadTenant(c)
+	if !ok {
+		return
+	}
+	if maxSize := tenant.SizeLimit(config.AppConfig.DirectUploadMaxSize); req.Size <= 0 || req.Size > maxSize {
+		c.JSON(http.StatusBadRequest, models.UploadSessionResponse{
+			Success: false,
+			Message: fmt.Sprintf("Size must be between 1 and %d bytes", maxSize),
+		})
+		return
+	}
+
+	partSize := services.MultipartPartSize(req.Size)
+	method := req.Method
+	if method == "" {
+		method = models.UploadMethodPut
+		if req.Size > partSize {
+			method = models.UploadMethodMultipart
+		}
+	}
+	switch method {
+	case models.UploadMethodPut, models.UploadMethodPost:
+		if req.Size > services.MaxSinglePutSize {
+			c.JSON(http.StatusBadRequest, models.UploadSessionResponse{
+				Success: false,
+				Message: "Files larger than 5GB must use the multipart method",
+			})
+			return
+		}
+		partSize = 0
+	case models.UploadMethodMultipart:
+	default:
+		c.JSON(http.StatusBadRequest, models.UploadSessionResponse{
+			Success: false,
+			Message: "Method must be put, post or multipart",
+		})
+		return
+	}
+
+	mediaID := uuid.New().String()
+	session := &models.UploadSession{
+		ID:         uuid.New().String(),
+		MediaID:    mediaID,
+		Method:     method,
+		Status:     models.SessionStatusPending,
+		Filename:   filename,
+		MimeType:   contentType,
+		MediaType:  declaredMediaType(req.ContentType, filename),
+		Size:       req.Size,
+		PartSize:   partSize,
+		StorageKey: services.MediaKey(tenant.ID, mediaID, filename),
+		TenantID:   tenant.ID,
+		ExpiresAt:  time.Now().Add(directUploadExpiry()),
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	response := models.UploadSessionResponse{
+		Success: true,
+		Message: "Upload session created. Upload the file, then call /api/v1/upload-sessions/" + session.ID + "/complete",
+		Session: session,
+	}
+
+	ctx := c.Request.Context()
+	var err error
+	switch method {
+	case models.UploadMethodPut:
+		response.Put, err = store.PresignPut(ctx, session.StorageKey, contentType, req.Size, directUploadExpiry())
+	case models.UploadMethodPost:
+		response.Post, err = store.PresignPost(ctx, session.StorageKey, contentType, req.Size, directUploadExpiry())
+	case models.UploadMethodMultipart:
+		session.MultipartUploadID, err = store.CreateMultipartUpload(ctx, session.StorageKey, contentType)
+		if err == nil {
+			response.Parts, err = h.presignParts(ctx, store, session)
+		}
+	}
+	if err != nil {
+		log.Printf("❌ Failed to presign upload: %v", err)
+		h.abortMultipart(store, session)
+		c.JSON(http.StatusInternalServerError, models.UploadSessionResponse{
+			Success: false,
+			Message: "Failed to create upload session",
+		})
+		return
+	}
+
+	if err := h.sessions.CreateUploadSession(session); err != nil {
+		log.Printf("❌ Failed to save upload session: %v", err)
+		h.abortMultipart(store, session)
+		c.JSON(http.StatusInternalServerError, models.UploadSessionResponse{
+			Success: false,
+			Message: "Failed to create upload session",
+		})
+		return
+	}
+
+	log.Printf("🎫 Upload session %s created (%s, %s, %d bytes)", session.ID, method, filename, req.Size)
+	c.JSON(http.StatusCreated, response)
+}
+
+// CompleteSession verifies the uploaded object, registers the media item and
+// queues video processing like a regular upload
+func (h *UploadSessionHandler) CompleteSession(c *gin.Context) {
+	store, ok := h.directStorage(c)
+	if !ok {
+		return
+	}
+	session, ok := h.findSession(c)
+	if !ok {
+		return
+	}
+
+	var req models.CompleteUploadRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.UploadSessionResponse{
+				Success: false,
+				Message: "Invalid request: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	if session.Method == models.UploadMethodMultipart {
+		if len(req.Parts) != session.PartCount() {
+			c.JSON(http.StatusBadRequest, models.UploadSessionResponse{
+				Success: false,
+				Message: fmt.Sprintf("Expected the ETags of %d parts", session.PartCount()),
+			})
+			return
+		}
+		if err := store.CompleteMultipartUpload(ctx, session.StorageKey, session.MultipartUploadID, req.Parts); err != nil {
+			log.Printf("❌ %v", err)
+			c.JSON(http.StatusConflict, models.UploadSessionResponse{
+				Success: false,
+				Message: "Failed to assemble the uploaded parts",
+			})
+			return
+		}
+	}
+
+	// Never trust the client: the object must exist with the declared size and type
+	info, err := h.media.storage.Head(ctx, session.StorageKey)
+	if errors.Is(err, services.ErrObjectNotFound) {
+		c.JSON(http.StatusConflict, models.UploadSessionResponse{
+			Success: false,
+			Message: "File has not been uploaded",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to verify upload: %v", err)
+		c.JSON(http.StatusInternalServerError, models.UploadSessionResponse{
+			Success: false,
+			Message: "Failed to verify upload",
+		})
+		return
+	}
+	if info.Size != session.Size || (info.ContentType != "" && info.ContentType != session.MimeType) {
+		log.Printf("❌ Upload %s does not match its session: %d bytes of %s", session.ID, info.Size, info.ContentType)
+		h.media.storage.Delete(ctx, session.StorageKey)
+		session.Status = models.SessionStatusAborted
+		h.sessions.UpdateUploadSession(session)
+		c.JSON(http.StatusBadRequest, models.UploadSessionResponse{
+			Success: false,
+			Message: "Uploaded file does not match the declared size or content type",
+		})
+		return
+	}
+
+	// The declared type is only a hint, the content decides
+	format, inputPath, err := h.verifyObject(ctx, session, info.Size)
+	if err == nil {
+		err = h.media.checkTenantFormat(session.TenantID, format)
+	}
+	if err != nil {
+		services.RemoveSpool(session.MediaID)
+		var rejected *services.ContentError
+		if !errors.As(err, &rejected) {
+			log.Printf("❌ Failed to verify upload: %v", err)
+			c.JSON(http.StatusInternalServerError, models.UploadSessionResponse{
+				Success: false,
+				Message: "Failed to verify upload",
+			})
+			return
+		}
+		log.Printf("❌ Upload %s rejected: %v", session.ID, err)
+		h.media.storage.Delete(ctx, session.StorageKey)
+		session.Status = models.SessionStatusAborted
+		h.sessions.UpdateUploadSession(session)
+		c.JSON(http.StatusBadRequest, models.UploadSessionResponse{
+			Success: false,
+			Message: "File rejected: " + rejected.Reason,
+		})
+		return
+	}
+
+	media := &models.Media{
+		ID:           session.MediaID,
+		TenantID:     session.TenantID,
+		Filename:     session.Filename,
+		OriginalName: session.Filename,
+		MediaType:    format.MediaType,
+		MimeType:     format.MimeType,
+		Size:         info.Size,
+		URL:          h.media.storage.URL(session.StorageKey),
+		StorageKey:   session.StorageKey,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	if !h.media.saveMedia(c, media) {
+		services.RemoveSpool(media.ID)
+		return
+	}
+
+	session.Status = models.SessionStatusCompleted
+	if err := h.sessions.UpdateUploadSession(session); err != nil {
+		log.Printf("⚠️ Failed to update upload session %s: %v", session.ID, err)
+	}
+	log.Printf("✅ Direct upload %s completed as media %s", session.ID, media.ID)
+
+	// Images were not spooled, so the processor downloads the stored original
+	if processingEnabled(media.MediaType) {
+		if _, err := h.media.queue.Enqueue(media.ID, inputPath); err != nil {
+			log.Printf("❌ Failed to create processing job: %v", err)
+			services.RemoveSpool(media.ID)
+			c.JSON(http.StatusInternalServerError, models.UploadSessionResponse{
+				Success: false,
+				Message: "File stored but failed to create processing job",
+				Media:   media,
+			})
+			return
+		}
+		c.JSON(http.StatusAccepted, models.UploadSessionResponse{
+			Success: true,
+			Message: processingMessage(media.MediaType, media.ID),
+			Session: session,
+			Media:   media,
+		})
+		return
+	}
+	services.RemoveSpool(media.ID)
+
+	c.JSON(http.StatusOK, models.UploadSessionResponse{
+		Success: true,
+		Message: "File uploaded successfully",
+		Session: session,
+		Media:   media,
+	})
+}
+
+// AbortSession cancels a pending session and discards what was uploaded
+func (h *UploadSessionHandler) AbortSession(c *gin.Context) {
+	store, ok := h.directStorage(c)
+	if !ok {
+		return
+	}
+	session, ok := h.findSession(c)
+	if !ok {
+		return
+	}
+
+	h.abortMultipart(store, session)
+	if err := h.media.storage.Delete(c.Request.Context(), session.StorageKey); err != nil {
+		log.Printf("⚠️ Failed to delete upload of session %s: %v", session.ID, err)
+	}
+	session.Status = models.SessionStatusAborted
+	if err := h.sessions.UpdateUploadSession(session); err != nil {
+		log.Printf("❌ Failed to update upload session: %v", err)
+		c.JSON(http.StatusInternalServerError, models.UploadSessionResponse{
+			Success: false,
+			Message: "Failed to abort upload session",
+		})
+		return
+	}
+
+	log.Printf("🗑️ Upload session %s aborted", session.ID)
+	c.JSON(http.StatusOK, models.UploadSessionResponse{
+		Success: true,
+		Message: "Upload session aborted",
+	})
+}
+
+// presignParts splits the session into parts of PartSize bytes, the last one
+// holding the rest, and presigns the upload of each
+func (h *UploadSessionHandler) presignParts(ctx context.Context, store services.DirectUploadStorage, session *models.UploadSession) ([]models.PresignedPart, error) {
+	parts := make([]models.PresignedPart, 0, session.PartCount())
+	for number := 1; number <= session.PartCount(); number++ {
+		size := session.PartSize
+		if remaining := session.Size - int64(number-1)*session.PartSize; remaining < size {
+			size = remaining
+		}
+
+		request, err := store.PresignUploadPart(ctx, session.StorageKey, session.MultipartUploadID, number, size, directUploadExpiry())
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, models.PresignedPart{PartNumber: number, Size: size, PresignedRequest: *request})
+	}
+	return parts, nil
+}
+
+func (h *UploadSessionHandler) abortMultipart(store services.DirectUploadStorage, session *models.UploadSession) {
+	if session.MultipartUploadID == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := store.AbortMultipartUpload(ctx, session.StorageKey, session.MultipartUploadID); err != nil {
+		log.Printf("⚠️ %v", err)
+	}
+}
+
+// verifyObject checks the first bytes of the stored upload of a session of
+// size bytes with services.CheckContent. Videos are then downloaded to the
+// spool and checked with FFprobe; the path of that copy is returned so the
+// processor does not download them again.
+func (h *UploadSessionHandler) verifyObject(ctx context.Context, session *models.UploadSession, size int64) (*services.ContentFormat, string, error) {
+	var head []byte
+	if size > 0 {
+		body, _, err := h.media.storage.GetRange(ctx, session.StorageKey, 0, min(size, services.SniffSize))
+		if err != nil {
+			return nil, "", err
+		}
+		defer body.Close()
+		if head, err = io.ReadAll(body); err != nil {
+			return nil, "", fmt.Errorf("failed to read upload: %v", err)
+		}
+	}
+	format, err := services.CheckContent(head)
+	if err != nil || format.MediaType != models.MediaTypeVideo {
+		return format, "", err
+	}
+
+	inputPath, err := services.SpoolObject(ctx, h.media.storage, session.StorageKey, session.MediaID, session.Filename)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to download upload: %v", err)
+	}
+	if format, err = services.VerifyFile(ctx, config.AppConfig.FFprobePath, inputPath); err != nil {
+		return nil, "", err
+	}
+	return format, inputPath, nil
+}
+
+// directStorage returns the storage backend when it supports presigned
+// uploads, answering 501 otherwise
+func (h *UploadSessionHandler) directStorage(c *gin.Context) (services.DirectUploadStorage, bool) {
+	store, ok := h.media.storage.(services.DirectUploadStorage)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, models.UploadSessionResponse{
+			Success: false,
+			Message: "Direct uploads require the S3 storage backend",
+		})
+		return nil, false
+	}
+	return store, true
+}
+
+// findSession loads the pending session named in the URL, answering 404 when
+// it does not exist or belongs to another tenant and 410 when it was completed or aborted. Expiry is
+// enforced by the presigned requests themselves.
+func (h *UploadSessionHandler) findSession(c *gin.Context) (*models.UploadSession, bool) {
+	session, err := h.sessions.GetUploadSession(c.Param("id"))
+	if err == nil && !canReach(c.Request.Context(), session.TenantID) {
+		err = repository.ErrNotFound
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, models.UploadSessionResponse{
+			Success: false,
+			Message: "Upload session not found",
+		})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("❌ Error loading upload session: %v", err)
+		c.JSON(http.StatusInternalServerError, models.UploadSessionResponse{
+			Success: false,
+			Message: "Failed to load upload session",
+		})
+		return nil, false
+	}
+	if session.Status != models.SessionStatusPending {
+		c.JSON(http.StatusGone, models.UploadSessionResponse{
+			Success: false,
+			Message: "Upload session is " + session.Status,
+		})
+		return nil, false
+	}
+	return session, true
+}
+
+func directUploadExpiry() time.Duration {
+	minutes := config.AppConfig.DirectUploadExpiry
+	if minutes <= 0 {
+		minutes = 60
+	}
+	return time.Duration(minutes) * time.Minute
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"api-s3/models"
+	"api-s3/repository"
+	"api-s3/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// WebhookHandler handles webhook subscription HTTP requests
+type WebhookHandler struct {
+	repo repository.WebhookRepository
+}
+
+// NewWebhookHandler creates a new WebhookHandler instance
+func NewWebhookHandler(repo repository.WebhookRepository) *WebhookHandler {
+	return &WebhookHandler{repo: repo}
+}
+
+// CreateWebhook registers a webhook. The signing secret is generated when
+// not provided and is only returned in this response.
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var req models.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.WebhookResponse{
+			Success: false,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	parsed, err := url.Parse(req.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		c.JSON(http.StatusBadRequest, models.WebhookResponse{
+			Success: false,
+			Message: "URL must be an absolute http or https URL",
+		})
+		return
+	}
+
+	events := req.Events
+	if len(events) == 0 {
+		events = models.WebhookEvents
+	}
+	for _, event := range events {
+		if !models.IsWebhookEvent(event) {
+			c.JSON(http.StatusBadRequest, models.WebhookResponse{
+				Success: false,
+				Message: "Unsupported event: " + event,
+			})
+			return
+		}
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		secret, err = services.GenerateWebhookSecret()
+		if err != nil {
+			log.Printf("❌ %v", err)
+			c.JSON(http.StatusInternalServerError, models.WebhookResponse{
+				Success: false,
+				Message: "Failed to create webhook",
+			})
+			return
+		}
+	}
+
+	webhook := &models.Webhook{
+		ID:        uuid.New().String(),
+		URL:       req.URL,
+		Secret:    secret,
+		Events:    events,
+		Active:    true,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := h.repo.SaveWebhook(webhook); err != nil {
+		log.Printf("❌ Error saving webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, models.WebhookResponse{
+			Success: false,
+			Message: "Failed to create webhook",
+		})
+		return
+	}
+
+	log.Printf("🪝 Webhook registered: %s %v", webhook.URL, webhook.Events)
+	c.JSON(http.StatusCreated, models.WebhookResponse{
+		Success: true,
+		Message: "Webhook created successfully",
+		Webhook: webhook,
+	})
+}
+
+// ListWebhooks returns all webhooks without their secrets
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	webhooks, err := h.repo.ListWebhooks()
+	if err != nil {
+		log.Printf("❌ Error listing webhooks: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to list webhooks",
+		})
+		return
+	}
+
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"message":  "Webhooks retrieved successfully",
+		"webhooks": webhooks,
+	})
+}
+
+// GetWebhook returns a single webhook without its secret
+func (h *WebhookHandler) GetWebhook(c *gin.Context) {
+	webhook, ok := h.findWebhook(c)
+	if !ok {
+		return
+	}
+
+	webhook.Secret = ""
+	c.JSON(http.StatusOK, models.WebhookResponse{
+		Success: true,
+		Message: "Webhook retrieved successfully",
+		Webhook: webhook,
+	})
+}
+
+// DeleteWebhook removes a webhook together with its delivery log
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	webhook, ok := h.findWebhook(c)
+	if !ok {
+		return
+	}
+
+	if err := h.repo.DeleteWebhook(webhook.ID); err != nil {
+		log.Printf("❌ Error deleting webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to delete webhook",
+		})
+		return
+	}
+
+	log.Printf("🗑️ Webhook deleted: %s", webhook.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Webhook deleted successfully",
+	})
+}
+
+// ListDeliveries returns the most recent deliveries of a webhook
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	webhook, ok := h.findWebhook(c)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	deliveries, err := h.repo.ListDeliveries(webhook.ID, limit)
+	if err != nil {
+		log.Printf("❌ Error listing webhook deliveries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to list deliveries",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"message":    "Deliveries retrieved successfully",
+		"deliveries": deliveries,
+	})
+}
+
+// findWebhook loads the webhook named in the URL, writing the error response
+// when it cannot be found
+func (h *WebhookHandler) findWebhook(c *gin.Context) (*models.Webhook, bool) {
+	webhook, err := h.repo.GetWebhook(c.Param("id"))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Webhook not found",
+		})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("❌ Error loading webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to load webhook",
+		})
+		return nil, false
+	}
+	return webhook, true
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"api-s3/config"
+	"api-s3/repository"
 	"api-s3/routes"
 	"api-s3/services"
 )
@@ -18,30 +23,89 @@ func main() {
 	config.LoadConfig()
 	log.Println("✅ Configuration loaded successfully")
 
-	// Initialize S3 service with better error handling
-	var s3Service *services.S3Service
-	var videoService *services.VideoService
-	
-	s3Service, err := services.NewS3Service()
+	// Initialize storage backend (S3 or local filesystem)
+	storage, err := services.NewStorage()
+	if err != nil {
+		log.Printf("⚠️  Failed to initialize storage: %v", err)
+		log.Printf("   Falling back to local storage in ./%s", config.AppConfig.LocalStoragePath)
+		storage, err = services.NewLocalStorage(config.AppConfig.LocalStoragePath)
+		if err != nil {
+			log.Fatalf("❌ Failed to initialize local storage: %v", err)
+		}
+	}
+	log.Printf("✅ Storage initialized successfully (%T)", storage)
+
+	// Open the media metadata database
+	repo, err := repository.NewSQLiteRepository(config.AppConfig.DatabasePath)
 	if err != nil {
-		log.Printf("⚠️  Failed to initialize S3 service: %v", err)
-		log.Println("   Running in local mode only")
-		log.Println("   Use /api/v1/upload-local for testing without S3")
-		s3Service = nil
-	} else {
-		log.Println("✅ S3 service initialized successfully")
+		log.Fatalf("❌ Failed to open database: %v", err)
+	}
+	defer repo.Close()
+	log.Printf("✅ Database opened: %s", config.AppConfig.DatabasePath)
+
+	// Register the bootstrap admin key used to create the other API keys
+	if config.AppConfig.AdminAPIKey != "" {
+		if err := services.EnsureAdminAPIKey(repo, config.AppConfig.AdminAPIKey); err != nil {
+			log.Fatalf("❌ Failed to register admin API key: %v", err)
+		}
+	}
+	if !config.AppConfig.AuthEnabled {
+		log.Printf("⚠️  AUTH_ENABLED is false, every endpoint is open without an API key")
+	} else if keys, err := repo.ListAPIKeys(); err == nil && len(keys) == 0 {
+		log.Printf("⚠️  No API keys exist, set ADMIN_API_KEY to create the first one")
+	}
+
+	// Accept JWT bearer tokens from the configured issuer
+	tokens, err := services.NewJWTVerifier()
+	if err != nil {
+		log.Fatalf("❌ Failed to configure JWT authentication: %v", err)
+	}
+	if tokens != nil {
+		if err := tokens.JWKS().Refresh(context.Background()); err != nil {
+			log.Printf("⚠️  %v, retrying on the first token", err)
+		} else {
+			log.Printf("✅ JWT authentication enabled for issuer %s", config.AppConfig.JWTIssuer)
+		}
+	}
+
+	// Signed playback keeps unauthenticated players off the stream endpoints
+	if config.AppConfig.PlaybackSigningKey != "" {
+		log.Printf("✅ Signed playback enabled, tokens valid for %d minutes by default", config.AppConfig.PlaybackTokenTTL)
+		if !config.AppConfig.AuthEnabled {
+			log.Printf("⚠️  AUTH_ENABLED is false, /api/v1/media/:id/stream/:quality stays open without a playback token")
+		}
 	}
 
 	// Initialize video service
-	if s3Service != nil {
-		videoService = services.NewVideoService(s3Service)
-		log.Println("✅ Video service initialized successfully")
-	} else {
-		log.Println("⚠️  Video service disabled (no S3 connection)")
+	videoService := services.NewVideoService(storage)
+	log.Println("✅ Video service initialized successfully")
+
+	// Start the background processing queue, resuming interrupted jobs
+	events := services.NewEventBroker()
+	processor := services.NewMediaProcessor(storage, videoService, repo, events)
+	queue := services.NewJobQueue(repo, processor, events)
+	if err := queue.Start(); err != nil {
+		log.Fatalf("❌ Failed to start job queue: %v", err)
+	}
+	defer queue.Stop()
+
+	// Deliver media events to the registered webhooks
+	dispatcher := services.NewWebhookDispatcher(repo, events)
+	if err := dispatcher.Start(); err != nil {
+		log.Fatalf("❌ Failed to start webhook dispatcher: %v", err)
 	}
+	defer dispatcher.Stop()
+
+	// Keep resumable uploads on disk and expire abandoned ones
+	uploads, err := services.NewTusStore(repo)
+	if err != nil {
+		log.Fatalf("❌ Failed to initialize resumable uploads: %v", err)
+	}
+	uploads.Start()
+	defer uploads.Stop()
 
 	// Setup routes
-	router := routes.SetupRoutes(s3Service, videoService)
+	router := routes.SetupRoutes(storage, videoService, repo, queue, events, uploads, tokens)
 	log.Println("✅ Routes configured successfully")
 
 	// Configure server for large file uploads
@@ -60,16 +124,60 @@ func main() {
 	port := ":" + config.AppConfig.Port
 	log.Printf(" Starting server on port %s", port)
 	log.Printf("📋 API endpoints:")
-	log.Printf("  POST   /api/v1/upload          (requires S3)")
-	log.Printf("  POST   /api/v1/upload-local    (local storage)")
+	log.Printf("  POST   /api/v1/upload")
+	log.Printf("  POST   /api/v1/upload-direct")
+	log.Printf("  POST   /api/v1/upload-large")
+	log.Printf("  POST   /api/v1/upload-stream")
+	log.Printf("  GET    /api/v1/media")
+	log.Printf("  GET    /api/v1/media/:id")
+	log.Printf("  GET    /api/v1/media/:id/progress")
+	log.Printf("  GET    /api/v1/media/:id/events")
 	log.Printf("  DELETE /api/v1/media/:id")
 	log.Printf("  GET    /api/v1/media/:id/stream")
 	log.Printf("  GET    /api/v1/media/:id/stream/:quality")
 	log.Printf("  GET    /api/v1/media/:id/thumbnail")
+	log.Printf("  POST   /api/v1/media/:id/playback")
+	log.Printf("  GET    /api/v1/playback/:token/stream/:quality")
+	log.Printf("  GET    /api/v1/playback/:token/hls/*path")
+	log.Printf("  POST   /api/v1/upload-sessions")
+	log.Printf("  POST   /api/v1/upload-sessions/:id/complete")
+	log.Printf("  DELETE /api/v1/upload-sessions/:id")
+	log.Printf("  POST   /api/v1/files (tus)")
+	log.Printf("  HEAD   /api/v1/files/:id")
+	log.Printf("  PATCH  /api/v1/files/:id")
+	log.Printf("  DELETE /api/v1/files/:id")
+	log.Printf("  POST   /api/v1/webhooks")
+	log.Printf("  GET    /api/v1/webhooks")
+	log.Printf("  GET    /api/v1/webhooks/:id")
+	log.Printf("  DELETE /api/v1/webhooks/:id")
+	log.Printf("  GET    /api/v1/webhooks/:id/deliveries")
+	log.Printf("  POST   /api/v1/admin/keys")
+	log.Printf("  GET    /api/v1/admin/keys")
+	log.Printf("  GET    /api/v1/admin/keys/:id")
+	log.Printf("  POST   /api/v1/admin/keys/:id/rotate")
+	log.Printf("  DELETE /api/v1/admin/keys/:id")
+	log.Printf("  POST   /api/v1/admin/tenants")
+	log.Printf("  GET    /api/v1/admin/tenants")
+	log.Printf("  GET    /api/v1/admin/tenants/:id")
+	log.Printf("  PUT    /api/v1/admin/tenants/:id")
 	log.Printf("  GET    /health")
 	log.Printf("  GET    /")
 
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatalf("❌ Failed to start server: %v", err)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("❌ Failed to start server: %v", err)
+		}
+	}()
+
+	// Shut down gracefully so running jobs are left for the next start to resume
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("🛑 Shutting down server...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("⚠️ Server shutdown error: %v", err)
 	}
 }
\ No newline at end of file
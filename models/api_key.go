@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+)
+
+// API key scopes. Admin manages API keys and webhooks and implies every
+// other scope.
+const (
+	ScopeUpload = "upload"
+	ScopeRead   = "read"
+	ScopeDelete = "delete"
+	ScopeAdmin  = "admin"
+)
+
+// APIKeyScopes lists the scopes an API key can carry
+var APIKeyScopes = []string{ScopeUpload, ScopeRead, ScopeDelete, ScopeAdmin}
+
+// IsAPIKeyScope reports whether scope is a known API key scope
+func IsAPIKeyScope(scope string) bool {
+	for _, known := range APIKeyScopes {
+		if known == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKey is a client credential. Only the SHA-256 hash of the key is stored;
+// the key itself is returned once, when it is created or rotated.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Key        string     `json:"key,omitempty"` // only returned when the key is created or rotated
+	KeyHash    string     `json:"-"`
+	Prefix     string     `json:"prefix"` // start of the key, to recognize it without the secret
+	Scopes     []string   `json:"scopes"`
+	TenantID   string     `json:"tenant_id"` // admin keys reach every tenant
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// HasScope reports whether the key grants scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, granted := range k.Scopes {
+		if granted == scope || granted == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Revoked reports whether the key has been revoked
+func (k *APIKey) Revoked() bool {
+	return k.RevokedAt != nil
+}
+
+type APIKeyRequest struct {
+	Name     string   `json:"name" binding:"required"`
+	Scopes   []string `json:"scopes" binding:"required"`
+	TenantID string   `json:"tenant_id"` // default: the default tenant
+}
+
+type APIKeyResponse struct {
+	Success bool    `json:"success"`
+	Message string  `json:"message"`
+	APIKey  *APIKey `json:"api_key,omitempty"`
+}
@@ -14,7 +14,28 @@ const (
 type VideoQuality string
 
 const (
-	QualityBest VideoQuality = "best_quality"
+	QualityAuto  VideoQuality = "auto" // highest available quality
+	QualityBest  VideoQuality = "best_quality"
+	Quality240p  VideoQuality = "240p"
+	Quality360p  VideoQuality = "360p"
+	Quality480p  VideoQuality = "480p"
+	Quality720p  VideoQuality = "720p"
+	Quality1080p VideoQuality = "1080p"
+)
+
+// ThumbnailSize names one of the poster sizes generated for a video
+type ThumbnailSize string
+
+const (
+	ThumbnailSmall  ThumbnailSize = "small"
+	ThumbnailMedium ThumbnailSize = "medium"
+	ThumbnailLarge  ThumbnailSize = "large"
+)
+
+// Variant formats
+const (
+	FormatHLS = "hls" // URL points to a rendition playlist
+	FormatMP4 = "mp4" // URL points to a progressive MP4 file
 )
 
 type Media struct {
@@ -25,10 +46,19 @@ type Media struct {
 	MimeType    string      `json:"mime_type"`
 	Size        int64       `json:"size"`
 	URL         string      `json:"url"`
+	StorageKey  string      `json:"storage_key,omitempty"`
 	ThumbnailURL string     `json:"thumbnail_url,omitempty"`
+	MasterURL   string      `json:"master_url,omitempty"`
+	DashURL     string      `json:"dash_url,omitempty"`
 	Duration    float64     `json:"duration,omitempty"`
 	Width       int         `json:"width,omitempty"`
 	Height      int         `json:"height,omitempty"`
+	Probe       *MediaProbe `json:"probe,omitempty"` // container and stream details, set once processed
+	Thumbnails  []Thumbnail `json:"thumbnails,omitempty"`
+	Trickplay   *Trickplay  `json:"trickplay,omitempty"` // scrub bar previews
+	Preview     *Preview    `json:"preview,omitempty"`   // silent animated hover preview
+	APIKeyID    string      `json:"api_key_id,omitempty"` // API key that uploaded the media
+	TenantID    string      `json:"tenant_id"`
 	CreatedAt   time.Time   `json:"created_at"`
 	UpdatedAt   time.Time   `json:"updated_at"`
 }
@@ -37,14 +67,64 @@ type VideoVariant struct {
 	ID          string      `json:"id"`
 	MediaID     string      `json:"media_id"`
 	Quality     VideoQuality `json:"quality"`
+	Format      string      `json:"format,omitempty"`
 	Width       int         `json:"width"`
 	Height      int         `json:"height"`
 	Bitrate     int         `json:"bitrate"`
 	URL         string      `json:"url"`
+	StorageKey  string      `json:"storage_key,omitempty"`
 	Size        int64       `json:"size"`
 	CreatedAt   time.Time   `json:"created_at"`
 }
 
+// Thumbnail is a poster image captured from a video
+type Thumbnail struct {
+	Size       ThumbnailSize `json:"size"`
+	Width      int           `json:"width"`
+	Height     int           `json:"height"`
+	URL        string        `json:"url"`
+	StorageKey string        `json:"storage_key,omitempty"`
+}
+
+// Trickplay describes the sprite sheets of scrub bar previews and the WebVTT
+// track mapping every interval of the video to a tile
+type Trickplay struct {
+	VTTURL     string   `json:"vtt_url"`
+	SpriteURLs []string `json:"sprite_urls"`
+	Format     string   `json:"format"`   // jpg or webp
+	Interval   int      `json:"interval"` // seconds covered by each tile
+	TileWidth  int      `json:"tile_width"`
+	TileHeight int      `json:"tile_height"`
+	Columns    int      `json:"columns"`
+	Rows       int      `json:"rows"`
+	Count      int      `json:"count"` // tiles over all sheets
+}
+
+// Preview is a short, silent, low resolution animated clip of a video, cut
+// from evenly spaced segments
+type Preview struct {
+	URL        string  `json:"url"`
+	StorageKey string  `json:"storage_key,omitempty"`
+	Format     string  `json:"format"` // mp4, webp or gif
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	Duration   float64 `json:"duration"`
+	Segments   int     `json:"segments"`
+}
+
+// ImageVariant is a resized copy of an uploaded image in a web format
+type ImageVariant struct {
+	ID         string    `json:"id"`
+	MediaID    string    `json:"media_id"`
+	Format     string    `json:"format"` // webp, avif or jpg
+	Width      int       `json:"width"`
+	Height     int       `json:"height"`
+	URL        string    `json:"url"`
+	StorageKey string    `json:"storage_key,omitempty"`
+	Size       int64     `json:"size"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
 type UploadResponse struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
@@ -61,13 +141,72 @@ type VideoStreamResponse struct {
 	Message string         `json:"message"`
 	Variants []VideoVariant `json:"variants,omitempty"`
 	MasterURL string       `json:"master_url,omitempty"`
+	DashURL  string         `json:"dash_url,omitempty"`
+	Trickplay *Trickplay    `json:"trickplay,omitempty"`
 }
 
+// Video processing job statuses
+const (
+	JobStatusPending    = "pending"
+	JobStatusProcessing = "processing"
+	JobStatusCompleted  = "completed"
+	JobStatusFailed     = "failed"
+)
+
+// Video processing job stages, reported while a job is processing
+const (
+	JobStageProbing    = "probing"
+	JobStageConverting = "converting"
+	JobStageUploading  = "uploading"
+	JobStageHLS        = "hls"
+	JobStageDASH       = "dash"
+	JobStageTrickplay  = "trickplay"
+	JobStagePreview    = "preview"
+	JobStageImages     = "images" // image variants being encoded
+)
+
+// How a job turned the upload into the playable MP4
+const (
+	ProcessingModePassthrough = "passthrough" // stored as uploaded
+	ProcessingModeRemux       = "remux"       // streams copied into a faststart MP4
+	ProcessingModeTranscode   = "transcode"   // video and/or audio re-encoded
+)
+
 type VideoProcessingJob struct {
-	ID        string    `json:"id"`
-	MediaID   string    `json:"media_id"`
-	Status    string    `json:"status"` // pending, processing, completed, failed
-	Progress  int       `json:"progress"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-} 
\ No newline at end of file
+	ID          string    `json:"id"`
+	MediaID     string    `json:"media_id"`
+	Status      string    `json:"status"` // pending, processing, completed, failed
+	Progress    int       `json:"progress"`
+	Stage       string    `json:"stage,omitempty"`
+	ETASeconds  int       `json:"eta_seconds,omitempty"`
+	ProcessingMode   string `json:"processing_mode,omitempty"` // passthrough, remux, transcode
+	ProcessingReason string `json:"processing_reason,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Attempts    int       `json:"attempts"`
+	MaxAttempts int       `json:"max_attempts"`
+	InputPath   string    `json:"-"` // spooled upload the job reads from
+	NextRunAt   time.Time `json:"next_run_at,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+} 
+
+// Media event types, streamed to clients and delivered to webhooks
+const (
+	EventMediaUploaded       = "media.uploaded"
+	EventProcessingQueued    = "media.processing.queued"
+	EventProcessingStarted   = "media.processing.started"
+	EventProcessingProgress  = "media.processing.progress"
+	EventProcessingRetrying  = "media.processing.retrying"
+	EventProcessingCompleted = "media.processing.completed"
+	EventProcessingFailed    = "media.processing.failed"
+	EventMediaDeleted        = "media.deleted"
+)
+
+// MediaEvent describes a state transition of a media item or its processing job
+type MediaEvent struct {
+	Type      string              `json:"type"`
+	MediaID   string              `json:"media_id"`
+	Media     *Media              `json:"media,omitempty"`
+	Job       *VideoProcessingJob `json:"job,omitempty"`
+	Timestamp time.Time           `json:"timestamp"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+)
+
+// PlaybackClaims is what a signed playback token grants: streaming one media
+// item until it expires, optionally only from one IP address and in some
+// renditions
+type PlaybackClaims struct {
+	MediaID    string   `json:"mid"`
+	ExpiresAt  int64    `json:"exp"`          // unix seconds
+	IP         string   `json:"ip,omitempty"` // client IP the token is bound to
+	Renditions []string `json:"r,omitempty"`  // qualities that may be played, empty for all
+}
+
+// AllowsRendition reports whether the token may play quality. The uploaded
+// original is only served by tokens not restricted to renditions.
+func (p *PlaybackClaims) AllowsRendition(quality VideoQuality) bool {
+	if len(p.Renditions) == 0 {
+		return true
+	}
+	for _, allowed := range p.Renditions {
+		if allowed == string(quality) {
+			return true
+		}
+	}
+	return false
+}
+
+type PlaybackRequest struct {
+	ExpiresIn  int      `json:"expires_in"` // seconds, default: PLAYBACK_TOKEN_TTL
+	BindIP     bool     `json:"bind_ip"`    // only accept the token from the requesting IP
+	Renditions []string `json:"renditions"` // default: every rendition and the original
+}
+
+type PlaybackResponse struct {
+	Success      bool      `json:"success"`
+	Message      string    `json:"message"`
+	Token        string    `json:"token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitempty"`
+	StreamURL    string    `json:"stream_url,omitempty"` // append the quality, e.g. /720p
+	HLSURL       string    `json:"hls_url,omitempty"`
+	DashURL      string    `json:"dash_url,omitempty"`
+	TrickplayURL string    `json:"trickplay_url,omitempty"` // WebVTT track of the sprite sheets
+	PreviewURL   string    `json:"preview_url,omitempty"`
+}
@@ -0,0 +1,75 @@
+package models
+
+// Stream types reported by the media probe
+const (
+	StreamTypeVideo    = "video"
+	StreamTypeAudio    = "audio"
+	StreamTypeSubtitle = "subtitle"
+	StreamTypeData     = "data"
+)
+
+// MediaProbe describes the container and every stream of a media file, as
+// reported by ffprobe
+type MediaProbe struct {
+	FormatName     string            `json:"format_name"`
+	FormatLongName string            `json:"format_long_name,omitempty"`
+	Duration       float64           `json:"duration,omitempty"` // seconds
+	Bitrate        int64             `json:"bitrate,omitempty"`  // bits per second
+	Size           int64             `json:"size,omitempty"`
+	Tags           map[string]string `json:"tags,omitempty"`
+	Streams        []ProbeStream     `json:"streams"`
+}
+
+// ProbeStream describes a single stream of a media file. Video fields are
+// only set on video streams and audio fields only on audio streams.
+type ProbeStream struct {
+	Index         int               `json:"index"`
+	Type          string            `json:"type"` // video, audio, subtitle, data
+	Codec         string            `json:"codec"`
+	CodecLongName string            `json:"codec_long_name,omitempty"`
+	Profile       string            `json:"profile,omitempty"`
+	Bitrate       int64             `json:"bitrate,omitempty"`
+	Duration      float64           `json:"duration,omitempty"`
+	Language      string            `json:"language,omitempty"`
+	Default       bool              `json:"default,omitempty"`
+	AttachedPic   bool              `json:"attached_pic,omitempty"` // cover art, not a playable video
+	Tags          map[string]string `json:"tags,omitempty"`
+
+	// Video
+	Width          int     `json:"width,omitempty"`
+	Height         int     `json:"height,omitempty"`
+	PixelFormat    string  `json:"pixel_format,omitempty"`
+	FrameRate      float64 `json:"frame_rate,omitempty"`
+	Rotation       int     `json:"rotation,omitempty"` // degrees, as the player must rotate the picture
+	ColorPrimaries string  `json:"color_primaries,omitempty"`
+	ColorTransfer  string  `json:"color_transfer,omitempty"`
+	ColorSpace     string  `json:"color_space,omitempty"`
+	ColorRange     string  `json:"color_range,omitempty"`
+	HDR            bool    `json:"hdr,omitempty"`
+
+	// Audio
+	Channels      int    `json:"channels,omitempty"`
+	ChannelLayout string `json:"channel_layout,omitempty"`
+	SampleRate    int    `json:"sample_rate,omitempty"`
+}
+
+// VideoStream returns the first video stream that is not cover art, or nil
+// for audio only files
+func (p *MediaProbe) VideoStream() *ProbeStream {
+	for i := range p.Streams {
+		if p.Streams[i].Type == StreamTypeVideo && !p.Streams[i].AttachedPic {
+			return &p.Streams[i]
+		}
+	}
+	return nil
+}
+
+// AudioStream returns the first audio stream, or nil for silent files
+func (p *MediaProbe) AudioStream() *ProbeStream {
+	for i := range p.Streams {
+		if p.Streams[i].Type == StreamTypeAudio {
+			return &p.Streams[i]
+		}
+	}
+	return nil
+}
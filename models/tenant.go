@@ -0,0 +1,74 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultTenantID owns media uploaded before tenants existed and every
+// upload made without a tenant
+const DefaultTenantID = "default"
+
+// tenantIDPattern keeps tenant IDs safe to use in storage keys
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// IsTenantID reports whether id is a valid tenant ID
+func IsTenantID(id string) bool {
+	return tenantIDPattern.MatchString(id)
+}
+
+// Tenant is a customer whose media are stored under their own prefix and
+// are only visible to their own API keys and tokens. Unset limits fall back
+// to the server configuration.
+type Tenant struct {
+	ID                string          `json:"id"`
+	Name              string          `json:"name"`
+	MaxFileSize       int64           `json:"max_file_size"`      // bytes, 0 for the server limits
+	AllowedContainers []string        `json:"allowed_containers"` // empty for ALLOWED_CONTAINERS
+	EncodingProfile   EncodingProfile `json:"encoding_profile"`
+	CreatedAt         time.Time       `json:"created_at"`
+	UpdatedAt         time.Time       `json:"updated_at"`
+}
+
+// EncodingProfile overrides how the videos of a tenant are encoded
+type EncodingProfile struct {
+	Renditions []string `json:"renditions"` // HLS and DASH ladder, empty for HLS_RENDITIONS
+}
+
+// SizeLimit returns the largest upload the tenant may send to an endpoint
+// accepting up to limit bytes
+func (t *Tenant) SizeLimit(limit int64) int64 {
+	if t.MaxFileSize > 0 && t.MaxFileSize < limit {
+		return t.MaxFileSize
+	}
+	return limit
+}
+
+// AllowsContainer reports whether the tenant accepts uploads in container,
+// ignoring case
+func (t *Tenant) AllowsContainer(container string) bool {
+	if len(t.AllowedContainers) == 0 {
+		return true
+	}
+	for _, allowed := range t.AllowedContainers {
+		if strings.EqualFold(allowed, container) {
+			return true
+		}
+	}
+	return false
+}
+
+type TenantRequest struct {
+	ID                string          `json:"id"` // only read when creating a tenant
+	Name              string          `json:"name" binding:"required"`
+	MaxFileSize       int64           `json:"max_file_size"`
+	AllowedContainers []string        `json:"allowed_containers"`
+	EncodingProfile   EncodingProfile `json:"encoding_profile"`
+}
+
+type TenantResponse struct {
+	Success bool    `json:"success"`
+	Message string  `json:"message"`
+	Tenant  *Tenant `json:"tenant,omitempty"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// TokenClaims is what a verified JWT bearer token grants
+type TokenClaims struct {
+	Subject   string
+	TenantID  string
+	Scopes    []string // permissions mapped from the token scopes: upload, read, delete
+	ExpiresAt time.Time
+}
+
+// HasScope reports whether the token grants scope
+func (t *TokenClaims) HasScope(scope string) bool {
+	for _, granted := range t.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// Upload is a resumable (tus) upload. The received bytes are kept on disk
+// until the upload is complete and handed to the media pipeline.
+type Upload struct {
+	ID        string    `json:"id"`
+	Filename  string    `json:"filename"`
+	MimeType  string    `json:"mime_type"`
+	MediaType MediaType `json:"media_type"`
+	Length    int64     `json:"length"`
+	Offset    int64     `json:"offset"`
+	Metadata  string    `json:"metadata"`           // raw Upload-Metadata header
+	MediaID   string    `json:"media_id,omitempty"` // set once the media record is created
+	TenantID  string    `json:"tenant_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Complete reports whether every byte of the upload has been received
+func (u *Upload) Complete() bool {
+	return u.Offset >= u.Length
+}
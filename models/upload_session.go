@@ -0,0 +1,96 @@
+package models
+
+import (
+	"time"
+)
+
+// Direct upload methods
+const (
+	UploadMethodPut       = "put"
+	UploadMethodPost      = "post"
+	UploadMethodMultipart = "multipart"
+)
+
+// Upload session statuses
+const (
+	SessionStatusPending   = "pending"
+	SessionStatusCompleted = "completed"
+	SessionStatusAborted   = "aborted"
+)
+
+// UploadSession is a direct upload from the client to the storage backend
+// through presigned requests. The media record is only created once the
+// client reports the upload complete and the object has been verified.
+type UploadSession struct {
+	ID                string    `json:"id"`
+	MediaID           string    `json:"media_id"`
+	Method            string    `json:"method"` // put, post, multipart
+	Status            string    `json:"status"` // pending, completed, aborted
+	Filename          string    `json:"filename"`
+	MimeType          string    `json:"mime_type"`
+	MediaType         MediaType `json:"media_type"`
+	Size              int64     `json:"size"`
+	PartSize          int64     `json:"part_size,omitempty"`
+	StorageKey        string    `json:"-"`
+	MultipartUploadID string    `json:"-"`
+	TenantID          string    `json:"tenant_id"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// PartCount returns the number of parts of a multipart session
+func (s *UploadSession) PartCount() int {
+	if s.PartSize <= 0 {
+		return 1
+	}
+	return int((s.Size + s.PartSize - 1) / s.PartSize)
+}
+
+// PresignedRequest is a request the client sends as is: the signature only
+// holds when every listed header is sent with the given value
+type PresignedRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// PresignedPost is a browser form upload: fields are sent before the file
+type PresignedPost struct {
+	URL    string            `json:"url"`
+	Fields map[string]string `json:"fields"`
+}
+
+// PresignedPart is the presigned request uploading one part of a multipart session
+type PresignedPart struct {
+	PartNumber int   `json:"part_number"`
+	Size       int64 `json:"size"`
+	PresignedRequest
+}
+
+// CompletedPart identifies an uploaded part by the ETag storage returned for it
+type CompletedPart struct {
+	PartNumber int    `json:"part_number"`
+	ETag       string `json:"etag"`
+}
+
+type UploadSessionRequest struct {
+	Filename    string `json:"filename" binding:"required"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size" binding:"required"`
+	Method      string `json:"method"` // default: multipart for files larger than one part, put otherwise
+}
+
+type CompleteUploadRequest struct {
+	Parts []CompletedPart `json:"parts"` // multipart sessions only
+}
+
+type UploadSessionResponse struct {
+	Success bool              `json:"success"`
+	Message string            `json:"message"`
+	Session *UploadSession    `json:"session,omitempty"`
+	Put     *PresignedRequest `json:"put,omitempty"`
+	Post    *PresignedPost    `json:"post,omitempty"`
+	Parts   []PresignedPart   `json:"parts,omitempty"`
+	Media   *Media            `json:"media,omitempty"`
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"time"
+)
+
+// Webhook delivery statuses
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusSucceeded = "succeeded"
+	DeliveryStatusFailed    = "failed"
+)
+
+// WebhookEvents lists the media events that can be delivered to webhooks
+var WebhookEvents = []string{
+	EventMediaUploaded,
+	EventProcessingCompleted,
+	EventProcessingFailed,
+	EventMediaDeleted,
+}
+
+// IsWebhookEvent reports whether events of the given type can be delivered
+func IsWebhookEvent(eventType string) bool {
+	for _, event := range WebhookEvents {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"` // only returned when the webhook is created
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Subscribes reports whether the webhook wants events of the given type
+func (w *Webhook) Subscribes(eventType string) bool {
+	if !w.Active {
+		return false
+	}
+	for _, event := range w.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type WebhookDelivery struct {
+	ID             string    `json:"id"`
+	WebhookID      string    `json:"webhook_id"`
+	EventType      string    `json:"event_type"`
+	MediaID        string    `json:"media_id"`
+	Payload        string    `json:"payload"`
+	Status         string    `json:"status"` // pending, succeeded, failed
+	Attempts       int       `json:"attempts"`
+	MaxAttempts    int       `json:"max_attempts"`
+	ResponseStatus int       `json:"response_status,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	NextAttemptAt  time.Time `json:"next_attempt_at"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type WebhookRequest struct {
+	URL    string   `json:"url" binding:"required"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+type WebhookResponse struct {
+	Success bool     `json:"success"`
+	Message string   `json:"message"`
+	Webhook *Webhook `json:"webhook,omitempty"`
+}
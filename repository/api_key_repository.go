@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"time"
+
+	"api-s3/models"
+)
+
+// APIKeyRepository persists API keys by the hash of their secret
+type APIKeyRepository interface {
+	CreateAPIKey(key *models.APIKey) error
+	// UpdateAPIKey saves the name, hash, prefix, scopes and revocation of a key
+	UpdateAPIKey(key *models.APIKey) error
+	GetAPIKey(id string) (*models.APIKey, error)
+	// GetAPIKeyByHash returns the key with the given hash, revoked or not
+	GetAPIKeyByHash(hash string) (*models.APIKey, error)
+	ListAPIKeys() ([]models.APIKey, error)
+	// TouchAPIKey records when a key was last used
+	TouchAPIKey(id string, usedAt time.Time) error
+}
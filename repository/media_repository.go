@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"errors"
+
+	"api-s3/models"
+)
+
+// ErrNotFound is returned when a record does not exist
+var ErrNotFound = errors.New("record not found")
+
+// MediaRepository persists media metadata, their variants and processing
+// jobs, and the tenants owning the media
+type MediaRepository interface {
+	TenantRepository
+
+	CreateMedia(media *models.Media) error
+	UpdateMedia(media *models.Media) error
+	GetMedia(id string) (*models.Media, error)
+	// ListMedia lists the media of a tenant, or of every tenant when tenantID is empty
+	ListMedia(tenantID string, limit, offset int) ([]models.Media, error)
+	// DeleteMedia removes the media together with its variants and jobs
+	DeleteMedia(id string) error
+
+	// SaveVariants replaces every variant of a media item
+	SaveVariants(mediaID string, variants []models.VideoVariant) error
+	GetVariants(mediaID string) ([]models.VideoVariant, error)
+	// SaveImageVariants replaces every image variant of a media item
+	SaveImageVariants(mediaID string, variants []models.ImageVariant) error
+	GetImageVariants(mediaID string) ([]models.ImageVariant, error)
+
+	CreateJob(job *models.VideoProcessingJob) error
+	UpdateJob(job *models.VideoProcessingJob) error
+	GetJob(id string) (*models.VideoProcessingJob, error)
+	// GetLatestJob returns the most recently created job of a media item
+	GetLatestJob(mediaID string) (*models.VideoProcessingJob, error)
+	// ClaimNextJob atomically moves the oldest due pending job to processing
+	// and counts the attempt. ErrNotFound means nothing is due.
+	ClaimNextJob() (*models.VideoProcessingJob, error)
+	// RequeueInterruptedJobs puts jobs left in processing by a previous run
+	// back in the queue and returns how many were found
+	RequeueInterruptedJobs() (int, error)
+
+	Close() error
+}
+
+// Repository is implemented by stores holding every kind of record
+type Repository interface {
+	MediaRepository
+	WebhookRepository
+	UploadRepository
+	UploadSessionRepository
+	APIKeyRepository
+}
@@ -0,0 +1,658 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"api-s3/models"
+
+	_ "modernc.org/sqlite"
+)
+
+// migrations are applied in order; the index of the last applied migration is
+// tracked in PRAGMA user_version. Only ever append to this list.
+var migrations = []string{
+	`CREATE TABLE media (
+		id            TEXT PRIMARY KEY,
+		filename      TEXT NOT NULL,
+		original_name TEXT NOT NULL,
+		media_type    TEXT NOT NULL,
+		mime_type     TEXT NOT NULL,
+		size          INTEGER NOT NULL DEFAULT 0,
+		url           TEXT NOT NULL DEFAULT '',
+		storage_key   TEXT NOT NULL DEFAULT '',
+		thumbnail_url TEXT NOT NULL DEFAULT '',
+		master_url    TEXT NOT NULL DEFAULT '',
+		dash_url      TEXT NOT NULL DEFAULT '',
+		duration      REAL NOT NULL DEFAULT 0,
+		width         INTEGER NOT NULL DEFAULT 0,
+		height        INTEGER NOT NULL DEFAULT 0,
+		created_at    TEXT NOT NULL,
+		updated_at    TEXT NOT NULL
+	)`,
+	`CREATE TABLE video_variants (
+		id          TEXT PRIMARY KEY,
+		media_id    TEXT NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+		quality     TEXT NOT NULL,
+		format      TEXT NOT NULL DEFAULT '',
+		width       INTEGER NOT NULL DEFAULT 0,
+		height      INTEGER NOT NULL DEFAULT 0,
+		bitrate     INTEGER NOT NULL DEFAULT 0,
+		url         TEXT NOT NULL DEFAULT '',
+		storage_key TEXT NOT NULL DEFAULT '',
+		size        INTEGER NOT NULL DEFAULT 0,
+		created_at  TEXT NOT NULL
+	)`,
+	`CREATE INDEX idx_video_variants_media ON video_variants(media_id)`,
+	`CREATE TABLE video_processing_jobs (
+		id         TEXT PRIMARY KEY,
+		media_id   TEXT NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+		status     TEXT NOT NULL,
+		progress   INTEGER NOT NULL DEFAULT 0,
+		error      TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	)`,
+	`CREATE INDEX idx_video_processing_jobs_media ON video_processing_jobs(media_id, created_at)`,
+	`ALTER TABLE video_processing_jobs ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE video_processing_jobs ADD COLUMN max_attempts INTEGER NOT NULL DEFAULT 1`,
+	`ALTER TABLE video_processing_jobs ADD COLUMN input_path TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE video_processing_jobs ADD COLUMN next_run_at TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX idx_video_processing_jobs_queue ON video_processing_jobs(status, next_run_at)`,
+	`ALTER TABLE video_processing_jobs ADD COLUMN stage TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE video_processing_jobs ADD COLUMN eta_seconds INTEGER NOT NULL DEFAULT 0`,
+	`CREATE TABLE webhooks (
+		id         TEXT PRIMARY KEY,
+		url        TEXT NOT NULL,
+		secret     TEXT NOT NULL,
+		events     TEXT NOT NULL DEFAULT '',
+		active     INTEGER NOT NULL DEFAULT 1,
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	)`,
+	`CREATE TABLE webhook_deliveries (
+		id              TEXT PRIMARY KEY,
+		webhook_id      TEXT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+		event_type      TEXT NOT NULL,
+		media_id        TEXT NOT NULL DEFAULT '',
+		payload         TEXT NOT NULL,
+		status          TEXT NOT NULL,
+		attempts        INTEGER NOT NULL DEFAULT 0,
+		max_attempts    INTEGER NOT NULL DEFAULT 1,
+		response_status INTEGER NOT NULL DEFAULT 0,
+		error           TEXT NOT NULL DEFAULT '',
+		next_attempt_at TEXT NOT NULL,
+		created_at      TEXT NOT NULL,
+		updated_at      TEXT NOT NULL
+	)`,
+	`CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at)`,
+	`CREATE INDEX idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, created_at)`,
+	`CREATE TABLE uploads (
+		id             TEXT PRIMARY KEY,
+		filename       TEXT NOT NULL,
+		mime_type      TEXT NOT NULL DEFAULT '',
+		media_type     TEXT NOT NULL,
+		length         INTEGER NOT NULL,
+		bytes_received INTEGER NOT NULL DEFAULT 0,
+		metadata       TEXT NOT NULL DEFAULT '',
+		media_id       TEXT NOT NULL DEFAULT '',
+		expires_at     TEXT NOT NULL,
+		created_at     TEXT NOT NULL,
+		updated_at     TEXT NOT NULL
+	)`,
+	`CREATE INDEX idx_uploads_expires ON uploads(expires_at)`,
+	`CREATE TABLE upload_sessions (
+		id                  TEXT PRIMARY KEY,
+		media_id            TEXT NOT NULL,
+		method              TEXT NOT NULL,
+		status              TEXT NOT NULL,
+		filename            TEXT NOT NULL,
+		mime_type           TEXT NOT NULL DEFAULT '',
+		media_type          TEXT NOT NULL,
+		size                INTEGER NOT NULL,
+		part_size           INTEGER NOT NULL DEFAULT 0,
+		storage_key         TEXT NOT NULL,
+		multipart_upload_id TEXT NOT NULL DEFAULT '',
+		expires_at          TEXT NOT NULL,
+		created_at          TEXT NOT NULL,
+		updated_at          TEXT NOT NULL
+	)`,
+	`ALTER TABLE media ADD COLUMN probe TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE video_processing_jobs ADD COLUMN processing_mode TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE video_processing_jobs ADD COLUMN processing_reason TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE media ADD COLUMN thumbnails TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE media ADD COLUMN trickplay TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE media ADD COLUMN preview TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE image_variants (
+		id          TEXT PRIMARY KEY,
+		media_id    TEXT NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+		format      TEXT NOT NULL,
+		width       INTEGER NOT NULL DEFAULT 0,
+		height      INTEGER NOT NULL DEFAULT 0,
+		url         TEXT NOT NULL DEFAULT '',
+		storage_key TEXT NOT NULL DEFAULT '',
+		size        INTEGER NOT NULL DEFAULT 0,
+		created_at  TEXT NOT NULL
+	)`,
+	`CREATE INDEX idx_image_variants_media ON image_variants(media_id)`,
+	`CREATE TABLE api_keys (
+		id           TEXT PRIMARY KEY,
+		name         TEXT NOT NULL,
+		key_hash     TEXT NOT NULL UNIQUE,
+		prefix       TEXT NOT NULL,
+		scopes       TEXT NOT NULL DEFAULT '',
+		last_used_at TEXT NOT NULL DEFAULT '',
+		revoked_at   TEXT NOT NULL DEFAULT '',
+		created_at   TEXT NOT NULL,
+		updated_at   TEXT NOT NULL
+	)`,
+	`ALTER TABLE media ADD COLUMN api_key_id TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE tenants (
+		id                 TEXT PRIMARY KEY,
+		name               TEXT NOT NULL,
+		max_file_size      INTEGER NOT NULL DEFAULT 0,
+		allowed_containers TEXT NOT NULL DEFAULT '',
+		renditions         TEXT NOT NULL DEFAULT '',
+		created_at         TEXT NOT NULL,
+		updated_at         TEXT NOT NULL
+	)`,
+	`INSERT INTO tenants (id, name, created_at, updated_at) VALUES ('default', 'Default',
+		strftime('%Y-%m-%dT%H:%M:%S.000000000Z', 'now'), strftime('%Y-%m-%dT%H:%M:%S.000000000Z', 'now'))`,
+	`ALTER TABLE media ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default'`,
+	`CREATE INDEX idx_media_tenant ON media(tenant_id, created_at)`,
+	`ALTER TABLE api_keys ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default'`,
+	`ALTER TABLE uploads ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default'`,
+	`ALTER TABLE upload_sessions ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default'`,
+}
+
+// SQLiteRepository is the default MediaRepository, backed by an embedded
+// SQLite database file
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteRepository opens (or creates) the database at path and brings the
+// schema up to date
+func NewSQLiteRepository(path string) (*SQLiteRepository, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create database directory: %v", err)
+		}
+	}
+
+	dsn := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	// SQLite allows a single writer; one connection avoids "database is locked"
+	db.SetMaxOpenConns(1)
+
+	repo := &SQLiteRepository{db: db}
+	if err := repo.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (r *SQLiteRepository) migrate() error {
+	var version int
+	if err := r.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %v", err)
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := r.db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to start migration: %v", err)
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %v", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %v", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %v", i+1, err)
+		}
+	}
+
+	if version < len(migrations) {
+		log.Printf("🗄️ Database schema migrated from version %d to %d", version, len(migrations))
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) Close() error {
+	return r.db.Close()
+}
+
+const mediaColumns = `id, filename, original_name, media_type, mime_type, size, url, storage_key,
+	thumbnail_url, master_url, dash_url, duration, width, height, probe, thumbnails, trickplay, preview, api_key_id,
+	tenant_id, created_at, updated_at`
+
+func (r *SQLiteRepository) CreateMedia(media *models.Media) error {
+	// Callers unaware of tenants create media of the default tenant
+	if media.TenantID == "" {
+		media.TenantID = models.DefaultTenantID
+	}
+	_, err := r.db.Exec(`INSERT INTO media (`+mediaColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		media.ID, media.Filename, media.OriginalName, string(media.MediaType), media.MimeType,
+		media.Size, media.URL, media.StorageKey, media.ThumbnailURL, media.MasterURL, media.DashURL,
+		media.Duration, media.Width, media.Height, encodeProbe(media.Probe), encodeThumbnails(media.Thumbnails),
+		encodeTrickplay(media.Trickplay), encodePreview(media.Preview), media.APIKeyID,
+		media.TenantID, formatTime(media.CreatedAt), formatTime(media.UpdatedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create media: %v", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) UpdateMedia(media *models.Media) error {
+	media.UpdatedAt = time.Now()
+	result, err := r.db.Exec(`UPDATE media SET filename = ?, original_name = ?, media_type = ?,
+		mime_type = ?, size = ?, url = ?, storage_key = ?, thumbnail_url = ?, master_url = ?,
+		dash_url = ?, duration = ?, width = ?, height = ?, probe = ?, thumbnails = ?, trickplay = ?,
+		preview = ?, updated_at = ?
+		WHERE id = ?`,
+		media.Filename, media.OriginalName, string(media.MediaType), media.MimeType, media.Size,
+		media.URL, media.StorageKey, media.ThumbnailURL, media.MasterURL, media.DashURL,
+		media.Duration, media.Width, media.Height, encodeProbe(media.Probe), encodeThumbnails(media.Thumbnails),
+		encodeTrickplay(media.Trickplay), encodePreview(media.Preview), formatTime(media.UpdatedAt), media.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update media: %v", err)
+	}
+	return expectAffected(result)
+}
+
+func (r *SQLiteRepository) GetMedia(id string) (*models.Media, error) {
+	row := r.db.QueryRow(`SELECT `+mediaColumns+` FROM media WHERE id = ?`, id)
+	media, err := scanMedia(row)
+	if err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+func (r *SQLiteRepository) ListMedia(tenantID string, limit, offset int) ([]models.Media, error) {
+	rows, err := r.db.Query(`SELECT `+mediaColumns+` FROM media WHERE ? = '' OR tenant_id = ?
+		ORDER BY created_at DESC LIMIT ? OFFSET ?`, tenantID, tenantID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list media: %v", err)
+	}
+	defer rows.Close()
+
+	list := []models.Media{}
+	for rows.Next() {
+		media, err := scanMedia(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *media)
+	}
+	return list, rows.Err()
+}
+
+func (r *SQLiteRepository) DeleteMedia(id string) error {
+	result, err := r.db.Exec(`DELETE FROM media WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete media: %v", err)
+	}
+	return expectAffected(result)
+}
+
+func (r *SQLiteRepository) SaveVariants(mediaID string, variants []models.VideoVariant) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM video_variants WHERE media_id = ?`, mediaID); err != nil {
+		return fmt.Errorf("failed to clear variants: %v", err)
+	}
+
+	for _, variant := range variants {
+		_, err := tx.Exec(`INSERT INTO video_variants (id, media_id, quality, format, width, height,
+			bitrate, url, storage_key, size, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			variant.ID, mediaID, string(variant.Quality), variant.Format, variant.Width, variant.Height,
+			variant.Bitrate, variant.URL, variant.StorageKey, variant.Size, formatTime(variant.CreatedAt),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save variant %s: %v", variant.Quality, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *SQLiteRepository) GetVariants(mediaID string) ([]models.VideoVariant, error) {
+	rows, err := r.db.Query(`SELECT id, media_id, quality, format, width, height, bitrate, url,
+		storage_key, size, created_at FROM video_variants WHERE media_id = ? ORDER BY height, bitrate`, mediaID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get variants: %v", err)
+	}
+	defer rows.Close()
+
+	variants := []models.VideoVariant{}
+	for rows.Next() {
+		var variant models.VideoVariant
+		var quality, createdAt string
+		if err := rows.Scan(&variant.ID, &variant.MediaID, &quality, &variant.Format, &variant.Width,
+			&variant.Height, &variant.Bitrate, &variant.URL, &variant.StorageKey, &variant.Size, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan variant: %v", err)
+		}
+		variant.Quality = models.VideoQuality(quality)
+		variant.CreatedAt = parseTime(createdAt)
+		variants = append(variants, variant)
+	}
+	return variants, rows.Err()
+}
+
+func (r *SQLiteRepository) SaveImageVariants(mediaID string, variants []models.ImageVariant) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM image_variants WHERE media_id = ?`, mediaID); err != nil {
+		return fmt.Errorf("failed to clear image variants: %v", err)
+	}
+
+	for _, variant := range variants {
+		_, err := tx.Exec(`INSERT INTO image_variants (id, media_id, format, width, height, url,
+			storage_key, size, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			variant.ID, mediaID, variant.Format, variant.Width, variant.Height, variant.URL,
+			variant.StorageKey, variant.Size, formatTime(variant.CreatedAt),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save image variant %dw %s: %v", variant.Width, variant.Format, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *SQLiteRepository) GetImageVariants(mediaID string) ([]models.ImageVariant, error) {
+	rows, err := r.db.Query(`SELECT id, media_id, format, width, height, url, storage_key, size,
+		created_at FROM image_variants WHERE media_id = ? ORDER BY width, format`, mediaID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image variants: %v", err)
+	}
+	defer rows.Close()
+
+	variants := []models.ImageVariant{}
+	for rows.Next() {
+		var variant models.ImageVariant
+		var createdAt string
+		if err := rows.Scan(&variant.ID, &variant.MediaID, &variant.Format, &variant.Width, &variant.Height,
+			&variant.URL, &variant.StorageKey, &variant.Size, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan image variant: %v", err)
+		}
+		variant.CreatedAt = parseTime(createdAt)
+		variants = append(variants, variant)
+	}
+	return variants, rows.Err()
+}
+
+const jobColumns = `id, media_id, status, progress, stage, eta_seconds, error, attempts, max_attempts,
+	input_path, processing_mode, processing_reason, next_run_at, created_at, updated_at`
+
+func (r *SQLiteRepository) CreateJob(job *models.VideoProcessingJob) error {
+	_, err := r.db.Exec(`INSERT INTO video_processing_jobs (`+jobColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.ID, job.MediaID, job.Status, job.Progress, job.Stage, job.ETASeconds, job.Error, job.Attempts, job.MaxAttempts,
+		job.InputPath, job.ProcessingMode, job.ProcessingReason,
+		formatTime(job.NextRunAt), formatTime(job.CreatedAt), formatTime(job.UpdatedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create job: %v", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) UpdateJob(job *models.VideoProcessingJob) error {
+	job.UpdatedAt = time.Now()
+	result, err := r.db.Exec(`UPDATE video_processing_jobs SET status = ?, progress = ?, stage = ?,
+		eta_seconds = ?, error = ?, attempts = ?, max_attempts = ?, input_path = ?, processing_mode = ?,
+		processing_reason = ?, next_run_at = ?, updated_at = ? WHERE id = ?`,
+		job.Status, job.Progress, job.Stage, job.ETASeconds, job.Error, job.Attempts, job.MaxAttempts, job.InputPath,
+		job.ProcessingMode, job.ProcessingReason, formatTime(job.NextRunAt), formatTime(job.UpdatedAt), job.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update job: %v", err)
+	}
+	return expectAffected(result)
+}
+
+func (r *SQLiteRepository) GetJob(id string) (*models.VideoProcessingJob, error) {
+	return scanJob(r.db.QueryRow(`SELECT `+jobColumns+` FROM video_processing_jobs WHERE id = ?`, id))
+}
+
+func (r *SQLiteRepository) GetLatestJob(mediaID string) (*models.VideoProcessingJob, error) {
+	return scanJob(r.db.QueryRow(`SELECT `+jobColumns+` FROM video_processing_jobs
+		WHERE media_id = ? ORDER BY created_at DESC LIMIT 1`, mediaID))
+}
+
+func (r *SQLiteRepository) ClaimNextJob() (*models.VideoProcessingJob, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	job, err := scanJob(tx.QueryRow(`SELECT `+jobColumns+` FROM video_processing_jobs
+		WHERE status = ? AND next_run_at <= ? ORDER BY next_run_at, created_at LIMIT 1`,
+		models.JobStatusPending, formatTime(now)))
+	if err != nil {
+		return nil, err
+	}
+
+	// Every attempt starts reporting progress from scratch
+	job.Status = models.JobStatusProcessing
+	job.Attempts++
+	job.Progress = 0
+	job.Stage = ""
+	job.ETASeconds = 0
+	job.UpdatedAt = now
+	if _, err := tx.Exec(`UPDATE video_processing_jobs SET status = ?, attempts = ?, progress = 0,
+		stage = '', eta_seconds = 0, updated_at = ? WHERE id = ?`,
+		job.Status, job.Attempts, formatTime(job.UpdatedAt), job.ID); err != nil {
+		return nil, fmt.Errorf("failed to claim job: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to claim job: %v", err)
+	}
+	return job, nil
+}
+
+func (r *SQLiteRepository) RequeueInterruptedJobs() (int, error) {
+	result, err := r.db.Exec(`UPDATE video_processing_jobs SET status = ?, next_run_at = ?, updated_at = ?
+		WHERE status = ?`, models.JobStatusPending, formatTime(time.Time{}), formatTime(time.Now()),
+		models.JobStatusProcessing)
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue jobs: %v", err)
+	}
+	affected, err := result.RowsAffected()
+	return int(affected), err
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanMedia(row scanner) (*models.Media, error) {
+	var media models.Media
+	var mediaType, probe, thumbnails, trickplay, preview, createdAt, updatedAt string
+	err := row.Scan(&media.ID, &media.Filename, &media.OriginalName, &mediaType, &media.MimeType,
+		&media.Size, &media.URL, &media.StorageKey, &media.ThumbnailURL, &media.MasterURL, &media.DashURL,
+		&media.Duration, &media.Width, &media.Height, &probe, &thumbnails, &trickplay, &preview, &media.APIKeyID,
+		&media.TenantID, &createdAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan media: %v", err)
+	}
+
+	media.MediaType = models.MediaType(mediaType)
+	media.Probe = decodeProbe(probe)
+	media.Thumbnails = decodeThumbnails(thumbnails)
+	media.Trickplay = decodeTrickplay(trickplay)
+	media.Preview = decodePreview(preview)
+	media.CreatedAt = parseTime(createdAt)
+	media.UpdatedAt = parseTime(updatedAt)
+	return &media, nil
+}
+
+// encodeProbe stores a probe result as JSON, or empty when there is none
+func encodeProbe(probe *models.MediaProbe) string {
+	if probe == nil {
+		return ""
+	}
+	data, err := json.Marshal(probe)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func decodeProbe(value string) *models.MediaProbe {
+	if value == "" {
+		return nil
+	}
+	var probe models.MediaProbe
+	if err := json.Unmarshal([]byte(value), &probe); err != nil {
+		log.Printf("⚠️ Ignoring unreadable probe result: %v", err)
+		return nil
+	}
+	return &probe
+}
+
+// encodeThumbnails stores the thumbnail list as JSON, or empty when there is none
+func encodeThumbnails(thumbnails []models.Thumbnail) string {
+	if len(thumbnails) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(thumbnails)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func decodeThumbnails(value string) []models.Thumbnail {
+	if value == "" {
+		return nil
+	}
+	var thumbnails []models.Thumbnail
+	if err := json.Unmarshal([]byte(value), &thumbnails); err != nil {
+		log.Printf("⚠️ Ignoring unreadable thumbnail list: %v", err)
+		return nil
+	}
+	return thumbnails
+}
+
+// encodeTrickplay stores the trickplay layout as JSON, or empty when there is none
+func encodeTrickplay(trickplay *models.Trickplay) string {
+	if trickplay == nil {
+		return ""
+	}
+	data, err := json.Marshal(trickplay)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func decodeTrickplay(value string) *models.Trickplay {
+	if value == "" {
+		return nil
+	}
+	var trickplay models.Trickplay
+	if err := json.Unmarshal([]byte(value), &trickplay); err != nil {
+		log.Printf("⚠️ Ignoring unreadable trickplay layout: %v", err)
+		return nil
+	}
+	return &trickplay
+}
+
+// encodePreview stores the animated preview as JSON, or empty when there is none
+func encodePreview(preview *models.Preview) string {
+	if preview == nil {
+		return ""
+	}
+	data, err := json.Marshal(preview)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func decodePreview(value string) *models.Preview {
+	if value == "" {
+		return nil
+	}
+	var preview models.Preview
+	if err := json.Unmarshal([]byte(value), &preview); err != nil {
+		log.Printf("⚠️ Ignoring unreadable preview: %v", err)
+		return nil
+	}
+	return &preview
+}
+
+func scanJob(row scanner) (*models.VideoProcessingJob, error) {
+	var job models.VideoProcessingJob
+	var nextRunAt, createdAt, updatedAt string
+	err := row.Scan(&job.ID, &job.MediaID, &job.Status, &job.Progress, &job.Stage, &job.ETASeconds, &job.Error, &job.Attempts,
+		&job.MaxAttempts, &job.InputPath, &job.ProcessingMode, &job.ProcessingReason, &nextRunAt, &createdAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan job: %v", err)
+	}
+
+	job.NextRunAt = parseTime(nextRunAt)
+	job.CreatedAt = parseTime(createdAt)
+	job.UpdatedAt = parseTime(updatedAt)
+	return &job, nil
+}
+
+func expectAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Times are stored as fixed width RFC 3339 text in UTC so they sort lexically
+const timeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+func parseTime(value string) time.Time {
+	t, _ := time.Parse(timeLayout, value)
+	return t
+}
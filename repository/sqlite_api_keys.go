@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"api-s3/models"
+)
+
+const apiKeyColumns = `id, name, key_hash, prefix, scopes, tenant_id, last_used_at, revoked_at, created_at, updated_at`
+
+func (r *SQLiteRepository) CreateAPIKey(key *models.APIKey) error {
+	_, err := r.db.Exec(`INSERT INTO api_keys (`+apiKeyColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		key.ID, key.Name, key.KeyHash, key.Prefix, strings.Join(key.Scopes, ","), key.TenantID,
+		formatOptionalTime(key.LastUsedAt), formatOptionalTime(key.RevokedAt),
+		formatTime(key.CreatedAt), formatTime(key.UpdatedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %v", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) UpdateAPIKey(key *models.APIKey) error {
+	key.UpdatedAt = time.Now()
+	result, err := r.db.Exec(`UPDATE api_keys SET name = ?, key_hash = ?, prefix = ?, scopes = ?,
+		revoked_at = ?, updated_at = ? WHERE id = ?`,
+		key.Name, key.KeyHash, key.Prefix, strings.Join(key.Scopes, ","),
+		formatOptionalTime(key.RevokedAt), formatTime(key.UpdatedAt), key.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update API key: %v", err)
+	}
+	return expectAffected(result)
+}
+
+func (r *SQLiteRepository) GetAPIKey(id string) (*models.APIKey, error) {
+	return scanAPIKey(r.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE id = ?`, id))
+}
+
+func (r *SQLiteRepository) GetAPIKeyByHash(hash string) (*models.APIKey, error) {
+	return scanAPIKey(r.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = ?`, hash))
+}
+
+func (r *SQLiteRepository) ListAPIKeys() ([]models.APIKey, error) {
+	rows, err := r.db.Query(`SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %v", err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *SQLiteRepository) TouchAPIKey(id string, usedAt time.Time) error {
+	result, err := r.db.Exec(`UPDATE api_keys SET last_used_at = ? WHERE id = ?`, formatTime(usedAt), id)
+	if err != nil {
+		return fmt.Errorf("failed to update API key: %v", err)
+	}
+	return expectAffected(result)
+}
+
+func scanAPIKey(row scanner) (*models.APIKey, error) {
+	var key models.APIKey
+	var scopes, lastUsedAt, revokedAt, createdAt, updatedAt string
+	err := row.Scan(&key.ID, &key.Name, &key.KeyHash, &key.Prefix, &scopes, &key.TenantID, &lastUsedAt, &revokedAt,
+		&createdAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan API key: %v", err)
+	}
+
+	key.Scopes = splitList(scopes)
+	key.LastUsedAt = parseOptionalTime(lastUsedAt)
+	key.RevokedAt = parseOptionalTime(revokedAt)
+	key.CreatedAt = parseTime(createdAt)
+	key.UpdatedAt = parseTime(updatedAt)
+	return &key, nil
+}
+
+// formatOptionalTime stores an unset time as empty text
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return formatTime(*t)
+}
+
+func parseOptionalTime(value string) *time.Time {
+	if value == "" {
+		return nil
+	}
+	t := parseTime(value)
+	return &t
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"api-s3/models"
+)
+
+const tenantColumns = `id, name, max_file_size, allowed_containers, renditions, created_at, updated_at`
+
+func (r *SQLiteRepository) CreateTenant(tenant *models.Tenant) error {
+	_, err := r.db.Exec(`INSERT INTO tenants (`+tenantColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		tenant.ID, tenant.Name, tenant.MaxFileSize, strings.Join(tenant.AllowedContainers, ","),
+		strings.Join(tenant.EncodingProfile.Renditions, ","),
+		formatTime(tenant.CreatedAt), formatTime(tenant.UpdatedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create tenant: %v", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) UpdateTenant(tenant *models.Tenant) error {
+	tenant.UpdatedAt = time.Now()
+	result, err := r.db.Exec(`UPDATE tenants SET name = ?, max_file_size = ?, allowed_containers = ?,
+		renditions = ?, updated_at = ? WHERE id = ?`,
+		tenant.Name, tenant.MaxFileSize, strings.Join(tenant.AllowedContainers, ","),
+		strings.Join(tenant.EncodingProfile.Renditions, ","), formatTime(tenant.UpdatedAt), tenant.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update tenant: %v", err)
+	}
+	return expectAffected(result)
+}
+
+func (r *SQLiteRepository) GetTenant(id string) (*models.Tenant, error) {
+	return scanTenant(r.db.QueryRow(`SELECT `+tenantColumns+` FROM tenants WHERE id = ?`, id))
+}
+
+func (r *SQLiteRepository) ListTenants() ([]models.Tenant, error) {
+	rows, err := r.db.Query(`SELECT ` + tenantColumns + ` FROM tenants ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenants: %v", err)
+	}
+	defer rows.Close()
+
+	tenants := []models.Tenant{}
+	for rows.Next() {
+		tenant, err := scanTenant(rows)
+		if err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, *tenant)
+	}
+	return tenants, rows.Err()
+}
+
+func scanTenant(row scanner) (*models.Tenant, error) {
+	var tenant models.Tenant
+	var containers, renditions, createdAt, updatedAt string
+	err := row.Scan(&tenant.ID, &tenant.Name, &tenant.MaxFileSize, &containers, &renditions,
+		&createdAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan tenant: %v", err)
+	}
+
+	tenant.AllowedContainers = splitList(containers)
+	tenant.EncodingProfile.Renditions = splitList(renditions)
+	tenant.CreatedAt = parseTime(createdAt)
+	tenant.UpdatedAt = parseTime(updatedAt)
+	return &tenant, nil
+}
+
+// splitList reads a comma separated column, empty meaning no items
+func splitList(value string) []string {
+	if value == "" {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"api-s3/models"
+)
+
+const uploadSessionColumns = `id, media_id, method, status, filename, mime_type, media_type, size, part_size,
+	storage_key, multipart_upload_id, tenant_id, expires_at, created_at, updated_at`
+
+func (r *SQLiteRepository) CreateUploadSession(session *models.UploadSession) error {
+	_, err := r.db.Exec(`INSERT INTO upload_sessions (`+uploadSessionColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		session.ID, session.MediaID, session.Method, session.Status, session.Filename, session.MimeType,
+		string(session.MediaType), session.Size, session.PartSize, session.StorageKey, session.MultipartUploadID,
+		session.TenantID, formatTime(session.ExpiresAt), formatTime(session.CreatedAt), formatTime(session.UpdatedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create upload session: %v", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) UpdateUploadSession(session *models.UploadSession) error {
+	session.UpdatedAt = time.Now()
+	result, err := r.db.Exec(`UPDATE upload_sessions SET status = ?, updated_at = ? WHERE id = ?`,
+		session.Status, formatTime(session.UpdatedAt), session.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update upload session: %v", err)
+	}
+	return expectAffected(result)
+}
+
+func (r *SQLiteRepository) GetUploadSession(id string) (*models.UploadSession, error) {
+	var session models.UploadSession
+	var mediaType, expiresAt, createdAt, updatedAt string
+	err := r.db.QueryRow(`SELECT `+uploadSessionColumns+` FROM upload_sessions WHERE id = ?`, id).Scan(
+		&session.ID, &session.MediaID, &session.Method, &session.Status, &session.Filename, &session.MimeType,
+		&mediaType, &session.Size, &session.PartSize, &session.StorageKey, &session.MultipartUploadID,
+		&session.TenantID, &expiresAt, &createdAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan upload session: %v", err)
+	}
+
+	session.MediaType = models.MediaType(mediaType)
+	session.ExpiresAt = parseTime(expiresAt)
+	session.CreatedAt = parseTime(createdAt)
+	session.UpdatedAt = parseTime(updatedAt)
+	return &session, nil
+}
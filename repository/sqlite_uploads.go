@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"api-s3/models"
+)
+
+const uploadColumns = `id, filename, mime_type, media_type, length, bytes_received, metadata, media_id,
+	tenant_id, expires_at, created_at, updated_at`
+
+func (r *SQLiteRepository) CreateUpload(upload *models.Upload) error {
+	_, err := r.db.Exec(`INSERT INTO uploads (`+uploadColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		upload.ID, upload.Filename, upload.MimeType, string(upload.MediaType), upload.Length, upload.Offset,
+		upload.Metadata, upload.MediaID, upload.TenantID, formatTime(upload.ExpiresAt), formatTime(upload.CreatedAt),
+		formatTime(upload.UpdatedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create upload: %v", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) UpdateUpload(upload *models.Upload) error {
+	upload.UpdatedAt = time.Now()
+	result, err := r.db.Exec(`UPDATE uploads SET bytes_received = ?, media_id = ?, expires_at = ?, updated_at = ?
+		WHERE id = ?`,
+		upload.Offset, upload.MediaID, formatTime(upload.ExpiresAt), formatTime(upload.UpdatedAt), upload.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update upload: %v", err)
+	}
+	return expectAffected(result)
+}
+
+func (r *SQLiteRepository) GetUpload(id string) (*models.Upload, error) {
+	return scanUpload(r.db.QueryRow(`SELECT `+uploadColumns+` FROM uploads WHERE id = ?`, id))
+}
+
+func (r *SQLiteRepository) DeleteUpload(id string) error {
+	result, err := r.db.Exec(`DELETE FROM uploads WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete upload: %v", err)
+	}
+	return expectAffected(result)
+}
+
+func (r *SQLiteRepository) ListExpiredUploads(now time.Time) ([]models.Upload, error) {
+	rows, err := r.db.Query(`SELECT `+uploadColumns+` FROM uploads WHERE expires_at < ?`, formatTime(now))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list uploads: %v", err)
+	}
+	defer rows.Close()
+
+	uploads := []models.Upload{}
+	for rows.Next() {
+		upload, err := scanUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, *upload)
+	}
+	return uploads, rows.Err()
+}
+
+func scanUpload(row scanner) (*models.Upload, error) {
+	var upload models.Upload
+	var mediaType, expiresAt, createdAt, updatedAt string
+	err := row.Scan(&upload.ID, &upload.Filename, &upload.MimeType, &mediaType, &upload.Length,
+		&upload.Offset, &upload.Metadata, &upload.MediaID, &upload.TenantID, &expiresAt, &createdAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan upload: %v", err)
+	}
+
+	upload.MediaType = models.MediaType(mediaType)
+	upload.ExpiresAt = parseTime(expiresAt)
+	upload.CreatedAt = parseTime(createdAt)
+	upload.UpdatedAt = parseTime(updatedAt)
+	return &upload, nil
+}
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"api-s3/models"
+)
+
+const webhookColumns = `id, url, secret, events, active, created_at, updated_at`
+
+func (r *SQLiteRepository) SaveWebhook(webhook *models.Webhook) error {
+	webhook.UpdatedAt = time.Now()
+	if webhook.CreatedAt.IsZero() {
+		webhook.CreatedAt = webhook.UpdatedAt
+	}
+	_, err := r.db.Exec(`INSERT INTO webhooks (`+webhookColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET url = excluded.url, secret = excluded.secret,
+		events = excluded.events, active = excluded.active, updated_at = excluded.updated_at`,
+		webhook.ID, webhook.URL, webhook.Secret, strings.Join(webhook.Events, ","), webhook.Active,
+		formatTime(webhook.CreatedAt), formatTime(webhook.UpdatedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save webhook: %v", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) GetWebhook(id string) (*models.Webhook, error) {
+	return scanWebhook(r.db.QueryRow(`SELECT `+webhookColumns+` FROM webhooks WHERE id = ?`, id))
+}
+
+func (r *SQLiteRepository) ListWebhooks() ([]models.Webhook, error) {
+	rows, err := r.db.Query(`SELECT ` + webhookColumns + ` FROM webhooks ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %v", err)
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+func (r *SQLiteRepository) DeleteWebhook(id string) error {
+	result, err := r.db.Exec(`DELETE FROM webhooks WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %v", err)
+	}
+	return expectAffected(result)
+}
+
+const deliveryColumns = `id, webhook_id, event_type, media_id, payload, status, attempts, max_attempts,
+	response_status, error, next_attempt_at, created_at, updated_at`
+
+func (r *SQLiteRepository) CreateDelivery(delivery *models.WebhookDelivery) error {
+	_, err := r.db.Exec(`INSERT INTO webhook_deliveries (`+deliveryColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		delivery.ID, delivery.WebhookID, delivery.EventType, delivery.MediaID, delivery.Payload,
+		delivery.Status, delivery.Attempts, delivery.MaxAttempts, delivery.ResponseStatus, delivery.Error,
+		formatTime(delivery.NextAttemptAt), formatTime(delivery.CreatedAt), formatTime(delivery.UpdatedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create delivery: %v", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) UpdateDelivery(delivery *models.WebhookDelivery) error {
+	delivery.UpdatedAt = time.Now()
+	result, err := r.db.Exec(`UPDATE webhook_deliveries SET status = ?, attempts = ?, response_status = ?,
+		error = ?, next_attempt_at = ?, updated_at = ? WHERE id = ?`,
+		delivery.Status, delivery.Attempts, delivery.ResponseStatus, delivery.Error,
+		formatTime(delivery.NextAttemptAt), formatTime(delivery.UpdatedAt), delivery.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update delivery: %v", err)
+	}
+	return expectAffected(result)
+}
+
+func (r *SQLiteRepository) ListDeliveries(webhookID string, limit int) ([]models.WebhookDelivery, error) {
+	return r.queryDeliveries(`SELECT `+deliveryColumns+` FROM webhook_deliveries
+		WHERE webhook_id = ? ORDER BY created_at DESC LIMIT ?`, webhookID, limit)
+}
+
+func (r *SQLiteRepository) ListDueDeliveries(now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	return r.queryDeliveries(`SELECT `+deliveryColumns+` FROM webhook_deliveries
+		WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at LIMIT ?`,
+		models.DeliveryStatusPending, formatTime(now), limit)
+}
+
+func (r *SQLiteRepository) queryDeliveries(query string, args ...any) ([]models.WebhookDelivery, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deliveries: %v", err)
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		var nextAttemptAt, createdAt, updatedAt string
+		if err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventType, &delivery.MediaID,
+			&delivery.Payload, &delivery.Status, &delivery.Attempts, &delivery.MaxAttempts,
+			&delivery.ResponseStatus, &delivery.Error, &nextAttemptAt, &createdAt, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan delivery: %v", err)
+		}
+		delivery.NextAttemptAt = parseTime(nextAttemptAt)
+		delivery.CreatedAt = parseTime(createdAt)
+		delivery.UpdatedAt = parseTime(updatedAt)
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func scanWebhook(row scanner) (*models.Webhook, error) {
+	var webhook models.Webhook
+	var events, createdAt, updatedAt string
+	err := row.Scan(&webhook.ID, &webhook.URL, &webhook.Secret, &events, &webhook.Active, &createdAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan webhook: %v", err)
+	}
+
+	webhook.Events = []string{}
+	if events != "" {
+		webhook.Events = strings.Split(events, ",")
+	}
+	webhook.CreatedAt = parseTime(createdAt)
+	webhook.UpdatedAt = parseTime(updatedAt)
+	return &webhook, nil
+}
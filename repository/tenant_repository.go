@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"api-s3/models"
+)
+
+// TenantRepository persists tenants and their upload and encoding settings
+type TenantRepository interface {
+	CreateTenant(tenant *models.Tenant) error
+	UpdateTenant(tenant *models.Tenant) error
+	GetTenant(id string) (*models.Tenant, error)
+	ListTenants() ([]models.Tenant, error)
+}
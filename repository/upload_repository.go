@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"time"
+
+	"api-s3/models"
+)
+
+// UploadRepository persists the state of resumable uploads
+type UploadRepository interface {
+	CreateUpload(upload *models.Upload) error
+	UpdateUpload(upload *models.Upload) error
+	GetUpload(id string) (*models.Upload, error)
+	DeleteUpload(id string) error
+	// ListExpiredUploads returns uploads whose expiry is before now
+	ListExpiredUploads(now time.Time) ([]models.Upload, error)
+}
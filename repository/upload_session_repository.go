@@ -0,0 +1,12 @@
+package repository
+
+import (
+	"api-s3/models"
+)
+
+// UploadSessionRepository persists direct (presigned) upload sessions
+type UploadSessionRepository interface {
+	CreateUploadSession(session *models.UploadSession) error
+	UpdateUploadSession(session *models.UploadSession) error
+	GetUploadSession(id string) (*models.UploadSession, error)
+}
@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"time"
+
+	"api-s3/models"
+)
+
+// WebhookRepository persists webhook subscriptions and their delivery log
+type WebhookRepository interface {
+	// SaveWebhook creates the webhook or replaces the one with the same ID
+	SaveWebhook(webhook *models.Webhook) error
+	GetWebhook(id string) (*models.Webhook, error)
+	ListWebhooks() ([]models.Webhook, error)
+	// DeleteWebhook removes the webhook together with its deliveries
+	DeleteWebhook(id string) error
+
+	CreateDelivery(delivery *models.WebhookDelivery) error
+	UpdateDelivery(delivery *models.WebhookDelivery) error
+	// ListDeliveries returns the most recent deliveries of a webhook, newest first
+	ListDeliveries(webhookID string, limit int) ([]models.WebhookDelivery, error)
+	// ListDueDeliveries returns pending deliveries whose next attempt is due
+	ListDueDeliveries(now time.Time, limit int) ([]models.WebhookDelivery, error)
+}
@@ -1,14 +1,19 @@
 package routes
 
 import (
+	"api-s3/config"
 	"api-s3/handlers"
+	"api-s3/models"
+	"api-s3/repository"
 	"api-s3/services"
+	"log"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes(s3Service *services.S3Service, videoService *services.VideoService) *gin.Engine {
+func SetupRoutes(storage services.Storage, videoService *services.VideoService, repo repository.Repository, queue *services.JobQueue, events *services.EventBroker, uploads *services.TusStore, tokens *services.JWTVerifier) *gin.Engine {
 	// Configure Gin for large file uploads
 	gin.SetMode(gin.ReleaseMode)
 	
@@ -21,20 +26,33 @@ func SetupRoutes(s3Service *services.S3Service, videoService *services.VideoServ
 	// Add logger middleware
 	router.Use(gin.Logger())
 	
+	// Only trust X-Forwarded-For from known proxies, playback tokens may be
+	// bound to the client IP
+	if err := router.SetTrustedProxies(config.AppConfig.TrustedProxies); err != nil {
+		log.Printf("⚠️  Invalid TRUSTED_PROXIES: %v", err)
+	}
+	
 	// Configure for large file uploads
 	router.MaxMultipartMemory = 1 << 30 // 1GB memory limit for multipart forms
 	
 	// CORS middleware
 	router.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		if origin := allowedOrigin(c.GetHeader("Origin")); origin != "" {
+			c.Header("Access-Control-Allow-Origin", origin)
+			if origin != "*" {
+				c.Header("Vary", "Origin")
+			}
+		}
+		c.Header("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key, Range, If-Range, Tus-Resumable, Upload-Length, Upload-Metadata, Upload-Offset, Upload-Defer-Length")
+		c.Header("Access-Control-Expose-Headers", "Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Offset, Upload-Length, Upload-Metadata, Upload-Expires, X-Media-ID, Accept-Ranges, Content-Range, ETag, X-Video-Quality")
 		
 		// Add headers for large file uploads
 		c.Header("X-Content-Type-Options", "nosniff")
 		c.Header("X-Frame-Options", "DENY")
 		
-		if c.Request.Method == "OPTIONS" {
+		// Answer preflight requests unless the route handles OPTIONS itself
+		if c.Request.Method == "OPTIONS" && c.FullPath() == "" {
 			c.AbortWithStatus(204)
 			return
 		}
@@ -56,40 +74,113 @@ func SetupRoutes(s3Service *services.S3Service, videoService *services.VideoServ
 	router.Static("/static", "./public")
 	router.LoadHTMLGlob("public/*.html")
 
-	// Serve uploaded files
-	router.Static("/uploads", "./uploads")
-
 	// Serve index page
 	router.GET("/", func(c *gin.Context) {
 		c.HTML(200, "index.html", nil)
 	})
 
 	// Create media handler
-	mediaHandler := handlers.NewMediaHandler(s3Service, videoService)
+	mediaHandler := handlers.NewMediaHandler(storage, videoService, repo, queue, events)
+	webhookHandler := handlers.NewWebhookHandler(repo)
+	tusHandler := handlers.NewTusHandler(mediaHandler, uploads)
+	sessionHandler := handlers.NewUploadSessionHandler(mediaHandler, repo)
+	apiKeyHandler := handlers.NewAPIKeyHandler(repo, tokens)
+	tenantHandler := handlers.NewTenantHandler(repo)
+	playbackHandler := handlers.NewPlaybackHandler(mediaHandler, services.NewPlaybackSigner())
+
+	// API key scopes guarding each route
+	canUpload := apiKeyHandler.RequireScope(models.ScopeUpload)
+	canRead := apiKeyHandler.RequireScope(models.ScopeRead)
+	canDelete := apiKeyHandler.RequireScope(models.ScopeDelete)
+	isAdmin := apiKeyHandler.RequireScope(models.ScopeAdmin)
+
+	// Files of the local storage backend, with the same auth and tenant checks
+	// as the API unless the URL is presigned
+	router.GET("/uploads/*path", mediaHandler.AllowPresigned(canRead), mediaHandler.ServeStoredFile)
+	router.HEAD("/uploads/*path", mediaHandler.AllowPresigned(canRead), mediaHandler.ServeStoredFile)
 
 	// API routes
 	api := router.Group("/api/v1")
 	{
 		// Media upload with large file support
-		api.POST("/upload", mediaHandler.UploadMedia)
+		api.POST("/upload", canUpload, mediaHandler.UploadMedia)
 		
 		// Direct upload without video optimization
-		api.POST("/upload-direct", mediaHandler.UploadMediaDirect)
+		api.POST("/upload-direct", canUpload, mediaHandler.UploadMediaDirect)
 		
 		// Large file upload endpoint (no size limit)
-		api.POST("/upload-large", mediaHandler.UploadMediaLarge)
+		api.POST("/upload-large", canUpload, mediaHandler.UploadMediaLarge)
+		
+		// Streaming upload straight into storage (S3 multipart), for very large files
+		api.POST("/upload-stream", canUpload, mediaHandler.UploadMediaStream)
 		
-		// Local upload (for testing without S3)
-		api.POST("/upload-local", mediaHandler.UploadMediaLocal)
+		// Local upload (deprecated alias of /upload, kept for old clients)
+		api.POST("/upload-local", canUpload, mediaHandler.UploadMediaLocal)
 		
 		// Media management
-		api.DELETE("/media/:id", mediaHandler.DeleteMedia)
+		api.GET("/media", canRead, mediaHandler.ListMedia)
+		api.DELETE("/media/:id", canDelete, mediaHandler.DeleteMedia)
 		
 		// Video streaming
-		api.GET("/media/:id/stream", mediaHandler.GetVideoStream)
-		api.GET("/media/:id/thumbnail", mediaHandler.GetThumbnail)
-		api.GET("/media/:id/progress", mediaHandler.GetProcessingProgress)
-		api.GET("/media/:id", mediaHandler.GetMediaInfo)
+		api.GET("/media/:id/stream", canRead, mediaHandler.GetVideoStream)
+		api.GET("/media/:id/stream/:quality", canRead, mediaHandler.StreamVideo)
+		api.HEAD("/media/:id/stream/:quality", canRead, mediaHandler.StreamVideo)
+		api.GET("/media/:id/thumbnail", canRead, mediaHandler.GetThumbnail)
+		api.GET("/media/:id/progress", canRead, mediaHandler.GetProcessingProgress)
+		api.GET("/media/:id/events", canRead, mediaHandler.StreamEvents)
+		api.GET("/media/:id", canRead, mediaHandler.GetMediaInfo)
+		
+		// Signed playback: tokens are minted with an API key, players only need the token
+		api.POST("/media/:id/playback", canRead, playbackHandler.CreateToken)
+		playback := api.Group("/playback/:token", playbackHandler.RequireToken)
+		playback.GET("/stream", playbackHandler.Stream)
+		playback.HEAD("/stream", playbackHandler.Stream)
+		playback.GET("/stream/:quality", playbackHandler.Stream)
+		playback.HEAD("/stream/:quality", playbackHandler.Stream)
+		playback.GET("/hls/*path", playbackHandler.ServeHLS)
+		playback.HEAD("/hls/*path", playbackHandler.ServeHLS)
+		playback.GET("/dash/*path", playbackHandler.ServeDASH)
+		playback.HEAD("/dash/*path", playbackHandler.ServeDASH)
+		playback.GET("/trickplay/*path", playbackHandler.ServeTrickplay)
+		playback.HEAD("/trickplay/*path", playbackHandler.ServeTrickplay)
+		playback.GET("/preview", playbackHandler.ServePreview)
+		playback.HEAD("/preview", playbackHandler.ServePreview)
+		
+		// Direct-to-storage uploads with presigned requests
+		api.POST("/upload-sessions", canUpload, sessionHandler.CreateSession)
+		api.POST("/upload-sessions/:id/complete", canUpload, sessionHandler.CompleteSession)
+		api.DELETE("/upload-sessions/:id", canUpload, sessionHandler.AbortSession)
+		
+		// Resumable uploads (tus 1.0); OPTIONS stays open for discovery
+		files := api.Group("/files", tusHandler.Resumable)
+		files.OPTIONS("", tusHandler.Options)
+		files.POST("", canUpload, tusHandler.CreateUpload)
+		files.HEAD("/:id", canUpload, tusHandler.GetUploadOffset)
+		files.PATCH("/:id", canUpload, tusHandler.PatchUpload)
+		files.DELETE("/:id", canUpload, tusHandler.DeleteUpload)
+		
+		// Webhook subscriptions
+		webhooks := api.Group("/webhooks", isAdmin)
+		webhooks.POST("", webhookHandler.CreateWebhook)
+		webhooks.GET("", webhookHandler.ListWebhooks)
+		webhooks.GET("/:id", webhookHandler.GetWebhook)
+		webhooks.DELETE("/:id", webhookHandler.DeleteWebhook)
+		webhooks.GET("/:id/deliveries", webhookHandler.ListDeliveries)
+		
+		// API key management
+		keys := api.Group("/admin/keys", isAdmin)
+		keys.POST("", apiKeyHandler.CreateKey)
+		keys.GET("", apiKeyHandler.ListKeys)
+		keys.GET("/:id", apiKeyHandler.GetKey)
+		keys.POST("/:id/rotate", apiKeyHandler.RotateKey)
+		keys.DELETE("/:id", apiKeyHandler.RevokeKey)
+		
+		// Tenant management
+		tenants := api.Group("/admin/tenants", isAdmin)
+		tenants.POST("", tenantHandler.CreateTenant)
+		tenants.GET("", tenantHandler.ListTenants)
+		tenants.GET("/:id", tenantHandler.GetTenant)
+		tenants.PUT("/:id", tenantHandler.UpdateTenant)
 	}
 
 	// Health check
@@ -101,4 +192,18 @@ func SetupRoutes(s3Service *services.S3Service, videoService *services.VideoServ
 	})
 
 	return router
-} 
\ No newline at end of file
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin value for a request
+// from origin, or "" when the origin is not allowed
+func allowedOrigin(origin string) string {
+	for _, allowed := range config.AppConfig.CORSAllowedOrigins {
+		if allowed == "*" {
+			return "*"
+		}
+		if origin != "" && strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
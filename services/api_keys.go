@@ -0,0 +1,100 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"api-s3/models"
+	"api-s3/repository"
+
+	"github.com/google/uuid"
+)
+
+// apiKeyPrefix starts every generated key, so leaked keys are easy to spot
+const apiKeyPrefix = "ak_"
+
+// GenerateAPIKey returns a new random API key
+func GenerateAPIKey() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate API key: %v", err)
+	}
+	return apiKeyPrefix + hex.EncodeToString(buf), nil
+}
+
+// HashAPIKey returns the hex encoded SHA-256 of a key, which is all that is
+// stored. Keys are long and random, so a fast hash is enough.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewAPIKey creates an API key record of a tenant with a fresh secret in Key
+func NewAPIKey(name, tenantID string, scopes []string) (*models.APIKey, error) {
+	key := &models.APIKey{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Scopes:    scopes,
+		TenantID:  tenantID,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := RotateAPIKey(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// RotateAPIKey replaces the secret of an API key, leaving the new one in Key
+func RotateAPIKey(key *models.APIKey) error {
+	secret, err := GenerateAPIKey()
+	if err != nil {
+		return err
+	}
+	setAPIKeySecret(key, secret)
+	return nil
+}
+
+func setAPIKeySecret(key *models.APIKey, secret string) {
+	key.Key = secret
+	key.KeyHash = HashAPIKey(secret)
+	key.Prefix = secret
+	if len(secret) > len(apiKeyPrefix)+8 {
+		key.Prefix = secret[:len(apiKeyPrefix)+8]
+	}
+}
+
+// EnsureAdminAPIKey stores secret as an admin key named "admin" unless a key
+// with that secret exists, so a fresh install can create the other keys
+func EnsureAdminAPIKey(repo repository.APIKeyRepository, secret string) error {
+	existing, err := repo.GetAPIKeyByHash(HashAPIKey(secret))
+	if err == nil {
+		if existing.Revoked() {
+			log.Printf("⚠️  ADMIN_API_KEY has been revoked and no longer works")
+		}
+		return nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+
+	key := &models.APIKey{
+		ID:        uuid.New().String(),
+		Name:      "admin",
+		Scopes:    []string{models.ScopeAdmin},
+		TenantID:  models.DefaultTenantID,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	setAPIKeySecret(key, secret)
+	if err := repo.CreateAPIKey(key); err != nil {
+		return err
+	}
+	log.Printf("🔑 Admin API key %s... registered from ADMIN_API_KEY", key.Prefix)
+	return nil
+}
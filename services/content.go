@@ -0,0 +1,257 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+
+	"api-s3/config"
+	"api-s3/models"
+)
+
+// SniffSize is how much of the start of a file SniffContent looks at
+const SniffSize = 512
+
+// ContentFormat is the container of an upload as recognized from its content
+type ContentFormat struct {
+	Container string // jpeg, png, gif, webp, avif, bmp, heic, mp4, mov, 3gp, mkv, webm, avi, flv or wmv
+	MediaType models.MediaType
+	MimeType  string
+}
+
+// ContentError explains why the content of an upload was rejected. Uploads
+// are never retried once rejected.
+type ContentError struct {
+	Reason string
+}
+
+func (e *ContentError) Error() string {
+	return e.Reason
+}
+
+func rejectContent(format string, args ...any) error {
+	return &ContentError{Reason: fmt.Sprintf(format, args...)}
+}
+
+var contentFormats = map[string]ContentFormat{
+	"jpeg": {MediaType: models.MediaTypeImage, MimeType: "image/jpeg"},
+	"png":  {MediaType: models.MediaTypeImage, MimeType: "image/png"},
+	"gif":  {MediaType: models.MediaTypeImage, MimeType: "image/gif"},
+	"webp": {MediaType: models.MediaTypeImage, MimeType: "image/webp"},
+	"avif": {MediaType: models.MediaTypeImage, MimeType: "image/avif"},
+	"bmp":  {MediaType: models.MediaTypeImage, MimeType: "image/bmp"},
+	"heic": {MediaType: models.MediaTypeImage, MimeType: "image/heic"},
+	"mp4":  {MediaType: models.MediaTypeVideo, MimeType: "video/mp4"},
+	"mov":  {MediaType: models.MediaTypeVideo, MimeType: "video/quicktime"},
+	"3gp":  {MediaType: models.MediaTypeVideo, MimeType: "video/3gpp"},
+	"mkv":  {MediaType: models.MediaTypeVideo, MimeType: "video/x-matroska"},
+	"webm": {MediaType: models.MediaTypeVideo, MimeType: "video/webm"},
+	"avi":  {MediaType: models.MediaTypeVideo, MimeType: "video/x-msvideo"},
+	"flv":  {MediaType: models.MediaTypeVideo, MimeType: "video/x-flv"},
+	"wmv":  {MediaType: models.MediaTypeVideo, MimeType: "video/x-ms-wmv"},
+}
+
+// asfHeader is the GUID every ASF (WMV) file starts with
+var asfHeader = []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11, 0xA6, 0xD9, 0x00, 0xAA, 0x00, 0x62, 0xCE, 0x6C}
+
+// SniffContent recognizes the container of a file from its first bytes, or
+// returns nil when it is not an image or video format
+func SniffContent(head []byte) *ContentFormat {
+	container := sniffContainer(head)
+	if container == "" {
+		return nil
+	}
+	format := contentFormats[container]
+	format.Container = container
+	return &format
+}
+
+func sniffContainer(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF}):
+		return "jpeg"
+	case bytes.HasPrefix(head, pngSignature):
+		return "png"
+	case bytes.HasPrefix(head, []byte("GIF87a")), bytes.HasPrefix(head, []byte("GIF89a")):
+		return "gif"
+	case bytes.HasPrefix(head, []byte("BM")) && len(head) >= 14:
+		return "bmp"
+	case bytes.HasPrefix(head, []byte("FLV\x01")):
+		return "flv"
+	case bytes.HasPrefix(head, asfHeader):
+		return "wmv"
+	case len(head) >= 12 && string(head[:4]) == "RIFF":
+		switch string(head[8:12]) {
+		case "WEBP":
+			return "webp"
+		case "AVI ":
+			return "avi"
+		}
+	case bytes.HasPrefix(head, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return sniffEBML(head)
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		return sniffISOBrand(head)
+	case len(head) >= 8:
+		// QuickTime files predating the ftyp atom start with one of these
+		switch string(head[4:8]) {
+		case "moov", "mdat", "wide", "free", "skip", "pnot":
+			return "mov"
+		}
+	}
+	return ""
+}
+
+// sniffEBML tells WebM from Matroska by the DocType element (0x4282) of the
+// EBML header
+func sniffEBML(head []byte) string {
+	i := bytes.Index(head, []byte{0x42, 0x82})
+	if i < 0 || i+3 > len(head) {
+		return ""
+	}
+	// A one byte size has the top bit set
+	size := int(head[i+2] &^ 0x80)
+	if head[i+2]&0x80 == 0 || i+3+size > len(head) {
+		return ""
+	}
+	switch string(head[i+3 : i+3+size]) {
+	case "webm":
+		return "webm"
+	case "matroska":
+		return "mkv"
+	}
+	return ""
+}
+
+// sniffISOBrand tells the ISO base media formats apart by the major and
+// compatible brands of the ftyp atom
+func sniffISOBrand(head []byte) string {
+	end := len(head)
+	if size := int(head[0])<<24 | int(head[1])<<16 | int(head[2])<<8 | int(head[3]); size >= 16 && size < end {
+		end = size
+	}
+	major := string(head[8:12])
+	brands := []string{major}
+	for i := 16; i+4 <= end; i += 4 {
+		brands = append(brands, string(head[i:i+4]))
+	}
+
+	for _, brand := range brands {
+		switch brand {
+		case "avif", "avis":
+			return "avif"
+		}
+	}
+	switch {
+	case major == "qt  ":
+		return "mov"
+	case strings.HasPrefix(major, "3gp"), strings.HasPrefix(major, "3g2"):
+		return "3gp"
+	case major == "heic", major == "heix", major == "mif1", major == "msf1":
+		return "heic"
+	}
+	return "mp4"
+}
+
+// CheckContent sniffs the start of an upload and rejects it unless it is an
+// image or video in one of the ALLOWED_CONTAINERS
+func CheckContent(head []byte) (*ContentFormat, error) {
+	format := SniffContent(head)
+	if format == nil {
+		return nil, rejectContent("file content is not a supported image or video (detected %s)",
+			http.DetectContentType(head))
+	}
+	if !allowed(config.AppConfig.AllowedContainers, format.Container) {
+		return nil, rejectContent("%s files are not allowed (allowed: %s)",
+			format.Container, strings.Join(config.AppConfig.AllowedContainers, ", "))
+	}
+	return format, nil
+}
+
+// IsAllowedContainer reports whether container is one of the
+// ALLOWED_CONTAINERS
+func IsAllowedContainer(container string) bool {
+	return allowed(config.AppConfig.AllowedContainers, container)
+}
+
+// CheckTenantFormat rejects content in a container the tenant does not
+// accept
+func CheckTenantFormat(tenant *models.Tenant, format *ContentFormat) error {
+	if !tenant.AllowsContainer(format.Container) {
+		return rejectContent("%s files are not allowed for this tenant (allowed: %s)",
+			format.Container, strings.Join(tenant.AllowedContainers, ", "))
+	}
+	return nil
+}
+
+// CheckProbe rejects a video without a video stream or using a codec
+// outside ALLOWED_VIDEO_CODECS and ALLOWED_AUDIO_CODECS
+func CheckProbe(probe *models.MediaProbe) error {
+	if probe.VideoStream() == nil {
+		return rejectContent("file has no video stream")
+	}
+	for _, stream := range probe.Streams {
+		switch {
+		case stream.Type == models.StreamTypeVideo && !stream.AttachedPic:
+			if !allowed(config.AppConfig.AllowedVideoCodecs, stream.Codec) {
+				return rejectContent("video codec %s is not allowed (allowed: %s)",
+					stream.Codec, strings.Join(config.AppConfig.AllowedVideoCodecs, ", "))
+			}
+		case stream.Type == models.StreamTypeAudio:
+			if !allowed(config.AppConfig.AllowedAudioCodecs, stream.Codec) {
+				return rejectContent("audio codec %s is not allowed (allowed: %s)",
+					stream.Codec, strings.Join(config.AppConfig.AllowedAudioCodecs, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// VerifyFile checks an upload on local disk: its magic bytes must be an
+// allowed container, and videos must also be readable by FFprobe with
+// allowed codecs. Rejections are returned as *ContentError.
+func VerifyFile(ctx context.Context, ffprobePath, path string) (*ContentFormat, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload: %v", err)
+	}
+	head := make([]byte, SniffSize)
+	n, err := io.ReadFull(file, head)
+	file.Close()
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("failed to read upload: %v", err)
+	}
+
+	format, err := CheckContent(head[:n])
+	if err != nil || format.MediaType != models.MediaTypeVideo {
+		return format, err
+	}
+
+	probe, err := ProbeMedia(ctx, ffprobePath, path)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, rejectContent("file is not a readable %s video", format.Container)
+		}
+		return nil, err
+	}
+	if err := CheckProbe(probe); err != nil {
+		return nil, err
+	}
+	return format, nil
+}
+
+// allowed reports whether value is in the configured list, ignoring case
+func allowed(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"api-s3/models"
+)
+
+// Codec decisions of a ConversionPlan
+const (
+	codecCopy   = "copy"
+	codecH264   = "libx264"
+	codecAAC    = "aac"
+	codecAbsent = ""
+)
+
+// ConversionPlan is how an upload becomes a progressive MP4 every browser
+// plays: kept as is, remuxed without re-encoding, or transcoded. Video and
+// audio are decided separately, so a playable stream is copied even when
+// the other one has to be transcoded.
+type ConversionPlan struct {
+	Mode        string // models.ProcessingMode*
+	Reason      string
+	VideoStream int    // input stream index
+	AudioStream int    // input stream index, -1 without audio
+	VideoCodec  string // copy or libx264
+	AudioCodec  string // copy, aac, or empty without audio
+}
+
+// PlanConversion decides the processing of a probed upload. inputPath is
+// read to find whether the MP4 index (moov atom) precedes the media data.
+func PlanConversion(probe *models.MediaProbe, inputPath, filename string) (*ConversionPlan, error) {
+	video := probe.VideoStream()
+	if video == nil {
+		return nil, fmt.Errorf("no video stream found")
+	}
+
+	plan := &ConversionPlan{
+		VideoStream: video.Index,
+		AudioStream: -1,
+		VideoCodec:  codecCopy,
+		AudioCodec:  codecAbsent,
+	}
+	var reasons []string
+
+	if !browserPlayableVideo(video) {
+		plan.VideoCodec = codecH264
+		reasons = append(reasons, fmt.Sprintf("%s %s video is not playable in browsers", video.Codec, video.PixelFormat))
+	}
+	if audio := probe.AudioStream(); audio != nil {
+		plan.AudioStream = audio.Index
+		plan.AudioCodec = codecCopy
+		if !browserPlayableAudio(audio) {
+			plan.AudioCodec = codecAAC
+			reasons = append(reasons, fmt.Sprintf("%s audio is not playable in browsers", audio.Codec))
+		}
+	}
+
+	if plan.VideoCodec != codecCopy || plan.AudioCodec == codecAAC {
+		plan.Mode = models.ProcessingModeTranscode
+		plan.Reason = strings.Join(reasons, "; ")
+		return plan, nil
+	}
+
+	if !isMP4Container(probe, filename) {
+		plan.Mode = models.ProcessingModeRemux
+		plan.Reason = fmt.Sprintf("streams are playable, %s container is not MP4", probe.FormatName)
+		return plan, nil
+	}
+
+	faststart, err := moovBeforeMdat(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	if !faststart {
+		plan.Mode = models.ProcessingModeRemux
+		plan.Reason = "MP4 index is at the end of the file, moving it to the front for streaming"
+		return plan, nil
+	}
+	plan.Mode = models.ProcessingModePassthrough
+	plan.Reason = "already a streamable MP4 with H.264 video"
+	return plan, nil
+}
+
+// FFmpegArgs returns the ffmpeg arguments producing the MP4 at outputPath
+func (p *ConversionPlan) FFmpegArgs(inputPath, outputPath string) []string {
+	args := []string{"-i", inputPath, "-map", fmt.Sprintf("0:%d", p.VideoStream)}
+	if p.AudioStream >= 0 {
+		args = append(args, "-map", fmt.Sprintf("0:%d", p.AudioStream))
+	}
+
+	if p.VideoCodec == codecCopy {
+		args = append(args, "-c:v", "copy")
+	} else {
+		args = append(args,
+			"-c:v", "libx264", // H.264 video codec
+			"-preset", "fast", // Fast preset (not slow)
+			"-crf", "23", // Good quality, fast encoding
+			"-pix_fmt", "yuv420p", // Standard pixel format
+		)
+	}
+	switch p.AudioCodec {
+	case codecCopy:
+		args = append(args, "-c:a", "copy")
+	case codecAAC:
+		args = append(args, "-c:a", "aac", "-b:a", "128k")
+	}
+
+	return append(args,
+		"-movflags", "+faststart", // Optimize for web streaming
+		"-threads", "0", // Use all CPU threads
+		"-f", "mp4", // Force MP4 format
+		"-y", // Overwrite output file
+		outputPath,
+	)
+}
+
+// browserPlayableVideo reports whether every major browser decodes the
+// stream: 8-bit 4:2:0 H.264
+func browserPlayableVideo(stream *models.ProbeStream) bool {
+	if stream.Codec != "h264" {
+		return false
+	}
+	switch stream.PixelFormat {
+	case "yuv420p", "yuvj420p":
+		return true
+	}
+	return false
+}
+
+func browserPlayableAudio(stream *models.ProbeStream) bool {
+	switch stream.Codec {
+	case "aac", "mp3":
+		return true
+	}
+	return false
+}
+
+// isMP4Container tells MP4 from QuickTime, which ffprobe reports under the
+// same format name, by the major brand and the file extension
+func isMP4Container(probe *models.MediaProbe, filename string) bool {
+	if !strings.Contains(probe.FormatName, "mp4") {
+		return false
+	}
+	if brand := strings.TrimSpace(probe.Tags["major_brand"]); brand != "" {
+		return brand != "qt"
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".mp4", ".m4v":
+		return true
+	}
+	return false
+}
+
+// moovBeforeMdat walks the top level atoms of an MP4 file and reports
+// whether the index (moov) comes before the media data (mdat), which lets
+// players start before the whole file is downloaded
+func moovBeforeMdat(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open video: %v", err)
+	}
+	defer file.Close()
+
+	var offset int64
+	header := make([]byte, 16)
+	for {
+		if _, err := file.ReadAt(header[:8], offset); err != nil {
+			if err == io.EOF {
+				return false, nil
+			}
+			return false, fmt.Errorf("failed to read MP4 atoms: %v", err)
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		switch string(header[4:8]) {
+		case "moov":
+			return true, nil
+		case "mdat":
+			return false, nil
+		}
+
+		switch size {
+		case 0: // atom extends to the end of the file
+			return false, nil
+		case 1: // 64-bit size follows the type
+			if _, err := file.ReadAt(header[8:16], offset+8); err != nil {
+				return false, fmt.Errorf("failed to read MP4 atoms: %v", err)
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+		}
+		if size < 8 {
+			return false, fmt.Errorf("invalid MP4 atom size %d", size)
+		}
+		offset += size
+	}
+}
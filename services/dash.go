@@ -0,0 +1,172 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"api-s3/config"
+	"api-s3/models"
+)
+
+const (
+	DASHManifest         = "manifest.mpd" // file name of the manifest below DASHPrefix
+	DASHManifestMimeType = "application/dash+xml"
+	dashSegmentMimeType  = "video/iso.segment"
+)
+
+var (
+	dashRepresentationPattern = regexp.MustCompile(`(?s)[ \t]*<Representation\b[^>]*?(?:/>|>.*?</Representation>)\n?`)
+	dashAttributePattern      = regexp.MustCompile(`\b(id|width|height)="([^"]*)"`)
+	dashSegmentPattern        = regexp.MustCompile(`^(?:init-(\d+)|chunk-(\d+)-\d+)\.m4s$`)
+)
+
+// DASHRepresentation is a representation listed in a DASH manifest. Audio
+// representations have no size.
+type DASHRepresentation struct {
+	ID     string
+	Width  int
+	Height int
+}
+
+// DASHPrefix returns the storage prefix holding the DASH output of a media item
+func DASHPrefix(tenantID, mediaID string) string {
+	return MediaPrefix(tenantID, mediaID) + "dash"
+}
+
+// CreateDASHPackage packages the progressive MP4 renditions CreateHLSLadder
+// left in workDir as MPEG-DASH (MPD + fragmented MP4 segments). The streams
+// are copied, not encoded again, so it costs a remux. Everything is uploaded
+// to storage and the manifest URL is returned.
+func (v *VideoService) CreateDASHPackage(ctx context.Context, workDir, tenantID, mediaID string, info *VideoInfo, variants []models.VideoVariant, onProgress ProgressFunc) (string, error) {
+	var inputs []string
+	for _, variant := range variants {
+		if variant.Format == models.FormatMP4 {
+			inputs = append(inputs, filepath.Join(workDir, string(variant.Quality)+".mp4"))
+		}
+	}
+	if len(inputs) == 0 {
+		return "", fmt.Errorf("no renditions to package as DASH")
+	}
+
+	outputDir := filepath.Join(workDir, "dash")
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create DASH directory: %v", err)
+	}
+
+	log.Printf("🎞️ Creating DASH package for %s with %d representations", mediaID, len(inputs))
+
+	if err := runFFmpeg(ctx, v.ffmpegPath, dashArgs(inputs, outputDir, info.HasAudio), info.Duration, onProgress); err != nil {
+		return "", fmt.Errorf("ffmpeg DASH packaging failed: %v", err)
+	}
+
+	prefix := DASHPrefix(tenantID, mediaID)
+	if err := v.uploadDirectory(ctx, outputDir, prefix); err != nil {
+		return "", err
+	}
+
+	manifestURL := v.storage.URL(path.Join(prefix, DASHManifest))
+	log.Printf("✅ DASH package uploaded: %s", manifestURL)
+	return manifestURL, nil
+}
+
+// dashSegmentDuration returns the configured DASH segment duration in seconds
+func dashSegmentDuration() int {
+	if config.AppConfig.DASHSegmentDuration <= 0 {
+		return 4
+	}
+	return config.AppConfig.DASHSegmentDuration
+}
+
+// dashArgs builds a single FFmpeg invocation that copies the video of every
+// rendition into its own representation plus the audio of the highest one
+// into a shared track
+func dashArgs(inputs []string, outputDir string, hasAudio bool) []string {
+	var args []string
+	for _, input := range inputs {
+		args = append(args, "-i", input)
+	}
+	for i := range inputs {
+		args = append(args, "-map", fmt.Sprintf("%d:v:0", i))
+	}
+
+	adaptationSets := "id=0,streams=v"
+	if hasAudio {
+		args = append(args, "-map", fmt.Sprintf("%d:a:0", len(inputs)-1))
+		adaptationSets += " id=1,streams=a"
+	}
+
+	return append(args,
+		"-c", "copy",
+		"-f", "dash",
+		// Segments are cut on the keyframes the renditions were encoded with
+		"-seg_duration", strconv.Itoa(dashSegmentDuration()),
+		"-use_template", "1",
+		"-use_timeline", "1",
+		"-init_seg_name", "init-$RepresentationID$.m4s",
+		"-media_seg_name", "chunk-$RepresentationID$-$Number%05d$.m4s",
+		"-adaptation_sets", adaptationSets,
+		"-y",
+		filepath.Join(outputDir, DASHManifest),
+	)
+}
+
+// FilterDASHManifest removes the representations allowed rejects from a DASH
+// manifest, leaving everything else as it was
+func FilterDASHManifest(manifest []byte, allowed func(DASHRepresentation) bool) []byte {
+	return dashRepresentationPattern.ReplaceAllFunc(manifest, func(element []byte) []byte {
+		if allowed(parseDASHRepresentation(element)) {
+			return element
+		}
+		return nil
+	})
+}
+
+// FindDASHRepresentation returns the representation of a DASH manifest with
+// the given id
+func FindDASHRepresentation(manifest []byte, id string) (DASHRepresentation, bool) {
+	for _, element := range dashRepresentationPattern.FindAll(manifest, -1) {
+		if representation := parseDASHRepresentation(element); representation.ID == id {
+			return representation, true
+		}
+	}
+	return DASHRepresentation{}, false
+}
+
+// DASHSegmentRepresentation returns the representation id of a DASH segment
+// file name (init-<id>.m4s or chunk-<id>-<number>.m4s)
+func DASHSegmentRepresentation(name string) (string, bool) {
+	match := dashSegmentPattern.FindStringSubmatch(name)
+	if match == nil {
+		return "", false
+	}
+	return match[1] + match[2], true
+}
+
+// parseDASHRepresentation reads the id and size of a Representation element
+func parseDASHRepresentation(element []byte) DASHRepresentation {
+	tag := element
+	if end := bytes.IndexByte(element, '>'); end >= 0 {
+		tag = element[:end]
+	}
+
+	var representation DASHRepresentation
+	for _, attribute := range dashAttributePattern.FindAllSubmatch(tag, -1) {
+		value := string(attribute[2])
+		switch string(attribute[1]) {
+		case "id":
+			representation.ID = value
+		case "width":
+			representation.Width, _ = strconv.Atoi(value)
+		case "height":
+			representation.Height, _ = strconv.Atoi(value)
+		}
+	}
+	return representation
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"api-s3/models"
+)
+
+// eventBufferSize is how many events a slow subscriber may fall behind
+// before further events are dropped for it
+const eventBufferSize = 32
+
+// EventBroker fans media events out to in-process subscribers such as the
+// Server-Sent Events endpoint. A nil *EventBroker discards every event.
+type EventBroker struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[chan models.MediaEvent]struct{}
+	handlers    []func(models.MediaEvent)
+}
+
+// NewEventBroker creates a new EventBroker instance
+func NewEventBroker() *EventBroker {
+	return &EventBroker{
+		subscribers: make(map[string]map[chan models.MediaEvent]struct{}),
+	}
+}
+
+// Subscribe returns a channel receiving the events of one media item, or of
+// every media item when mediaID is empty. The returned function unsubscribes
+// and must be called once the subscriber is done.
+func (b *EventBroker) Subscribe(mediaID string) (<-chan models.MediaEvent, func()) {
+	ch := make(chan models.MediaEvent, eventBufferSize)
+
+	b.mu.Lock()
+	if b.subscribers[mediaID] == nil {
+		b.subscribers[mediaID] = make(map[chan models.MediaEvent]struct{})
+	}
+	b.subscribers[mediaID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers[mediaID], ch)
+			if len(b.subscribers[mediaID]) == 0 {
+				delete(b.subscribers, mediaID)
+			}
+			b.mu.Unlock()
+		})
+	}
+}
+
+// OnEvent registers a handler that is called synchronously for every
+// published event, after the broker lock is released. Unlike subscribers,
+// handlers never miss an event, so they must return quickly.
+func (b *EventBroker) OnEvent(handler func(models.MediaEvent)) {
+	b.mu.Lock()
+	b.handlers = append(b.handlers, handler)
+	b.mu.Unlock()
+}
+
+// Publish delivers an event to its subscribers without blocking. Media and
+// job are copied so later changes by the publisher are not observed.
+func (b *EventBroker) Publish(eventType string, mediaID string, media *models.Media, job *models.VideoProcessingJob) {
+	if b == nil {
+		return
+	}
+
+	event := models.MediaEvent{
+		Type:      eventType,
+		MediaID:   mediaID,
+		Timestamp: time.Now(),
+	}
+	if media != nil {
+		mediaCopy := *media
+		event.Media = &mediaCopy
+	}
+	if job != nil {
+		jobCopy := *job
+		event.Job = &jobCopy
+	}
+
+	b.mu.RLock()
+	handlers := b.handlers
+	keys := []string{""}
+	if mediaID != "" {
+		keys = append(keys, mediaID)
+	}
+	for _, key := range keys {
+		for ch := range b.subscribers[key] {
+			select {
+			case ch <- event:
+			default:
+				// Subscriber is not keeping up; it can resync from the progress endpoint
+			}
+		}
+	}
+	b.mu.RUnlock()
+
+	// Handlers may be slow, so they must not hold up Subscribe and unsubscribe
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ProgressFunc receives the completed fraction (0 to 1) of a running FFmpeg command
+type ProgressFunc func(fraction float64)
+
+// runFFmpeg runs FFmpeg with machine readable progress on stdout, reporting
+// the encoded position against duration (in seconds) to onProgress. Progress
+// is only reported when the duration is known.
+func runFFmpeg(ctx context.Context, ffmpegPath string, args []string, duration float64, onProgress ProgressFunc) error {
+	args = append([]string{"-progress", "pipe:1", "-nostats"}, args...)
+	cmd := exec.CommandContext(ctx, ffmpegPath, args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to attach to ffmpeg output: %v", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %v", err)
+	}
+
+	ReadFFmpegProgress(stdout, duration, onProgress)
+
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("❌ FFmpeg error output: %s", stderr.String())
+		return fmt.Errorf("ffmpeg failed: %v", err)
+	}
+	return nil
+}
+
+// ReadFFmpegProgress parses the key=value blocks written by `ffmpeg -progress`
+// until r is exhausted. Each block ends with a progress=continue|end line.
+func ReadFFmpegProgress(r io.Reader, duration float64, onProgress ProgressFunc) {
+	if onProgress == nil {
+		io.Copy(io.Discard, r)
+		return
+	}
+
+	var position float64
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "out_time_us", "out_time_ms":
+			// Both are in microseconds; out_time_ms is misnamed in FFmpeg
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil && us >= 0 {
+				position = float64(us) / 1e6
+			}
+		case "out_time":
+			if position == 0 {
+				position = parseDuration(value)
+			}
+		case "progress":
+			if value == "end" {
+				onProgress(1)
+			} else if duration > 0 {
+				onProgress(clampFraction(position / duration))
+			}
+			position = 0
+		}
+	}
+	// Drain whatever is left so FFmpeg never blocks on a full pipe
+	io.Copy(io.Discard, r)
+}
+
+func clampFraction(fraction float64) float64 {
+	if fraction < 0 {
+		return 0
+	}
+	if fraction > 1 {
+		return 1
+	}
+	return fraction
+}
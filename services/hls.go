@@ -0,0 +1,347 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"api-s3/config"
+	"api-s3/models"
+)
+
+// Rendition describes a single rung of the adaptive bitrate ladder
+type Rendition struct {
+	Quality      models.VideoQuality
+	Width        int
+	Height       int
+	VideoBitrate string
+	MaxRate      string
+	AudioBitrate string
+	Profile      string
+	Level        string
+	CodecTag     string // RFC 6381 codec string matching Profile/Level
+}
+
+// RenditionLadder holds the encoding settings for every supported quality.
+// Which of them are produced is controlled by HLS_RENDITIONS.
+var RenditionLadder = map[models.VideoQuality]Rendition{
+	models.Quality240p:  {models.Quality240p, 426, 240, "400k", "480k", "64k", "main", "3.0", "avc1.4d401e"},
+	models.Quality360p:  {models.Quality360p, 640, 360, "800k", "960k", "96k", "main", "3.0", "avc1.4d401e"},
+	models.Quality480p:  {models.Quality480p, 854, 480, "1400k", "1680k", "128k", "main", "3.1", "avc1.4d401f"},
+	models.Quality720p:  {models.Quality720p, 1280, 720, "2800k", "3360k", "128k", "main", "3.1", "avc1.4d401f"},
+	models.Quality1080p: {models.Quality1080p, 1920, 1080, "5000k", "6000k", "192k", "high", "4.0", "avc1.640028"},
+}
+
+const (
+	HLSMasterPlaylist   = "master.m3u8" // file name of the master playlist below HLSPrefix
+	hlsVariantPlaylist  = "playlist.m3u8"
+	hlsAudioCodecTag    = "mp4a.40.2"
+	HLSPlaylistMimeType = "application/vnd.apple.mpegurl"
+	hlsSegmentMimeType  = "video/mp2t"
+)
+
+// HLSPrefix returns the storage prefix holding the HLS output of a media item
+func HLSPrefix(tenantID, mediaID string) string {
+	return MediaPrefix(tenantID, mediaID) + "hls"
+}
+
+// RenditionKey returns the storage key of the progressive MP4 copy of a
+// rendition, which /stream serves
+func RenditionKey(tenantID, mediaID string, quality models.VideoQuality) string {
+	return MediaPrefix(tenantID, mediaID) + "renditions/" + string(quality) + ".mp4"
+}
+
+// selectRenditions returns the renditions of the ladder, HLS_RENDITIONS when
+// empty, that do not upscale the source, ordered from lowest to highest. The
+// smallest rendition is always kept so that tiny sources still get a
+// playable stream.
+func selectRenditions(ladder []string, info *VideoInfo) []Rendition {
+	if len(ladder) == 0 {
+		ladder = config.AppConfig.HLSRenditions
+	}
+	var configured []Rendition
+	for _, name := range ladder {
+		rendition, ok := RenditionLadder[models.VideoQuality(strings.ToLower(name))]
+		if !ok {
+			log.Printf("⚠️  Unknown HLS rendition %q, skipping", name)
+			continue
+		}
+		configured = append(configured, rendition)
+	}
+	sort.Slice(configured, func(i, j int) bool {
+		return configured[i].Height < configured[j].Height
+	})
+
+	// Compare against the short side so portrait videos are not over-encoded
+	sourceSize := info.Height
+	if info.Width > 0 && info.Width < sourceSize {
+		sourceSize = info.Width
+	}
+
+	var selected []Rendition
+	for _, rendition := range configured {
+		if sourceSize > 0 && rendition.Height > sourceSize {
+			continue
+		}
+		selected = append(selected, rendition)
+	}
+	if len(selected) == 0 && len(configured) > 0 {
+		selected = append(selected, configured[0])
+	}
+	return selected
+}
+
+// fitWithin scales the source dimensions into the rendition box keeping the
+// aspect ratio, rounding to even numbers as required by yuv420p
+func fitWithin(srcWidth, srcHeight int, rendition Rendition) (int, int) {
+	if srcWidth <= 0 || srcHeight <= 0 {
+		return rendition.Width, rendition.Height
+	}
+
+	// Portrait sources use the rendition height as their short side
+	boxWidth, boxHeight := rendition.Width, rendition.Height
+	if srcHeight > srcWidth {
+		boxWidth, boxHeight = rendition.Height, rendition.Width
+	}
+
+	scale := float64(boxWidth) / float64(srcWidth)
+	if hScale := float64(boxHeight) / float64(srcHeight); hScale < scale {
+		scale = hScale
+	}
+
+	width := int(float64(srcWidth)*scale) / 2 * 2
+	height := int(float64(srcHeight)*scale) / 2 * 2
+	return width, height
+}
+
+// CreateHLSLadder encodes the input into the configured HLS rendition ladder,
+// writes a master playlist and uploads everything to storage. Every rendition
+// is also remuxed into a progressive MP4 for /stream, left in workDir as
+// <quality>.mp4 so CreateDASHPackage can package it without encoding again.
+// It returns the HLS variants followed by the MP4 variants together with the
+// master playlist URL. onProgress, if set, receives the fraction of the ladder
+// encoded so far.
+func (v *VideoService) CreateHLSLadder(ctx context.Context, inputPath, workDir, tenantID, mediaID string, info *VideoInfo, ladder []string, onProgress ProgressFunc) ([]models.VideoVariant, string, error) {
+	hlsDir := filepath.Join(workDir, "hls")
+	if err := os.MkdirAll(hlsDir, 0755); err != nil {
+		return nil, "", fmt.Errorf("failed to create HLS directory: %v", err)
+	}
+
+	renditions := selectRenditions(ladder, info)
+	if len(renditions) == 0 {
+		return nil, "", fmt.Errorf("no HLS renditions configured")
+	}
+
+	log.Printf("🎞️ Creating HLS ladder for %s with %d renditions", mediaID, len(renditions))
+
+	var variants []models.VideoVariant
+	for i, rendition := range renditions {
+		var renditionProgress ProgressFunc
+		if onProgress != nil {
+			// Every rendition is an equal share of the ladder
+			done := float64(i)
+			renditionProgress = func(fraction float64) {
+				onProgress((done + fraction) / float64(len(renditions)))
+			}
+		}
+
+		width, height := fitWithin(info.Width, info.Height, rendition)
+		outputDir := filepath.Join(hlsDir, string(rendition.Quality))
+		if err := v.encodeHLSRendition(ctx, inputPath, outputDir, rendition, width, height, info.Duration, renditionProgress); err != nil {
+			return nil, "", fmt.Errorf("failed to encode %s rendition: %v", rendition.Quality, err)
+		}
+
+		variants = append(variants, models.VideoVariant{
+			ID:        generateVideoUniqueID(),
+			MediaID:   mediaID,
+			Quality:   rendition.Quality,
+			Format:    models.FormatHLS,
+			Width:     width,
+			Height:    height,
+			Bitrate:   parseBitrate(rendition.MaxRate) + parseBitrate(rendition.AudioBitrate),
+			CreatedAt: time.Now(),
+		})
+		log.Printf("✅ Encoded %s rendition (%dx%d)", rendition.Quality, width, height)
+	}
+
+	master := buildMasterPlaylist(renditions, variants, info.HasAudio)
+	if err := os.WriteFile(filepath.Join(hlsDir, HLSMasterPlaylist), master, 0644); err != nil {
+		return nil, "", fmt.Errorf("failed to write master playlist: %v", err)
+	}
+
+	prefix := HLSPrefix(tenantID, mediaID)
+	if err := v.uploadDirectory(ctx, hlsDir, prefix); err != nil {
+		return nil, "", err
+	}
+
+	for i := range variants {
+		variantDir := filepath.Join(hlsDir, string(variants[i].Quality))
+		variants[i].Size = directorySize(variantDir)
+		variants[i].StorageKey = path.Join(prefix, string(variants[i].Quality), hlsVariantPlaylist)
+		variants[i].URL = v.storage.URL(variants[i].StorageKey)
+	}
+
+	masterURL := v.storage.URL(path.Join(prefix, HLSMasterPlaylist))
+	log.Printf("✅ HLS ladder uploaded: %s", masterURL)
+
+	// The segments are already encoded, so the progressive copies only cost a remux
+	var progressive []models.VideoVariant
+	for _, variant := range variants {
+		outputPath := filepath.Join(workDir, string(variant.Quality)+".mp4")
+		playlistPath := filepath.Join(hlsDir, string(variant.Quality), hlsVariantPlaylist)
+		if err := v.remuxRendition(ctx, playlistPath, outputPath, info.Duration); err != nil {
+			log.Printf("⚠️ Failed to remux %s rendition into MP4: %v", variant.Quality, err)
+			continue
+		}
+
+		key := RenditionKey(tenantID, mediaID, variant.Quality)
+		url, err := UploadLocalFile(ctx, v.storage, outputPath, key, "video/mp4")
+		if err != nil {
+			return nil, "", err
+		}
+		if stat, err := os.Stat(outputPath); err == nil {
+			variant.Size = stat.Size()
+		}
+		variant.ID = generateVideoUniqueID()
+		variant.Format = models.FormatMP4
+		variant.StorageKey = key
+		variant.URL = url
+		progressive = append(progressive, variant)
+	}
+	log.Printf("✅ %d progressive renditions uploaded", len(progressive))
+
+	return append(variants, progressive...), masterURL, nil
+}
+
+// remuxRendition copies the segments of an encoded HLS rendition into a
+// progressive MP4 with the index up front
+func (v *VideoService) remuxRendition(ctx context.Context, playlistPath, outputPath string, duration float64) error {
+	args := []string{
+		"-i", playlistPath,
+		"-c", "copy",
+		"-bsf:a", "aac_adtstoasc",
+		"-movflags", "+faststart",
+		"-y",
+		outputPath,
+	}
+	return runFFmpeg(ctx, v.ffmpegPath, args, duration, nil)
+}
+
+func (v *VideoService) encodeHLSRendition(ctx context.Context, inputPath, outputDir string, rendition Rendition, width, height int, duration float64, onProgress ProgressFunc) error {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create rendition directory: %v", err)
+	}
+
+	segmentDuration := hlsSegmentDuration()
+
+	args := []string{
+		"-i", inputPath,
+		"-map", "0:v:0",
+		"-map", "0:a:0?", // Audio is optional
+		"-vf", fmt.Sprintf("scale=%d:%d:flags=lanczos", width, height),
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-profile:v", rendition.Profile,
+		"-level", rendition.Level,
+		"-b:v", rendition.VideoBitrate,
+		"-maxrate", rendition.MaxRate,
+		"-bufsize", fmt.Sprintf("%dk", parseBitrate(rendition.MaxRate)*2),
+		"-pix_fmt", "yuv420p",
+		// Keyframes on segment boundaries so every rendition switches cleanly
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", keyframeInterval()),
+		"-sc_threshold", "0",
+		"-c:a", "aac",
+		"-b:a", rendition.AudioBitrate,
+		"-ac", "2",
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(segmentDuration),
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(outputDir, "segment_%04d.ts"),
+		"-threads", "0",
+		"-y",
+		filepath.Join(outputDir, hlsVariantPlaylist),
+	}
+
+	return runFFmpeg(ctx, v.ffmpegPath, args, duration, onProgress)
+}
+
+// hlsSegmentDuration returns the configured HLS segment duration in seconds
+func hlsSegmentDuration() int {
+	if config.AppConfig.HLSSegmentDuration <= 0 {
+		return 6
+	}
+	return config.AppConfig.HLSSegmentDuration
+}
+
+// keyframeInterval returns the seconds between forced keyframes: the HLS
+// segment duration, shortened to fit the DASH segments too when DASH is
+// packaged from the same encodes, since copied streams can only be cut on
+// keyframes
+func keyframeInterval() int {
+	interval := hlsSegmentDuration()
+	if config.AppConfig.EnableDASH {
+		for dash := dashSegmentDuration(); dash != 0; {
+			interval, dash = dash, interval%dash
+		}
+	}
+	return interval
+}
+
+// buildMasterPlaylist renders the master playlist, highest quality first
+func buildMasterPlaylist(renditions []Rendition, variants []models.VideoVariant, hasAudio bool) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("#EXTM3U\n")
+	buf.WriteString("#EXT-X-VERSION:3\n")
+	buf.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+
+	for i := len(variants) - 1; i >= 0; i-- {
+		codecs := renditions[i].CodecTag
+		if hasAudio {
+			codecs += "," + hlsAudioCodecTag
+		}
+		fmt.Fprintf(&buf, "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d,CODECS=\"%s\",NAME=\"%s\"\n",
+			variants[i].Bitrate*1000, variants[i].Width, variants[i].Height, codecs, variants[i].Quality)
+		fmt.Fprintf(&buf, "%s/%s\n", variants[i].Quality, hlsVariantPlaylist)
+	}
+
+	return buf.Bytes()
+}
+
+// uploadDirectory uploads every file below localDir keeping the relative layout
+func (v *VideoService) uploadDirectory(ctx context.Context, localDir, prefix string) error {
+	return filepath.Walk(localDir, func(filePath string, fileInfo os.FileInfo, err error) error {
+		if err != nil || fileInfo.IsDir() {
+			return err
+		}
+
+		relative, err := filepath.Rel(localDir, filePath)
+		if err != nil {
+			return err
+		}
+		key := path.Join(prefix, filepath.ToSlash(relative))
+
+		if _, err := UploadLocalFile(ctx, v.storage, filePath, key, contentTypeByExtension(filePath)); err != nil {
+			return fmt.Errorf("failed to upload %s: %v", relative, err)
+		}
+		return nil
+	})
+}
+
+func directorySize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(_ string, fileInfo os.FileInfo, err error) error {
+		if err == nil && !fileInfo.IsDir() {
+			size += fileInfo.Size()
+		}
+		return nil
+	})
+	return size
+}
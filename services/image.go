@@ -0,0 +1,273 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"api-s3/config"
+	"api-s3/models"
+
+	"github.com/google/uuid"
+)
+
+// exifSearchSize bounds how much of an upload is read looking for EXIF data,
+// which has to fit in a single 64KB JPEG segment near the start of the file
+const exifSearchSize = 256 * 1024
+
+// ImageInfo describes an uploaded image. Width and Height are the displayed
+// size, with the EXIF orientation applied.
+type ImageInfo struct {
+	Width       int
+	Height      int
+	Orientation int // EXIF orientation of the upload, 0 when absent
+	Probe       *models.MediaProbe
+}
+
+// ImageVariantKey returns the storage key of an image variant
+func ImageVariantKey(tenantID, mediaID string, width int, format string) string {
+	return MediaPrefix(tenantID, mediaID) + fmt.Sprintf("images/%d.%s", width, format)
+}
+
+// ImageWidths returns the configured IMAGE_SIZES that do not upscale the
+// source, smallest first. A source narrower than every size gets a single
+// variant at its own width.
+func ImageWidths(srcWidth int) []int {
+	seen := map[int]bool{}
+	var widths []int
+	for _, size := range config.AppConfig.ImageSizes {
+		width, err := strconv.Atoi(strings.TrimSuffix(strings.ToLower(size), "w"))
+		if err != nil || width <= 0 {
+			log.Printf("⚠️  Unknown image size %q, skipping", size)
+			continue
+		}
+		if seen[width] || (srcWidth > 0 && width > srcWidth) {
+			continue
+		}
+		seen[width] = true
+		widths = append(widths, width)
+	}
+	sort.Ints(widths)
+	if len(widths) == 0 && srcWidth > 0 {
+		widths = append(widths, srcWidth)
+	}
+	return widths
+}
+
+// getImageInfo probes an image with FFprobe and reads its EXIF orientation
+func (v *VideoService) getImageInfo(ctx context.Context, inputPath string) (*ImageInfo, error) {
+	probe, err := ProbeMedia(ctx, v.ffprobePath, inputPath)
+	if err != nil {
+		return nil, err
+	}
+	stream := probe.VideoStream()
+	if stream == nil {
+		return nil, fmt.Errorf("no image stream found")
+	}
+
+	info := &ImageInfo{Width: stream.Width, Height: stream.Height, Probe: probe}
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image: %v", err)
+	}
+	defer file.Close()
+	head, err := io.ReadAll(io.LimitReader(file, exifSearchSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %v", err)
+	}
+
+	info.Orientation = ExifOrientation(head)
+	if info.Orientation >= 5 {
+		info.Width, info.Height = info.Height, info.Width
+	}
+	return info, nil
+}
+
+// orientationFilter returns the FFmpeg filter turning an image with the given
+// EXIF orientation upright, or empty when it already is
+func orientationFilter(orientation int) string {
+	switch orientation {
+	case 2:
+		return "hflip"
+	case 3:
+		return "hflip,vflip"
+	case 4:
+		return "vflip"
+	case 5:
+		return "transpose=0"
+	case 6:
+		return "transpose=1"
+	case 7:
+		return "transpose=3"
+	case 8:
+		return "transpose=2"
+	}
+	return ""
+}
+
+// SanitizeImage writes an upright copy of the upload without EXIF, GPS, XMP
+// or text metadata into dir and returns its path. JPEG and PNG files that are
+// already upright are stripped losslessly; rotated images are re-encoded
+// with the orientation applied. Other formats are returned unchanged.
+func (v *VideoService) SanitizeImage(ctx context.Context, inputPath, dir string, info *ImageInfo) (string, error) {
+	outputPath := filepath.Join(dir, "sanitized"+strings.ToLower(filepath.Ext(inputPath)))
+
+	if filter := orientationFilter(info.Orientation); filter != "" {
+		log.Printf("🔄 Applying EXIF orientation %d", info.Orientation)
+		args := []string{
+			"-noautorotate",
+			"-i", inputPath,
+			"-vf", filter,
+			"-frames:v", "1",
+			"-map_metadata", "-1",
+			"-q:v", "2",
+			"-y", outputPath,
+		}
+		if err := runFFmpeg(ctx, v.ffmpegPath, args, 0, nil); err != nil {
+			return "", fmt.Errorf("failed to orient image: %v", err)
+		}
+		return outputPath, nil
+	}
+
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read image: %v", err)
+	}
+	stripped, ok := StripImageMetadata(data)
+	if !ok {
+		log.Printf("🖼️ No metadata stripping for %s, keeping the upload as is", filepath.Ext(inputPath))
+		return inputPath, nil
+	}
+	if err := os.WriteFile(outputPath, stripped, 0644); err != nil {
+		return "", fmt.Errorf("failed to write image: %v", err)
+	}
+	log.Printf("🧽 Stripped %d bytes of metadata", len(data)-len(stripped))
+	return outputPath, nil
+}
+
+// CreateImageVariants encodes the image into every IMAGE_SIZES width and
+// IMAGE_FORMATS format and uploads the results. A format the FFmpeg build
+// cannot encode is skipped. onProgress, if set, receives the fraction of
+// variants done.
+func (v *VideoService) CreateImageVariants(ctx context.Context, inputPath, tenantID, mediaID string, info *ImageInfo, onProgress ProgressFunc) ([]models.ImageVariant, error) {
+	tempDir, err := os.MkdirTemp("", "images_"+mediaID+"_")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	var formats []string
+	for _, format := range config.AppConfig.ImageFormats {
+		format = strings.ToLower(format)
+		if format == "jpeg" {
+			format = "jpg"
+		}
+		if imageEncoderArgs(format, 0) == nil {
+			log.Printf("⚠️  Unknown image format %q, skipping", format)
+			continue
+		}
+		formats = append(formats, format)
+	}
+	widths := ImageWidths(info.Width)
+	if len(formats) == 0 || len(widths) == 0 {
+		return nil, fmt.Errorf("no image sizes or formats configured")
+	}
+
+	total := len(formats) * len(widths)
+	done := 0
+	var variants []models.ImageVariant
+	for _, format := range formats {
+		for _, target := range widths {
+			width, height := scaleToWidth(info.Width, info.Height, target)
+			outputPath := filepath.Join(tempDir, fmt.Sprintf("%d.%s", target, format))
+			args := []string{
+				"-i", inputPath,
+				"-vf", fmt.Sprintf("scale=%d:%d:flags=lanczos", width, height),
+				"-frames:v", "1",
+				"-map_metadata", "-1",
+			}
+			args = append(args, imageEncoderArgs(format, config.AppConfig.ImageQuality)...)
+			args = append(args, "-y", outputPath)
+
+			if err := runFFmpeg(ctx, v.ffmpegPath, args, 0, nil); err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				log.Printf("⚠️ Skipping %s variants: %v", format, err)
+				done += len(widths) - len(variantsOf(variants, format))
+				break
+			}
+
+			key := ImageVariantKey(tenantID, mediaID, target, format)
+			url, err := UploadLocalFile(ctx, v.storage, outputPath, key, contentTypeByExtension(outputPath))
+			if err != nil {
+				return nil, fmt.Errorf("failed to upload %dw %s variant: %v", target, format, err)
+			}
+			var size int64
+			if stat, err := os.Stat(outputPath); err == nil {
+				size = stat.Size()
+			}
+			variants = append(variants, models.ImageVariant{
+				ID:         uuid.New().String(),
+				MediaID:    mediaID,
+				Format:     format,
+				Width:      width,
+				Height:     height,
+				URL:        url,
+				StorageKey: key,
+				Size:       size,
+				CreatedAt:  time.Now(),
+			})
+
+			done++
+			if onProgress != nil {
+				onProgress(float64(done) / float64(total))
+			}
+		}
+	}
+
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("no image variant could be encoded")
+	}
+	return variants, nil
+}
+
+// variantsOf returns the variants encoded in format
+func variantsOf(variants []models.ImageVariant, format string) []models.ImageVariant {
+	var matching []models.ImageVariant
+	for _, variant := range variants {
+		if variant.Format == format {
+			matching = append(matching, variant)
+		}
+	}
+	return matching
+}
+
+// imageEncoderArgs returns the FFmpeg encoder arguments of an image format
+// with IMAGE_QUALITY (1-100) mapped onto the scale of its encoder, or nil for
+// an unsupported format
+func imageEncoderArgs(format string, quality int) []string {
+	if quality <= 0 || quality > 100 {
+		quality = 80
+	}
+	switch format {
+	case "webp":
+		return []string{"-c:v", "libwebp", "-quality", strconv.Itoa(quality)}
+	case "avif":
+		// CRF 10 (best) to 50 (smallest)
+		crf := 50 - quality*40/100
+		return []string{"-c:v", "libaom-av1", "-still-picture", "1", "-crf", strconv.Itoa(crf),
+			"-cpu-used", "6", "-pix_fmt", "yuv420p"}
+	case "jpg":
+		// -q:v 2 (best) to 31 (smallest)
+		return []string{"-q:v", strconv.Itoa(2 + (100-quality)*29/100)}
+	}
+	return nil
+}
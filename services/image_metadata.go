@@ -0,0 +1,175 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// JPEG markers dropped by StripImageMetadata: APP1 holds EXIF (with GPS) and
+// XMP, APP13 holds IPTC, COM holds free text. APP2 (ICC profile) and APP14
+// (Adobe color transform) are needed to render the image and are kept.
+const (
+	jpegAPP1  = 0xE1
+	jpegAPP13 = 0xED
+	jpegCOM   = 0xFE
+	jpegSOS   = 0xDA
+)
+
+// PNG chunks dropped by StripImageMetadata
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+// ExifOrientation returns the EXIF orientation (1 to 8) of a JPEG image, or
+// 0 when the image has no readable orientation tag
+func ExifOrientation(data []byte) int {
+	var orientation int
+	walkJPEGSegments(data, func(marker byte, offset int, segment []byte) bool {
+		if marker != jpegAPP1 || !bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return true
+		}
+		orientation = tiffOrientation(segment[6:])
+		return orientation == 0
+	})
+	return orientation
+}
+
+// tiffOrientation reads the orientation tag (0x0112) from the first IFD of
+// the TIFF structure embedded in an EXIF segment
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) != 0x0112 {
+			continue
+		}
+		// SHORT values are stored left aligned in the value field
+		value := int(order.Uint16(tiff[entry+8:]))
+		if value < 1 || value > 8 {
+			return 0
+		}
+		return value
+	}
+	return 0
+}
+
+// StripImageMetadata removes EXIF, GPS, XMP, IPTC and text metadata from a
+// JPEG or PNG image without touching the pixel data. ok is false for other
+// formats and for data that cannot be parsed.
+func StripImageMetadata(data []byte) (stripped []byte, ok bool) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		return stripJPEGMetadata(data)
+	case bytes.HasPrefix(data, pngSignature):
+		return stripPNGMetadata(data)
+	}
+	return nil, false
+}
+
+func stripJPEGMetadata(data []byte) ([]byte, bool) {
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xFF, 0xD8)
+
+	rest := -1
+	complete := walkJPEGSegments(data, func(marker byte, offset int, segment []byte) bool {
+		if marker == jpegSOS {
+			// Everything from the start of scan on is image data
+			rest = offset
+			return false
+		}
+		if marker != jpegAPP1 && marker != jpegAPP13 && marker != jpegCOM {
+			out = append(out, 0xFF, marker, byte((len(segment)+2)>>8), byte(len(segment)+2))
+			out = append(out, segment...)
+		}
+		return true
+	})
+	if !complete || rest < 0 {
+		return nil, false
+	}
+	return append(out, data[rest:]...), true
+}
+
+// walkJPEGSegments calls fn with the marker, offset and payload of every
+// segment up to and including the start of scan, until fn returns false. It
+// reports whether the segments could be parsed.
+func walkJPEGSegments(data []byte, fn func(marker byte, offset int, segment []byte) bool) bool {
+	if !bytes.HasPrefix(data, []byte{0xFF, 0xD8}) {
+		return false
+	}
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xFF {
+			return false
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			pos++ // fill byte
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return false
+		}
+		if !fn(marker, pos, data[pos+4:pos+2+length]) {
+			return true
+		}
+		if marker == jpegSOS {
+			return true
+		}
+		pos += 2 + length
+	}
+	return false
+}
+
+func stripPNGMetadata(data []byte) ([]byte, bool) {
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+
+	for pos := len(pngSignature); pos < len(data); {
+		if pos+12 > len(data) {
+			return nil, false
+		}
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, false
+		}
+		chunkType := string(data[pos+4 : pos+8])
+		if !pngMetadataChunks[chunkType] {
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+		if chunkType == "IEND" {
+			return out, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"log"
+	"math"
+	"time"
+
+	"api-s3/models"
+	"api-s3/repository"
+)
+
+// progressSaveInterval limits how often progress is written to the database
+const progressSaveInterval = time.Second
+
+// jobStage is a step of a processing job weighted by its share of the work
+type jobStage struct {
+	name   string
+	weight float64
+}
+
+// jobProgress turns the progress of the individual stages of a job into an
+// overall percentage and an ETA, persists them on the job and publishes them
+type jobProgress struct {
+	repo    repository.MediaRepository
+	events  *EventBroker
+	job     *models.VideoProcessingJob
+	stages  []jobStage
+	total   float64
+	current int // index into stages, -1 before the first stage
+	done    float64
+	started time.Time
+	saved   time.Time
+}
+
+func newJobProgress(repo repository.MediaRepository, events *EventBroker, job *models.VideoProcessingJob, stages []jobStage) *jobProgress {
+	var total float64
+	for _, stage := range stages {
+		total += stage.weight
+	}
+	return &jobProgress{
+		repo:    repo,
+		events:  events,
+		job:     job,
+		stages:  stages,
+		total:   total,
+		current: -1,
+		started: time.Now(),
+	}
+}
+
+// Begin marks the previous stage as finished and starts the named one
+func (p *jobProgress) Begin(name string) {
+	if p.current >= 0 && p.current < len(p.stages) {
+		p.done += p.stages[p.current].weight
+	}
+	for i := p.current + 1; i < len(p.stages); i++ {
+		if p.stages[i].name == name {
+			p.current = i
+			break
+		}
+	}
+
+	p.job.Stage = name
+	p.set(0, true)
+}
+
+// Update reports the completed fraction of the current stage
+func (p *jobProgress) Update(fraction float64) {
+	p.set(fraction, false)
+}
+
+func (p *jobProgress) set(fraction float64, force bool) {
+	overall := 0.0
+	if p.total > 0 {
+		weight := 0.0
+		if p.current >= 0 && p.current < len(p.stages) {
+			weight = p.stages[p.current].weight
+		}
+		overall = (p.done + weight*clampFraction(fraction)) / p.total
+	}
+
+	// 100 is reserved for the completed job
+	progress := int(overall * 100)
+	if progress > 99 {
+		progress = 99
+	}
+
+	if !force && (progress == p.job.Progress || time.Since(p.saved) < progressSaveInterval) {
+		return
+	}
+
+	p.job.Progress = progress
+	p.job.ETASeconds = estimateRemaining(time.Since(p.started), overall)
+	p.saved = time.Now()
+	if err := p.repo.UpdateJob(p.job); err != nil {
+		log.Printf("⚠️ Failed to save progress of job %s: %v", p.job.ID, err)
+	}
+	p.events.Publish(models.EventProcessingProgress, p.job.MediaID, nil, p.job)
+}
+
+// estimateRemaining extrapolates the remaining seconds from the elapsed time,
+// returning 0 until enough progress has been made to be meaningful
+func estimateRemaining(elapsed time.Duration, overall float64) int {
+	if overall < 0.01 || overall >= 1 {
+		return 0
+	}
+	remaining := elapsed.Seconds() * (1 - overall) / overall
+	return int(math.Ceil(remaining))
+}
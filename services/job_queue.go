@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"api-s3/config"
+	"api-s3/models"
+	"api-s3/repository"
+
+	"github.com/google/uuid"
+)
+
+// jobPollInterval is how often idle workers look for jobs whose retry
+// backoff has expired
+const jobPollInterval = 2 * time.Second
+
+// JobProcessor runs a single claimed processing job
+type JobProcessor interface {
+	Process(ctx context.Context, job *models.VideoProcessingJob) error
+}
+
+// JobQueue is a persistent queue of video processing jobs worked by a bounded
+// pool of workers. Jobs live in the repository, so pending work and jobs that
+// were interrupted by a crash are picked up again on the next start.
+type JobQueue struct {
+	repo        repository.MediaRepository
+	processor   JobProcessor
+	events      *EventBroker
+	workers     int
+	maxAttempts int
+	backoff     time.Duration
+
+	wake   chan struct{}
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewJobQueue creates a job queue using the worker and retry settings from
+// the configuration. Job state transitions are published to events.
+func NewJobQueue(repo repository.MediaRepository, processor JobProcessor, events *EventBroker) *JobQueue {
+	workers := config.AppConfig.ProcessingWorkers
+	if workers <= 0 {
+		workers = 1
+	}
+	maxAttempts := config.AppConfig.JobMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+
+	return &JobQueue{
+		repo:        repo,
+		processor:   processor,
+		events:      events,
+		workers:     workers,
+		maxAttempts: maxAttempts,
+		backoff:     time.Duration(config.AppConfig.JobRetryBackoff) * time.Second,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Enqueue records a pending job for a media item whose upload has been
+// spooled to inputPath and wakes an idle worker
+func (q *JobQueue) Enqueue(mediaID, inputPath string) (*models.VideoProcessingJob, error) {
+	job := &models.VideoProcessingJob{
+		ID:          uuid.New().String(),
+		MediaID:     mediaID,
+		Status:      models.JobStatusPending,
+		MaxAttempts: q.maxAttempts,
+		InputPath:   inputPath,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	if err := q.repo.CreateJob(job); err != nil {
+		return nil, err
+	}
+
+	log.Printf("📥 Queued processing job %s for media %s", job.ID, mediaID)
+	q.events.Publish(models.EventProcessingQueued, mediaID, nil, job)
+	q.notify()
+	return job, nil
+}
+
+// Start requeues jobs interrupted by a previous run and starts the workers
+func (q *JobQueue) Start() error {
+	recovered, err := q.repo.RequeueInterruptedJobs()
+	if err != nil {
+		return fmt.Errorf("failed to recover interrupted jobs: %v", err)
+	}
+	if recovered > 0 {
+		log.Printf("♻️ Requeued %d interrupted processing job(s)", recovered)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q.cancel = cancel
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.worker(ctx, i+1)
+	}
+
+	log.Printf("👷 Job queue started with %d worker(s)", q.workers)
+	return nil
+}
+
+// Stop cancels running jobs and waits for the workers to exit. Cancelled jobs
+// stay in processing and are requeued by the next Start.
+func (q *JobQueue) Stop() {
+	if q.cancel == nil {
+		return
+	}
+	q.cancel()
+	q.wg.Wait()
+	log.Println("👷 Job queue stopped")
+}
+
+func (q *JobQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *JobQueue) worker(ctx context.Context, id int) {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain every due job before going back to sleep
+		for ctx.Err() == nil {
+			job, err := q.repo.ClaimNextJob()
+			if errors.Is(err, repository.ErrNotFound) {
+				break
+			}
+			if err != nil {
+				log.Printf("❌ Worker %d failed to claim a job: %v", id, err)
+				break
+			}
+			q.run(ctx, id, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// run processes a claimed job and records the outcome, scheduling a retry
+// with exponential backoff while attempts remain
+func (q *JobQueue) run(ctx context.Context, workerID int, job *models.VideoProcessingJob) {
+	if job.MaxAttempts > 0 && job.Attempts > job.MaxAttempts {
+		// Interrupted on its last attempt
+		q.finish(job, models.JobStatusFailed, "processing was interrupted too many times")
+		return
+	}
+
+	log.Printf("🎬 Worker %d processing job %s (attempt %d/%d)", workerID, job.ID, job.Attempts, job.MaxAttempts)
+	q.events.Publish(models.EventProcessingStarted, job.MediaID, nil, job)
+
+	err := q.processor.Process(ctx, job)
+	if err == nil {
+		q.finish(job, models.JobStatusCompleted, "")
+		log.Printf("✅ Job %s completed", job.ID)
+		return
+	}
+
+	if ctx.Err() != nil {
+		log.Printf("⏸️ Job %s interrupted by shutdown, it will resume on restart", job.ID)
+		return
+	}
+
+	// Rejected content fails the same way on every attempt
+	var rejected *ContentError
+	if errors.As(err, &rejected) || job.Attempts >= job.MaxAttempts {
+		log.Printf("❌ Job %s failed permanently: %v", job.ID, err)
+		q.finish(job, models.JobStatusFailed, err.Error())
+		return
+	}
+
+	delay := q.retryDelay(job.Attempts)
+	log.Printf("🔁 Job %s failed, retrying in %v: %v", job.ID, delay, err)
+	job.Status = models.JobStatusPending
+	job.Error = err.Error()
+	job.NextRunAt = time.Now().Add(delay)
+	if err := q.repo.UpdateJob(job); err != nil {
+		log.Printf("⚠️ Failed to schedule retry of job %s: %v", job.ID, err)
+	}
+	q.events.Publish(models.EventProcessingRetrying, job.MediaID, nil, job)
+}
+
+// finish records a final job status and releases the spooled upload
+func (q *JobQueue) finish(job *models.VideoProcessingJob, status, message string) {
+	job.Status = status
+	job.Error = message
+	job.ETASeconds = 0
+	if status == models.JobStatusCompleted {
+		job.Progress = 100
+		job.Stage = ""
+	}
+	if err := q.repo.UpdateJob(job); err != nil {
+		log.Printf("⚠️ Failed to update job %s: %v", job.ID, err)
+	}
+	if err := RemoveSpool(job.MediaID); err != nil {
+		log.Printf("⚠️ Failed to remove spooled upload of %s: %v", job.MediaID, err)
+	}
+
+	eventType := models.EventProcessingFailed
+	if status == models.JobStatusCompleted {
+		eventType = models.EventProcessingCompleted
+	}
+	media, err := q.repo.GetMedia(job.MediaID)
+	if err != nil {
+		media = nil
+	}
+	q.events.Publish(eventType, job.MediaID, media, job)
+}
+
+// retryDelay doubles the configured backoff after every failed attempt
+func (q *JobQueue) retryDelay(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return q.backoff * time.Duration(1<<uint(attempts-1))
+}
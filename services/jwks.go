@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jwksMinRefresh keeps tokens with unknown key IDs from hammering the JWKS source
+const jwksMinRefresh = 30 * time.Second
+
+// jsonWebKey is a key of a JWKS document; only RSA and EC signing keys are used
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// JWKS caches the public keys of a JSON Web Key Set read from an http(s) URL
+// or a local file. The set is reloaded once it is older than the TTL, or
+// when a token names a key it does not hold, so key rotation at the issuer
+// is picked up without a restart. A failed reload keeps the previous keys.
+// Only one reload runs at a time and it runs outside the lock: callers whose
+// key is cached keep using it meanwhile, the others wait for the reload.
+type JWKS struct {
+	source string
+	ttl    time.Duration
+	client *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	loadedAt    time.Time
+	attemptedAt time.Time
+	loadErr     error         // outcome of the last reload
+	reloading   chan struct{} // closed when the running reload finishes
+}
+
+// NewJWKS creates a key set cache for source. Keys are loaded on first use.
+func NewJWKS(source string, ttl time.Duration) *JWKS {
+	return &JWKS{
+		source: source,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Key returns the public key with the given key ID. A token without a key ID
+// matches the set only when it holds a single key.
+func (j *JWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	key := j.lookup(kid)
+	stale := time.Since(j.loadedAt) > j.ttl
+	var done <-chan struct{}
+	if (key == nil || stale) && time.Since(j.attemptedAt) >= jwksMinRefresh {
+		done = j.startReload()
+	} else if key == nil && j.reloading != nil {
+		done = j.reloading
+	}
+	j.mu.Unlock()
+
+	if key == nil && done != nil {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if key == nil {
+		key = j.lookup(kid)
+	}
+	if key == nil {
+		if j.keys == nil {
+			if j.loadErr != nil {
+				return nil, j.loadErr
+			}
+			return nil, fmt.Errorf("JWKS from %s is not available", j.source)
+		}
+		return nil, &TokenError{Reason: fmt.Sprintf("unknown signing key %q", kid)}
+	}
+	return key, nil
+}
+
+// Refresh reloads the key set now, or waits for the reload already running
+func (j *JWKS) Refresh(ctx context.Context) error {
+	j.mu.Lock()
+	done := j.startReload()
+	j.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.loadErr
+}
+
+func (j *JWKS) lookup(kid string) crypto.PublicKey {
+	if kid == "" && len(j.keys) == 1 {
+		for _, key := range j.keys {
+			return key
+		}
+	}
+	return j.keys[kid]
+}
+
+// startReload starts a reload unless one is running and returns the channel
+// closed when it finishes. j.mu must be held.
+func (j *JWKS) startReload() <-chan struct{} {
+	if j.reloading == nil {
+		j.reloading = make(chan struct{})
+		j.attemptedAt = time.Now()
+		go j.reload(j.reloading)
+	}
+	return j.reloading
+}
+
+// reload fetches the key set without holding the lock. It is not tied to the
+// request that started it, since other callers may be waiting for it too.
+func (j *JWKS) reload(done chan struct{}) {
+	keys, err := j.fetch(context.Background())
+
+	j.mu.Lock()
+	j.loadErr = err
+	if err == nil {
+		j.keys = keys
+		j.loadedAt = time.Now()
+	} else if j.keys != nil {
+		log.Printf("⚠️  Failed to reload JWKS, keeping cached keys: %v", err)
+	}
+	j.reloading = nil
+	j.mu.Unlock()
+	close(done)
+}
+
+func (j *JWKS) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	data, err := j.load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load JWKS from %s: %w", j.source, err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS from %s: %w", j.source, err)
+	}
+	return keys, nil
+}
+
+func (j *JWKS) load(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(j.source, "http://") && !strings.HasPrefix(j.source, "https://") {
+		return os.ReadFile(strings.TrimPrefix(j.source, "file://"))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// parseJWKS returns the signing keys of a JWKS document by key ID, skipping
+// encryption keys and key types that cannot verify RS256 or ES256
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			log.Printf("⚠️  Skipping JWKS key %q: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no usable signing keys")
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %v", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, fmt.Errorf("invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, errX := decodeBigInt(k.X)
+		y, errY := decodeBigInt(k.Y)
+		if errX != nil || errY != nil || !elliptic.P256().IsOnCurve(x, y) {
+			return nil, fmt.Errorf("invalid point")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("empty value")
+	}
+	return new(big.Int).SetBytes(raw), nil
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"api-s3/config"
+	"api-s3/models"
+)
+
+// TokenError explains why a bearer token was rejected
+type TokenError struct {
+	Reason string
+}
+
+func (e *TokenError) Error() string {
+	return e.Reason
+}
+
+func rejectToken(format string, args ...any) error {
+	return &TokenError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// tokenPermissions are the scopes a token can be granted; admin is reserved
+// for API keys
+var tokenPermissions = []string{models.ScopeUpload, models.ScopeRead, models.ScopeDelete}
+
+// JWTVerifier validates RS256 and ES256 signed JWT bearer tokens against a
+// JWKS and maps their scopes to permissions
+type JWTVerifier struct {
+	jwks        *JWKS
+	issuer      string
+	audience    string
+	scopeClaim  []string
+	tenantClaim []string
+	scopeMap    map[string][]string
+	clockSkew   time.Duration
+}
+
+// NewJWTVerifier creates a verifier from the JWT settings of the
+// configuration, or returns nil when JWT_JWKS_URL is not set
+func NewJWTVerifier() (*JWTVerifier, error) {
+	cfg := config.AppConfig
+	if cfg.JWTJWKSURL == "" {
+		return nil, nil
+	}
+	if cfg.JWTIssuer == "" || cfg.JWTAudience == "" {
+		return nil, errors.New("JWT_ISSUER and JWT_AUDIENCE are required with JWT_JWKS_URL")
+	}
+
+	scopeMap := map[string][]string{}
+	for _, permission := range tokenPermissions {
+		scopeMap[permission] = []string{permission}
+	}
+	if len(cfg.JWTScopeMap) > 0 {
+		scopeMap = map[string][]string{}
+		for _, pair := range cfg.JWTScopeMap {
+			scope, permission, ok := strings.Cut(pair, "=")
+			scope, permission = strings.TrimSpace(scope), strings.TrimSpace(permission)
+			if !ok || scope == "" || !allowed(tokenPermissions, permission) {
+				return nil, fmt.Errorf("invalid JWT_SCOPE_MAP entry %q, expected scope=upload|read|delete", pair)
+			}
+			scopeMap[scope] = append(scopeMap[scope], permission)
+		}
+	}
+
+	var tenantClaim []string
+	if cfg.JWTTenantClaim != "" {
+		tenantClaim = strings.Split(cfg.JWTTenantClaim, ".")
+	}
+
+	return &JWTVerifier{
+		jwks:        NewJWKS(cfg.JWTJWKSURL, time.Duration(cfg.JWTJWKSCacheTTL)*time.Minute),
+		issuer:      cfg.JWTIssuer,
+		audience:    cfg.JWTAudience,
+		scopeClaim:  strings.Split(cfg.JWTScopeClaim, "."),
+		tenantClaim: tenantClaim,
+		scopeMap:    scopeMap,
+		clockSkew:   time.Duration(cfg.JWTClockSkew) * time.Second,
+	}, nil
+}
+
+// JWKS returns the key set the verifier checks signatures against
+func (v *JWTVerifier) JWKS() *JWKS {
+	return v.jwks
+}
+
+// IsJWT reports whether a bearer credential looks like a JWT rather than an
+// API key
+func IsJWT(credential string) bool {
+	return strings.Count(credential, ".") == 2
+}
+
+// Verify checks the signature, issuer, audience and lifetime of a token and
+// returns what it grants. Rejected tokens are returned as *TokenError; other
+// errors mean the JWKS could not be loaded.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (*models.TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, rejectToken("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, rejectToken("malformed token header")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, rejectToken("malformed token signature")
+	}
+	if header.Alg != "RS256" && header.Alg != "ES256" {
+		return nil, rejectToken("unsupported signing algorithm %q", header.Alg)
+	}
+
+	key, err := v.jwks.Key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if !verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature) {
+		return nil, rejectToken("invalid token signature")
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, rejectToken("malformed token payload")
+	}
+	return v.checkClaims(claims)
+}
+
+func (v *JWTVerifier) checkClaims(claims map[string]any) (*models.TokenClaims, error) {
+	if iss, _ := claims["iss"].(string); iss != v.issuer {
+		return nil, rejectToken("unexpected issuer %q", iss)
+	}
+	if !hasAudience(claims["aud"], v.audience) {
+		return nil, rejectToken("token is not intended for %s", v.audience)
+	}
+
+	now := time.Now()
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return nil, rejectToken("token has no expiry")
+	}
+	if now.After(exp.Add(v.clockSkew)) {
+		return nil, rejectToken("token has expired")
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(v.clockSkew).Before(nbf) {
+		return nil, rejectToken("token is not valid yet")
+	}
+
+	tenantID := models.DefaultTenantID
+	if v.tenantClaim != nil {
+		tenantID, _ = claimAt(claims, v.tenantClaim).(string)
+		if !models.IsTenantID(tenantID) {
+			return nil, rejectToken("token has no valid %s claim", strings.Join(v.tenantClaim, "."))
+		}
+	}
+
+	subject, _ := claims["sub"].(string)
+	result := &models.TokenClaims{Subject: subject, TenantID: tenantID, Scopes: []string{}, ExpiresAt: exp}
+	for _, scope := range tokenScopes(claimAt(claims, v.scopeClaim)) {
+		for _, permission := range v.scopeMap[scope] {
+			if !result.HasScope(permission) {
+				result.Scopes = append(result.Scopes, permission)
+			}
+		}
+	}
+	return result, nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) bool {
+	digest := sha256.Sum256([]byte(signed))
+	switch alg {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature) == nil
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(ecKey, digest[:], r, s)
+	}
+	return false
+}
+
+func decodeSegment(segment string, v any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// hasAudience reports whether an aud claim, a string or a list of strings,
+// names audience
+func hasAudience(aud any, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []any:
+		for _, item := range aud {
+			if item == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func numericDate(value any) (time.Time, bool) {
+	number, ok := value.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(seconds), 0), true
+}
+
+// claimAt returns the claim at a dotted path, such as realm_access.roles
+func claimAt(claims map[string]any, path []string) any {
+	var value any = claims
+	for _, name := range path {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+	return value
+}
+
+// tokenScopes reads a space separated scope string or a list of strings
+func tokenScopes(value any) []string {
+	switch value := value.(type) {
+	case string:
+		return strings.Fields(value)
+	case []any:
+		var scopes []string
+		for _, item := range value {
+			if scope, ok := item.(string); ok {
+				scopes = append(scopes, scope)
+			}
+		}
+		return scopes
+	}
+	return nil
+}
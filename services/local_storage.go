@@ -0,0 +1,245 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"api-s3/config"
+)
+
+// LocalStorage stores objects as files below a root directory. Objects are
+// served from /uploads to callers allowed to read them; presigned URLs carry
+// an expiring HMAC signature that stands in for credentials.
+type LocalStorage struct {
+	root string
+	key  []byte // signs presigned URLs
+}
+
+// NewLocalStorage creates a LocalStorage below root. Presigned URLs are signed
+// with LOCAL_URL_SIGNING_KEY, or a random key when it is unset, which makes
+// them invalid after a restart.
+func NewLocalStorage(root string) (*LocalStorage, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %v", err)
+	}
+
+	var key []byte
+	if config.AppConfig != nil {
+		key = []byte(config.AppConfig.LocalURLSigningKey)
+	}
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate URL signing key: %v", err)
+		}
+	}
+	return &LocalStorage{root: root, key: key}, nil
+}
+
+// path resolves key below the root, refusing keys that escape it
+func (l *LocalStorage) path(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" {
+		return "", fmt.Errorf("invalid key: %q", key)
+	}
+	return filepath.Join(l.root, filepath.FromSlash(cleaned)), nil
+}
+
+func (l *LocalStorage) Put(ctx context.Context, key string, reader io.Reader, contentType string) error {
+	filePath, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	// Write to a temp file first so readers never see a partial object
+	tempFile, err := os.CreateTemp(filepath.Dir(filePath), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %v", err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	if _, err := io.Copy(tempFile, reader); err != nil {
+		tempFile.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %v", err)
+	}
+	if err := os.Rename(tempFile.Name(), filePath); err != nil {
+		return fmt.Errorf("failed to store file: %v", err)
+	}
+	return nil
+}
+
+func (l *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	return l.GetRange(ctx, key, 0, -1)
+}
+
+func (l *LocalStorage) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, *ObjectInfo, error) {
+	filePath, err := l.path(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+		}
+		return nil, nil, fmt.Errorf("failed to open file: %v", err)
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed to stat file: %v", err)
+	}
+
+	if offset > 0 {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, nil, fmt.Errorf("failed to seek file: %v", err)
+		}
+	}
+
+	var body io.ReadCloser = file
+	if length >= 0 {
+		body = struct {
+			io.Reader
+			io.Closer
+		}{io.LimitReader(file, length), file}
+	}
+
+	return body, l.objectInfo(key, fileInfo), nil
+}
+
+func (l *LocalStorage) Head(ctx context.Context, key string) (*ObjectInfo, error) {
+	filePath, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+		}
+		return nil, fmt.Errorf("failed to stat file: %v", err)
+	}
+	if fileInfo.IsDir() {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+	return l.objectInfo(key, fileInfo), nil
+}
+
+// List walks only the directory holding prefix, since the key prefix may end
+// within a name (media/ab matches media/abc/...)
+func (l *LocalStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+
+	dir := prefix
+	if !strings.HasSuffix(dir, "/") {
+		dir = path.Dir(dir)
+	}
+	start := filepath.Join(l.root, filepath.FromSlash(path.Clean("/"+dir)))
+	if _, err := os.Stat(start); os.IsNotExist(err) {
+		return objects, nil
+	}
+
+	err := filepath.Walk(start, func(filePath string, fileInfo os.FileInfo, err error) error {
+		if err != nil || fileInfo.IsDir() || strings.HasPrefix(fileInfo.Name(), ".upload-") {
+			return err
+		}
+
+		relative, err := filepath.Rel(l.root, filePath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(relative)
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, *l.objectInfo(key, fileInfo))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %v", err)
+	}
+
+	return objects, nil
+}
+
+func (l *LocalStorage) Delete(ctx context.Context, key string) error {
+	filePath, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete file: %v", err)
+	}
+
+	// Remove directories left empty, stopping at the storage root
+	for dir := filepath.Dir(filePath); dir != filepath.Clean(l.root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// PresignGet returns the /uploads URL of key with an expiry and a signature,
+// which VerifyPresigned accepts in place of credentials
+func (l *LocalStorage) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	expiresAt := strconv.FormatInt(time.Now().Add(expires).Unix(), 10)
+	query := url.Values{
+		"expires":   {expiresAt},
+		"signature": {l.sign(key, expiresAt)},
+	}
+	return l.URL(key) + "?" + query.Encode(), nil
+}
+
+// VerifyPresigned reports whether query carries an unexpired signature made by
+// PresignGet for key
+func (l *LocalStorage) VerifyPresigned(key string, query url.Values) bool {
+	expiresAt, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return false
+	}
+	return hmac.Equal([]byte(query.Get("signature")), []byte(l.sign(key, query.Get("expires"))))
+}
+
+// sign returns the base64url HMAC-SHA256 of the cleaned key and the expiry
+func (l *LocalStorage) sign(key, expiresAt string) string {
+	mac := hmac.New(sha256.New, l.key)
+	mac.Write([]byte(strings.TrimPrefix(path.Clean("/"+key), "/") + "\n" + expiresAt))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (l *LocalStorage) URL(key string) string {
+	return "/uploads/" + strings.TrimPrefix(key, "/")
+}
+
+func (l *LocalStorage) objectInfo(key string, fileInfo os.FileInfo) *ObjectInfo {
+	return &ObjectInfo{
+		Key:          key,
+		Size:         fileInfo.Size(),
+		ContentType:  contentTypeByExtension(key),
+		ETag:         fmt.Sprintf("\"%x-%x\"", fileInfo.ModTime().UnixNano(), fileInfo.Size()),
+		LastModified: fileInfo.ModTime(),
+	}
+}
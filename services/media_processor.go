@@ -0,0 +1,379 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"api-s3/config"
+	"api-s3/models"
+	"api-s3/repository"
+)
+
+// MediaProcessor is the JobProcessor for uploaded media: it produces the
+// playable MP4 and the streaming outputs of videos and the responsive
+// variants of images, and records them on the media item
+type MediaProcessor struct {
+	storage      Storage
+	videoService *VideoService
+	repo         repository.MediaRepository
+	events       *EventBroker
+}
+
+// NewMediaProcessor creates a new MediaProcessor instance
+func NewMediaProcessor(storage Storage, videoService *VideoService, repo repository.MediaRepository, events *EventBroker) *MediaProcessor {
+	return &MediaProcessor{
+		storage:      storage,
+		videoService: videoService,
+		repo:         repo,
+		events:       events,
+	}
+}
+
+// Process turns the spooled upload of a job into a playable MP4, kept as is,
+// remuxed or transcoded as PlanConversion decides, and reports the progress
+// of every stage on the job
+func (p *MediaProcessor) Process(ctx context.Context, job *models.VideoProcessingJob) error {
+	media, err := p.repo.GetMedia(job.MediaID)
+	if err != nil {
+		return fmt.Errorf("failed to load media %s: %v", job.MediaID, err)
+	}
+	if err := p.ensureInput(ctx, job, media); err != nil {
+		return err
+	}
+	if media.MediaType == models.MediaTypeImage {
+		return p.processImage(ctx, job, media)
+	}
+
+	mediaID := media.ID
+	log.Printf("🎬 Starting fast video conversion for: %s", mediaID)
+
+	job.Stage = models.JobStageProbing
+	if err := p.repo.UpdateJob(job); err != nil {
+		log.Printf("⚠️ Failed to update job %s: %v", job.ID, err)
+	}
+	p.events.Publish(models.EventProcessingProgress, job.MediaID, nil, job)
+	info, err := p.videoService.getVideoInfo(ctx, job.InputPath)
+	if err != nil {
+		return fmt.Errorf("failed to get video info: %v", err)
+	}
+	// Uploads were probed when accepted, but the allowed codecs may have changed since
+	if err := CheckProbe(info.Probe); err != nil {
+		return fmt.Errorf("video rejected: %w", err)
+	}
+	media.Duration = info.Duration
+	media.Width = info.Width
+	media.Height = info.Height
+	media.Probe = info.Probe
+
+	// Decide per stream from the probe: keep, remux or transcode
+	conversion, err := PlanConversion(info.Probe, job.InputPath, media.OriginalName)
+	if err != nil {
+		return fmt.Errorf("failed to plan conversion: %v", err)
+	}
+	job.ProcessingMode = conversion.Mode
+	job.ProcessingReason = conversion.Reason
+	log.Printf("🧭 %s: %s (%s; video %s, audio %q)", mediaID, conversion.Mode, conversion.Reason,
+		conversion.VideoCodec, conversion.AudioCodec)
+	ladder := p.ladder(media)
+	progress := newJobProgress(p.repo, p.events, job, p.plan(info, conversion.Mode, ladder))
+
+	if conversion.Mode == models.ProcessingModePassthrough {
+		key := MediaKey(media.TenantID, mediaID, media.OriginalName)
+		progress.Begin(models.JobStageUploading)
+		if media.StorageKey != key {
+			log.Printf("☁️ Uploading original MP4 to storage: %s", key)
+			uploadedURL, err := UploadLocalFile(ctx, p.storage, job.InputPath, key, "video/mp4")
+			if err != nil {
+				log.Printf("❌ Storage upload failed: %v", err)
+				return err
+			}
+
+			log.Printf("✅ Original MP4 upload completed: %s", uploadedURL)
+			media.URL = uploadedURL
+			media.StorageKey = key
+		}
+		return p.createStreamingOutputs(ctx, job.InputPath, media, info, ladder, progress)
+	}
+
+	tempDir, err := os.MkdirTemp("", "convert_"+mediaID+"_")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	outputFilename := fmt.Sprintf("%s_converted.mp4", mediaID)
+	outputPath := filepath.Join(tempDir, outputFilename)
+	progress.Begin(models.JobStageConverting)
+	if err := p.convert(ctx, conversion, job.InputPath, outputPath, media.Size, info.Duration, progress.Update); err != nil {
+		return err
+	}
+
+	// Upload converted video to storage
+	key := MediaKey(media.TenantID, mediaID, outputFilename)
+	log.Printf("☁️ Uploading converted video to storage: %s", key)
+
+	progress.Begin(models.JobStageUploading)
+	uploadedURL, err := UploadLocalFile(ctx, p.storage, outputPath, key, "video/mp4")
+	if err != nil {
+		log.Printf("❌ Storage upload failed: %v", err)
+		return err
+	}
+
+	log.Printf("✅ Video %s completed: %s", conversion.Mode, uploadedURL)
+	media.Filename = outputFilename
+	media.MimeType = "video/mp4"
+	media.URL = uploadedURL
+	media.StorageKey = key
+	return p.createStreamingOutputs(ctx, job.InputPath, media, info, ladder, progress)
+}
+
+// processImage stores an upright copy of an uploaded image without metadata
+// in place of the original and encodes its responsive variants
+func (p *MediaProcessor) processImage(ctx context.Context, job *models.VideoProcessingJob, media *models.Media) error {
+	log.Printf("🖼️ Starting image processing for: %s", media.ID)
+	progress := newJobProgress(p.repo, p.events, job, []jobStage{
+		{models.JobStageProbing, 0.1},
+		{models.JobStageUploading, 0.2},
+		{models.JobStageImages, 1},
+	})
+
+	progress.Begin(models.JobStageProbing)
+	info, err := p.videoService.getImageInfo(ctx, job.InputPath)
+	if err != nil {
+		return fmt.Errorf("failed to read image: %v", err)
+	}
+	media.Width = info.Width
+	media.Height = info.Height
+	media.Probe = info.Probe
+
+	tempDir, err := os.MkdirTemp("", "image_"+media.ID+"_")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sanitized, err := p.videoService.SanitizeImage(ctx, job.InputPath, tempDir, info)
+	if err != nil {
+		return err
+	}
+
+	// The sanitized copy replaces the original, so location data is never served
+	progress.Begin(models.JobStageUploading)
+	key := MediaKey(media.TenantID, media.ID, media.OriginalName)
+	log.Printf("☁️ Uploading sanitized image to storage: %s", key)
+	uploadedURL, err := UploadLocalFile(ctx, p.storage, sanitized, key, contentTypeByExtension(key))
+	if err != nil {
+		log.Printf("❌ Storage upload failed: %v", err)
+		return err
+	}
+	media.URL = uploadedURL
+	media.StorageKey = key
+	if stat, err := os.Stat(sanitized); err == nil {
+		media.Size = stat.Size()
+	}
+
+	progress.Begin(models.JobStageImages)
+	variants, err := p.videoService.CreateImageVariants(ctx, sanitized, media.TenantID, media.ID, info, progress.Update)
+	if err != nil {
+		return err
+	}
+	log.Printf("✅ %d image variants ready for %s", len(variants), media.ID)
+	media.ThumbnailURL = variants[0].URL
+
+	if err := p.repo.UpdateMedia(media); err != nil {
+		return fmt.Errorf("failed to save media: %v", err)
+	}
+	if err := p.repo.SaveImageVariants(media.ID, variants); err != nil {
+		return fmt.Errorf("failed to save image variants: %v", err)
+	}
+	return nil
+}
+
+// ensureInput makes sure the source of a job is on local disk. Uploads that
+// were stored without a spooled copy, or whose copy is gone, are downloaded
+// into the spool.
+func (p *MediaProcessor) ensureInput(ctx context.Context, job *models.VideoProcessingJob, media *models.Media) error {
+	if job.InputPath != "" {
+		if _, err := os.Stat(job.InputPath); err == nil {
+			return nil
+		}
+	}
+	if media.StorageKey == "" {
+		return fmt.Errorf("spooled upload is missing and the media has no stored original")
+	}
+
+	log.Printf("⬇️ Downloading original from storage: %s", media.StorageKey)
+	inputPath, err := SpoolObject(ctx, p.storage, media.StorageKey, media.ID, media.OriginalName)
+	if err != nil {
+		return fmt.Errorf("failed to download original: %v", err)
+	}
+
+	job.InputPath = inputPath
+	return nil
+}
+
+// ladder returns the renditions of the encoding profile of the tenant owning
+// media, or nil for the HLS_RENDITIONS ladder
+func (p *MediaProcessor) ladder(media *models.Media) []string {
+	tenant, err := p.repo.GetTenant(media.TenantID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			log.Printf("⚠️ Failed to load tenant %s, using the default ladder: %v", media.TenantID, err)
+		}
+		return nil
+	}
+	return tenant.EncodingProfile.Renditions
+}
+
+// plan weights the stages of a job by roughly how much encoding they do: a
+// transcode and every HLS rendition count as one encode, a remux only copies,
+// trickplay only decodes, the preview encodes a few seconds, DASH copies the
+// HLS renditions
+func (p *MediaProcessor) plan(info *VideoInfo, mode string, ladder []string) []jobStage {
+	var stages []jobStage
+	switch mode {
+	case models.ProcessingModeTranscode:
+		stages = append(stages, jobStage{models.JobStageConverting, 1})
+	case models.ProcessingModeRemux:
+		stages = append(stages, jobStage{models.JobStageConverting, 0.2})
+	}
+	stages = append(stages, jobStage{models.JobStageUploading, 0.2})
+	if config.AppConfig.EnableTrickplay {
+		stages = append(stages, jobStage{models.JobStageTrickplay, 0.5})
+	}
+	if config.AppConfig.EnablePreview {
+		stages = append(stages, jobStage{models.JobStagePreview, 0.1})
+	}
+
+	renditions := float64(len(selectRenditions(ladder, info)))
+	if config.AppConfig.EnableHLS || config.AppConfig.EnableDASH {
+		stages = append(stages, jobStage{models.JobStageHLS, renditions})
+	}
+	if config.AppConfig.EnableDASH {
+		stages = append(stages, jobStage{models.JobStageDASH, 0.2})
+	}
+	return stages
+}
+
+// convert remuxes or transcodes the input into a web friendly MP4 as planned,
+// with a timeout that grows with the duration of the video
+func (p *MediaProcessor) convert(ctx context.Context, conversion *ConversionPlan, inputPath, outputPath string, size int64, duration float64, onProgress ProgressFunc) error {
+	log.Printf("🎬 Converting to MP4 (%s)...", conversion.Mode)
+
+	timeout := ConvertTimeout(duration)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	log.Printf("⏱️ Starting FFmpeg %s (timeout: %v)...", conversion.Mode, timeout)
+	log.Printf("📊 Input file size: %d bytes (%d MB)", size, size/(1024*1024))
+
+	if err := runFFmpeg(ctx, config.AppConfig.FFmpegPath, conversion.FFmpegArgs(inputPath, outputPath), duration, onProgress); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			log.Printf("❌ FFmpeg conversion timed out")
+			return fmt.Errorf("FFmpeg conversion timed out")
+		}
+		return err
+	}
+
+	log.Printf("✅ FFmpeg %s completed successfully", conversion.Mode)
+	return nil
+}
+
+// ConvertTimeout allows CONVERT_TIMEOUT_RATIO seconds of conversion per second
+// of video and at least CONVERT_TIMEOUT_MIN minutes, which is all a video of
+// unknown duration gets
+func ConvertTimeout(duration float64) time.Duration {
+	timeout := time.Duration(config.AppConfig.ConvertTimeoutMin) * time.Minute
+	scaled := time.Duration(duration * float64(config.AppConfig.ConvertTimeoutRatio) * float64(time.Second))
+	if scaled > timeout {
+		timeout = scaled
+	}
+	return timeout
+}
+
+// createStreamingOutputs builds the adaptive bitrate HLS ladder with its
+// progressive MP4 copies and the DASH package, each only when enabled in the
+// configuration, and persists the media record together with its variants
+func (p *MediaProcessor) createStreamingOutputs(ctx context.Context, inputPath string, media *models.Media, info *VideoInfo, ladder []string, progress *jobProgress) error {
+	var variants []models.VideoVariant
+
+	// A missing poster should not cost the viewer the video, so failures only warn
+	if p.videoService != nil {
+		thumbnails, err := p.videoService.CreateThumbnails(ctx, inputPath, media.TenantID, media.ID, info)
+		if err != nil {
+			log.Printf("⚠️ Thumbnail generation failed for %s: %v", media.ID, err)
+		} else {
+			media.Thumbnails = thumbnails
+			if thumbnail := SelectThumbnail(thumbnails, DefaultThumbnailSize); thumbnail != nil {
+				media.ThumbnailURL = thumbnail.URL
+			}
+			log.Printf("✅ %d thumbnails ready: %s", len(thumbnails), media.ThumbnailURL)
+		}
+	}
+
+	// Scrub bar previews are optional as well
+	if p.videoService != nil && config.AppConfig.EnableTrickplay {
+		progress.Begin(models.JobStageTrickplay)
+		trickplay, err := p.videoService.CreateTrickplay(ctx, inputPath, media.TenantID, media.ID, info, progress.Update)
+		if err != nil {
+			log.Printf("⚠️ Trickplay generation failed for %s: %v", media.ID, err)
+		} else {
+			log.Printf("✅ Trickplay ready with %d sheets: %s", len(trickplay.SpriteURLs), trickplay.VTTURL)
+			media.Trickplay = trickplay
+		}
+	}
+
+	if p.videoService != nil && config.AppConfig.EnablePreview {
+		progress.Begin(models.JobStagePreview)
+		preview, err := p.videoService.CreatePreview(ctx, inputPath, media.TenantID, media.ID, info, progress.Update)
+		if err != nil {
+			log.Printf("⚠️ Preview generation failed for %s: %v", media.ID, err)
+		} else {
+			log.Printf("✅ Preview ready: %s", preview.URL)
+			media.Preview = preview
+		}
+	}
+
+	// DASH is packaged from the HLS renditions, so it needs the ladder encoded
+	if p.videoService != nil && (config.AppConfig.EnableHLS || config.AppConfig.EnableDASH) {
+		workDir, err := os.MkdirTemp("", "renditions_"+media.ID+"_")
+		if err != nil {
+			return fmt.Errorf("failed to create temp directory: %v", err)
+		}
+		defer os.RemoveAll(workDir)
+
+		progress.Begin(models.JobStageHLS)
+		hlsVariants, masterURL, err := p.videoService.CreateHLSLadder(ctx, inputPath, workDir, media.TenantID, media.ID, info, ladder, progress.Update)
+		if err != nil {
+			log.Printf("❌ HLS ladder creation failed: %v", err)
+			return err
+		}
+		log.Printf("✅ HLS ladder ready with %d variants: %s", len(hlsVariants), masterURL)
+		variants = append(variants, hlsVariants...)
+		media.MasterURL = masterURL
+
+		if config.AppConfig.EnableDASH {
+			progress.Begin(models.JobStageDASH)
+			manifestURL, err := p.videoService.CreateDASHPackage(ctx, workDir, media.TenantID, media.ID, info, hlsVariants, progress.Update)
+			if err != nil {
+				log.Printf("❌ DASH packaging failed: %v", err)
+				return err
+			}
+			log.Printf("✅ DASH package ready: %s", manifestURL)
+			media.DashURL = manifestURL
+		}
+	}
+
+	if err := p.repo.UpdateMedia(media); err != nil {
+		return fmt.Errorf("failed to save media: %v", err)
+	}
+	if err := p.repo.SaveVariants(media.ID, variants); err != nil {
+		return fmt.Errorf("failed to save variants: %v", err)
+	}
+	return nil
+}
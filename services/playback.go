@@ -0,0 +1,102 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"api-s3/config"
+	"api-s3/models"
+)
+
+// PlaybackSigner mints and verifies the HMAC signed tokens the playback
+// endpoints require
+type PlaybackSigner struct {
+	key []byte
+}
+
+// NewPlaybackSigner returns a signer keyed with PLAYBACK_SIGNING_KEY, or nil
+// when signed playback is disabled
+func NewPlaybackSigner() *PlaybackSigner {
+	if config.AppConfig.PlaybackSigningKey == "" {
+		return nil
+	}
+	return &PlaybackSigner{key: []byte(config.AppConfig.PlaybackSigningKey)}
+}
+
+// Sign returns a token granting claims: the base64url encoded JSON claims and
+// their base64url encoded HMAC-SHA256, joined by a dot
+func (s *PlaybackSigner) Sign(claims *models.PlaybackClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.mac(encoded)), nil
+}
+
+// Verify checks the signature and expiry of a token and, when the token is
+// bound to an IP address, that clientIP matches it. Rejected tokens are
+// returned as *TokenError.
+func (s *PlaybackSigner) Verify(token, clientIP string) (*models.PlaybackClaims, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, rejectToken("malformed token")
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, s.mac(encoded)) {
+		return nil, rejectToken("invalid token signature")
+	}
+
+	var claims models.PlaybackClaims
+	if err := decodeSegment(encoded, &claims); err != nil || claims.MediaID == "" {
+		return nil, rejectToken("malformed token")
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, rejectToken("token expired")
+	}
+	if claims.IP != "" && claims.IP != clientIP {
+		return nil, rejectToken("token is bound to another IP address")
+	}
+	return &claims, nil
+}
+
+func (s *PlaybackSigner) mac(encoded string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+// FilterMasterPlaylist drops the variants of an HLS master playlist whose
+// quality the claims do not allow. Variant URIs name the quality as their
+// first directory, as written by buildMasterPlaylist.
+func FilterMasterPlaylist(playlist []byte, claims *models.PlaybackClaims) []byte {
+	var buf bytes.Buffer
+	var streamInf string
+	scanner := bufio.NewScanner(bytes.NewReader(playlist))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			streamInf = line
+			continue
+		case streamInf != "" && line != "" && !strings.HasPrefix(line, "#"):
+			quality, _, _ := strings.Cut(line, "/")
+			if claims.AllowsRendition(models.VideoQuality(quality)) {
+				buf.WriteString(streamInf + "\n")
+				buf.WriteString(line + "\n")
+			}
+			streamInf = ""
+			continue
+		}
+		if streamInf == "" {
+			buf.WriteString(line + "\n")
+		}
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"api-s3/config"
+	"api-s3/models"
+)
+
+// PreviewSegment is a window of the source video cut into the preview
+type PreviewSegment struct {
+	Start    float64
+	Duration float64
+}
+
+// PreviewKey returns the storage key of the animated preview of a media item
+func PreviewKey(tenantID, mediaID, format string) string {
+	return MediaPrefix(tenantID, mediaID) + "preview." + format
+}
+
+// PreviewSegments spreads count windows of length seconds evenly over the
+// video, each centered in its share of the duration; a single window is the
+// middle of the video. Videos too short for every window are used whole.
+func PreviewSegments(duration float64, count int, length float64) []PreviewSegment {
+	if count <= 0 {
+		count = 1
+	}
+	if length <= 0 {
+		length = 1
+	}
+	if duration <= 0 {
+		return []PreviewSegment{{Start: 0, Duration: length * float64(count)}}
+	}
+	if duration <= length*float64(count) {
+		return []PreviewSegment{{Start: 0, Duration: duration}}
+	}
+
+	spacing := duration / float64(count)
+	segments := make([]PreviewSegment, count)
+	for i := range segments {
+		start := float64(i)*spacing + (spacing-length)/2
+		if start < 0 {
+			start = 0
+		}
+		segments[i] = PreviewSegment{Start: start, Duration: length}
+	}
+	return segments
+}
+
+// CreatePreview cuts PREVIEW_SEGMENTS windows of PREVIEW_SEGMENT_DURATION
+// seconds out of the video and joins them into a silent clip of
+// PREVIEW_WIDTH pixels at PREVIEW_FPS, encoded as MP4, animated WebP or GIF
+// as set in PREVIEW_FORMAT. onProgress, if set, receives the fraction of the
+// preview encoded so far.
+func (v *VideoService) CreatePreview(ctx context.Context, inputPath, tenantID, mediaID string, info *VideoInfo, onProgress ProgressFunc) (*models.Preview, error) {
+	tempDir, err := os.MkdirTemp("", "preview_"+mediaID+"_")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cfg := config.AppConfig
+	format := strings.ToLower(cfg.PreviewFormat)
+	if format != "webp" && format != "gif" {
+		format = "mp4"
+	}
+	width := cfg.PreviewWidth
+	if width <= 0 {
+		width = 320
+	}
+	fps := cfg.PreviewFPS
+	if fps <= 0 {
+		fps = 12
+	}
+
+	segments := PreviewSegments(info.Duration, cfg.PreviewSegments, float64(cfg.PreviewSegmentDuration))
+	preview := &models.Preview{Format: format, Segments: len(segments)}
+	preview.Width, preview.Height = scaleToWidth(info.Width, info.Height, width)
+	for _, segment := range segments {
+		preview.Duration += segment.Duration
+	}
+	log.Printf("🎞️ Creating %.1fs %s preview from %d segments", preview.Duration, format, len(segments))
+
+	outputPath := filepath.Join(tempDir, "preview."+format)
+	args := previewArgs(inputPath, outputPath, segments, preview, fps)
+	if err := runFFmpeg(ctx, v.ffmpegPath, args, preview.Duration, onProgress); err != nil {
+		return nil, fmt.Errorf("failed to create preview: %v", err)
+	}
+
+	preview.StorageKey = PreviewKey(tenantID, mediaID, format)
+	preview.URL, err = UploadLocalFile(ctx, v.storage, outputPath, preview.StorageKey, contentTypeByExtension(outputPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload preview: %v", err)
+	}
+	return preview, nil
+}
+
+// previewArgs builds the FFmpeg arguments opening every segment as its own
+// seeked input, scaling them and concatenating them without audio
+func previewArgs(inputPath, outputPath string, segments []PreviewSegment, preview *models.Preview, fps int) []string {
+	var args, filters []string
+	labels := ""
+	for i, segment := range segments {
+		args = append(args,
+			"-ss", fmt.Sprintf("%.3f", segment.Start),
+			"-t", fmt.Sprintf("%.3f", segment.Duration),
+			"-i", inputPath,
+		)
+		filters = append(filters, fmt.Sprintf("[%d:v]fps=%d,scale=%d:%d:flags=lanczos,setsar=1[v%d]",
+			i, fps, preview.Width, preview.Height, i))
+		labels += fmt.Sprintf("[v%d]", i)
+	}
+	filters = append(filters, fmt.Sprintf("%sconcat=n=%d:v=1:a=0[clip]", labels, len(segments)))
+
+	output := "[clip]"
+	var codec []string
+	switch preview.Format {
+	case "gif":
+		// A palette built from the clip itself keeps GIF colors close to the source
+		filters = append(filters, "[clip]split[a][b];[a]palettegen=stats_mode=diff[palette];[b][palette]paletteuse=dither=bayer[gif]")
+		output = "[gif]"
+		codec = []string{"-loop", "0"}
+	case "webp":
+		codec = []string{"-c:v", "libwebp", "-quality", "60", "-loop", "0"}
+	default:
+		codec = []string{"-c:v", "libx264", "-preset", "veryfast", "-crf", "28", "-pix_fmt", "yuv420p", "-movflags", "+faststart"}
+	}
+
+	args = append(args, "-filter_complex", strings.Join(filters, ";"), "-map", output, "-an")
+	args = append(args, codec...)
+	return append(args, "-y", outputPath)
+}
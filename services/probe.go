@@ -0,0 +1,170 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"api-s3/models"
+)
+
+// ffprobeOutput is the part of `ffprobe -print_format json -show_format
+// -show_streams` that is kept. ffprobe prints most numbers as strings.
+type ffprobeOutput struct {
+	Format struct {
+		FormatName     string            `json:"format_name"`
+		FormatLongName string            `json:"format_long_name"`
+		Duration       string            `json:"duration"`
+		BitRate        string            `json:"bit_rate"`
+		Size           string            `json:"size"`
+		Tags           map[string]string `json:"tags"`
+	} `json:"format"`
+	Streams []struct {
+		Index          int               `json:"index"`
+		CodecType      string            `json:"codec_type"`
+		CodecName      string            `json:"codec_name"`
+		CodecLongName  string            `json:"codec_long_name"`
+		Profile        string            `json:"profile"`
+		BitRate        string            `json:"bit_rate"`
+		Duration       string            `json:"duration"`
+		Width          int               `json:"width"`
+		Height         int               `json:"height"`
+		PixFmt         string            `json:"pix_fmt"`
+		AvgFrameRate   string            `json:"avg_frame_rate"`
+		RFrameRate     string            `json:"r_frame_rate"`
+		ColorPrimaries string            `json:"color_primaries"`
+		ColorTransfer  string            `json:"color_transfer"`
+		ColorSpace     string            `json:"color_space"`
+		ColorRange     string            `json:"color_range"`
+		Channels       int               `json:"channels"`
+		ChannelLayout  string            `json:"channel_layout"`
+		SampleRate     string            `json:"sample_rate"`
+		Tags           map[string]string `json:"tags"`
+		Disposition    map[string]int    `json:"disposition"`
+		SideDataList   []struct {
+			SideDataType string  `json:"side_data_type"`
+			Rotation     float64 `json:"rotation"`
+		} `json:"side_data_list"`
+	} `json:"streams"`
+}
+
+// ProbeMedia inspects a media file with ffprobe. Only the container headers
+// are read, the streams are not decoded.
+func ProbeMedia(ctx context.Context, ffprobePath, inputPath string) (*models.MediaProbe, error) {
+	cmd := exec.CommandContext(ctx, ffprobePath,
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		inputPath,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return ParseProbeOutput(output)
+}
+
+// ParseProbeOutput converts the JSON printed by ffprobe into a MediaProbe
+func ParseProbeOutput(data []byte) (*models.MediaProbe, error) {
+	var output ffprobeOutput
+	if err := json.Unmarshal(data, &output); err != nil {
+		return nil, fmt.Errorf("invalid ffprobe output: %v", err)
+	}
+
+	probe := &models.MediaProbe{
+		FormatName:     output.Format.FormatName,
+		FormatLongName: output.Format.FormatLongName,
+		Duration:       parseFloat(output.Format.Duration),
+		Bitrate:        parseInt(output.Format.BitRate),
+		Size:           parseInt(output.Format.Size),
+		Tags:           output.Format.Tags,
+		Streams:        make([]models.ProbeStream, 0, len(output.Streams)),
+	}
+
+	for _, s := range output.Streams {
+		stream := models.ProbeStream{
+			Index:         s.Index,
+			Type:          s.CodecType,
+			Codec:         s.CodecName,
+			CodecLongName: s.CodecLongName,
+			Profile:       s.Profile,
+			Bitrate:       parseInt(s.BitRate),
+			Duration:      parseFloat(s.Duration),
+			Language:      s.Tags["language"],
+			Default:       s.Disposition["default"] == 1,
+			AttachedPic:   s.Disposition["attached_pic"] == 1,
+			Tags:          s.Tags,
+		}
+
+		switch s.CodecType {
+		case models.StreamTypeVideo:
+			stream.Width = s.Width
+			stream.Height = s.Height
+			stream.PixelFormat = s.PixFmt
+			stream.FrameRate = parseFrameRate(s.AvgFrameRate)
+			if stream.FrameRate == 0 {
+				stream.FrameRate = parseFrameRate(s.RFrameRate)
+			}
+			stream.ColorPrimaries = s.ColorPrimaries
+			stream.ColorTransfer = s.ColorTransfer
+			stream.ColorSpace = s.ColorSpace
+			stream.ColorRange = s.ColorRange
+			// PQ (HDR10, Dolby Vision) and HLG transfer functions
+			stream.HDR = s.ColorTransfer == "smpte2084" || s.ColorTransfer == "arib-std-b67"
+
+			// Older ffprobe versions report rotation as a tag, newer ones in
+			// the display matrix, counter-clockwise
+			if rotate, err := strconv.Atoi(s.Tags["rotate"]); err == nil {
+				stream.Rotation = normalizeRotation(rotate)
+			}
+			for _, sideData := range s.SideDataList {
+				if sideData.SideDataType == "Display Matrix" {
+					stream.Rotation = normalizeRotation(-int(math.Round(sideData.Rotation)))
+				}
+			}
+		case models.StreamTypeAudio:
+			stream.Channels = s.Channels
+			stream.ChannelLayout = s.ChannelLayout
+			stream.SampleRate = int(parseInt(s.SampleRate))
+		}
+		probe.Streams = append(probe.Streams, stream)
+	}
+	return probe, nil
+}
+
+// parseFrameRate parses a rational frame rate such as 30000/1001
+func parseFrameRate(value string) float64 {
+	numerator, denominator, ok := strings.Cut(value, "/")
+	if !ok {
+		return parseFloat(value)
+	}
+	n, d := parseFloat(numerator), parseFloat(denominator)
+	if d == 0 {
+		return 0
+	}
+	return math.Round(n/d*1000) / 1000
+}
+
+// normalizeRotation maps a rotation in degrees into [0, 360)
+func normalizeRotation(degrees int) int {
+	return ((degrees % 360) + 360) % 360
+}
+
+func parseFloat(value string) float64 {
+	parsed, _ := strconv.ParseFloat(value, 64)
+	return parsed
+}
+
+func parseInt(value string) int64 {
+	parsed, _ := strconv.ParseInt(value, 10, 64)
+	return parsed
+}
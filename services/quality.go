@@ -0,0 +1,58 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"api-s3/models"
+)
+
+// ParseVideoQuality validates a requested quality: auto, best_quality or a
+// height such as 720p. It returns the quality and its target height, which is
+// zero for auto and best_quality.
+func ParseVideoQuality(value string) (models.VideoQuality, int, error) {
+	quality := models.VideoQuality(strings.ToLower(value))
+	if quality == models.QualityAuto || quality == models.QualityBest {
+		return quality, 0, nil
+	}
+
+	height, err := strconv.Atoi(strings.TrimSuffix(string(quality), "p"))
+	if err != nil || !strings.HasSuffix(string(quality), "p") || height <= 0 {
+		return "", 0, fmt.Errorf("invalid quality %q, use auto, best_quality or a height such as 720p", value)
+	}
+	return quality, height, nil
+}
+
+// SelectVariant picks the progressive MP4 variant to stream for a quality.
+// An exact match wins; otherwise the tallest variant not above the target
+// height is used, then the shortest one above it. auto and best_quality pick
+// the tallest variant. It returns nil when there is no MP4 variant at all.
+func SelectVariant(variants []models.VideoVariant, quality models.VideoQuality, height int) *models.VideoVariant {
+	var exact, below, above *models.VideoVariant
+	for i := range variants {
+		variant := &variants[i]
+		if variant.Format != models.FormatMP4 || variant.StorageKey == "" {
+			continue
+		}
+
+		if variant.Quality == quality {
+			exact = variant
+		}
+		if height == 0 || variant.Height <= height {
+			if below == nil || variant.Height > below.Height {
+				below = variant
+			}
+		} else if above == nil || variant.Height < above.Height {
+			above = variant
+		}
+	}
+
+	switch {
+	case exact != nil:
+		return exact
+	case below != nil:
+		return below
+	}
+	return above
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"api-s3/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// S3 requires every part but the last to be at least 5MB and allows at
+	// most 10000 parts per upload
+	minPartSize = 5 * 1024 * 1024
+	maxParts    = 10000
+)
+
+// MultipartPartSize returns the part size for a multipart upload of size
+// bytes: S3_PART_SIZE, doubled until the upload fits in the part limit
+func MultipartPartSize(size int64) int64 {
+	partSize := config.AppConfig.S3PartSize
+	if partSize < minPartSize {
+		partSize = minPartSize
+	}
+	for size > partSize*maxParts {
+		partSize *= 2
+	}
+	return partSize
+}
+
+// PartProgress reports a stored part of a streaming upload
+type PartProgress struct {
+	PartNumber    int
+	PartSize      int64
+	BytesUploaded int64 // total of every part stored so far
+}
+
+// PartProgressFunc receives the progress of a streaming upload; it may be
+// called from several goroutines, but never concurrently
+type PartProgressFunc func(PartProgress)
+
+// StreamingStorage is implemented by backends that store objects of unknown
+// size from a stream in parts instead of a single request
+type StreamingStorage interface {
+	// PutStream stores the content of reader under key and returns its size
+	PutStream(ctx context.Context, key string, reader io.Reader, contentType string, onPart PartProgressFunc) (int64, error)
+}
+
+// PutStream stores a stream under key, using the parallel multipart upload
+// of the backend when it has one, and returns the number of bytes stored
+func PutStream(ctx context.Context, store Storage, key string, reader io.Reader, contentType string, onPart PartProgressFunc) (int64, error) {
+	if streaming, ok := store.(StreamingStorage); ok {
+		return streaming.PutStream(ctx, key, reader, contentType, onPart)
+	}
+
+	counter := &countingReader{reader: reader}
+	if err := store.Put(ctx, key, counter, contentType); err != nil {
+		return counter.count, err
+	}
+	if onPart != nil {
+		onPart(PartProgress{PartNumber: 1, PartSize: counter.count, BytesUploaded: counter.count})
+	}
+	return counter.count, nil
+}
+
+// PutStream uploads the stream as an S3 multipart upload, sending up to
+// S3_UPLOAD_CONCURRENCY parts in parallel. Memory use is bounded by
+// (concurrency + 1) * S3_PART_SIZE. Streams shorter than one part are sent
+// with a single PutObject. Any failure, including a cancelled ctx when the
+// client disconnects, aborts the upload so no orphaned parts are billed.
+func (s *S3Service) PutStream(ctx context.Context, key string, reader io.Reader, contentType string, onPart PartProgressFunc) (int64, error) {
+	partSize := config.AppConfig.S3PartSize
+	if partSize < minPartSize {
+		partSize = minPartSize
+	}
+	concurrency := config.AppConfig.S3UploadConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	// Read the first part before deciding between a single and a multipart upload
+	first := make([]byte, partSize)
+	n, err := io.ReadFull(reader, first)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		if err := s.Put(ctx, key, bytes.NewReader(first[:n]), contentType); err != nil {
+			return 0, err
+		}
+		if onPart != nil {
+			onPart(PartProgress{PartNumber: 1, PartSize: int64(n), BytesUploaded: int64(n)})
+		}
+		return int64(n), nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read upload: %w", err)
+	}
+
+	created, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to start multipart upload: %v", err)
+	}
+	uploadID := created.UploadId
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		parts    []types.CompletedPart
+		uploaded int64
+		firstErr error
+	)
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+		cancel()
+	}
+
+	// Buffers are recycled so at most concurrency parts are in flight while
+	// the next one is read
+	buffers := make(chan []byte, concurrency+1)
+	buffers <- first
+	for i := 0; i < concurrency; i++ {
+		buffers <- make([]byte, partSize)
+	}
+
+	sendPart := func(partNumber int32, buf []byte, size int) {
+		defer wg.Done()
+		defer func() { buffers <- buf }()
+
+		result, err := s.client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:        aws.String(s.bucket),
+			Key:           aws.String(key),
+			UploadId:      uploadID,
+			PartNumber:    aws.Int32(partNumber),
+			Body:          bytes.NewReader(buf[:size]),
+			ContentLength: aws.Int64(int64(size)),
+		})
+		if err != nil {
+			fail(fmt.Errorf("failed to upload part %d: %v", partNumber, err))
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		parts = append(parts, types.CompletedPart{ETag: result.ETag, PartNumber: aws.Int32(partNumber)})
+		uploaded += int64(size)
+		if onPart != nil {
+			onPart(PartProgress{PartNumber: int(partNumber), PartSize: int64(size), BytesUploaded: uploaded})
+		}
+	}
+
+	<-buffers // first is already filled
+	wg.Add(1)
+	go sendPart(1, first, n)
+
+	for partNumber := int32(2); ctx.Err() == nil; partNumber++ {
+		var buf []byte
+		select {
+		case buf = <-buffers:
+		case <-ctx.Done():
+		}
+		if buf == nil {
+			break
+		}
+
+		n, err := io.ReadFull(reader, buf)
+		if n == 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+			buffers <- buf
+			break
+		}
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			buffers <- buf
+			fail(fmt.Errorf("failed to read upload: %w", err))
+			break
+		}
+		if partNumber > maxParts {
+			buffers <- buf
+			fail(fmt.Errorf("upload exceeds %d parts of %d bytes", maxParts, partSize))
+			break
+		}
+
+		wg.Add(1)
+		go sendPart(partNumber, buf, n)
+		if err != nil {
+			break // short read: this was the last part
+		}
+	}
+	wg.Wait()
+
+	if firstErr == nil && ctx.Err() != nil {
+		firstErr = ctx.Err()
+	}
+	if firstErr != nil {
+		s.abortMultipart(key, uploadID)
+		return uploaded, firstErr
+	}
+
+	sort.Slice(parts, func(i, j int) bool {
+		return aws.ToInt32(parts[i].PartNumber) < aws.ToInt32(parts[j].PartNumber)
+	})
+	_, err = s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(key),
+		UploadId:        uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		s.abortMultipart(key, uploadID)
+		return uploaded, fmt.Errorf("failed to complete multipart upload: %v", err)
+	}
+	return uploaded, nil
+}
+
+// abortMultipart discards the parts of a failed upload. It uses its own
+// context because the request context is usually the reason for the abort.
+func (s *S3Service) abortMultipart(key string, uploadID *string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := s.AbortMultipartUpload(ctx, key, aws.ToString(uploadID)); err != nil {
+		log.Printf("⚠️ Failed to abort multipart upload of %s: %v", key, err)
+		return
+	}
+	log.Printf("🧹 Aborted multipart upload of %s", key)
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
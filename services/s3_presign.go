@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"api-s3/models"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// MaxSinglePutSize is the largest object S3 accepts in a single PUT or POST
+const MaxSinglePutSize = 5 * 1024 * 1024 * 1024
+
+// DirectUploadStorage is implemented by backends that let clients upload
+// straight to storage with presigned requests
+type DirectUploadStorage interface {
+	// PresignPut returns a PUT request storing exactly size bytes of contentType under key
+	PresignPut(ctx context.Context, key, contentType string, size int64, expires time.Duration) (*models.PresignedRequest, error)
+	// PresignPost returns a browser form upload policy with the same constraints
+	PresignPost(ctx context.Context, key, contentType string, size int64, expires time.Duration) (*models.PresignedPost, error)
+	// CreateMultipartUpload starts a multipart upload and returns its ID
+	CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error)
+	// PresignUploadPart returns a PUT request uploading exactly size bytes as one part
+	PresignUploadPart(ctx context.Context, key, uploadID string, partNumber int, size int64, expires time.Duration) (*models.PresignedRequest, error)
+	// CompleteMultipartUpload assembles the uploaded parts into the object
+	CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []models.CompletedPart) error
+	// AbortMultipartUpload discards the parts of an unfinished upload
+	AbortMultipartUpload(ctx context.Context, key, uploadID string) error
+}
+
+func (s *S3Service) PresignPut(ctx context.Context, key, contentType string, size int64, expires time.Duration) (*models.PresignedRequest, error) {
+	presignClient := s3.NewPresignClient(s.client)
+
+	request, err := presignClient.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign upload: %v", err)
+	}
+	return presignedRequest(request), nil
+}
+
+// PresignPost builds an S3 POST policy signed with Signature Version 4. The
+// SDK has no helper for it, so the policy is assembled here.
+func (s *S3Service) PresignPost(ctx context.Context, key, contentType string, size int64, expires time.Duration) (*models.PresignedPost, error) {
+	creds, err := s.credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load credentials: %v", err)
+	}
+
+	now := time.Now().UTC()
+	date := now.Format("20060102")
+	fields := map[string]string{
+		"key":              key,
+		"Content-Type":     contentType,
+		"x-amz-algorithm":  "AWS4-HMAC-SHA256",
+		"x-amz-credential": fmt.Sprintf("%s/%s/%s/s3/aws4_request", creds.AccessKeyID, date, s.region),
+		"x-amz-date":       now.Format("20060102T150405Z"),
+	}
+	if creds.SessionToken != "" {
+		fields["x-amz-security-token"] = creds.SessionToken
+	}
+
+	conditions := []any{
+		map[string]string{"bucket": s.bucket},
+		[]any{"content-length-range", size, size},
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		conditions = append(conditions, []any{"eq", "$" + name, fields[name]})
+	}
+
+	policy, err := json.Marshal(map[string]any{
+		"expiration": now.Add(expires).Format("2006-01-02T15:04:05.000Z"),
+		"conditions": conditions,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode policy: %v", err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(policy)
+
+	signingKey := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	signingKey = hmacSHA256(signingKey, s.region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+
+	fields["policy"] = encoded
+	fields["x-amz-signature"] = hex.EncodeToString(hmacSHA256(signingKey, encoded))
+	return &models.PresignedPost{
+		URL:    strings.TrimSuffix(s.URL(""), "/"),
+		Fields: fields,
+	}, nil
+}
+
+func (s *S3Service) CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error) {
+	result, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to start multipart upload: %v", err)
+	}
+	return aws.ToString(result.UploadId), nil
+}
+
+func (s *S3Service) PresignUploadPart(ctx context.Context, key, uploadID string, partNumber int, size int64, expires time.Duration) (*models.PresignedRequest, error) {
+	presignClient := s3.NewPresignClient(s.client)
+
+	request, err := presignClient.PresignUploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int32(int32(partNumber)),
+		ContentLength: aws.Int64(size),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign part %d: %v", partNumber, err)
+	}
+	return presignedRequest(request), nil
+}
+
+func (s *S3Service) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []models.CompletedPart) error {
+	completed := make([]types.CompletedPart, len(parts))
+	for i, part := range parts {
+		completed[i] = types.CompletedPart{
+			ETag:       aws.String(part.ETag),
+			PartNumber: aws.Int32(int32(part.PartNumber)),
+		}
+	}
+	sort.Slice(completed, func(i, j int) bool {
+		return aws.ToInt32(completed[i].PartNumber) < aws.ToInt32(completed[j].PartNumber)
+	})
+
+	_, err := s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %v", err)
+	}
+	return nil
+}
+
+func (s *S3Service) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	_, err := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to abort multipart upload: %v", err)
+	}
+	return nil
+}
+
+// presignedRequest converts a presigned SDK request, leaving out the Host
+// header the HTTP client sets by itself
+func presignedRequest(request *v4.PresignedHTTPRequest) *models.PresignedRequest {
+	headers := make(map[string]string)
+	for name, values := range request.SignedHeader {
+		if strings.EqualFold(name, "Host") || len(values) == 0 {
+			continue
+		}
+		headers[name] = values[0]
+	}
+	return &models.PresignedRequest{
+		Method:  request.Method,
+		URL:     request.URL,
+		Headers: headers,
+	}
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -2,12 +2,11 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"mime/multipart"
-	"net/http"
-	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,11 +16,15 @@ import (
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
+// S3Service is the Storage implementation backed by an S3 bucket
 type S3Service struct {
-	client *s3.Client
-	bucket string
+	client      *s3.Client
+	bucket      string
+	region      string
+	credentials aws.CredentialsProvider
 }
 
 func NewS3Service() (*S3Service, error) {
@@ -38,229 +41,165 @@ func NewS3Service() (*S3Service, error) {
 		return nil, fmt.Errorf("unable to load SDK config: %v", err)
 	}
 
-	client := s3.NewFromConfig(cfg)
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if config.AppConfig.AWSS3Endpoint != "" {
+			o.BaseEndpoint = aws.String(config.AppConfig.AWSS3Endpoint)
+			o.UsePathStyle = true
+		}
+	})
 
 	return &S3Service{
-		client: client,
-		bucket: config.AppConfig.AWSS3Bucket,
+		client:      client,
+		bucket:      config.AppConfig.AWSS3Bucket,
+		region:      cfg.Region,
+		credentials: cfg.Credentials,
 	}, nil
 }
 
-func (s *S3Service) UploadFile(file *multipart.FileHeader, folder string) (string, error) {
-	src, err := file.Open()
-	if err != nil {
-		return "", fmt.Errorf("failed to open file: %v", err)
-	}
-	defer src.Close()
-
-	// Generate unique filename
-	ext := filepath.Ext(file.Filename)
-	filename := fmt.Sprintf("%s/%s%s", folder, generateUniqueID(), ext)
-
-	// Upload to S3
-	_, err = s.client.PutObject(context.TODO(), &s3.PutObjectInput{
+func (s *S3Service) Put(ctx context.Context, key string, reader io.Reader, contentType string) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
 		Bucket:      aws.String(s.bucket),
-		Key:         aws.String(filename),
-		Body:        src,
-		ContentType: aws.String(file.Header.Get("Content-Type")),
+		Key:         aws.String(key),
+		Body:        reader,
+		ContentType: aws.String(contentType),
 	})
 
 	if err != nil {
-		return "", fmt.Errorf("failed to upload file to S3: %v", err)
+		return fmt.Errorf("failed to upload file to S3: %v", err)
 	}
 
-	// Return the S3 URL
-	url := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucket, config.AppConfig.AWSRegion, filename)
-	return url, nil
+	return nil
 }
 
-func (s *S3Service) UploadFileFromReader(reader io.Reader, filename, contentType, folder string) (string, error) {
-	// Generate unique filename
-	ext := filepath.Ext(filename)
-	uniqueFilename := fmt.Sprintf("%s/%s%s", folder, generateUniqueID(), ext)
+func (s *S3Service) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	return s.GetRange(ctx, key, 0, -1)
+}
 
-	// Upload to S3
-	_, err := s.client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket:      aws.String(s.bucket),
-		Key:         aws.String(uniqueFilename),
-		Body:        reader,
-		ContentType: aws.String(contentType),
-	})
+func (s *S3Service) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, *ObjectInfo, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}
+	if length >= 0 {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	} else if offset > 0 {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
+	}
 
+	result, err := s.client.GetObject(ctx, input)
 	if err != nil {
-		return "", fmt.Errorf("failed to upload file to S3: %v", err)
+		return nil, nil, s.wrapError(key, "failed to get object from S3", err)
 	}
 
-	// Return the S3 URL
-	url := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucket, config.AppConfig.AWSRegion, uniqueFilename)
-	return url, nil
+	info := &ObjectInfo{
+		Key:          key,
+		Size:         aws.ToInt64(result.ContentLength),
+		ContentType:  aws.ToString(result.ContentType),
+		ETag:         aws.ToString(result.ETag),
+		LastModified: aws.ToTime(result.LastModified),
+	}
+	// A ranged read reports the size of the whole object in Content-Range
+	if contentRange := aws.ToString(result.ContentRange); contentRange != "" {
+		if _, total, ok := strings.Cut(contentRange, "/"); ok {
+			if size, err := strconv.ParseInt(total, 10, 64); err == nil {
+				info.Size = size
+			}
+		}
+	}
+	return result.Body, info, nil
 }
 
-func (s *S3Service) DeleteFile(key string) error {
-	_, err := s.client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+func (s *S3Service) Head(ctx context.Context, key string) (*ObjectInfo, error) {
+	result, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 	})
-
 	if err != nil {
-		return fmt.Errorf("failed to delete file from S3: %v", err)
+		return nil, s.wrapError(key, "failed to head object in S3", err)
 	}
 
-	return nil
+	return &ObjectInfo{
+		Key:          key,
+		Size:         aws.ToInt64(result.ContentLength),
+		ContentType:  aws.ToString(result.ContentType),
+		ETag:         aws.ToString(result.ETag),
+		LastModified: aws.ToTime(result.LastModified),
+	}, nil
 }
 
-func (s *S3Service) GeneratePresignedURL(key string, expires time.Duration) (string, error) {
-	presignClient := s3.NewPresignClient(s.client)
+// List lists objects in S3 with the given prefix, following pagination
+func (s *S3Service) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	log.Printf("📋 Listing objects with prefix: %s", prefix)
 
-	request, err := presignClient.PresignGetObject(context.TODO(), &s3.GetObjectInput{
+	var objects []ObjectInfo
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
 		Bucket: aws.String(s.bucket),
-		Key:    aws.String(key),
-	}, s3.WithPresignExpires(expires))
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %v", err)
+		}
 
-	if err != nil {
-		return "", fmt.Errorf("failed to generate presigned URL: %v", err)
+		for _, obj := range page.Contents {
+			if obj.Key == nil {
+				continue
+			}
+			objects = append(objects, ObjectInfo{
+				Key:          *obj.Key,
+				Size:         aws.ToInt64(obj.Size),
+				ETag:         aws.ToString(obj.ETag),
+				LastModified: aws.ToTime(obj.LastModified),
+			})
+		}
 	}
 
-	return request.URL, nil
-}
-
-func (s *S3Service) GetFileURL(key string) string {
-	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucket, config.AppConfig.AWSRegion, key)
-}
-
-func (s *S3Service) ExtractKeyFromURL(url string) string {
-	// Extract key from S3 URL
-	// Format: https://bucket.s3.region.amazonaws.com/key
-	parts := strings.Split(url, ".amazonaws.com/")
-	if len(parts) > 1 {
-		return parts[1]
-	}
-	return ""
+	log.Printf("✅ Listed %d objects", len(objects))
+	return objects, nil
 }
 
-func (s *S3Service) FileExists(key string) (bool, error) {
-	_, err := s.client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+func (s *S3Service) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 	})
 
 	if err != nil {
-		// Check if it's a "not found" error
-		if strings.Contains(err.Error(), "NoSuchKey") {
-			return false, nil
-		}
-		return false, err
+		return fmt.Errorf("failed to delete file from S3: %v", err)
 	}
 
-	return true, nil
+	return nil
 }
 
-func generateUniqueID() string {
-	return fmt.Sprintf("%d", time.Now().UnixNano())
-}
+func (s *S3Service) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	presignClient := s3.NewPresignClient(s.client)
 
-// StreamFile streams a file from S3 to the HTTP response
-func (s *S3Service) StreamFile(w http.ResponseWriter, r *http.Request, key string) error {
-	log.Printf("📺 Streaming file from S3: %s", key)
-	
-	// Get the object from S3
-	result, err := s.client.GetObject(context.TODO(), &s3.GetObjectInput{
+	request, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
-	})
-	if err != nil {
-		return fmt.Errorf("failed to get object from S3: %v", err)
-	}
-	defer result.Body.Close()
-	
-	// Set appropriate headers for video streaming
-	w.Header().Set("Content-Type", "video/mp4")
-	w.Header().Set("Accept-Ranges", "bytes")
-	
-	// Get file size
-	if result.ContentLength != nil {
-		w.Header().Set("Content-Length", fmt.Sprintf("%d", *result.ContentLength))
-	}
-	
-	// Handle Range requests for video seeking
-	rangeHeader := r.Header.Get("Range")
-	if rangeHeader != "" {
-		// Parse range header (e.g., "bytes=0-1023")
-		if strings.HasPrefix(rangeHeader, "bytes=") {
-			rangeStr := strings.TrimPrefix(rangeHeader, "bytes=")
-			parts := strings.Split(rangeStr, "-")
-			if len(parts) == 2 {
-				start := parts[0]
-				end := parts[1]
-				
-				// Handle incomplete range (e.g., "bytes=0-")
-				if end == "" {
-					// If no end specified, stream from start to end of file
-					end = fmt.Sprintf("%d", *result.ContentLength-1)
-					log.Printf("📺 Incomplete range, streaming from %s to end (%s)", start, end)
-				}
-				
-				// Set partial content status
-				w.Header().Set("Content-Range", fmt.Sprintf("bytes %s-%s/%d", start, end, *result.ContentLength))
-				w.WriteHeader(http.StatusPartialContent)
-				
-				log.Printf("📺 Streaming range: %s-%s", start, end)
-			}
-		}
-	} else {
-		// Full content request - don't write status if already written
-		if !isResponseWritten(w) {
-			w.WriteHeader(http.StatusOK)
-		}
-	}
-	
-	// Stream the file content
-	_, err = io.Copy(w, result.Body)
+	}, s3.WithPresignExpires(expires))
+
 	if err != nil {
-		// Check if it's a broken pipe error (normal for video streaming)
-		if strings.Contains(err.Error(), "broken pipe") || 
-		   strings.Contains(err.Error(), "connection reset") ||
-		   strings.Contains(err.Error(), "write: broken pipe") {
-			// Don't log broken pipe errors - they're normal for video streaming
-			return nil // Don't treat as error
-		}
-		return fmt.Errorf("failed to stream file content: %v", err)
+		return "", fmt.Errorf("failed to generate presigned URL: %v", err)
 	}
-	
-	log.Printf("✅ File streamed successfully: %s", key)
-	return nil
+
+	return request.URL, nil
 }
 
-// ListObjects lists objects in S3 with the given prefix
-func (s *S3Service) ListObjects(prefix string) ([]string, error) {
-	log.Printf("📋 Listing objects with prefix: %s", prefix)
-	
-	var objects []string
-	
-	// List objects in S3
-	result, err := s.client.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{
-		Bucket: aws.String(s.bucket),
-		Prefix: aws.String(prefix),
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to list objects: %v", err)
+func (s *S3Service) URL(key string) string {
+	if endpoint := config.AppConfig.AWSS3Endpoint; endpoint != "" {
+		return fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(endpoint, "/"), s.bucket, key)
 	}
-	
-	// Extract object keys
-	for _, obj := range result.Contents {
-		if obj.Key != nil {
-			objects = append(objects, *obj.Key)
-			log.Printf("📄 Found object: %s", *obj.Key)
-		}
-	}
-	
-	log.Printf("✅ Listed %d objects", len(objects))
-	return objects, nil
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucket, config.AppConfig.AWSRegion, key)
 }
 
-// isResponseWritten checks if the response has already been written
-func isResponseWritten(w http.ResponseWriter) bool {
-	// Try to access the underlying response writer to check if it's written
-	// This is a simple check - in production you might want a more robust solution
-	return false // For now, assume not written to avoid issues
-} 
\ No newline at end of file
+// wrapError maps S3 "not found" errors onto ErrObjectNotFound
+func (s *S3Service) wrapError(key, message string, err error) error {
+	var noSuchKey *types.NoSuchKey
+	var notFound *types.NotFound
+	if errors.As(err, &noSuchKey) || errors.As(err, &notFound) {
+		return fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+	return fmt.Errorf("%s: %v", message, err)
+}
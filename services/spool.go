@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"api-s3/config"
+)
+
+// SpoolDir returns the directory holding the spooled uploads of a media item
+func SpoolDir(mediaID string) string {
+	return filepath.Join(config.AppConfig.SpoolPath, mediaID)
+}
+
+// SpoolUpload copies an upload to the spool directory so it survives the
+// request and a restart of the server. The file is synced to disk before the
+// path is returned.
+func SpoolUpload(src io.Reader, mediaID, filename string) (string, error) {
+	dir := SpoolDir(mediaID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create spool directory: %v", err)
+	}
+
+	spoolPath := filepath.Join(dir, filepath.Base(filename))
+	file, err := os.Create(spoolPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create spool file: %v", err)
+	}
+
+	if _, err := io.Copy(file, src); err != nil {
+		file.Close()
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to spool upload: %v", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to sync spool file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to close spool file: %v", err)
+	}
+	return spoolPath, nil
+}
+
+// CreateSpoolFile creates the spool file of an upload that is copied while it
+// is stored elsewhere. The caller closes the file and removes the spool when
+// the upload is not kept.
+func CreateSpoolFile(mediaID, filename string) (*os.File, error) {
+	dir := SpoolDir(mediaID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %v", err)
+	}
+
+	file, err := os.Create(filepath.Join(dir, filepath.Base(filename)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool file: %v", err)
+	}
+	return file, nil
+}
+
+// SpoolObject downloads a stored object into the spool directory of a media
+// item and returns the path of the copy
+func SpoolObject(ctx context.Context, store Storage, key, mediaID, filename string) (string, error) {
+	dir := SpoolDir(mediaID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create spool directory: %v", err)
+	}
+
+	spoolPath := filepath.Join(dir, filepath.Base(filename))
+	if err := DownloadObject(ctx, store, key, spoolPath); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return spoolPath, nil
+}
+
+// RemoveSpool deletes the spooled uploads of a media item
+func RemoveSpool(mediaID string) error {
+	return os.RemoveAll(SpoolDir(mediaID))
+}
+
+// SpoolFile moves a file that is already on local disk into the spool
+// directory, copying it when a rename is not possible
+func SpoolFile(path, mediaID, filename string) (string, error) {
+	dir := SpoolDir(mediaID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create spool directory: %v", err)
+	}
+
+	spoolPath := filepath.Join(dir, filepath.Base(filename))
+	if err := os.Rename(path, spoolPath); err == nil {
+		return spoolPath, nil
+	}
+
+	// Different filesystem
+	src, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer src.Close()
+
+	spoolPath, err = SpoolUpload(src, mediaID, filename)
+	if err != nil {
+		return "", err
+	}
+	os.Remove(path)
+	return spoolPath, nil
+}
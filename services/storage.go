@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"api-s3/config"
+	"api-s3/models"
+)
+
+// ErrObjectNotFound is returned by storage backends when a key does not exist
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// Storage is the object store holding uploaded media and every derived asset.
+// Keys are slash separated paths such as "media/<id>/<file>".
+type Storage interface {
+	// Put stores the content of reader under key
+	Put(ctx context.Context, key string, reader io.Reader, contentType string) error
+	// Get opens the whole object for reading
+	Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+	// GetRange opens length bytes starting at offset; a negative length reads to the end
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, *ObjectInfo, error)
+	// Head returns the object metadata without its content
+	Head(ctx context.Context, key string) (*ObjectInfo, error)
+	// List returns every object whose key starts with prefix
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Delete removes the object; deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+	// PresignGet returns a URL granting temporary read access to the object
+	PresignGet(ctx context.Context, key string, expires time.Duration) (string, error)
+	// URL returns the public URL of the object
+	URL(key string) string
+}
+
+// NewStorage creates the storage backend selected by STORAGE_BACKEND. When no
+// backend is configured S3 is used if credentials are present, otherwise the
+// local filesystem.
+func NewStorage() (Storage, error) {
+	backend := strings.ToLower(config.AppConfig.StorageBackend)
+	if backend == "" {
+		backend = "local"
+		if config.AppConfig.AWSAccessKeyID != "" && config.AppConfig.AWSSecretAccessKey != "" && config.AppConfig.AWSS3Bucket != "" {
+			backend = "s3"
+		}
+	}
+
+	switch backend {
+	case "s3":
+		return NewS3Service()
+	case "local":
+		return NewLocalStorage(config.AppConfig.LocalStoragePath)
+	}
+	return nil, fmt.Errorf("unknown storage backend: %s", backend)
+}
+
+// ObjectExists reports whether key exists in the storage backend
+func ObjectExists(ctx context.Context, store Storage, key string) (bool, error) {
+	if _, err := store.Head(ctx, key); err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// ReadObject downloads a small object (e.g. a playlist) into memory
+func ReadObject(ctx context.Context, store Storage, key string) ([]byte, error) {
+	body, _, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %s: %v", key, err)
+	}
+	return data, nil
+}
+
+// DownloadObject copies an object to a local file
+func DownloadObject(ctx context.Context, store Storage, key, localPath string) error {
+	body, _, err := store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	file, err := os.Create(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to create local file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, body); err != nil {
+		return fmt.Errorf("failed to copy file content: %v", err)
+	}
+	return nil
+}
+
+// UploadLocalFile stores a local file under key and returns its URL
+func UploadLocalFile(ctx context.Context, store Storage, localPath, key, contentType string) (string, error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %v", localPath, err)
+	}
+	defer file.Close()
+
+	if err := store.Put(ctx, key, file, contentType); err != nil {
+		return "", err
+	}
+	return store.URL(key), nil
+}
+
+// DeletePrefix removes every object below prefix and returns how many were deleted
+func DeletePrefix(ctx context.Context, store Storage, prefix string) (int, error) {
+	objects, err := store.List(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, object := range objects {
+		if err := store.Delete(ctx, object.Key); err != nil {
+			return 0, err
+		}
+		log.Printf("🗑️ Deleted object: %s", object.Key)
+	}
+	return len(objects), nil
+}
+
+// MediaPrefix returns the storage prefix holding everything for a media
+// item. Media of the default tenant keep the original media/<id>/ layout,
+// other tenants get their own tenants/<tenant>/ tree.
+func MediaPrefix(tenantID, mediaID string) string {
+	if tenantID == "" || tenantID == models.DefaultTenantID {
+		return fmt.Sprintf("media/%s/", mediaID)
+	}
+	return fmt.Sprintf("tenants/%s/media/%s/", tenantID, mediaID)
+}
+
+// MediaKey returns the storage key of a file belonging to a media item
+func MediaKey(tenantID, mediaID, filename string) string {
+	return MediaPrefix(tenantID, mediaID) + filepath.Base(filename)
+}
+
+// MediaIDOfKey returns the media item a storage key laid out by MediaPrefix
+// belongs to
+func MediaIDOfKey(key string) (string, bool) {
+	parts := strings.Split(key, "/")
+	switch {
+	case len(parts) >= 3 && parts[0] == "media":
+		return parts[1], parts[1] != ""
+	case len(parts) >= 5 && parts[0] == "tenants" && parts[2] == "media":
+		return parts[3], parts[3] != ""
+	}
+	return "", false
+}
+
+// contentTypeByExtension guesses a content type for backends that do not
+// store one, covering the streaming formats the mime package does not know
+func contentTypeByExtension(key string) string {
+	ext := strings.ToLower(filepath.Ext(key))
+	switch ext {
+	case ".m3u8":
+		return HLSPlaylistMimeType
+	case ".ts":
+		return hlsSegmentMimeType
+	case ".mpd":
+		return DASHManifestMimeType
+	case ".m4s":
+		return dashSegmentMimeType
+	case ".mp4":
+		return "video/mp4"
+	case ".vtt":
+		return "text/vtt"
+	}
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
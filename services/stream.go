@@ -0,0 +1,378 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"api-s3/config"
+)
+
+// ErrInvalidRange is returned for a Range header that cannot be satisfied
+var ErrInvalidRange = errors.New("invalid range")
+
+// maxByteRanges is how many ranges, once merged, a request may ask for before
+// the whole object is sent instead. Every range is a separate storage read.
+const maxByteRanges = 16
+
+// ByteRange is a satisfiable range of an object, with the end inclusive
+type ByteRange struct {
+	Start int64
+	End   int64
+}
+
+// Length returns the number of bytes in the range
+func (r ByteRange) Length() int64 {
+	return r.End - r.Start + 1
+}
+
+// ContentRange returns the Content-Range value of the range within size bytes
+func (r ByteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.End, size)
+}
+
+// ParseRange parses a Range header against an object of size bytes. It
+// supports open ranges (bytes=500-) and suffix ranges (bytes=-500), clamps
+// ends past the object and drops ranges starting past it. ErrInvalidRange is
+// returned for malformed headers and when no range is left.
+func ParseRange(header string, size int64) ([]ByteRange, error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return nil, ErrInvalidRange
+	}
+
+	var ranges []ByteRange
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, ErrInvalidRange
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+		var r ByteRange
+		if first == "" {
+			// Suffix range: the last N bytes
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, ErrInvalidRange
+			}
+			if n == 0 || size == 0 {
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			r = ByteRange{Start: size - n, End: size - 1}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, ErrInvalidRange
+			}
+			end := size - 1
+			if last != "" {
+				end, err = strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, ErrInvalidRange
+				}
+				if end >= size {
+					end = size - 1
+				}
+			}
+			if start >= size {
+				continue
+			}
+			r = ByteRange{Start: start, End: end}
+		}
+		ranges = append(ranges, r)
+	}
+
+	if len(ranges) == 0 {
+		return nil, ErrInvalidRange
+	}
+	return ranges, nil
+}
+
+// StreamObject streams a stored object to the HTTP response with its stored
+// content type, ETag and Last-Modified, answering a matching If-None-Match or
+// If-Modified-Since with 304. Range requests are answered with only the
+// requested bytes, fetched from storage with a ranged read: a single range as
+// 206 with Content-Range, several ranges as a multipart/byteranges body.
+// Overlapping and adjacent ranges are merged, and more than maxByteRanges get
+// the whole object. Unsatisfiable ranges are answered with 416. scope decides
+// who may cache the response.
+func StreamObject(w http.ResponseWriter, r *http.Request, store Storage, key string, scope CacheScope) error {
+	log.Printf("📺 Streaming file from storage: %s", key)
+
+	info, err := store.Head(r.Context(), key)
+	if err != nil {
+		return err
+	}
+
+	contentType := info.ContentType
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType = contentTypeByExtension(key)
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Cache-Control", CacheControl(contentType, scope))
+	if info.ETag != "" {
+		w.Header().Set("ETag", info.ETag)
+	}
+	if !info.LastModified.IsZero() {
+		w.Header().Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	// Validators are checked before Range, so a cached copy is never refetched
+	if notModified(r, info) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	w.Header().Set("Content-Type", contentType)
+
+	rangeHeader := r.Header.Get("Range")
+	if rangeHeader == "" || !ifRangeMatches(r.Header.Get("If-Range"), info) {
+		return writeObject(w, r, store, key, info, nil)
+	}
+
+	ranges, err := ParseRange(rangeHeader, info.Size)
+	if err != nil {
+		log.Printf("⚠️ Unsatisfiable range %q for %s (%d bytes)", rangeHeader, key, info.Size)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", info.Size))
+		w.Header().Del("Content-Type")
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return nil
+	}
+
+	// Many small ranges are cheaper to answer with a single read
+	ranges = CoalesceRanges(ranges)
+	if len(ranges) > maxByteRanges {
+		log.Printf("⚠️ %d ranges requested for %s, sending the whole file", len(ranges), key)
+		return writeObject(w, r, store, key, info, nil)
+	}
+	return writeObject(w, r, store, key, info, ranges)
+}
+
+// CoalesceRanges sorts ranges by their start and merges those that overlap
+// or touch, so no byte is read from storage twice
+func CoalesceRanges(ranges []ByteRange) []ByteRange {
+	sorted := append([]ByteRange(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+
+	merged := sorted[:0]
+	for _, br := range sorted {
+		if last := len(merged) - 1; last >= 0 && br.Start <= merged[last].End+1 {
+			if br.End > merged[last].End {
+				merged[last].End = br.End
+			}
+			continue
+		}
+		merged = append(merged, br)
+	}
+	return merged
+}
+
+// CacheScope says who may keep a copy of a streamed response
+type CacheScope int
+
+const (
+	// CachePublic is for anonymous requests: shared caches may store the response
+	CachePublic CacheScope = iota
+	// CachePrivate is for authenticated requests: only the client may store it
+	CachePrivate
+	// CacheNoStore is for token URLs: nobody may store it
+	CacheNoStore
+)
+
+// CacheControl returns the configured Cache-Control value for a content type,
+// restricted to the client for private responses
+func CacheControl(contentType string, scope CacheScope) string {
+	if scope == CacheNoStore {
+		return "private, no-store"
+	}
+
+	value := config.AppConfig.CacheControlDefault
+	switch {
+	case strings.HasPrefix(contentType, "video/"):
+		value = config.AppConfig.CacheControlVideo
+	case strings.HasPrefix(contentType, "image/"):
+		value = config.AppConfig.CacheControlImage
+	}
+	if scope == CachePublic {
+		return value
+	}
+
+	// Directives for shared caches do not apply to a private response
+	directives := []string{"private"}
+	for _, directive := range strings.Split(value, ",") {
+		directive = strings.TrimSpace(directive)
+		name, _, _ := strings.Cut(strings.ToLower(directive), "=")
+		if directive == "" || name == "public" || name == "private" || name == "s-maxage" || name == "proxy-revalidate" {
+			continue
+		}
+		directives = append(directives, directive)
+	}
+	return strings.Join(directives, ", ")
+}
+
+// notModified reports whether the client copy is current. If-None-Match takes
+// precedence over If-Modified-Since and uses the weak comparison.
+func notModified(r *http.Request, info *ObjectInfo) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		if info.ETag == "" {
+			return false
+		}
+		for _, tag := range strings.Split(ifNoneMatch, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(info.ETag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || info.LastModified.IsZero() {
+		return false
+	}
+	return !info.LastModified.Truncate(time.Second).After(since)
+}
+
+// ifRangeMatches reports whether the Range header applies: If-Range is
+// absent, or names the current strong ETag or Last-Modified date
+func ifRangeMatches(ifRange string, info *ObjectInfo) bool {
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		return !strings.HasPrefix(ifRange, "W/") && ifRange == info.ETag
+	}
+	date, err := http.ParseTime(ifRange)
+	if err != nil || info.LastModified.IsZero() {
+		return false
+	}
+	return info.LastModified.Truncate(time.Second).Equal(date)
+}
+
+// writeObject writes the whole object, a single range or a multipart body
+func writeObject(w http.ResponseWriter, r *http.Request, store Storage, key string, info *ObjectInfo, ranges []ByteRange) error {
+	switch len(ranges) {
+	case 0:
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodHead {
+			return nil
+		}
+		return copyRange(w, r, store, key, 0, -1)
+
+	case 1:
+		br := ranges[0]
+		log.Printf("📺 Streaming range %d-%d of %s", br.Start, br.End, key)
+		w.Header().Set("Content-Range", br.ContentRange(info.Size))
+		w.Header().Set("Content-Length", strconv.FormatInt(br.Length(), 10))
+		w.WriteHeader(http.StatusPartialContent)
+		if r.Method == http.MethodHead {
+			return nil
+		}
+		return copyRange(w, r, store, key, br.Start, br.Length())
+	}
+
+	contentType := w.Header().Get("Content-Type")
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	partHeader := func(br ByteRange) textproto.MIMEHeader {
+		return textproto.MIMEHeader{
+			"Content-Type":  {contentType},
+			"Content-Range": {br.ContentRange(info.Size)},
+		}
+	}
+
+	// Measure the multipart body with empty parts, then add the part sizes
+	counter := &countingWriter{}
+	mw := multipart.NewWriter(counter)
+	mw.SetBoundary(boundary)
+	length := int64(0)
+	for _, br := range ranges {
+		mw.CreatePart(partHeader(br))
+		length += br.Length()
+	}
+	mw.Close()
+	length += counter.count
+
+	log.Printf("📺 Streaming %d ranges of %s", len(ranges), key)
+	w.Header().Set("Content-Type", "multipart/byteranges; boundary="+boundary)
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	if r.Method == http.MethodHead {
+		return nil
+	}
+
+	mw = multipart.NewWriter(w)
+	mw.SetBoundary(boundary)
+	for _, br := range ranges {
+		part, err := mw.CreatePart(partHeader(br))
+		if err != nil {
+			return streamError(err)
+		}
+		if err := copyRange(part, r, store, key, br.Start, br.Length()); err != nil {
+			return err
+		}
+	}
+	return streamError(mw.Close())
+}
+
+// copyRange copies length bytes of the object from offset to w; a negative
+// length copies to the end
+func copyRange(w io.Writer, r *http.Request, store Storage, key string, offset, length int64) error {
+	body, _, err := store.GetRange(r.Context(), key, offset, length)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if _, err := io.Copy(w, body); err != nil {
+		return streamError(err)
+	}
+	return nil
+}
+
+// streamError drops errors caused by the client going away, which are normal
+// while a player seeks or closes the stream
+func streamError(err error) error {
+	if err == nil || IsClientDisconnect(err) {
+		return nil
+	}
+	return fmt.Errorf("failed to stream file content: %v", err)
+}
+
+// IsClientDisconnect reports whether err was caused by the client going away,
+// which is normal while a player seeks or closes the stream
+func IsClientDisconnect(err error) bool {
+	message := err.Error()
+	return strings.Contains(message, "broken pipe") ||
+		strings.Contains(message, "connection reset") ||
+		strings.Contains(message, "context canceled")
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	count int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.count += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"api-s3/config"
+	"api-s3/models"
+)
+
+// ThumbnailBox is the bounding box a thumbnail size is scaled into. Portrait
+// videos use it rotated, so the long side of the frame fits the box width.
+type ThumbnailBox struct {
+	Width  int
+	Height int
+}
+
+// ThumbnailSizes holds the bounding box of every supported thumbnail size.
+// Which of them are produced is controlled by THUMBNAIL_SIZES.
+var ThumbnailSizes = map[models.ThumbnailSize]ThumbnailBox{
+	models.ThumbnailSmall:  {320, 180},
+	models.ThumbnailMedium: {640, 360},
+	models.ThumbnailLarge:  {1280, 720},
+}
+
+// DefaultThumbnailSize is served when no size is requested and is the one
+// stored as the thumbnail URL of the media
+const DefaultThumbnailSize = models.ThumbnailMedium
+
+// ThumbnailKey returns the storage key of a thumbnail size of a media item
+func ThumbnailKey(tenantID, mediaID string, size models.ThumbnailSize) string {
+	return MediaPrefix(tenantID, mediaID) + fmt.Sprintf("thumbnails/%s.jpg", size)
+}
+
+// ThumbnailTimestamp returns the position in seconds a poster is captured
+// at: THUMBNAIL_POSITION percent into the video, which stays inside short
+// videos where a fixed offset would point past the end
+func ThumbnailTimestamp(duration float64) float64 {
+	if duration <= 0 {
+		return 0
+	}
+	position := float64(config.AppConfig.ThumbnailPosition)
+	if position < 0 || position >= 100 {
+		position = 10
+	}
+	return duration * position / 100
+}
+
+// SelectThumbnail returns the thumbnail of the requested size, or the closest
+// one available when that size was not generated
+func SelectThumbnail(thumbnails []models.Thumbnail, size models.ThumbnailSize) *models.Thumbnail {
+	want := ThumbnailSizes[size].Width
+	var best *models.Thumbnail
+	bestDiff := 0
+	for i := range thumbnails {
+		if thumbnails[i].Size == size {
+			return &thumbnails[i]
+		}
+		diff := ThumbnailSizes[thumbnails[i].Size].Width - want
+		if diff < 0 {
+			diff = -diff
+		}
+		if best == nil || diff < bestDiff {
+			best, bestDiff = &thumbnails[i], diff
+		}
+	}
+	return best
+}
+
+// thumbnailOutput is one size captured by CreateThumbnails
+type thumbnailOutput struct {
+	size   models.ThumbnailSize
+	width  int
+	height int
+	path   string
+}
+
+// CreateThumbnails captures a poster frame at ThumbnailTimestamp and stores it
+// in every configured size, scaled without distortion or upscaling. The frame
+// is decoded once and split into all sizes in a single FFmpeg run.
+func (v *VideoService) CreateThumbnails(ctx context.Context, inputPath, tenantID, mediaID string, info *VideoInfo) ([]models.Thumbnail, error) {
+	tempDir, err := os.MkdirTemp("", "thumb_"+mediaID+"_")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	var outputs []thumbnailOutput
+	for _, name := range config.AppConfig.ThumbnailSizes {
+		size := models.ThumbnailSize(strings.ToLower(name))
+		box, ok := ThumbnailSizes[size]
+		if !ok {
+			log.Printf("⚠️  Unknown thumbnail size %q, skipping", name)
+			continue
+		}
+		width, height := fitThumbnail(info.Width, info.Height, box)
+		outputs = append(outputs, thumbnailOutput{size, width, height, filepath.Join(tempDir, string(size)+".jpg")})
+	}
+	if len(outputs) == 0 {
+		return nil, fmt.Errorf("no thumbnail sizes configured")
+	}
+	sort.Slice(outputs, func(i, j int) bool {
+		return ThumbnailSizes[outputs[i].size].Width < ThumbnailSizes[outputs[j].size].Width
+	})
+
+	at := ThumbnailTimestamp(info.Duration)
+	log.Printf("🖼️ Capturing %d thumbnail sizes at %.2fs", len(outputs), at)
+	if err := runFFmpeg(ctx, v.ffmpegPath, thumbnailArgs(inputPath, at, outputs), 0, nil); err != nil {
+		return nil, fmt.Errorf("failed to create thumbnails: %v", err)
+	}
+
+	// Seeking to the last frames of some files yields nothing; use the first frame
+	if _, err := os.Stat(outputs[0].path); err != nil && at > 0 {
+		log.Printf("⚠️ No frame at %.2fs, capturing the first frame instead", at)
+		if err := runFFmpeg(ctx, v.ffmpegPath, thumbnailArgs(inputPath, 0, outputs), 0, nil); err != nil {
+			return nil, fmt.Errorf("failed to create thumbnails: %v", err)
+		}
+	}
+
+	thumbnails := make([]models.Thumbnail, 0, len(outputs))
+	for _, output := range outputs {
+		key := ThumbnailKey(tenantID, mediaID, output.size)
+		url, err := UploadLocalFile(ctx, v.storage, output.path, key, "image/jpeg")
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload %s thumbnail: %v", output.size, err)
+		}
+		thumbnails = append(thumbnails, models.Thumbnail{
+			Size:       output.size,
+			Width:      output.width,
+			Height:     output.height,
+			URL:        url,
+			StorageKey: key,
+		})
+	}
+	return thumbnails, nil
+}
+
+// thumbnailArgs builds the FFmpeg arguments capturing one frame at the given
+// position and writing it scaled to every output
+func thumbnailArgs(inputPath string, at float64, outputs []thumbnailOutput) []string {
+	labels := make([]string, len(outputs))
+	filters := make([]string, 0, len(outputs)+1)
+	for i := range outputs {
+		labels[i] = fmt.Sprintf("[t%d]", i)
+	}
+	filters = append(filters, fmt.Sprintf("[0:v]split=%d%s", len(outputs), strings.Join(labels, "")))
+	for i, output := range outputs {
+		filters = append(filters, fmt.Sprintf("%sscale=%d:%d:flags=lanczos[o%d]", labels[i], output.width, output.height, i))
+	}
+
+	args := []string{
+		"-ss", fmt.Sprintf("%.3f", at),
+		"-i", inputPath,
+		"-filter_complex", strings.Join(filters, ";"),
+	}
+	for i, output := range outputs {
+		args = append(args, "-map", fmt.Sprintf("[o%d]", i), "-frames:v", "1", "-q:v", "3", "-y", output.path)
+	}
+	return args
+}
+
+// fitThumbnail scales the source dimensions into the box keeping the aspect
+// ratio, never upscaling and rounding to even numbers
+func fitThumbnail(srcWidth, srcHeight int, box ThumbnailBox) (int, int) {
+	if srcWidth <= 0 || srcHeight <= 0 {
+		return box.Width, box.Height
+	}
+
+	boxWidth, boxHeight := box.Width, box.Height
+	if srcHeight > srcWidth {
+		boxWidth, boxHeight = box.Height, box.Width
+	}
+
+	scale := float64(boxWidth) / float64(srcWidth)
+	if hScale := float64(boxHeight) / float64(srcHeight); hScale < scale {
+		scale = hScale
+	}
+	if scale > 1 {
+		scale = 1
+	}
+
+	width := int(float64(srcWidth)*scale) / 2 * 2
+	height := int(float64(srcHeight)*scale) / 2 * 2
+	if width < 2 {
+		width = 2
+	}
+	if height < 2 {
+		height = 2
+	}
+	return width, height
+}
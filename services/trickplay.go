@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"api-s3/config"
+	"api-s3/models"
+)
+
+// TrickplayPlaylist is the file name of the WebVTT track below TrickplayPrefix
+const TrickplayPlaylist = "thumbnails.vtt"
+
+// TrickplayPrefix returns the storage prefix holding the sprite sheets and
+// WebVTT track of a media item
+func TrickplayPrefix(tenantID, mediaID string) string {
+	return MediaPrefix(tenantID, mediaID) + "trickplay"
+}
+
+// trickplayLayout returns the configured trickplay settings with sane
+// fallbacks, the tiles sized to TRICKPLAY_WIDTH keeping the aspect ratio
+func trickplayLayout(info *VideoInfo) *models.Trickplay {
+	cfg := config.AppConfig
+	layout := &models.Trickplay{
+		Format:   strings.ToLower(cfg.TrickplayFormat),
+		Interval: cfg.TrickplayInterval,
+		Columns:  cfg.TrickplayColumns,
+		Rows:     cfg.TrickplayRows,
+	}
+	if layout.Format != "webp" {
+		layout.Format = "jpg"
+	}
+	if layout.Interval <= 0 {
+		layout.Interval = 10
+	}
+	if layout.Columns <= 0 {
+		layout.Columns = 10
+	}
+	if layout.Rows <= 0 {
+		layout.Rows = 10
+	}
+
+	width := cfg.TrickplayWidth
+	if width <= 0 {
+		width = 160
+	}
+	layout.TileWidth, layout.TileHeight = scaleToWidth(info.Width, info.Height, width)
+	return layout
+}
+
+// scaleToWidth scales the source dimensions down to width keeping the aspect
+// ratio, never upscaling and rounding to even numbers. Unknown sources are
+// assumed to be 16:9.
+func scaleToWidth(srcWidth, srcHeight, width int) (int, int) {
+	if srcWidth > 0 && srcWidth < width {
+		width = srcWidth
+	}
+	width = width / 2 * 2
+	height := width * 9 / 16 / 2 * 2
+	if srcWidth > 0 && srcHeight > 0 {
+		height = int(float64(width)*float64(srcHeight)/float64(srcWidth)) / 2 * 2
+	}
+	if width < 2 {
+		width = 2
+	}
+	if height < 2 {
+		height = 2
+	}
+	return width, height
+}
+
+// CreateTrickplay captures one tile every TRICKPLAY_INTERVAL seconds, tiles
+// them into sprite sheets of TRICKPLAY_COLUMNS x TRICKPLAY_ROWS and writes a
+// WebVTT track pointing every interval at its tile. Sheets and track are
+// uploaded under TrickplayPrefix. onProgress, if set, receives the fraction
+// of the video processed so far.
+func (v *VideoService) CreateTrickplay(ctx context.Context, inputPath, tenantID, mediaID string, info *VideoInfo, onProgress ProgressFunc) (*models.Trickplay, error) {
+	tempDir, err := os.MkdirTemp("", "trickplay_"+mediaID+"_")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	layout := trickplayLayout(info)
+	log.Printf("🎞️ Creating %dx%d trickplay sheets, one %dx%d tile every %ds",
+		layout.Columns, layout.Rows, layout.TileWidth, layout.TileHeight, layout.Interval)
+
+	pattern := filepath.Join(tempDir, "sprite_%03d."+layout.Format)
+	if err := runFFmpeg(ctx, v.ffmpegPath, trickplayArgs(inputPath, pattern, layout), info.Duration, onProgress); err != nil {
+		return nil, fmt.Errorf("failed to create sprite sheets: %v", err)
+	}
+
+	sheets, err := filepath.Glob(filepath.Join(tempDir, "sprite_*."+layout.Format))
+	if err != nil || len(sheets) == 0 {
+		return nil, fmt.Errorf("ffmpeg produced no sprite sheets")
+	}
+	sort.Strings(sheets)
+
+	// A tile per started interval, bounded by what the sheets can hold
+	layout.Count = int(math.Ceil(info.Duration / float64(layout.Interval)))
+	if capacity := len(sheets) * layout.Columns * layout.Rows; layout.Count > capacity || layout.Count <= 0 {
+		layout.Count = capacity
+	}
+
+	names := make([]string, len(sheets))
+	prefix := TrickplayPrefix(tenantID, mediaID)
+	for i, sheet := range sheets {
+		names[i] = filepath.Base(sheet)
+		url, err := UploadLocalFile(ctx, v.storage, sheet, prefix+"/"+names[i], contentTypeByExtension(sheet))
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload sprite sheet: %v", err)
+		}
+		layout.SpriteURLs = append(layout.SpriteURLs, url)
+	}
+
+	// Tiles are referenced relative to the track, so it works from any URL
+	vttPath := filepath.Join(tempDir, TrickplayPlaylist)
+	if err := os.WriteFile(vttPath, []byte(TrickplayVTT(layout, info.Duration, names)), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write trickplay track: %v", err)
+	}
+	layout.VTTURL, err = UploadLocalFile(ctx, v.storage, vttPath, prefix+"/"+TrickplayPlaylist, "text/vtt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload trickplay track: %v", err)
+	}
+	return layout, nil
+}
+
+// trickplayArgs builds the FFmpeg arguments sampling one frame per interval,
+// scaling it to the tile size and tiling the frames into sheets
+func trickplayArgs(inputPath, outputPattern string, layout *models.Trickplay) []string {
+	filter := fmt.Sprintf("fps=1/%d,scale=%d:%d:flags=lanczos,tile=%dx%d",
+		layout.Interval, layout.TileWidth, layout.TileHeight, layout.Columns, layout.Rows)
+
+	args := []string{
+		"-i", inputPath,
+		"-an", "-sn",
+		"-vf", filter,
+	}
+	if layout.Format == "webp" {
+		args = append(args, "-c:v", "libwebp", "-quality", "75")
+	} else {
+		args = append(args, "-q:v", "5")
+	}
+	return append(args, "-y", outputPattern)
+}
+
+// TrickplayVTT builds the WebVTT track of a trickplay layout: one cue per
+// tile covering its interval, pointing at the tile region of its sheet with
+// a media fragment (sheet#xywh=x,y,w,h)
+func TrickplayVTT(layout *models.Trickplay, duration float64, sheets []string) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+
+	perSheet := layout.Columns * layout.Rows
+	if perSheet <= 0 {
+		return b.String()
+	}
+	for i := 0; i < layout.Count; i++ {
+		sheet := i / perSheet
+		if sheet >= len(sheets) {
+			break
+		}
+		start := float64(i * layout.Interval)
+		end := start + float64(layout.Interval)
+		if duration > 0 && end > duration {
+			end = duration
+		}
+		if end <= start {
+			break
+		}
+
+		tile := i % perSheet
+		x := (tile % layout.Columns) * layout.TileWidth
+		y := (tile / layout.Columns) * layout.TileHeight
+		fmt.Fprintf(&b, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			vttTimestamp(start), vttTimestamp(end), sheets[sheet], x, y, layout.TileWidth, layout.TileHeight)
+	}
+	return b.String()
+}
+
+// vttTimestamp formats seconds as a WebVTT timestamp (HH:MM:SS.mmm)
+func vttTimestamp(seconds float64) string {
+	ms := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"api-s3/config"
+	"api-s3/models"
+	"api-s3/repository"
+
+	"github.com/google/uuid"
+)
+
+// tusPurgeInterval is how often expired uploads are removed
+const tusPurgeInterval = 30 * time.Minute
+
+var (
+	// ErrUploadLocked is returned while another request writes to the upload
+	ErrUploadLocked = errors.New("upload is locked by another request")
+	// ErrOffsetMismatch is returned when a chunk does not start where the
+	// previous one ended
+	ErrOffsetMismatch = errors.New("upload offset does not match")
+)
+
+// TusStore keeps the data of resumable uploads on disk and their state in the
+// repository, so an interrupted upload can continue where it stopped, even
+// across restarts. Unfinished uploads are removed once they expire.
+type TusStore struct {
+	repo       repository.UploadRepository
+	dir        string
+	expiration time.Duration
+
+	mu     sync.Mutex
+	locked map[string]bool
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewTusStore creates a TusStore using the upload directory and expiration
+// from the configuration
+func NewTusStore(repo repository.UploadRepository) (*TusStore, error) {
+	dir := config.AppConfig.TusUploadPath
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %v", err)
+	}
+
+	expiration := time.Duration(config.AppConfig.TusExpiration) * time.Hour
+	if expiration <= 0 {
+		expiration = 24 * time.Hour
+	}
+
+	return &TusStore{
+		repo:       repo,
+		dir:        dir,
+		expiration: expiration,
+		locked:     make(map[string]bool),
+	}, nil
+}
+
+// ParseTusMetadata decodes an Upload-Metadata header: comma separated pairs
+// of a key and an optional base64 encoded value
+func ParseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.Fields(pair)
+		if len(parts) > 2 {
+			return nil, fmt.Errorf("invalid metadata pair: %q", pair)
+		}
+		value := ""
+		if len(parts) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid metadata value for %q: %v", parts[0], err)
+			}
+			value = string(decoded)
+		}
+		metadata[parts[0]] = value
+	}
+	return metadata, nil
+}
+
+// Path returns the file holding the received bytes of an upload
+func (s *TusStore) Path(id string) string {
+	return filepath.Join(s.dir, id)
+}
+
+// Create registers a new upload and creates its empty data file
+func (s *TusStore) Create(upload *models.Upload) error {
+	if upload.ID == "" {
+		upload.ID = uuid.New().String()
+	}
+	upload.Offset = 0
+	upload.CreatedAt = time.Now()
+	upload.UpdatedAt = upload.CreatedAt
+	upload.ExpiresAt = upload.CreatedAt.Add(s.expiration)
+
+	file, err := os.Create(s.Path(upload.ID))
+	if err != nil {
+		return fmt.Errorf("failed to create upload file: %v", err)
+	}
+	file.Close()
+
+	if err := s.repo.CreateUpload(upload); err != nil {
+		os.Remove(s.Path(upload.ID))
+		return err
+	}
+	return nil
+}
+
+// Get returns the state of an upload
+func (s *TusStore) Get(id string) (*models.Upload, error) {
+	return s.repo.GetUpload(id)
+}
+
+// Lock gives the caller exclusive write access to an upload until the
+// returned function is called
+func (s *TusStore) Lock(id string) (func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.locked[id] {
+		return nil, ErrUploadLocked
+	}
+	s.locked[id] = true
+
+	return func() {
+		s.mu.Lock()
+		delete(s.locked, id)
+		s.mu.Unlock()
+	}, nil
+}
+
+// Append writes a chunk starting at offset, which must match the bytes
+// received so far, and returns the number of bytes written. Whatever arrived
+// before the reader failed is kept, so the client can resume from there. The
+// caller must hold the lock of the upload.
+func (s *TusStore) Append(upload *models.Upload, offset int64, r io.Reader) (int64, error) {
+	if offset != upload.Offset {
+		return 0, ErrOffsetMismatch
+	}
+
+	file, err := os.OpenFile(s.Path(upload.ID), os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open upload file: %v", err)
+	}
+	defer file.Close()
+
+	// Drop bytes past the recorded offset left by a crash during a write
+	if err := file.Truncate(offset); err != nil {
+		return 0, fmt.Errorf("failed to truncate upload file: %v", err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to seek upload file: %v", err)
+	}
+
+	written, copyErr := io.Copy(file, io.LimitReader(r, upload.Length-offset))
+	if err := file.Sync(); err != nil && copyErr == nil {
+		copyErr = fmt.Errorf("failed to sync upload file: %v", err)
+	}
+
+	upload.Offset += written
+	upload.ExpiresAt = time.Now().Add(s.expiration)
+	if err := s.repo.UpdateUpload(upload); err != nil {
+		return written, err
+	}
+	return written, copyErr
+}
+
+// Complete records the media item created from a finished upload and
+// releases its data file, which the media pipeline has taken over
+func (s *TusStore) Complete(upload *models.Upload, mediaID string) error {
+	upload.MediaID = mediaID
+	if err := os.Remove(s.Path(upload.ID)); err != nil && !os.IsNotExist(err) {
+		log.Printf("⚠️ Failed to remove upload file %s: %v", upload.ID, err)
+	}
+	return s.repo.UpdateUpload(upload)
+}
+
+// Terminate removes an upload and its data
+func (s *TusStore) Terminate(id string) error {
+	if err := os.Remove(s.Path(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove upload file: %v", err)
+	}
+	return s.repo.DeleteUpload(id)
+}
+
+// PurgeExpired removes every expired upload and returns how many were removed
+func (s *TusStore) PurgeExpired() (int, error) {
+	uploads, err := s.repo.ListExpiredUploads(time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, upload := range uploads {
+		unlock, err := s.Lock(upload.ID)
+		if err != nil {
+			continue // being written to, so not really expired
+		}
+		if err := s.Terminate(upload.ID); err != nil {
+			log.Printf("⚠️ Failed to remove expired upload %s: %v", upload.ID, err)
+		} else {
+			purged++
+		}
+		unlock()
+	}
+	return purged, nil
+}
+
+// Start removes expired uploads now and periodically afterwards
+func (s *TusStore) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(tusPurgeInterval)
+		defer ticker.Stop()
+		for {
+			if purged, err := s.PurgeExpired(); err != nil {
+				log.Printf("❌ Failed to purge expired uploads: %v", err)
+			} else if purged > 0 {
+				log.Printf("🧹 Removed %d expired upload(s)", purged)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends the periodic removal of expired uploads
+func (s *TusStore) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	s.wg.Wait()
+}
@@ -0,0 +1,333 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"api-s3/config"
+	"api-s3/models"
+	"api-s3/repository"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultWebhookID is the ID of the webhook configured through WEBHOOK_URL
+	DefaultWebhookID = "default"
+
+	webhookPollInterval = 2 * time.Second
+	webhookBatchSize    = 20
+	webhookEventBuffer  = 256
+
+	// Headers sent with every delivery
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// webhookPayload is the JSON body of a delivery
+type webhookPayload struct {
+	ID string `json:"id"` // shared by every delivery of the same event
+	models.MediaEvent
+}
+
+// WebhookDispatcher records a delivery for every webhook subscribed to a
+// published media event and sends them in the background, retrying failed
+// deliveries with exponential backoff. Deliveries are persisted, so pending
+// ones survive a restart.
+type WebhookDispatcher struct {
+	repo        repository.WebhookRepository
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+
+	events chan models.MediaEvent
+	wake   chan struct{}
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewWebhookDispatcher creates a dispatcher using the webhook settings from
+// the configuration and hooks it into events
+func NewWebhookDispatcher(repo repository.WebhookRepository, events *EventBroker) *WebhookDispatcher {
+	maxAttempts := config.AppConfig.WebhookMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+
+	d := &WebhookDispatcher{
+		repo:        repo,
+		client:      &http.Client{Timeout: time.Duration(config.AppConfig.WebhookTimeout) * time.Second},
+		maxAttempts: maxAttempts,
+		backoff:     time.Duration(config.AppConfig.WebhookRetryBackoff) * time.Second,
+		events:      make(chan models.MediaEvent, webhookEventBuffer),
+		wake:        make(chan struct{}, 1),
+	}
+	if events != nil {
+		events.OnEvent(d.notify)
+	}
+	return d
+}
+
+// GenerateWebhookSecret returns a random secret for signing deliveries
+func GenerateWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// SignWebhookPayload returns the signature of a delivery: the hex encoded
+// HMAC-SHA256 of "<timestamp>.<body>" keyed with the webhook secret
+func SignWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Start registers the webhook from the configuration, if any, and starts
+// sending deliveries
+func (d *WebhookDispatcher) Start() error {
+	if config.AppConfig.WebhookURL != "" {
+		if err := d.registerDefault(); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	d.wg.Add(2)
+	go d.record(ctx)
+	go d.run(ctx)
+
+	log.Println("🪝 Webhook dispatcher started")
+	return nil
+}
+
+// Stop records the events still buffered and waits for the delivery in
+// flight to finish
+func (d *WebhookDispatcher) Stop() {
+	if d.cancel == nil {
+		return
+	}
+	d.cancel()
+	d.wg.Wait()
+}
+
+func (d *WebhookDispatcher) registerDefault() error {
+	events := config.AppConfig.WebhookEvents
+	if len(events) == 0 {
+		events = models.WebhookEvents
+	}
+
+	webhook := &models.Webhook{
+		ID:     DefaultWebhookID,
+		URL:    config.AppConfig.WebhookURL,
+		Secret: config.AppConfig.WebhookSecret,
+		Events: events,
+		Active: true,
+	}
+	if existing, err := d.repo.GetWebhook(DefaultWebhookID); err == nil {
+		webhook.CreatedAt = existing.CreatedAt
+	}
+	if err := d.repo.SaveWebhook(webhook); err != nil {
+		return fmt.Errorf("failed to register default webhook: %v", err)
+	}
+
+	if webhook.Secret == "" {
+		log.Println("⚠️  WEBHOOK_SECRET is not set, deliveries to the default webhook are signed with an empty key")
+	}
+	log.Printf("🪝 Default webhook registered: %s", webhook.URL)
+	return nil
+}
+
+// notify hands a published event to the recorder, so publishing requests do
+// not wait for the database. When the buffer is full the deliveries are
+// recorded right away rather than dropped.
+func (d *WebhookDispatcher) notify(event models.MediaEvent) {
+	if !models.IsWebhookEvent(event.Type) {
+		return
+	}
+	select {
+	case d.events <- event:
+	default:
+		d.enqueue(event)
+	}
+}
+
+// record stores the deliveries of buffered events until the dispatcher
+// stops, then drains what is left
+func (d *WebhookDispatcher) record(ctx context.Context) {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case event := <-d.events:
+			d.enqueue(event)
+		case <-ctx.Done():
+			for {
+				select {
+				case event := <-d.events:
+					d.enqueue(event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// enqueue records a delivery for every webhook subscribed to the event
+func (d *WebhookDispatcher) enqueue(event models.MediaEvent) {
+	webhooks, err := d.repo.ListWebhooks()
+	if err != nil {
+		log.Printf("❌ Failed to load webhooks: %v", err)
+		return
+	}
+
+	var payload []byte
+	for _, webhook := range webhooks {
+		if !webhook.Subscribes(event.Type) {
+			continue
+		}
+		if payload == nil {
+			payload, err = json.Marshal(webhookPayload{ID: uuid.New().String(), MediaEvent: event})
+			if err != nil {
+				log.Printf("❌ Failed to encode webhook payload: %v", err)
+				return
+			}
+		}
+
+		delivery := &models.WebhookDelivery{
+			ID:            uuid.New().String(),
+			WebhookID:     webhook.ID,
+			EventType:     event.Type,
+			MediaID:       event.MediaID,
+			Payload:       string(payload),
+			Status:        models.DeliveryStatusPending,
+			MaxAttempts:   d.maxAttempts,
+			NextAttemptAt: time.Now(),
+			CreatedAt:     time.Now(),
+			UpdatedAt:     time.Now(),
+		}
+		if err := d.repo.CreateDelivery(delivery); err != nil {
+			log.Printf("❌ Failed to record webhook delivery: %v", err)
+			continue
+		}
+	}
+
+	if payload != nil {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (d *WebhookDispatcher) run(ctx context.Context) {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		deliveries, err := d.repo.ListDueDeliveries(time.Now(), webhookBatchSize)
+		if err != nil {
+			log.Printf("❌ Failed to load webhook deliveries: %v", err)
+		}
+		for i := range deliveries {
+			if ctx.Err() != nil {
+				return
+			}
+			d.attempt(ctx, &deliveries[i])
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// attempt sends a delivery once and records the outcome
+func (d *WebhookDispatcher) attempt(ctx context.Context, delivery *models.WebhookDelivery) {
+	webhook, err := d.repo.GetWebhook(delivery.WebhookID)
+	if err != nil {
+		// Webhook deleted meanwhile; its deliveries went with it
+		return
+	}
+
+	delivery.Attempts++
+	status, err := d.send(ctx, webhook, delivery)
+	delivery.ResponseStatus = status
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliveryStatusSucceeded
+		delivery.Error = ""
+		log.Printf("🪝 Delivered %s to %s", delivery.EventType, webhook.URL)
+	case ctx.Err() != nil:
+		// Shutting down; try again after the restart without counting this attempt
+		delivery.Attempts--
+		return
+	case delivery.Attempts >= delivery.MaxAttempts:
+		delivery.Status = models.DeliveryStatusFailed
+		delivery.Error = err.Error()
+		log.Printf("❌ Webhook delivery %s to %s failed permanently: %v", delivery.ID, webhook.URL, err)
+	default:
+		delay := d.backoff * time.Duration(1<<uint(delivery.Attempts-1))
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = time.Now().Add(delay)
+		log.Printf("🔁 Webhook delivery %s to %s failed, retrying in %v: %v", delivery.ID, webhook.URL, delay, err)
+	}
+
+	if err := d.repo.UpdateDelivery(delivery); err != nil {
+		log.Printf("⚠️ Failed to update webhook delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// send posts the signed payload, treating any non-2xx response as a failure
+func (d *WebhookDispatcher) send(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("invalid webhook request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "api-s3-webhooks/1.0")
+	req.Header.Set(WebhookEventHeader, delivery.EventType)
+	req.Header.Set(WebhookDeliveryHeader, delivery.ID)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(webhook.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
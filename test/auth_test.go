@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"api-s3/config"
+	"api-s3/handlers"
+	"api-s3/models"
+	"api-s3/repository"
+	"api-s3/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAdminKey = "ak_test-admin-key"
+
+func setupAuthTest(t *testing.T) (*gin.Engine, *repository.SQLiteRepository) {
+	loadTestConfig(t)
+	config.AppConfig.AuthEnabled = true
+	config.AppConfig.EnableImageProcessing = false
+	storage, err := services.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newTestRepository(t)
+	if err := services.EnsureAdminAPIKey(repo, testAdminKey); err != nil {
+		t.Fatal(err)
+	}
+
+	media := handlers.NewMediaHandler(storage, nil, repo, nil, nil)
+	keys := handlers.NewAPIKeyHandler(repo, nil)
+	router := gin.New()
+	router.POST("/api/v1/upload-stream", keys.RequireScope(models.ScopeUpload), media.UploadMediaStream)
+	router.GET("/api/v1/media", keys.RequireScope(models.ScopeRead), media.ListMedia)
+	admin := router.Group("/api/v1/admin/keys", keys.RequireScope(models.ScopeAdmin))
+	admin.POST("", keys.CreateKey)
+	admin.POST("/:id/rotate", keys.RotateKey)
+	admin.DELETE("/:id", keys.RevokeKey)
+	return router, repo
+}
+
+func authRequest(router *gin.Engine, method, target, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func createTestKey(t *testing.T, router *gin.Engine, scopes ...string) *models.APIKey {
+	body, _ := json.Marshal(models.APIKeyRequest{Name: "client", Scopes: scopes})
+	w := authRequest(router, http.MethodPost, "/api/v1/admin/keys", testAdminKey, string(body))
+	if !assert.Equal(t, http.StatusCreated, w.Code, w.Body.String()) {
+		t.FailNow()
+	}
+	var resp models.APIKeyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp.APIKey
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	router, _ := setupAuthTest(t)
+
+	w := authRequest(router, http.MethodGet, "/api/v1/media", "", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+
+	assert.Equal(t, http.StatusUnauthorized, authRequest(router, http.MethodGet, "/api/v1/media", "ak_unknown", "").Code)
+
+	reader := createTestKey(t, router, "READ", models.ScopeRead)
+	assert.Equal(t, []string{models.ScopeRead}, reader.Scopes)
+	assert.True(t, strings.HasPrefix(reader.Key, reader.Prefix))
+
+	assert.Equal(t, http.StatusOK, authRequest(router, http.MethodGet, "/api/v1/media", reader.Key, "").Code)
+	assert.Equal(t, http.StatusOK, authRequest(router, http.MethodGet, "/api/v1/media?api_key="+reader.Key, "", "").Code)
+
+	w = authRequest(router, http.MethodPost, "/api/v1/upload-stream?filename=a.png", reader.Key, "\x89PNG\r\n\x1a\n")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "API key lacks the upload scope")
+
+	w = authRequest(router, http.MethodPost, "/api/v1/admin/keys", reader.Key, `{"name":"x","scopes":["read"]}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = authRequest(router, http.MethodPost, "/api/v1/admin/keys", testAdminKey, `{"name":"x","scopes":["superuser"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	config.AppConfig.AuthEnabled = false
+	assert.Equal(t, http.StatusOK, authRequest(router, http.MethodGet, "/api/v1/media", "", "").Code)
+}
+
+func TestAPIKeyRotateAndRevoke(t *testing.T) {
+	router, repo := setupAuthTest(t)
+	key := createTestKey(t, router, models.ScopeRead)
+
+	w := authRequest(router, http.MethodPost, "/api/v1/admin/keys/"+key.ID+"/rotate", testAdminKey, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var rotated models.APIKeyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rotated))
+	assert.Equal(t, key.ID, rotated.APIKey.ID)
+	assert.NotEqual(t, key.Key, rotated.APIKey.Key)
+
+	assert.Equal(t, http.StatusUnauthorized, authRequest(router, http.MethodGet, "/api/v1/media", key.Key, "").Code)
+	assert.Equal(t, http.StatusOK, authRequest(router, http.MethodGet, "/api/v1/media", rotated.APIKey.Key, "").Code)
+
+	stored, err := repo.GetAPIKey(key.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, stored.LastUsedAt)
+	assert.Equal(t, services.HashAPIKey(rotated.APIKey.Key), stored.KeyHash)
+
+	assert.Equal(t, http.StatusOK, authRequest(router, http.MethodDelete, "/api/v1/admin/keys/"+key.ID, testAdminKey, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, authRequest(router, http.MethodGet, "/api/v1/media", rotated.APIKey.Key, "").Code)
+	assert.Equal(t, http.StatusConflict, authRequest(router, http.MethodPost, "/api/v1/admin/keys/"+key.ID+"/rotate", testAdminKey, "").Code)
+	assert.Equal(t, http.StatusNotFound, authRequest(router, http.MethodDelete, "/api/v1/admin/keys/missing", testAdminKey, "").Code)
+}
+
+func TestUploadRecordsAPIKey(t *testing.T) {
+	router, repo := setupAuthTest(t)
+	key := createTestKey(t, router, models.ScopeUpload)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/upload-stream?filename=a.png",
+		bytes.NewReader([]byte("\x89PNG\r\n\x1a\n-png-data")))
+	req.Header.Set("X-API-Key", key.Key)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if !assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		return
+	}
+
+	var resp models.UploadResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	media, err := repo.GetMedia(resp.Media.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, key.ID, media.APIKeyID)
+}
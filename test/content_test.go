@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"api-s3/config"
+	"api-s3/handlers"
+	"api-s3/models"
+	"api-s3/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSniffContent(t *testing.T) {
+	cases := map[string]string{
+		"\xff\xd8\xff\xe0\x00\x10JFIF":                             "jpeg",
+		"\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR":                      "png",
+		"GIF89a\x01\x00\x01\x00":                                   "gif",
+		"RIFF\x24\x00\x00\x00WEBPVP8 ":                             "webp",
+		"\x00\x00\x00\x1cftypavif\x00\x00\x00\x00avifmif1miaf":     "avif",
+		"\x00\x00\x00\x18ftypmif1\x00\x00\x00\x00mif1avif":         "avif",
+		"\x00\x00\x00\x20ftypisom\x00\x00\x02\x00isomiso2avc1mp41": "mp4",
+		"\x00\x00\x00\x14ftypqt  \x00\x00\x02\x00qt  ":             "mov",
+		"\x00\x00\x00\x08wide\x00\x00\x00\x00mdat":                 "mov",
+		"\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\x82\x88matroska": "mkv",
+		"\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\x82\x84webm":     "webm",
+		"RIFF\x24\x00\x00\x00AVI LIST":                             "avi",
+	}
+	for head, container := range cases {
+		format := services.SniffContent([]byte(head))
+		if assert.NotNil(t, format, container) {
+			assert.Equal(t, container, format.Container)
+		}
+	}
+
+	for _, head := range []string{"MZ\x90\x00\x03\x00", "\x7fELF\x02\x01", "%PDF-1.7", "<html>", ""} {
+		assert.Nil(t, services.SniffContent([]byte(head)), head)
+	}
+}
+
+func TestCheckContent(t *testing.T) {
+	loadTestConfig(t)
+
+	format, err := services.CheckContent([]byte("\x00\x00\x00\x14ftypqt  \x00\x00\x02\x00qt  "))
+	assert.NoError(t, err)
+	assert.Equal(t, models.MediaTypeVideo, format.MediaType)
+	assert.Equal(t, "video/quicktime", format.MimeType)
+
+	// A renamed executable
+	_, err = services.CheckContent([]byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00"))
+	assert.IsType(t, &services.ContentError{}, err)
+	assert.Contains(t, err.Error(), "not a supported image or video")
+
+	config.AppConfig.AllowedContainers = []string{"jpeg", "png", "mp4"}
+	_, err = services.CheckContent([]byte("GIF89a\x01\x00\x01\x00"))
+	assert.EqualError(t, err, "gif files are not allowed (allowed: jpeg, png, mp4)")
+}
+
+func TestCheckProbe(t *testing.T) {
+	loadTestConfig(t)
+	config.AppConfig.AllowedVideoCodecs = []string{"h264", "vp9"}
+	config.AppConfig.AllowedAudioCodecs = []string{"aac", "opus"}
+
+	assert.NoError(t, services.CheckProbe(testProbe("mov,mp4,m4a,3gp,3g2,mj2", "isom", "h264", "yuv420p", "aac")))
+	assert.EqualError(t, services.CheckProbe(testProbe("matroska,webm", "", "hevc", "yuv420p", "aac")),
+		"video codec hevc is not allowed (allowed: h264, vp9)")
+	assert.EqualError(t, services.CheckProbe(testProbe("matroska,webm", "", "vp9", "yuv420p", "flac")),
+		"audio codec flac is not allowed (allowed: aac, opus)")
+
+	// Cover art alone is not a video
+	probe := &models.MediaProbe{Streams: []models.ProbeStream{
+		{Type: models.StreamTypeVideo, Codec: "mjpeg", AttachedPic: true},
+		{Type: models.StreamTypeAudio, Codec: "aac"},
+	}}
+	assert.EqualError(t, services.CheckProbe(probe), "file has no video stream")
+}
+
+func TestUploadRejectsRenamedExecutable(t *testing.T) {
+	loadTestConfig(t)
+	storage, err := services.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := handlers.NewMediaHandler(storage, nil, newTestRepository(t), nil, nil)
+	router := gin.New()
+	router.POST("/api/v1/upload-stream", handler.UploadMediaStream)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/upload-stream?filename=holiday.jpg",
+		strings.NewReader("MZ\x90\x00\x03\x00\x00\x00\x04\x00\x00\x00\xff\xff"))
+	req.Header.Set("Content-Type", "image/jpeg")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "File rejected: file content is not a supported image or video")
+
+	list, err := storage.List(req.Context(), "media/")
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func TestUploadIgnoresDeclaredType(t *testing.T) {
+	loadTestConfig(t)
+	config.AppConfig.EnableImageProcessing = false
+	storage, err := services.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := handlers.NewMediaHandler(storage, nil, newTestRepository(t), nil, nil)
+	router := gin.New()
+	router.POST("/api/v1/upload-stream", handler.UploadMediaStream)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/upload-stream?filename=scan.bin",
+		strings.NewReader("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if !assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		return
+	}
+
+	var response models.UploadResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	if assert.NotNil(t, response.Media) {
+		assert.Equal(t, models.MediaTypeImage, response.Media.MediaType)
+		assert.Equal(t, "image/png", response.Media.MimeType)
+	}
+}
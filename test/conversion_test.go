@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"api-s3/config"
+	"api-s3/models"
+	"api-s3/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeMP4 writes a file made of empty top level atoms of the given types
+func writeMP4(t *testing.T, atoms ...string) string {
+	var data []byte
+	for _, atom := range atoms {
+		header := make([]byte, 16)
+		binary.BigEndian.PutUint32(header, 16)
+		copy(header[4:], atom)
+		data = append(data, header...)
+	}
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testProbe(format, brand, videoCodec, pixelFormat, audioCodec string) *models.MediaProbe {
+	probe := &models.MediaProbe{
+		FormatName: format,
+		Tags:       map[string]string{"major_brand": brand},
+		Streams: []models.ProbeStream{
+			{Index: 0, Type: models.StreamTypeVideo, Codec: videoCodec, PixelFormat: pixelFormat},
+		},
+	}
+	if audioCodec != "" {
+		probe.Streams = append(probe.Streams, models.ProbeStream{Index: 1, Type: models.StreamTypeAudio, Codec: audioCodec})
+	}
+	return probe
+}
+
+func TestPlanConversion(t *testing.T) {
+	faststart := writeMP4(t, "ftyp", "moov", "mdat")
+	trailing := writeMP4(t, "ftyp", "free", "mdat", "moov")
+	mp4 := "mov,mp4,m4a,3gp,3g2,mj2"
+
+	plan, err := services.PlanConversion(testProbe(mp4, "isom", "h264", "yuv420p", "aac"), faststart, "clip.mp4")
+	assert.NoError(t, err)
+	assert.Equal(t, models.ProcessingModePassthrough, plan.Mode)
+
+	// Trailing moov atom
+	plan, err = services.PlanConversion(testProbe(mp4, "isom", "h264", "yuv420p", "aac"), trailing, "clip.mp4")
+	assert.NoError(t, err)
+	assert.Equal(t, models.ProcessingModeRemux, plan.Mode)
+
+	// H.264 in Matroska only needs a new container
+	plan, err = services.PlanConversion(testProbe("matroska,webm", "", "h264", "yuv420p", "aac"), trailing, "clip.mkv")
+	assert.NoError(t, err)
+	assert.Equal(t, models.ProcessingModeRemux, plan.Mode)
+	args := strings.Join(plan.FFmpegArgs("in.mkv", "out.mp4"), " ")
+	assert.Contains(t, args, "-c:v copy")
+	assert.Contains(t, args, "-c:a copy")
+	assert.Contains(t, args, "+faststart")
+
+	// QuickTime shares the MP4 format name
+	plan, err = services.PlanConversion(testProbe(mp4, "qt  ", "h264", "yuv420p", "aac"), faststart, "clip.mov")
+	assert.NoError(t, err)
+	assert.Equal(t, models.ProcessingModeRemux, plan.Mode)
+
+	// HEVC in an MP4 is transcoded, the AAC audio is kept
+	plan, err = services.PlanConversion(testProbe(mp4, "isom", "hevc", "yuv420p10le", "aac"), faststart, "clip.mp4")
+	assert.NoError(t, err)
+	assert.Equal(t, models.ProcessingModeTranscode, plan.Mode)
+	assert.Contains(t, plan.Reason, "hevc")
+	args = strings.Join(plan.FFmpegArgs("in.mp4", "out.mp4"), " ")
+	assert.Contains(t, args, "-c:v libx264")
+	assert.Contains(t, args, "-c:a copy")
+
+	// Opus audio is transcoded, the H.264 video is kept
+	plan, err = services.PlanConversion(testProbe("matroska,webm", "", "h264", "yuv420p", "opus"), faststart, "clip.webm")
+	assert.NoError(t, err)
+	assert.Equal(t, models.ProcessingModeTranscode, plan.Mode)
+	args = strings.Join(plan.FFmpegArgs("in.webm", "out.mp4"), " ")
+	assert.Contains(t, args, "-c:v copy")
+	assert.Contains(t, args, "-c:a aac")
+
+	// Silent videos map no audio
+	plan, err = services.PlanConversion(testProbe(mp4, "isom", "h264", "yuv420p", ""), faststart, "clip.mp4")
+	assert.NoError(t, err)
+	assert.Equal(t, models.ProcessingModePassthrough, plan.Mode)
+	assert.NotContains(t, strings.Join(plan.FFmpegArgs("in", "out"), " "), "0:1")
+
+	_, err = services.PlanConversion(&models.MediaProbe{}, faststart, "clip.mp4")
+	assert.Error(t, err)
+}
+
+func TestConvertTimeoutScalesWithDuration(t *testing.T) {
+	loadTestConfig(t)
+	config.AppConfig.ConvertTimeoutRatio = 4
+	config.AppConfig.ConvertTimeoutMin = 5
+
+	assert.Equal(t, 5*time.Minute, services.ConvertTimeout(0))
+	assert.Equal(t, 5*time.Minute, services.ConvertTimeout(30))
+	assert.Equal(t, 8*time.Hour, services.ConvertTimeout(2*3600))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"api-s3/handlers"
+	"api-s3/models"
+	"api-s3/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// readEvent reads the next "event:"/"data:" pair from a Server-Sent Events stream
+func readEvent(t *testing.T, reader *bufio.Reader) (string, models.MediaEvent) {
+	var name string
+	var event models.MediaEvent
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("event stream ended: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &event))
+		case line == "" && name != "":
+			return name, event
+		}
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	repo := setupJobQueueTest(t)
+
+	events := services.NewEventBroker()
+	queue := services.NewJobQueue(repo, &flakyProcessor{}, events)
+	job, err := queue.Enqueue("media-1", "input.mov")
+	assert.NoError(t, err)
+
+	handler := handlers.NewMediaHandler(nil, nil, repo, queue, events)
+	router := gin.New()
+	router.GET("/api/v1/media/:id/events", handler.StreamEvents)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/v1/media/media-1/events")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	reader := bufio.NewReader(resp.Body)
+
+	// The current state comes first
+	name, event := readEvent(t, reader)
+	assert.Equal(t, models.EventProcessingQueued, name)
+	assert.Equal(t, job.ID, event.Job.ID)
+
+	// Then transitions as they are published
+	job.Status = models.JobStatusProcessing
+	job.Progress = 40
+	job.Stage = models.JobStageHLS
+	events.Publish(models.EventProcessingProgress, "media-1", nil, job)
+	events.Publish(models.EventProcessingProgress, "other-media", nil, job)
+
+	name, event = readEvent(t, reader)
+	assert.Equal(t, models.EventProcessingProgress, name)
+	assert.Equal(t, "media-1", event.MediaID)
+	assert.Equal(t, 40, event.Job.Progress)
+	assert.Equal(t, models.JobStageHLS, event.Job.Stage)
+}
+
+func TestStreamEventsUnknownMedia(t *testing.T) {
+	repo := setupJobQueueTest(t)
+	handler := handlers.NewMediaHandler(nil, nil, repo, nil, services.NewEventBroker())
+
+	router := gin.New()
+	router.GET("/api/v1/media/:id/events", handler.StreamEvents)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/media/missing/events", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestEventHandlersDoNotBlockSubscribers(t *testing.T) {
+	events := services.NewEventBroker()
+	entered, release := make(chan struct{}), make(chan struct{})
+	events.OnEvent(func(models.MediaEvent) {
+		close(entered)
+		<-release
+	})
+	go events.Publish(models.EventMediaUploaded, "media-1", nil, nil)
+	<-entered
+
+	subscribed := make(chan struct{})
+	go func() {
+		_, unsubscribe := events.Subscribe("media-1")
+		unsubscribe()
+		close(subscribed)
+	}()
+	select {
+	case <-subscribed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Subscribe waited for a slow event handler")
+	}
+	close(release)
+}
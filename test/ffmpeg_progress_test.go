@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"api-s3/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadFFmpegProgress(t *testing.T) {
+	output := strings.Join([]string{
+		"frame=25",
+		"out_time_us=2500000",
+		"out_time_ms=2500000",
+		"out_time=00:00:02.500000",
+		"progress=continue",
+		"frame=50",
+		"out_time_us=N/A",
+		"out_time_ms=N/A",
+		"out_time=00:00:05.000000",
+		"progress=continue",
+		"frame=100",
+		"out_time_us=10000000",
+		"progress=end",
+	}, "\n")
+
+	var reported []float64
+	services.ReadFFmpegProgress(strings.NewReader(output), 10, func(fraction float64) {
+		reported = append(reported, fraction)
+	})
+
+	assert.Equal(t, []float64{0.25, 0.5, 1}, reported)
+}
+
+func TestReadFFmpegProgressUnknownDuration(t *testing.T) {
+	output := "out_time_us=2500000\nprogress=continue\nprogress=end\n"
+
+	var reported []float64
+	services.ReadFFmpegProgress(strings.NewReader(output), 0, func(fraction float64) {
+		reported = append(reported, fraction)
+	})
+
+	// Only completion can be reported without a duration
+	assert.Equal(t, []float64{1}, reported)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"api-s3/config"
+	"api-s3/models"
+	"api-s3/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// jpegSegment builds a JPEG marker segment with its length field
+func jpegSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// exifSegment builds a little endian APP1 Exif segment holding only the
+// orientation and a GPS IFD pointer tag
+func exifSegment(orientation uint16) []byte {
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tiff = append(tiff, 2, 0) // two entries
+	entry := make([]byte, 12)
+	binary.LittleEndian.PutUint16(entry[0:], 0x0112)
+	binary.LittleEndian.PutUint16(entry[2:], 3) // SHORT
+	binary.LittleEndian.PutUint32(entry[4:], 1)
+	binary.LittleEndian.PutUint16(entry[8:], orientation)
+	tiff = append(tiff, entry...)
+	gps := make([]byte, 12)
+	binary.LittleEndian.PutUint16(gps[0:], 0x8825)
+	binary.LittleEndian.PutUint16(gps[2:], 4) // LONG
+	binary.LittleEndian.PutUint32(gps[4:], 1)
+	tiff = append(tiff, gps...)
+	tiff = append(tiff, 0, 0, 0, 0) // no next IFD
+	return jpegSegment(0xE1, append([]byte("Exif\x00\x00"), tiff...))
+}
+
+func testJPEG(segments ...[]byte) []byte {
+	data := []byte{0xFF, 0xD8}
+	for _, segment := range segments {
+		data = append(data, segment...)
+	}
+	// Start of scan followed by entropy coded data and the end marker
+	data = append(data, jpegSegment(0xDA, []byte{1, 1, 0, 0, 0x3F, 0})...)
+	return append(data, 0x12, 0x34, 0xFF, 0x00, 0x56, 0xFF, 0xD9)
+}
+
+func TestExifOrientation(t *testing.T) {
+	jfif := jpegSegment(0xE0, []byte("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00"))
+
+	assert.Equal(t, 6, services.ExifOrientation(testJPEG(jfif, exifSegment(6))))
+	assert.Equal(t, 0, services.ExifOrientation(testJPEG(jfif)))
+	assert.Equal(t, 0, services.ExifOrientation(testJPEG(exifSegment(9)))) // out of range
+	assert.Equal(t, 0, services.ExifOrientation([]byte("not an image")))
+}
+
+func TestStripImageMetadataJPEG(t *testing.T) {
+	jfif := jpegSegment(0xE0, []byte("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00"))
+	icc := jpegSegment(0xE2, []byte("ICC_PROFILE\x00\x01\x01"))
+	comment := jpegSegment(0xFE, []byte("shot at home"))
+	quant := jpegSegment(0xDB, bytes.Repeat([]byte{1}, 65))
+
+	stripped, ok := services.StripImageMetadata(testJPEG(jfif, exifSegment(1), icc, comment, quant))
+	assert.True(t, ok)
+	assert.Equal(t, testJPEG(jfif, icc, quant), stripped)
+	assert.Equal(t, 0, services.ExifOrientation(stripped))
+
+	_, ok = services.StripImageMetadata([]byte("GIF89a"))
+	assert.False(t, ok)
+	_, ok = services.StripImageMetadata([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0xFF}) // truncated
+	assert.False(t, ok)
+}
+
+func TestStripImageMetadataPNG(t *testing.T) {
+	chunk := func(chunkType string, payload []byte) []byte {
+		data := make([]byte, 4, 12+len(payload))
+		binary.BigEndian.PutUint32(data, uint32(len(payload)))
+		data = append(data, chunkType...)
+		data = append(data, payload...)
+		return append(data, 0, 0, 0, 0) // CRC is not checked
+	}
+	png := func(chunks ...[]byte) []byte {
+		data := []byte("\x89PNG\r\n\x1a\n")
+		for _, c := range chunks {
+			data = append(data, c...)
+		}
+		return data
+	}
+	ihdr := chunk("IHDR", make([]byte, 13))
+	idat := chunk("IDAT", []byte{1, 2, 3})
+	iend := chunk("IEND", nil)
+
+	stripped, ok := services.StripImageMetadata(png(ihdr, chunk("tEXt", []byte("Author\x00me")),
+		chunk("eXIf", []byte("MM\x00*")), idat, iend))
+	assert.True(t, ok)
+	assert.Equal(t, png(ihdr, idat, iend), stripped)
+}
+
+func TestImageWidths(t *testing.T) {
+	loadTestConfig(t)
+	config.AppConfig.ImageSizes = []string{"1024", "320w", "640", "320", "bogus"}
+
+	assert.Equal(t, []int{320, 640, 1024}, services.ImageWidths(4000))
+	assert.Equal(t, []int{320, 640}, services.ImageWidths(800))
+	// Smaller than every size: one variant at its own width
+	assert.Equal(t, []int{200}, services.ImageWidths(200))
+}
+
+func TestRepositoryImageVariants(t *testing.T) {
+	repo := newTestRepository(t)
+	assert.NoError(t, repo.CreateMedia(&models.Media{ID: "img-1", MediaType: models.MediaTypeImage}))
+
+	now := time.Now().UTC().Truncate(time.Second)
+	variant := func(id, format string, width int) models.ImageVariant {
+		key := services.ImageVariantKey(models.DefaultTenantID, "img-1", width, format)
+		return models.ImageVariant{ID: id, MediaID: "img-1", Format: format, Width: width, Height: width / 2,
+			URL: "/uploads/" + key, StorageKey: key, Size: int64(width), CreatedAt: now}
+	}
+	assert.NoError(t, repo.SaveImageVariants("img-1", []models.ImageVariant{
+		variant("a", "webp", 640), variant("b", "avif", 320), variant("c", "webp", 320),
+	}))
+
+	variants, err := repo.GetImageVariants("img-1")
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ImageVariant{
+		variant("b", "avif", 320), variant("c", "webp", 320), variant("a", "webp", 640),
+	}, variants)
+
+	// Saving again replaces the previous list
+	assert.NoError(t, repo.SaveImageVariants("img-1", []models.ImageVariant{variant("d", "webp", 1024)}))
+	variants, err = repo.GetImageVariants("img-1")
+	assert.NoError(t, err)
+	assert.Len(t, variants, 1)
+}
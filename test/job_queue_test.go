@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"api-s3/config"
+	"api-s3/models"
+	"api-s3/repository"
+	"api-s3/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyProcessor fails the first failures calls and succeeds afterwards
+type flakyProcessor struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+}
+
+func (p *flakyProcessor) Process(ctx context.Context, job *models.VideoProcessingJob) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	if p.calls <= p.failures {
+		return errors.New("transient failure")
+	}
+	return nil
+}
+
+func setupJobQueueTest(t *testing.T) *repository.SQLiteRepository {
+	loadTestConfig(t)
+	config.AppConfig.ProcessingWorkers = 1
+	config.AppConfig.JobMaxAttempts = 3
+	config.AppConfig.JobRetryBackoff = 0
+
+	repo := newTestRepository(t)
+	media := &models.Media{ID: "media-1", Filename: "clip.mov", OriginalName: "clip.mov",
+		MediaType: models.MediaTypeVideo, MimeType: "video/quicktime", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := repo.CreateMedia(media); err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func waitForJob(t *testing.T, repo repository.MediaRepository, jobID, status string) *models.VideoProcessingJob {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := repo.GetJob(jobID)
+		if err == nil && job.Status == status {
+			return job
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not reach status %s", jobID, status)
+	return nil
+}
+
+func TestJobQueueRetriesFailedJobs(t *testing.T) {
+	repo := setupJobQueueTest(t)
+	processor := &flakyProcessor{failures: 2}
+	queue := services.NewJobQueue(repo, processor, nil)
+	assert.NoError(t, queue.Start())
+	defer queue.Stop()
+
+	job, err := queue.Enqueue("media-1", "input.mov")
+	assert.NoError(t, err)
+
+	done := waitForJob(t, repo, job.ID, models.JobStatusCompleted)
+	assert.Equal(t, 3, done.Attempts)
+	assert.Equal(t, 100, done.Progress)
+}
+
+func TestJobQueueFailsAfterMaxAttempts(t *testing.T) {
+	repo := setupJobQueueTest(t)
+	queue := services.NewJobQueue(repo, &flakyProcessor{failures: 10}, nil)
+	assert.NoError(t, queue.Start())
+	defer queue.Stop()
+
+	job, err := queue.Enqueue("media-1", "input.mov")
+	assert.NoError(t, err)
+
+	failed := waitForJob(t, repo, job.ID, models.JobStatusFailed)
+	assert.Equal(t, 3, failed.Attempts)
+	assert.Equal(t, "transient failure", failed.Error)
+}
+
+func TestJobQueueRecoversInterruptedJobs(t *testing.T) {
+	repo := setupJobQueueTest(t)
+
+	// A job left in processing by a crashed run
+	job := &models.VideoProcessingJob{ID: "job-1", MediaID: "media-1", Status: models.JobStatusProcessing,
+		Attempts: 1, MaxAttempts: 3, InputPath: "input.mov", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	assert.NoError(t, repo.CreateJob(job))
+
+	processor := &flakyProcessor{}
+	queue := services.NewJobQueue(repo, processor, nil)
+	assert.NoError(t, queue.Start())
+	defer queue.Stop()
+
+	done := waitForJob(t, repo, job.ID, models.JobStatusCompleted)
+	assert.Equal(t, 2, done.Attempts)
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"api-s3/config"
+	"api-s3/handlers"
+	"api-s3/models"
+	"api-s3/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testIssuer   = "https://issuer.example.com/"
+	testAudience = "media-api"
+)
+
+// testSigner signs tokens with a locally generated key published in a JWKS file
+type testSigner struct {
+	kid string
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+}
+
+func (s *testSigner) jwk() map[string]string {
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	if s.rsa != nil {
+		return map[string]string{"kty": "RSA", "kid": s.kid, "use": "sig",
+			"n": b64(s.rsa.N.Bytes()), "e": b64(big.NewInt(int64(s.rsa.E)).Bytes())}
+	}
+	return map[string]string{"kty": "EC", "kid": s.kid, "crv": "P-256",
+		"x": b64(s.ec.X.FillBytes(make([]byte, 32))), "y": b64(s.ec.Y.FillBytes(make([]byte, 32)))}
+}
+
+func (s *testSigner) sign(t *testing.T, claims map[string]any) string {
+	alg := "RS256"
+	if s.ec != nil {
+		alg = "ES256"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": s.kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	var err error
+	if s.rsa != nil {
+		signature, err = rsa.SignPKCS1v15(rand.Reader, s.rsa, crypto.SHA256, digest[:])
+	} else {
+		var r, sv *big.Int
+		r, sv, err = ecdsa.Sign(rand.Reader, s.ec, digest[:])
+		signature = append(r.FillBytes(make([]byte, 32)), sv.FillBytes(make([]byte, 32))...)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func newTestSigners(t *testing.T) (*testSigner, *testSigner) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testSigner{kid: "rsa-1", rsa: rsaKey}, &testSigner{kid: "ec-1", ec: ecKey}
+}
+
+func writeJWKS(t *testing.T, path string, signers ...*testSigner) {
+	var keys []map[string]string
+	for _, signer := range signers {
+		keys = append(keys, signer.jwk())
+	}
+	data, _ := json.Marshal(map[string]any{"keys": keys})
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func setupJWTTest(t *testing.T, signers ...*testSigner) *services.JWTVerifier {
+	loadTestConfig(t)
+	config.AppConfig.JWTJWKSURL = filepath.Join(t.TempDir(), "jwks.json")
+	config.AppConfig.JWTIssuer = testIssuer
+	config.AppConfig.JWTAudience = testAudience
+	writeJWKS(t, config.AppConfig.JWTJWKSURL, signers...)
+
+	verifier, err := services.NewJWTVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return verifier
+}
+
+func testClaims(scope any) map[string]any {
+	return map[string]any{
+		"iss":   testIssuer,
+		"aud":   []string{"account", testAudience},
+		"sub":   "user-42",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": scope,
+	}
+}
+
+func TestJWTVerify(t *testing.T) {
+	rsaSigner, ecSigner := newTestSigners(t)
+	verifier := setupJWTTest(t, rsaSigner, ecSigner)
+	ctx := context.Background()
+
+	for _, signer := range []*testSigner{rsaSigner, ecSigner} {
+		claims, err := verifier.Verify(ctx, signer.sign(t, testClaims("openid upload read")))
+		if assert.NoError(t, err, signer.kid) {
+			assert.Equal(t, "user-42", claims.Subject)
+			assert.Equal(t, []string{models.ScopeUpload, models.ScopeRead}, claims.Scopes)
+		}
+	}
+
+	rejected := map[string]map[string]any{
+		"unexpected issuer":         {"iss": "https://evil.example.com/"},
+		"token is not intended for": {"aud": "other-api"},
+		"token has expired":         {"exp": time.Now().Add(-time.Hour).Unix()},
+		"token is not valid yet":    {"nbf": time.Now().Add(time.Hour).Unix()},
+		"token has no expiry":       {"exp": nil},
+	}
+	for reason, override := range rejected {
+		claims := testClaims("read")
+		for name, value := range override {
+			claims[name] = value
+		}
+		_, err := verifier.Verify(ctx, rsaSigner.sign(t, claims))
+		assert.IsType(t, &services.TokenError{}, err, reason)
+		assert.Contains(t, err.Error(), reason)
+	}
+
+	// Signed by a key that is not in the JWKS
+	strangerRSA, _ := newTestSigners(t)
+	_, err := verifier.Verify(ctx, strangerRSA.sign(t, testClaims("read")))
+	assert.EqualError(t, err, "invalid token signature")
+
+	// Unsigned tokens are never accepted
+	parts := strings.Split(rsaSigner.sign(t, testClaims("read")), ".")
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	_, err = verifier.Verify(ctx, header+"."+parts[1]+".")
+	assert.EqualError(t, err, `unsupported signing algorithm "none"`)
+}
+
+func TestJWTScopeMap(t *testing.T) {
+	rsaSigner, _ := newTestSigners(t)
+	loadTestConfig(t)
+	config.AppConfig.JWTScopeMap = []string{"media:admin=admin"}
+	config.AppConfig.JWTJWKSURL = "jwks.json"
+	config.AppConfig.JWTIssuer = testIssuer
+	config.AppConfig.JWTAudience = testAudience
+	_, err := services.NewJWTVerifier()
+	assert.Error(t, err, "tokens cannot be granted admin")
+
+	setupJWTTest(t, rsaSigner)
+	config.AppConfig.JWTScopeClaim = "realm_access.roles"
+	config.AppConfig.JWTScopeMap = []string{"media-editor=upload", "media-editor=delete", "viewer=read"}
+	verifier, err := services.NewJWTVerifier()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	claims := testClaims(nil)
+	claims["realm_access"] = map[string]any{"roles": []string{"media-editor", "offline_access"}}
+	granted, err := verifier.Verify(context.Background(), rsaSigner.sign(t, claims))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{models.ScopeUpload, models.ScopeDelete}, granted.Scopes)
+}
+
+func TestJWTMiddleware(t *testing.T) {
+	rsaSigner, ecSigner := newTestSigners(t)
+	verifier := setupJWTTest(t, rsaSigner, ecSigner)
+	config.AppConfig.AuthEnabled = true
+
+	keys := handlers.NewAPIKeyHandler(newTestRepository(t), verifier)
+	router := gin.New()
+	router.GET("/api/v1/media", keys.RequireScope(models.ScopeRead), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	})
+	get := func(target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	reader := rsaSigner.sign(t, testClaims("read"))
+	assert.Equal(t, http.StatusOK, get("/api/v1/media", reader).Code)
+	assert.Equal(t, http.StatusOK, get("/api/v1/media?access_token="+reader, "").Code)
+
+	w := get("/api/v1/media", rsaSigner.sign(t, testClaims("upload")))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "Token lacks the read scope")
+
+	w = get("/api/v1/media", ecSigner.sign(t, testClaims("read")))
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	claims := testClaims("read")
+	claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	w = get("/api/v1/media", rsaSigner.sign(t, claims))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid token: token has expired")
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), "invalid_token")
+}
+
+func TestJWKSServesCachedKeysDuringReload(t *testing.T) {
+	rsaSigner, ecSigner := newTestSigners(t)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, rsaSigner)
+
+	// Every reload after the first hangs until released
+	release := make(chan struct{})
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) > 1 {
+			<-release
+		}
+		http.ServeFile(w, r, path)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	jwks := services.NewJWKS(server.URL, time.Hour)
+	_, err := jwks.Key(ctx, "rsa-1")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	writeJWKS(t, path, rsaSigner, ecSigner)
+	refreshed := make(chan error, 1)
+	go func() { refreshed <- jwks.Refresh(ctx) }()
+	for deadline := time.Now().Add(5 * time.Second); requests.Load() < 2 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cached := make(chan error, 1)
+	go func() {
+		_, err := jwks.Key(ctx, "rsa-1")
+		cached <- err
+	}()
+	select {
+	case err := <-cached:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Error("cached key was not served while the key set reloaded")
+	}
+
+	close(release)
+	assert.NoError(t, <-refreshed)
+	assert.Equal(t, int32(2), requests.Load())
+	_, err = jwks.Key(ctx, "ec-1")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"api-s3/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalStorageRoundTrip(t *testing.T) {
+	store, err := services.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	err = store.Put(ctx, "media/abc/video.mp4", strings.NewReader("0123456789"), "video/mp4")
+	assert.NoError(t, err)
+
+	info, err := store.Head(ctx, "media/abc/video.mp4")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), info.Size)
+	assert.Equal(t, "video/mp4", info.ContentType)
+
+	body, _, err := store.GetRange(ctx, "media/abc/video.mp4", 2, 3)
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(body)
+	body.Close()
+	assert.Equal(t, "234", string(data))
+
+	objects, err := store.List(ctx, "media/abc/")
+	assert.NoError(t, err)
+	assert.Len(t, objects, 1)
+
+	// Prefixes are not directory names, and missing ones are empty
+	store.Put(ctx, "media/abcd/photo.jpg", strings.NewReader("x"), "image/jpeg")
+	objects, err = store.List(ctx, "media/ab")
+	assert.NoError(t, err)
+	assert.Len(t, objects, 2)
+	objects, err = store.List(ctx, "media/missing/")
+	assert.NoError(t, err)
+	assert.Empty(t, objects)
+	store.Delete(ctx, "media/abcd/photo.jpg")
+
+	deleted, err := services.DeletePrefix(ctx, store, "media/abc/")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+
+	exists, err := services.ObjectExists(ctx, store, "media/abc/video.mp4")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestLocalStorageRejectsEscapingKeys(t *testing.T) {
+	root := t.TempDir()
+	store, err := services.NewLocalStorage(root + "/store")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// "../" is cleaned against the storage root instead of escaping it
+	err = store.Put(context.Background(), "../outside.txt", strings.NewReader("x"), "text/plain")
+	assert.NoError(t, err)
+
+	exists, _ := services.ObjectExists(context.Background(), store, "outside.txt")
+	assert.True(t, exists)
+}
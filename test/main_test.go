@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,44 +10,107 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"api-s3/config"
-	"api-s3/handlers"
 	"api-s3/models"
+	"api-s3/repository"
+	"api-s3/routes"
 	"api-s3/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
-func setupTestServer() (*gin.Engine, *handlers.MediaHandler) {
-	// Load test config
+// loadTestConfig loads the configuration with the spool and tus upload
+// directories inside the temporary directory of the test
+func loadTestConfig(t *testing.T) {
 	config.LoadConfig()
+	config.AppConfig.SpoolPath = t.TempDir()
+	config.AppConfig.TusUploadPath = t.TempDir()
+}
+
+// testMediaID is the video setupTestServer stores for the route tests
+const testMediaID = "test-media-id"
+
+// setupTestServer builds the router of the server with routes.SetupRoutes on
+// local storage, with the admin key testAdminKey and the video testMediaID
+func setupTestServer(t *testing.T) (*gin.Engine, *repository.SQLiteRepository) {
+	// Load test config
+	loadTestConfig(t)
+	config.AppConfig.AuthEnabled = true
+	config.AppConfig.PlaybackSigningKey = ""
 	
 	// Initialize services
-	s3Service, _ := services.NewS3Service()
-	videoService := services.NewVideoService(s3Service)
-	
-	// Create handler
-	handler := handlers.NewMediaHandler(s3Service, videoService)
-	
-	// Setup router
-	router := gin.New()
-	router.Use(gin.Logger())
-	
-	// Setup routes
-	api := router.Group("/api/v1")
-	{
-		api.POST("/upload", handler.UploadMedia)
-		api.DELETE("/media/:id", handler.DeleteMedia)
-		api.GET("/media/:id/stream", handler.GetVideoStream)
-		api.GET("/media/:id/stream/:quality", handler.StreamVideo)
-		api.GET("/media/:id/thumbnail", handler.GetThumbnail)
+	storage, err := services.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	videoService := services.NewVideoService(storage)
+	repo := newTestRepository(t)
+	if err := services.EnsureAdminAPIKey(repo, testAdminKey); err != nil {
+		t.Fatal(err)
+	}
+	uploads, err := services.NewTusStore(repo)
+	if err != nil {
+		t.Fatal(err)
 	}
 	
-	return router, handler
+	events := services.NewEventBroker()
+	queue := services.NewJobQueue(repo, services.NewMediaProcessor(storage, videoService, repo, events), events)
+	seedTestMedia(t, storage, repo)
+	
+	// The routes load their templates from public/ at the repository root
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(".."); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	
+	return routes.SetupRoutes(storage, videoService, repo, queue, events, uploads, nil), repo
+}
+
+// seedTestMedia stores the video testMediaID with its upload, a 720p MP4
+// rendition and a thumbnail
+func seedTestMedia(t *testing.T, storage services.Storage, repo *repository.SQLiteRepository) {
+	ctx := context.Background()
+	key := services.MediaKey(models.DefaultTenantID, testMediaID, "test.mp4")
+	rendition := services.RenditionKey(models.DefaultTenantID, testMediaID, models.Quality720p)
+	thumbnail := services.ThumbnailKey(models.DefaultTenantID, testMediaID, models.ThumbnailMedium)
+	for object, contentType := range map[string]string{key: "video/mp4", rendition: "video/mp4", thumbnail: "image/jpeg"} {
+		if err := storage.Put(ctx, object, strings.NewReader(object), contentType); err != nil {
+			t.Fatal(err)
+		}
+	}
+	
+	media := &models.Media{
+		ID:           testMediaID,
+		MediaType:    models.MediaTypeVideo,
+		OriginalName: "test.mp4",
+		Filename:     "test.mp4",
+		MimeType:     "video/mp4",
+		StorageKey:   key,
+		URL:          storage.URL(key),
+		ThumbnailURL: storage.URL(thumbnail),
+		Thumbnails: []models.Thumbnail{
+			{Size: models.ThumbnailMedium, Width: 640, Height: 360, URL: storage.URL(thumbnail), StorageKey: thumbnail},
+		},
+	}
+	if err := repo.CreateMedia(media); err != nil {
+		t.Fatal(err)
+	}
+	variants := []models.VideoVariant{
+		{ID: "test-variant-id", MediaID: testMediaID, Quality: models.Quality720p, Format: models.FormatMP4, Width: 1280, Height: 720, StorageKey: rendition, URL: storage.URL(rendition)},
+	}
+	if err := repo.SaveVariants(testMediaID, variants); err != nil {
+		t.Fatal(err)
+	}
 }
 
 func createTestFile(filename string, content string) (*os.File, error) {
@@ -76,20 +140,27 @@ func createTestFile(filename string, content string) (*os.File, error) {
 }
 
 func TestHealthCheck(t *testing.T) {
-	router, _ := setupTestServer()
+	router, _ := setupTestServer(t)
 	
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/health", nil)
 	router.ServeHTTP(w, req)
 	
 	assert.Equal(t, 200, w.Code)
+	
+	// The API itself requires a key
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/media", nil)
+	router.ServeHTTP(w, req)
+	
+	assert.Equal(t, 401, w.Code)
 }
 
 func TestUploadImage(t *testing.T) {
-	router, _ := setupTestServer()
+	router, _ := setupTestServer(t)
 	
 	// Create test image file
-	testFile, err := createTestFile("test.jpg", "fake image content")
+	testFile, err := createTestFile("test.jpg", "\xff\xd8\xff\xe0fake image content")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -116,10 +187,11 @@ func TestUploadImage(t *testing.T) {
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/api/v1/upload", body)
 	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+testAdminKey)
 	router.ServeHTTP(w, req)
 	
-	// Check response
-	assert.Equal(t, 200, w.Code)
+	// Check response: images are queued for processing
+	assert.Equal(t, 202, w.Code)
 	
 	var response models.UploadResponse
 	err = json.Unmarshal(w.Body.Bytes(), &response)
@@ -129,15 +201,27 @@ func TestUploadImage(t *testing.T) {
 }
 
 func TestUploadVideo(t *testing.T) {
-	router, _ := setupTestServer()
+	router, _ := setupTestServer(t)
+	
+	// Uploaded videos are verified with ffprobe, so the test needs a real one
+	for _, tool := range []string{config.AppConfig.FFmpegPath, config.AppConfig.FFprobePath} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not installed", tool)
+		}
+	}
 	
 	// Create test video file
-	testFile, err := createTestFile("test.mp4", "fake video content")
+	testFile, err := createTestFile("test.mp4", "")
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer testFile.Close()
 	defer os.Remove(testFile.Name())
+	generate := exec.Command(config.AppConfig.FFmpegPath, "-f", "lavfi", "-i", "testsrc=duration=1:size=320x240:rate=25",
+		"-c:v", "libx264", "-pix_fmt", "yuv420p", "-f", "mp4", "-y", testFile.Name())
+	if output, err := generate.CombinedOutput(); err != nil {
+		t.Fatalf("failed to generate test video: %v\n%s", err, output)
+	}
 	
 	// Create multipart form
 	body := &bytes.Buffer{}
@@ -159,26 +243,31 @@ func TestUploadVideo(t *testing.T) {
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/api/v1/upload", body)
 	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+testAdminKey)
 	router.ServeHTTP(w, req)
 	
-	// Check response
-	assert.Equal(t, 200, w.Code)
+	// Check response: videos are queued for processing
+	if !assert.Equal(t, 202, w.Code, w.Body.String()) {
+		return
+	}
 	
 	var response models.UploadResponse
 	err = json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
 	assert.True(t, response.Success)
-	assert.Equal(t, "video", string(response.Media.MediaType))
+	if assert.NotNil(t, response.Media) {
+		assert.Equal(t, "video", string(response.Media.MediaType))
+	}
 }
 
 func TestGetVideoStream(t *testing.T) {
-	router, _ := setupTestServer()
+	router, _ := setupTestServer(t)
 	
-	// Test with mock media ID
-	mediaID := "test-media-id"
+	mediaID := testMediaID
 	
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/v1/media/%s/stream", mediaID), nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminKey)
 	router.ServeHTTP(w, req)
 	
 	// Check response
@@ -192,42 +281,56 @@ func TestGetVideoStream(t *testing.T) {
 }
 
 func TestStreamVideo(t *testing.T) {
-	router, _ := setupTestServer()
+	router, _ := setupTestServer(t)
 	
-	// Test with mock media ID and quality
-	mediaID := "test-media-id"
+	mediaID := testMediaID
 	quality := "720p"
 	
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/v1/media/%s/stream/%s", mediaID, quality), nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminKey)
 	router.ServeHTTP(w, req)
 	
-	// Should redirect to presigned URL
-	assert.Equal(t, 307, w.Code)
+	// Streams the 720p rendition
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "720p", w.Header().Get("X-Video-Quality"))
 }
 
 func TestGetThumbnail(t *testing.T) {
-	router, _ := setupTestServer()
+	router, _ := setupTestServer(t)
 	
-	// Test with mock media ID
-	mediaID := "test-media-id"
+	mediaID := testMediaID
 	
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/v1/media/%s/thumbnail", mediaID), nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminKey)
 	router.ServeHTTP(w, req)
 	
 	// Should redirect to presigned URL
 	assert.Equal(t, 307, w.Code)
+	
+	// The presigned URL works without credentials, a forged one does not
+	location := w.Header().Get("Location")
+	for target, code := range map[string]int{
+		location: 200,
+		strings.Replace(location, "signature=", "signature=x", 1): 403,
+		strings.Split(location, "?")[0]: 401,
+	} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", target, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, code, w.Code, target)
+	}
 }
 
 func TestDeleteMedia(t *testing.T) {
-	router, _ := setupTestServer()
+	router, _ := setupTestServer(t)
 	
-	// Test with mock media ID
-	mediaID := "test-media-id"
+	mediaID := testMediaID
 	
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("DELETE", fmt.Sprintf("/api/v1/media/%s", mediaID), nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminKey)
 	router.ServeHTTP(w, req)
 	
 	// Check response
@@ -237,10 +340,17 @@ func TestDeleteMedia(t *testing.T) {
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
 	assert.True(t, response.Success)
+	
+	// The media is gone afterwards
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/api/v1/media/%s", mediaID), nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminKey)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 404, w.Code)
 }
 
 func TestInvalidFileType(t *testing.T) {
-	router, _ := setupTestServer()
+	router, _ := setupTestServer(t)
 	
 	// Create test file with invalid extension
 	testFile, err := createTestFile("test.txt", "text content")
@@ -270,6 +380,7 @@ func TestInvalidFileType(t *testing.T) {
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/api/v1/upload", body)
 	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+testAdminKey)
 	router.ServeHTTP(w, req)
 	
 	// Should return error
@@ -282,11 +393,12 @@ func TestInvalidFileType(t *testing.T) {
 }
 
 func TestMissingFile(t *testing.T) {
-	router, _ := setupTestServer()
+	router, _ := setupTestServer(t)
 	
 	// Make request without file
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/api/v1/upload", nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminKey)
 	router.ServeHTTP(w, req)
 	
 	// Should return error
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"api-s3/config"
+	"api-s3/handlers"
+	"api-s3/models"
+	"api-s3/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const testMasterPlaylist = `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXT-X-STREAM-INF:BANDWIDTH=2800000,RESOLUTION=1280x720,CODECS="avc1.4d401f",NAME="720p"
+720p/playlist.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360,CODECS="avc1.4d401e",NAME="360p"
+360p/playlist.m3u8
+`
+
+const testDASHManifest = `<?xml version="1.0" encoding="utf-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="static">
+	<Period id="0" start="PT0.0S">
+		<AdaptationSet id="0" contentType="video">
+			<Representation id="0" mimeType="video/mp4" codecs="avc1.4d401e" bandwidth="800000" width="640" height="360">
+				<SegmentTemplate timescale="1000" initialization="init-$RepresentationID$.m4s" media="chunk-$RepresentationID$-$Number%05d$.m4s" startNumber="1"/>
+			</Representation>
+			<Representation id="1" mimeType="video/mp4" codecs="avc1.4d401f" bandwidth="2800000" width="1280" height="720">
+				<SegmentTemplate timescale="1000" initialization="init-$RepresentationID$.m4s" media="chunk-$RepresentationID$-$Number%05d$.m4s" startNumber="1"/>
+			</Representation>
+		</AdaptationSet>
+		<AdaptationSet id="1" contentType="audio">
+			<Representation id="2" mimeType="audio/mp4" codecs="mp4a.40.2" bandwidth="128000" audioSamplingRate="48000">
+				<SegmentTemplate timescale="48000" initialization="init-$RepresentationID$.m4s" media="chunk-$RepresentationID$-$Number%05d$.m4s" startNumber="1"/>
+			</Representation>
+		</AdaptationSet>
+	</Period>
+</MPD>
+`
+
+func TestPlaybackTokens(t *testing.T) {
+	loadTestConfig(t)
+	config.AppConfig.PlaybackSigningKey = "test-signing-key"
+	signer := services.NewPlaybackSigner()
+
+	claims := &models.PlaybackClaims{MediaID: "v1", ExpiresAt: time.Now().Add(time.Minute).Unix(), IP: "192.0.2.1", Renditions: []string{"360p"}}
+	token, err := signer.Sign(claims)
+	if !assert.NoError(t, err) {
+		return
+	}
+	granted, err := signer.Verify(token, "192.0.2.1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, claims, granted)
+	}
+
+	_, err = signer.Verify(token, "198.51.100.7")
+	assert.EqualError(t, err, "token is bound to another IP address")
+
+	payload, signature, _ := strings.Cut(token, ".")
+	forged, _ := signer.Sign(&models.PlaybackClaims{MediaID: "v2", ExpiresAt: claims.ExpiresAt})
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+	_, err = signer.Verify(forgedPayload+"."+signature, "192.0.2.1")
+	assert.EqualError(t, err, "invalid token signature")
+	_, err = signer.Verify(payload, "192.0.2.1")
+	assert.EqualError(t, err, "malformed token")
+
+	expired, _ := signer.Sign(&models.PlaybackClaims{MediaID: "v1", ExpiresAt: time.Now().Add(-time.Second).Unix()})
+	_, err = signer.Verify(expired, "192.0.2.1")
+	assert.EqualError(t, err, "token expired")
+
+	config.AppConfig.PlaybackSigningKey = "another-key"
+	_, err = services.NewPlaybackSigner().Verify(token, "192.0.2.1")
+	assert.EqualError(t, err, "invalid token signature")
+
+	config.AppConfig.PlaybackSigningKey = ""
+	assert.Nil(t, services.NewPlaybackSigner())
+}
+
+func TestFilterMasterPlaylist(t *testing.T) {
+	filtered := string(services.FilterMasterPlaylist([]byte(testMasterPlaylist), &models.PlaybackClaims{Renditions: []string{"360p"}}))
+	assert.Contains(t, filtered, "#EXT-X-INDEPENDENT-SEGMENTS\n")
+	assert.Contains(t, filtered, "NAME=\"360p\"\n360p/playlist.m3u8\n")
+	assert.NotContains(t, filtered, "720p")
+
+	assert.Equal(t, testMasterPlaylist, string(services.FilterMasterPlaylist([]byte(testMasterPlaylist), &models.PlaybackClaims{})))
+}
+
+func TestPlaybackEndpoints(t *testing.T) {
+	loadTestConfig(t)
+	config.AppConfig.AuthEnabled = false
+	config.AppConfig.PlaybackSigningKey = "test-signing-key"
+	storage, err := services.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newTestRepository(t)
+	media := handlers.NewMediaHandler(storage, nil, repo, nil, nil)
+	playback := handlers.NewPlaybackHandler(media, services.NewPlaybackSigner())
+	router := gin.New()
+	router.GET("/api/v1/media", media.ListMedia)
+	router.GET("/api/v1/media/:id", media.GetMediaInfo)
+	router.GET("/api/v1/media/:id/stream", media.GetVideoStream)
+	router.POST("/api/v1/media/:id/playback", playback.CreateToken)
+	group := router.Group("/api/v1/playback/:token", playback.RequireToken)
+	group.GET("/stream/:quality", playback.Stream)
+	group.GET("/hls/*path", playback.ServeHLS)
+	group.GET("/dash/*path", playback.ServeDASH)
+	group.GET("/trickplay/*path", playback.ServeTrickplay)
+	group.GET("/preview", playback.ServePreview)
+
+	ctx := context.Background()
+	hls := services.HLSPrefix(models.DefaultTenantID, "v1")
+	dash := services.DASHPrefix(models.DefaultTenantID, "v1")
+	trickplay := services.TrickplayPrefix(models.DefaultTenantID, "v1")
+	preview := services.PreviewKey(models.DefaultTenantID, "v1", "mp4")
+	storage.Put(ctx, "media/v1/movie.mp4", strings.NewReader("original"), "video/mp4")
+	storage.Put(ctx, "media/v1/720p.mp4", strings.NewReader("hd"), "video/mp4")
+	storage.Put(ctx, "media/v1/360p.mp4", strings.NewReader("sd"), "video/mp4")
+	storage.Put(ctx, hls+"/master.m3u8", strings.NewReader(testMasterPlaylist), "application/vnd.apple.mpegurl")
+	storage.Put(ctx, hls+"/360p/segment_0000.ts", strings.NewReader("sd-segment"), "video/mp2t")
+	storage.Put(ctx, hls+"/720p/segment_0000.ts", strings.NewReader("hd-segment"), "video/mp2t")
+	storage.Put(ctx, dash+"/manifest.mpd", strings.NewReader(testDASHManifest), "application/dash+xml")
+	for _, segment := range []string{"init-0.m4s", "chunk-0-00001.m4s", "chunk-1-00001.m4s", "chunk-2-00001.m4s"} {
+		storage.Put(ctx, dash+"/"+segment, strings.NewReader(segment), "video/iso.segment")
+	}
+	storage.Put(ctx, trickplay+"/thumbnails.vtt", strings.NewReader("WEBVTT\n"), "text/vtt")
+	storage.Put(ctx, trickplay+"/sprite_000.jpg", strings.NewReader("sprite"), "image/jpeg")
+	storage.Put(ctx, preview, strings.NewReader("preview"), "video/mp4")
+	repo.CreateMedia(&models.Media{ID: "v1", MediaType: models.MediaTypeVideo, StorageKey: "media/v1/movie.mp4", URL: "/uploads/media/v1/movie.mp4",
+		MasterURL: "/uploads/" + hls + "/master.m3u8", DashURL: "/uploads/media/v1/dash/manifest.mpd",
+		ThumbnailURL: "/uploads/media/v1/thumbnails/medium.jpg",
+		Thumbnails:   []models.Thumbnail{{Size: "medium", Width: 640, Height: 360, URL: "/uploads/media/v1/thumbnails/medium.jpg"}},
+		Trickplay:    &models.Trickplay{VTTURL: "/uploads/media/v1/trickplay/thumbnails.vtt"},
+		Preview:      &models.Preview{URL: "/uploads/" + preview, StorageKey: preview}})
+	repo.CreateMedia(&models.Media{ID: "i1", MediaType: models.MediaTypeImage, StorageKey: "media/i1/a.png"})
+	repo.SaveVariants("v1", []models.VideoVariant{
+		{ID: "a", MediaID: "v1", Quality: models.Quality720p, Format: models.FormatMP4, Width: 1280, Height: 720, StorageKey: "media/v1/720p.mp4", URL: "/uploads/media/v1/720p.mp4"},
+		{ID: "b", MediaID: "v1", Quality: models.Quality360p, Format: models.FormatMP4, Width: 640, Height: 360, StorageKey: "media/v1/360p.mp4"},
+	})
+
+	mint := func(id, body string) *models.PlaybackResponse {
+		w := authRequest(router, http.MethodPost, "/api/v1/media/"+id+"/playback", "", body)
+		if !assert.Equal(t, http.StatusCreated, w.Code, w.Body.String()) {
+			t.FailNow()
+		}
+		var resp models.PlaybackResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return &resp
+	}
+
+	// Storage URLs would play the video without a token
+	for _, target := range []string{"/api/v1/media", "/api/v1/media/v1", "/api/v1/media/v1/stream"} {
+		w := authRequest(router, http.MethodGet, target, "", "")
+		assert.Equal(t, http.StatusOK, w.Code, target)
+		assert.NotContains(t, w.Body.String(), "/uploads/media/v1/", target)
+	}
+
+	full := mint("v1", "")
+	w := authRequest(router, http.MethodGet, full.StreamURL+"/auto", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "hd", w.Body.String())
+	assert.Equal(t, "private, no-store", w.Header().Get("Cache-Control"))
+
+	restricted := mint("v1", `{"expires_in":60,"renditions":["360P"]}`)
+	w = authRequest(router, http.MethodGet, restricted.StreamURL+"/720p", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "sd", w.Body.String())
+	assert.Equal(t, "360p", w.Header().Get("X-Video-Quality"))
+
+	w = authRequest(router, http.MethodGet, restricted.HLSURL, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "360p/playlist.m3u8")
+	assert.NotContains(t, w.Body.String(), "720p")
+	base := strings.TrimSuffix(restricted.HLSURL, "master.m3u8")
+	w = authRequest(router, http.MethodGet, base+"360p/segment_0000.ts", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "sd-segment", w.Body.String())
+	assert.Equal(t, http.StatusForbidden, authRequest(router, http.MethodGet, base+"720p/segment_0000.ts", "", "").Code)
+	assert.Equal(t, http.StatusForbidden, authRequest(router, http.MethodGet, base+"360p/../720p/segment_0000.ts", "", "").Code)
+
+	// DASH lists and serves only the allowed video and the audio
+	assert.True(t, strings.HasSuffix(full.DashURL, "/dash/manifest.mpd"), full.DashURL)
+	w = authRequest(router, http.MethodGet, full.DashURL, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `id="1"`)
+	w = authRequest(router, http.MethodGet, restricted.DashURL, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "private, no-store", w.Header().Get("Cache-Control"))
+	assert.Contains(t, w.Body.String(), `<Representation id="0"`)
+	assert.Contains(t, w.Body.String(), `<Representation id="2"`)
+	assert.NotContains(t, w.Body.String(), `<Representation id="1"`)
+	assert.Contains(t, w.Body.String(), "</MPD>")
+	dashBase := strings.TrimSuffix(restricted.DashURL, "manifest.mpd")
+	for _, segment := range []string{"init-0.m4s", "chunk-0-00001.m4s", "chunk-2-00001.m4s"} {
+		w = authRequest(router, http.MethodGet, dashBase+segment, "", "")
+		assert.Equal(t, http.StatusOK, w.Code, segment)
+		assert.Equal(t, segment, w.Body.String())
+	}
+	assert.Equal(t, http.StatusForbidden, authRequest(router, http.MethodGet, dashBase+"chunk-1-00001.m4s", "", "").Code)
+	assert.Equal(t, http.StatusNotFound, authRequest(router, http.MethodGet, dashBase+"other.m4s", "", "").Code)
+	assert.Equal(t, http.StatusOK, authRequest(router, http.MethodGet, strings.TrimSuffix(full.DashURL, "manifest.mpd")+"chunk-1-00001.m4s", "", "").Code)
+
+	// Trickplay and the preview are granted by any token for the video
+	w = authRequest(router, http.MethodGet, restricted.TrickplayURL, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "WEBVTT\n", w.Body.String())
+	w = authRequest(router, http.MethodGet, strings.TrimSuffix(restricted.TrickplayURL, "thumbnails.vtt")+"sprite_000.jpg", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "sprite", w.Body.String())
+	w = authRequest(router, http.MethodGet, restricted.PreviewURL, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "preview", w.Body.String())
+
+	bound := mint("v1", `{"bind_ip":true}`)
+	assert.Equal(t, http.StatusOK, authRequest(router, http.MethodGet, bound.StreamURL+"/360p", "", "").Code)
+
+	assert.Equal(t, http.StatusForbidden, authRequest(router, http.MethodGet, "/api/v1/playback/bogus/stream/auto", "", "").Code)
+	assert.Equal(t, http.StatusBadRequest, authRequest(router, http.MethodPost, "/api/v1/media/v1/playback", "", `{"renditions":["4k"]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, authRequest(router, http.MethodPost, "/api/v1/media/v1/playback", "", `{"renditions":["best_quality"]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, authRequest(router, http.MethodPost, "/api/v1/media/v1/playback", "", `{"expires_in":999999}`).Code)
+	assert.Equal(t, http.StatusBadRequest, authRequest(router, http.MethodPost, "/api/v1/media/i1/playback", "", "").Code)
+	assert.Equal(t, http.StatusNotFound, authRequest(router, http.MethodPost, "/api/v1/media/missing/playback", "", "").Code)
+}
+
+func TestPlaybackProcessedRenditions(t *testing.T) {
+	loadTestConfig(t)
+	config.AppConfig.AuthEnabled = false
+	config.AppConfig.PlaybackSigningKey = "test-signing-key"
+	storage, err := services.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newTestRepository(t)
+	processTestVideo(t, storage, repo, "v1")
+
+	media := handlers.NewMediaHandler(storage, nil, repo, nil, nil)
+	playback := handlers.NewPlaybackHandler(media, services.NewPlaybackSigner())
+	router := gin.New()
+	router.POST("/api/v1/media/:id/playback", playback.CreateToken)
+	group := router.Group("/api/v1/playback/:token", playback.RequireToken)
+	group.GET("/stream/:quality", playback.Stream)
+	group.GET("/hls/*path", playback.ServeHLS)
+
+	w := authRequest(router, http.MethodPost, "/api/v1/media/v1/playback", "", `{"renditions":["240p"]}`)
+	if !assert.Equal(t, http.StatusCreated, w.Code, w.Body.String()) {
+		return
+	}
+	var token models.PlaybackResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &token))
+
+	w = authRequest(router, http.MethodGet, token.StreamURL+"/720p", "", "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "240p", w.Header().Get("X-Video-Quality"))
+	assert.Equal(t, "video/mp4", w.Header().Get("Content-Type"))
+
+	w = authRequest(router, http.MethodGet, token.HLSURL, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "240p/playlist.m3u8")
+	assert.NotContains(t, w.Body.String(), "360p")
+	base := strings.TrimSuffix(token.HLSURL, "master.m3u8")
+	assert.Equal(t, http.StatusOK, authRequest(router, http.MethodGet, base+"240p/playlist.m3u8", "", "").Code)
+	assert.Equal(t, http.StatusForbidden, authRequest(router, http.MethodGet, base+"360p/playlist.m3u8", "", "").Code)
+}
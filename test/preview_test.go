@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"api-s3/models"
+	"api-s3/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreviewSegments(t *testing.T) {
+	// Five 1s windows centered in each fifth of a 100s video
+	segments := services.PreviewSegments(100, 5, 1)
+	assert.Equal(t, []services.PreviewSegment{
+		{Start: 9.5, Duration: 1},
+		{Start: 29.5, Duration: 1},
+		{Start: 49.5, Duration: 1},
+		{Start: 69.5, Duration: 1},
+		{Start: 89.5, Duration: 1},
+	}, segments)
+
+	// A single highlight window from the middle
+	assert.Equal(t, []services.PreviewSegment{{Start: 28, Duration: 4}}, services.PreviewSegments(60, 1, 4))
+
+	// Too short for every window: the whole video
+	assert.Equal(t, []services.PreviewSegment{{Start: 0, Duration: 3}}, services.PreviewSegments(3, 5, 1))
+}
+
+func TestRepositoryStoresPreview(t *testing.T) {
+	repo := newTestRepository(t)
+	preview := &models.Preview{
+		URL:        "/uploads/media/v1/preview.mp4",
+		StorageKey: services.PreviewKey(models.DefaultTenantID, "v1", "mp4"),
+		Format:     "mp4",
+		Width:      320,
+		Height:     180,
+		Duration:   5,
+		Segments:   5,
+	}
+	assert.NoError(t, repo.CreateMedia(&models.Media{ID: "v1", MediaType: models.MediaTypeVideo}))
+
+	media, err := repo.GetMedia("v1")
+	assert.NoError(t, err)
+	assert.Nil(t, media.Preview)
+
+	media.Preview = preview
+	assert.NoError(t, repo.UpdateMedia(media))
+	media, err = repo.GetMedia("v1")
+	assert.NoError(t, err)
+	assert.Equal(t, preview, media.Preview)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"testing"
+
+	"api-s3/models"
+	"api-s3/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Trimmed output of ffprobe -print_format json -show_format -show_streams for
+// an HDR phone video recorded in portrait
+const ffprobeFixture = `{
+	"streams": [
+		{
+			"index": 0,
+			"codec_name": "hevc",
+			"codec_long_name": "H.265 / HEVC (High Efficiency Video Coding)",
+			"profile": "Main 10",
+			"codec_type": "video",
+			"width": 3840,
+			"height": 2160,
+			"pix_fmt": "yuv420p10le",
+			"color_range": "tv",
+			"color_space": "bt2020nc",
+			"color_transfer": "arib-std-b67",
+			"color_primaries": "bt2020",
+			"r_frame_rate": "30/1",
+			"avg_frame_rate": "30000/1001",
+			"duration": "12.512000",
+			"bit_rate": "41234567",
+			"disposition": {"default": 1, "attached_pic": 0},
+			"tags": {"language": "und", "handler_name": "Core Media Video"},
+			"side_data_list": [{"side_data_type": "Display Matrix", "displaymatrix": "...", "rotation": -90}]
+		},
+		{
+			"index": 1,
+			"codec_name": "aac",
+			"codec_long_name": "AAC (Advanced Audio Coding)",
+			"profile": "LC",
+			"codec_type": "audio",
+			"sample_rate": "48000",
+			"channels": 2,
+			"channel_layout": "stereo",
+			"duration": "12.500000",
+			"bit_rate": "192000",
+			"disposition": {"default": 1, "attached_pic": 0},
+			"tags": {"language": "eng"}
+		},
+		{
+			"index": 2,
+			"codec_name": "mjpeg",
+			"codec_type": "video",
+			"width": 600,
+			"height": 600,
+			"disposition": {"default": 0, "attached_pic": 1}
+		}
+	],
+	"format": {
+		"filename": "IMG_0001.MOV",
+		"format_name": "mov,mp4,m4a,3gp,3g2,mj2",
+		"format_long_name": "QuickTime / MOV",
+		"duration": "12.512000",
+		"size": "64512345",
+		"bit_rate": "41248301",
+		"tags": {"major_brand": "qt  ", "com.apple.quicktime.make": "Apple"}
+	}
+}`
+
+func TestParseProbeOutput(t *testing.T) {
+	probe, err := services.ParseProbeOutput([]byte(ffprobeFixture))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "mov,mp4,m4a,3gp,3g2,mj2", probe.FormatName)
+	assert.Equal(t, 12.512, probe.Duration)
+	assert.Equal(t, int64(64512345), probe.Size)
+	assert.Equal(t, int64(41248301), probe.Bitrate)
+	assert.Equal(t, "Apple", probe.Tags["com.apple.quicktime.make"])
+	assert.Len(t, probe.Streams, 3)
+
+	video := probe.VideoStream()
+	assert.Equal(t, 0, video.Index)
+	assert.Equal(t, "hevc", video.Codec)
+	assert.Equal(t, "Main 10", video.Profile)
+	assert.Equal(t, "yuv420p10le", video.PixelFormat)
+	assert.Equal(t, 29.97, video.FrameRate)
+	assert.Equal(t, 90, video.Rotation)
+	assert.Equal(t, "bt2020", video.ColorPrimaries)
+	assert.True(t, video.HDR)
+	assert.Equal(t, int64(41234567), video.Bitrate)
+
+	audio := probe.AudioStream()
+	assert.Equal(t, "aac", audio.Codec)
+	assert.Equal(t, 2, audio.Channels)
+	assert.Equal(t, "stereo", audio.ChannelLayout)
+	assert.Equal(t, 48000, audio.SampleRate)
+	assert.Equal(t, "eng", audio.Language)
+
+	assert.True(t, probe.Streams[2].AttachedPic)
+
+	_, err = services.ParseProbeOutput([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestRepositoryStoresProbe(t *testing.T) {
+	repo := newTestRepository(t)
+	probe, _ := services.ParseProbeOutput([]byte(ffprobeFixture))
+
+	media := &models.Media{ID: "media-1", MediaType: models.MediaTypeVideo}
+	assert.NoError(t, repo.CreateMedia(media))
+	stored, _ := repo.GetMedia("media-1")
+	assert.Nil(t, stored.Probe)
+
+	media.Probe = probe
+	assert.NoError(t, repo.UpdateMedia(media))
+	stored, _ = repo.GetMedia("media-1")
+	assert.Equal(t, probe, stored.Probe)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"api-s3/models"
+	"api-s3/repository"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRepository(t *testing.T) *repository.SQLiteRepository {
+	repo, err := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "media.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func TestRepositoryMediaLifecycle(t *testing.T) {
+	repo := newTestRepository(t)
+
+	media := &models.Media{
+		ID:           "media-1",
+		Filename:     "clip.mp4",
+		OriginalName: "clip.mp4",
+		MediaType:    models.MediaTypeVideo,
+		MimeType:     "video/mp4",
+		Size:         1024,
+		StorageKey:   "media/media-1/clip.mp4",
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	assert.NoError(t, repo.CreateMedia(media))
+
+	stored, err := repo.GetMedia("media-1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1024), stored.Size)
+	assert.Equal(t, models.MediaTypeVideo, stored.MediaType)
+	assert.WithinDuration(t, media.CreatedAt, stored.CreatedAt, time.Millisecond)
+
+	variants := []models.VideoVariant{
+		{ID: "v-720", Quality: models.Quality720p, Format: models.FormatHLS, Height: 720, CreatedAt: time.Now()},
+		{ID: "v-360", Quality: models.Quality360p, Format: models.FormatHLS, Height: 360, CreatedAt: time.Now()},
+	}
+	assert.NoError(t, repo.SaveVariants("media-1", variants))
+
+	loaded, err := repo.GetVariants("media-1")
+	assert.NoError(t, err)
+	assert.Len(t, loaded, 2)
+	assert.Equal(t, models.Quality360p, loaded[0].Quality)
+
+	job := &models.VideoProcessingJob{ID: "job-1", MediaID: "media-1", Status: models.JobStatusPending, CreatedAt: time.Now()}
+	assert.NoError(t, repo.CreateJob(job))
+	job.Status = models.JobStatusCompleted
+	job.Progress = 100
+	assert.NoError(t, repo.UpdateJob(job))
+
+	latest, err := repo.GetLatestJob("media-1")
+	assert.NoError(t, err)
+	assert.Equal(t, models.JobStatusCompleted, latest.Status)
+
+	// Deleting the media cascades to variants and jobs
+	assert.NoError(t, repo.DeleteMedia("media-1"))
+	_, err = repo.GetMedia("media-1")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	_, err = repo.GetLatestJob("media-1")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	loaded, _ = repo.GetVariants("media-1")
+	assert.Empty(t, loaded)
+}
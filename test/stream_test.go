@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"api-s3/config"
+	"api-s3/handlers"
+	"api-s3/models"
+	"api-s3/repository"
+	"api-s3/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func streamRequest(t *testing.T, store services.Storage, key string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/stream", nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	if err := services.StreamObject(w, req, store, key, services.CachePublic); err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestParseRange(t *testing.T) {
+	ranges, err := services.ParseRange("bytes=0-99, 500-, -200", 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, []services.ByteRange{{Start: 0, End: 99}, {Start: 500, End: 999}, {Start: 800, End: 999}}, ranges)
+
+	// Ends past the object are clamped, starts past it are dropped
+	ranges, err = services.ParseRange("bytes=900-5000,2000-", 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, []services.ByteRange{{Start: 900, End: 999}}, ranges)
+
+	for _, header := range []string{"bytes=1000-", "bytes=-0", "bytes=5-2", "bytes=a-b", "items=0-1", "bytes=0-1"} {
+		size := int64(1000)
+		if header == "bytes=0-1" {
+			size = 0
+		}
+		_, err := services.ParseRange(header, size)
+		assert.ErrorIs(t, err, services.ErrInvalidRange, header)
+	}
+}
+
+func TestStreamObjectRanges(t *testing.T) {
+	loadTestConfig(t)
+	store, err := services.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := "media/abc/video.mp4"
+	store.Put(context.Background(), key, strings.NewReader("0123456789"), "video/mp4")
+
+	w := streamRequest(t, store, key, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "10", w.Header().Get("Content-Length"))
+	assert.Equal(t, "0123456789", w.Body.String())
+	etag := w.Header().Get("ETag")
+
+	w = streamRequest(t, store, key, map[string]string{"Range": "bytes=2-4"})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "bytes 2-4/10", w.Header().Get("Content-Range"))
+	assert.Equal(t, "3", w.Header().Get("Content-Length"))
+	assert.Equal(t, "234", w.Body.String())
+
+	w = streamRequest(t, store, key, map[string]string{"Range": "bytes=-3"})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "bytes 7-9/10", w.Header().Get("Content-Range"))
+	assert.Equal(t, "789", w.Body.String())
+
+	w = streamRequest(t, store, key, map[string]string{"Range": "bytes=20-"})
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, w.Code)
+	assert.Equal(t, "bytes */10", w.Header().Get("Content-Range"))
+
+	// A stale If-Range gets the whole file
+	w = streamRequest(t, store, key, map[string]string{"Range": "bytes=2-4", "If-Range": `"stale"`})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0123456789", w.Body.String())
+
+	w = streamRequest(t, store, key, map[string]string{"Range": "bytes=2-4", "If-Range": etag})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+
+	// Several ranges come back as multipart/byteranges
+	w = streamRequest(t, store, key, map[string]string{"Range": "bytes=0-1,-2"})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, strconv.Itoa(w.Body.Len()), w.Header().Get("Content-Length"))
+	mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	assert.NoError(t, err)
+	assert.Equal(t, "multipart/byteranges", mediaType)
+
+	reader := multipart.NewReader(w.Body, params["boundary"])
+	var parts []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, "video/mp4", part.Header.Get("Content-Type"))
+		data, _ := io.ReadAll(part)
+		parts = append(parts, part.Header.Get("Content-Range")+"="+string(data))
+	}
+	assert.Equal(t, []string{"bytes 0-1/10=01", "bytes 8-9/10=89"}, parts)
+}
+
+func TestCoalesceRanges(t *testing.T) {
+	ranges := services.CoalesceRanges([]services.ByteRange{{Start: 50, End: 60}, {Start: 0, End: 9}, {Start: 10, End: 19}, {Start: 55, End: 70}, {Start: 30, End: 40}})
+	assert.Equal(t, []services.ByteRange{{Start: 0, End: 19}, {Start: 30, End: 40}, {Start: 50, End: 70}}, ranges)
+}
+
+func TestStreamObjectManyRanges(t *testing.T) {
+	fake, s3Service := setupFakeS3(t)
+	data := strings.Repeat("0123456789", 10)
+	fake.objects["/bucket/media/abc/video.mp4"] = []byte(data)
+	fake.types["/bucket/media/abc/video.mp4"] = "video/mp4"
+
+	// Overlapping ranges are read once
+	w := streamRequest(t, s3Service, "media/abc/video.mp4", map[string]string{"Range": "bytes=0-4,2-9,-5"})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, []string{"bytes=0-9", "bytes=95-99"}, fake.ranges)
+
+	// Too many ranges get the whole file with a single read
+	fake.ranges = nil
+	var specs []string
+	for i := 0; i < 20; i++ {
+		specs = append(specs, fmt.Sprintf("%d-%d", i*4, i*4+1))
+	}
+	w = streamRequest(t, s3Service, "media/abc/video.mp4", map[string]string{"Range": "bytes=" + strings.Join(specs, ",")})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, data, w.Body.String())
+	assert.Len(t, fake.ranges, 1)
+}
+
+func TestStreamObjectForwardsRangeToS3(t *testing.T) {
+	fake, s3Service := setupFakeS3(t)
+	fake.objects["/bucket/media/abc/video.mp4"] = []byte("0123456789")
+	fake.types["/bucket/media/abc/video.mp4"] = "video/mp4"
+
+	w := streamRequest(t, s3Service, "media/abc/video.mp4", map[string]string{"Range": "bytes=-4"})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "bytes 6-9/10", w.Header().Get("Content-Range"))
+	assert.Equal(t, "4", w.Header().Get("Content-Length"))
+	assert.Equal(t, "6789", w.Body.String())
+	assert.Equal(t, []string{"bytes=6-9"}, fake.ranges)
+}
+
+func TestStreamObjectConditionalGet(t *testing.T) {
+	loadTestConfig(t)
+	config.AppConfig.CacheControlImage = "public, max-age=60"
+	store, err := services.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := "media/abc/photo.png"
+	store.Put(context.Background(), key, strings.NewReader("png-data"), "image/png")
+
+	w := streamRequest(t, store, key, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, "public, max-age=60", w.Header().Get("Cache-Control"))
+	etag := w.Header().Get("ETag")
+	lastModified := w.Header().Get("Last-Modified")
+	assert.NotEmpty(t, etag)
+	assert.NotEmpty(t, lastModified)
+
+	w = streamRequest(t, store, key, map[string]string{"If-None-Match": `"other", W/` + etag})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+
+	w = streamRequest(t, store, key, map[string]string{"If-Modified-Since": lastModified})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	// If-None-Match wins over If-Modified-Since
+	w = streamRequest(t, store, key, map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": lastModified})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "png-data", w.Body.String())
+}
+
+func TestCacheControlScope(t *testing.T) {
+	loadTestConfig(t)
+	config.AppConfig.CacheControlVideo = "public, max-age=86400, s-maxage=600"
+	assert.Equal(t, "public, max-age=86400, s-maxage=600", services.CacheControl("video/mp4", services.CachePublic))
+	assert.Equal(t, "private, max-age=86400", services.CacheControl("video/mp4", services.CachePrivate))
+	assert.Equal(t, "private, no-store", services.CacheControl("video/mp4", services.CacheNoStore))
+}
+
+func TestSelectVariant(t *testing.T) {
+	variants := []models.VideoVariant{
+		{Quality: models.Quality360p, Format: models.FormatMP4, Height: 360, StorageKey: "360.mp4"},
+		{Quality: models.Quality720p, Format: models.FormatMP4, Height: 720, StorageKey: "720.mp4"},
+		{Quality: models.Quality1080p, Format: models.FormatHLS, Height: 1080, StorageKey: "1080.m3u8"},
+	}
+	pick := func(value string) string {
+		quality, height, err := services.ParseVideoQuality(value)
+		assert.NoError(t, err)
+		return services.SelectVariant(variants, quality, height).StorageKey
+	}
+
+	assert.Equal(t, "720.mp4", pick("720p"))
+	assert.Equal(t, "720.mp4", pick("auto"))
+	assert.Equal(t, "720.mp4", pick("1080p")) // HLS renditions are not progressive
+	assert.Equal(t, "360.mp4", pick("480p"))
+	assert.Equal(t, "360.mp4", pick("144p"))
+	assert.Nil(t, services.SelectVariant(nil, models.QualityAuto, 0))
+
+	_, _, err := services.ParseVideoQuality("hd")
+	assert.Error(t, err)
+}
+
+func TestStreamVideoQuality(t *testing.T) {
+	loadTestConfig(t)
+	storage, err := services.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newTestRepository(t)
+	handler := handlers.NewMediaHandler(storage, nil, repo, nil, nil)
+	router := gin.New()
+	router.GET("/api/v1/media/:id/stream/:quality", handler.StreamVideo)
+
+	ctx := context.Background()
+	storage.Put(ctx, "media/v1/movie.mp4", strings.NewReader("original"), "video/mp4")
+	storage.Put(ctx, "media/v1/best.mp4", strings.NewReader("best"), "video/mp4")
+	repo.CreateMedia(&models.Media{ID: "v1", MediaType: models.MediaTypeVideo, StorageKey: "media/v1/movie.mp4"})
+	repo.CreateMedia(&models.Media{ID: "v2", MediaType: models.MediaTypeVideo, StorageKey: "media/v1/movie.mp4"})
+	repo.SaveVariants("v1", []models.VideoVariant{
+		{ID: "b", MediaID: "v1", Quality: models.QualityBest, Format: models.FormatMP4, Height: 1080, StorageKey: "media/v1/best.mp4"},
+	})
+
+	stream := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := stream("/api/v1/media/v1/stream/720p")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "best", w.Body.String())
+	assert.Equal(t, "best_quality", w.Header().Get("X-Video-Quality"))
+
+	// Without variants the uploaded file is served
+	w = stream("/api/v1/media/v2/stream/auto")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "original", w.Body.String())
+	assert.Equal(t, "original", w.Header().Get("X-Video-Quality"))
+
+	assert.Equal(t, http.StatusBadRequest, stream("/api/v1/media/v1/stream/hd").Code)
+	assert.Equal(t, http.StatusNotFound, stream("/api/v1/media/missing/stream/auto").Code)
+}
+
+// processTestVideo runs a generated 640x360 clip through the media processor
+// with a 240p and 360p ladder, skipping the test when ffmpeg is not installed.
+// DASH is packaged when the caller enabled it.
+func processTestVideo(t *testing.T, storage services.Storage, repo repository.MediaRepository, mediaID string) {
+	for _, tool := range []string{config.AppConfig.FFmpegPath, config.AppConfig.FFprobePath} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not installed", tool)
+		}
+	}
+	config.AppConfig.EnableHLS = true
+	config.AppConfig.HLSRenditions = []string{"240p", "360p"}
+	config.AppConfig.EnableTrickplay = false
+	config.AppConfig.EnablePreview = false
+
+	input := filepath.Join(t.TempDir(), "clip.mp4")
+	generate := exec.Command(config.AppConfig.FFmpegPath, "-f", "lavfi", "-i", "testsrc=duration=2:size=640x360:rate=25",
+		"-f", "lavfi", "-i", "sine=duration=2", "-c:v", "libx264", "-pix_fmt", "yuv420p", "-c:a", "aac", "-shortest", "-y", input)
+	if output, err := generate.CombinedOutput(); err != nil {
+		t.Fatalf("failed to generate test video: %v\n%s", err, output)
+	}
+
+	ctx := context.Background()
+	media := &models.Media{
+		ID:           mediaID,
+		MediaType:    models.MediaTypeVideo,
+		OriginalName: "clip.mp4",
+		Filename:     "clip.mp4",
+		MimeType:     "video/mp4",
+		StorageKey:   services.MediaKey(models.DefaultTenantID, mediaID, "clip.mp4"),
+	}
+	if _, err := services.UploadLocalFile(ctx, storage, input, media.StorageKey, "video/mp4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CreateMedia(media); err != nil {
+		t.Fatal(err)
+	}
+	job := &models.VideoProcessingJob{ID: "job-" + mediaID, MediaID: mediaID, Status: models.JobStatusProcessing, InputPath: input}
+	if err := repo.CreateJob(job); err != nil {
+		t.Fatal(err)
+	}
+	processor := services.NewMediaProcessor(storage, services.NewVideoService(storage), repo, services.NewEventBroker())
+	if err := processor.Process(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamVideoProcessedRenditions(t *testing.T) {
+	loadTestConfig(t)
+	storage, err := services.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newTestRepository(t)
+	processTestVideo(t, storage, repo, "v1")
+
+	variants, err := repo.GetVariants("v1")
+	assert.NoError(t, err)
+	selected := services.SelectVariant(variants, models.Quality720p, 720)
+	if assert.NotNil(t, selected) {
+		assert.Equal(t, models.FormatMP4, selected.Format)
+		assert.Equal(t, models.Quality360p, selected.Quality)
+		assert.Equal(t, services.RenditionKey(models.DefaultTenantID, "v1", models.Quality360p), selected.StorageKey)
+	}
+
+	handler := handlers.NewMediaHandler(storage, nil, repo, nil, nil)
+	router := gin.New()
+	router.GET("/api/v1/media/:id/stream/:quality", handler.StreamVideo)
+	for requested, served := range map[string]string{"720p": "360p", "240p": "240p", "auto": "360p"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/media/v1/stream/"+requested, nil))
+		assert.Equal(t, http.StatusOK, w.Code, requested)
+		assert.Equal(t, served, w.Header().Get("X-Video-Quality"), requested)
+		assert.Equal(t, "video/mp4", w.Header().Get("Content-Type"), requested)
+	}
+}
+
+func TestProcessPackagesDASHFromRenditions(t *testing.T) {
+	loadTestConfig(t)
+	config.AppConfig.EnableDASH = true
+	storage, err := services.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newTestRepository(t)
+	processTestVideo(t, storage, repo, "v1")
+
+	media, err := repo.GetMedia("v1")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotEmpty(t, media.DashURL)
+
+	prefix := services.DASHPrefix(models.DefaultTenantID, "v1")
+	body, _, err := storage.Get(context.Background(), prefix+"/manifest.mpd")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer body.Close()
+	manifest, _ := io.ReadAll(body)
+	assert.Contains(t, string(manifest), `height="240"`)
+	assert.Contains(t, string(manifest), `height="360"`)
+	assert.Contains(t, string(manifest), `mimeType="audio/mp4"`)
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"api-s3/config"
+	"api-s3/handlers"
+	"api-s3/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 implements just enough of the S3 API for multipart uploads
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	types    map[string]string
+	parts    map[int][]byte
+	failPart int
+	aborted  bool
+	puts     int
+	ranges   []string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	query := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.types[r.URL.Path] = r.Header.Get("Content-Type")
+		fmt.Fprint(w, `<InitiateMultipartUploadResult><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`)
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		if number == f.failPart {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<Error><Code>AccessDenied</Code><Message>denied</Message></Error>`)
+			return
+		}
+		f.parts[number] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, number))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		var complete struct {
+			Parts []struct {
+				PartNumber int
+			} `xml:"Part"`
+		}
+		xml.Unmarshal(body, &complete)
+		numbers := []int{}
+		for _, part := range complete.Parts {
+			numbers = append(numbers, part.PartNumber)
+		}
+		if !sort.IntsAreSorted(numbers) || len(numbers) != len(f.parts) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `<Error><Code>InvalidPartOrder</Code></Error>`)
+			return
+		}
+		var object []byte
+		for _, number := range numbers {
+			object = append(object, f.parts[number]...)
+		}
+		f.objects[r.URL.Path] = object
+		fmt.Fprint(w, `<CompleteMultipartUploadResult><ETag>"done"</ETag></CompleteMultipartUploadResult>`)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		f.aborted = true
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		f.puts++
+		f.objects[r.URL.Path] = body
+		f.types[r.URL.Path] = r.Header.Get("Content-Type")
+		w.Header().Set("ETag", `"single"`)
+	case r.Method == http.MethodHead:
+		object, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(object)))
+		w.Header().Set("Content-Type", f.types[r.URL.Path])
+		w.Header().Set("ETag", `"single"`)
+	case r.Method == http.MethodGet:
+		object, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>NoSuchKey</Code></Error>`)
+			return
+		}
+		w.Header().Set("Content-Type", f.types[r.URL.Path])
+		w.Header().Set("ETag", `"single"`)
+		f.ranges = append(f.ranges, r.Header.Get("Range"))
+		var start, end int
+		if n, _ := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); n == 2 {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(object)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(object[start : end+1])
+			return
+		}
+		w.Write(object)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func setupFakeS3(t *testing.T) (*fakeS3, *services.S3Service) {
+	fake := &fakeS3{objects: map[string][]byte{}, types: map[string]string{}, parts: map[int][]byte{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	loadTestConfig(t)
+	config.AppConfig.AWSS3Endpoint = server.URL
+	config.AppConfig.AWSS3Bucket = "bucket"
+	config.AppConfig.AWSAccessKeyID = "test"
+	config.AppConfig.AWSSecretAccessKey = "test"
+	config.AppConfig.S3PartSize = 5 * 1024 * 1024
+	config.AppConfig.S3UploadConcurrency = 3
+
+	s3Service, err := services.NewS3Service()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, s3Service
+}
+
+func TestS3PutStreamMultipart(t *testing.T) {
+	fake, s3Service := setupFakeS3(t)
+	data := bytes.Repeat([]byte("0123456789abcdef"), 12*1024*1024/16)
+
+	var progress []services.PartProgress
+	size, err := s3Service.PutStream(context.Background(), "media/1/big.mp4", bytes.NewReader(data), "video/mp4",
+		func(part services.PartProgress) { progress = append(progress, part) })
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), size)
+	assert.Len(t, progress, 3)
+	assert.Equal(t, int64(len(data)), progress[len(progress)-1].BytesUploaded)
+	assert.Equal(t, data, fake.objects["/bucket/media/1/big.mp4"])
+	assert.False(t, fake.aborted)
+
+	// Small streams skip the multipart upload
+	size, err = s3Service.PutStream(context.Background(), "media/2/small.jpg", strings.NewReader("tiny"), "image/jpeg", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), size)
+	assert.Equal(t, 1, fake.puts)
+}
+
+func TestS3PutStreamAbortsOnFailure(t *testing.T) {
+	fake, s3Service := setupFakeS3(t)
+	fake.failPart = 2
+	data := bytes.Repeat([]byte("x"), 11*1024*1024)
+
+	_, err := s3Service.PutStream(context.Background(), "media/1/big.mp4", bytes.NewReader(data), "video/mp4", nil)
+	assert.Error(t, err)
+	assert.True(t, fake.aborted)
+	assert.NotContains(t, fake.objects, "/bucket/media/1/big.mp4")
+}
+
+func TestUploadMediaStream(t *testing.T) {
+	loadTestConfig(t)
+	// Images are stored as uploaded, without the processing queue
+	config.AppConfig.EnableImageProcessing = false
+	storage, err := services.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newTestRepository(t)
+	handler := handlers.NewMediaHandler(storage, nil, repo, nil, nil)
+	router := gin.New()
+	router.POST("/api/v1/upload-stream", handler.UploadMediaStream)
+
+	// Raw body
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/upload-stream?filename=photo.png", strings.NewReader("\x89PNG\r\n\x1a\n"))
+	req.Header.Set("Content-Type", "image/png")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"size":8`)
+
+	// Multipart form, streamed part by part
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("note", "ignored")
+	part, _ := writer.CreateFormFile("file", "scan.jpg")
+	part.Write([]byte("\xff\xd8\xff\xe0jpeg-b"))
+	writer.Close()
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/upload-stream", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"original_name":"scan.jpg"`)
+	assert.Contains(t, w.Body.String(), `"size":10`)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/upload-stream", strings.NewReader("data"))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestUploadMediaStreamTooLarge(t *testing.T) {
+	_, s3Service := setupFakeS3(t)
+	config.AppConfig.EnableImageProcessing = false
+	config.AppConfig.StreamMaxSize = 1000
+	local, err := services.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, storage := range map[string]services.Storage{"local": local, "s3": s3Service} {
+		handler := handlers.NewMediaHandler(storage, nil, newTestRepository(t), nil, nil)
+		router := gin.New()
+		router.POST("/api/v1/upload-stream", handler.UploadMediaStream)
+
+		body := "\x89PNG\r\n\x1a\n" + strings.Repeat("x", 5*1024)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/upload-stream?filename=photo.png", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, name+": "+w.Body.String())
+		assert.Contains(t, w.Body.String(), "1000 bytes", name)
+	}
+}
+
+func TestUploadMediaStreamVerifiesVideo(t *testing.T) {
+	loadTestConfig(t)
+	if _, err := exec.LookPath(config.AppConfig.FFprobePath); err != nil {
+		t.Skipf("%s is not installed", config.AppConfig.FFprobePath)
+	}
+	storage, err := services.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := handlers.NewMediaHandler(storage, nil, newTestRepository(t), nil, nil)
+	router := gin.New()
+	router.POST("/api/v1/upload-stream", handler.UploadMediaStream)
+
+	// The magic bytes of an MP4 in front of something FFprobe cannot read
+	body := "\x00\x00\x00\x14ftypisom\x00\x00\x02\x00isom" + strings.Repeat("x", 4096)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/upload-stream?filename=movie.mp4", strings.NewReader(body))
+	req.Header.Set("Content-Type", "video/mp4")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "File rejected")
+
+	list, err := storage.List(req.Context(), "media/")
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+	spooled, _ := os.ReadDir(config.AppConfig.SpoolPath)
+	assert.Empty(t, spooled)
+}
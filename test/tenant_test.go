@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"api-s3/config"
+	"api-s3/handlers"
+	"api-s3/models"
+	"api-s3/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTenantTest(t *testing.T) *gin.Engine {
+	loadTestConfig(t)
+	config.AppConfig.AuthEnabled = true
+	config.AppConfig.EnableImageProcessing = false
+	storage, err := services.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newTestRepository(t)
+	if err := services.EnsureAdminAPIKey(repo, testAdminKey); err != nil {
+		t.Fatal(err)
+	}
+
+	media := handlers.NewMediaHandler(storage, nil, repo, nil, nil)
+	keys := handlers.NewAPIKeyHandler(repo, nil)
+	tenants := handlers.NewTenantHandler(repo)
+	router := gin.New()
+	router.POST("/api/v1/upload-stream", keys.RequireScope(models.ScopeUpload), media.UploadMediaStream)
+	router.GET("/api/v1/media", keys.RequireScope(models.ScopeRead), media.ListMedia)
+	router.GET("/api/v1/media/:id", keys.RequireScope(models.ScopeRead), media.GetMediaInfo)
+	router.DELETE("/api/v1/media/:id", keys.RequireScope(models.ScopeDelete), media.DeleteMedia)
+	router.GET("/uploads/*path", keys.RequireScope(models.ScopeRead), media.ServeStoredFile)
+	router.POST("/api/v1/admin/keys", keys.RequireScope(models.ScopeAdmin), keys.CreateKey)
+	admin := router.Group("/api/v1/admin/tenants", keys.RequireScope(models.ScopeAdmin))
+	admin.POST("", tenants.CreateTenant)
+	admin.GET("/:id", tenants.GetTenant)
+	admin.PUT("/:id", tenants.UpdateTenant)
+	return router
+}
+
+func createTestTenant(t *testing.T, router *gin.Engine, body string) (*models.Tenant, string) {
+	w := authRequest(router, http.MethodPost, "/api/v1/admin/tenants", testAdminKey, body)
+	if !assert.Equal(t, http.StatusCreated, w.Code, w.Body.String()) {
+		t.FailNow()
+	}
+	var resp models.TenantResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	request, _ := json.Marshal(models.APIKeyRequest{Name: resp.Tenant.ID, TenantID: resp.Tenant.ID,
+		Scopes: []string{models.ScopeUpload, models.ScopeRead, models.ScopeDelete}})
+	w = authRequest(router, http.MethodPost, "/api/v1/admin/keys", testAdminKey, string(request))
+	if !assert.Equal(t, http.StatusCreated, w.Code, w.Body.String()) {
+		t.FailNow()
+	}
+	var key models.APIKeyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &key))
+	assert.Equal(t, resp.Tenant.ID, key.APIKey.TenantID)
+	return resp.Tenant, key.APIKey.Key
+}
+
+func TestTenantIsolation(t *testing.T) {
+	router := setupTenantTest(t)
+	_, acme := createTestTenant(t, router, `{"id":"acme","name":"Acme"}`)
+	_, globex := createTestTenant(t, router, `{"id":"globex","name":"Globex"}`)
+
+	w := authRequest(router, http.MethodPost, "/api/v1/upload-stream?filename=a.png", acme, "\x89PNG\r\n\x1a\n-png-data")
+	if !assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		return
+	}
+	var upload models.UploadResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &upload))
+	media := upload.Media
+	assert.Equal(t, "acme", media.TenantID)
+	assert.True(t, strings.HasPrefix(media.StorageKey, "tenants/acme/media/"+media.ID+"/"), media.StorageKey)
+
+	target := "/api/v1/media/" + media.ID
+	assert.Equal(t, http.StatusOK, authRequest(router, http.MethodGet, target, acme, "").Code)
+	assert.Equal(t, http.StatusNotFound, authRequest(router, http.MethodGet, target, globex, "").Code)
+	assert.Equal(t, http.StatusNotFound, authRequest(router, http.MethodDelete, target, globex, "").Code)
+	assert.Equal(t, http.StatusOK, authRequest(router, http.MethodGet, target, testAdminKey, "").Code)
+
+	// Stored files are behind the same checks
+	file := "/uploads/" + media.StorageKey
+	w = authRequest(router, http.MethodGet, file, acme, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "\x89PNG\r\n\x1a\n-png-data", w.Body.String())
+	assert.Equal(t, "private, max-age=604800", w.Header().Get("Cache-Control"))
+	assert.Equal(t, http.StatusNotFound, authRequest(router, http.MethodGet, file, globex, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, authRequest(router, http.MethodGet, file, "", "").Code)
+	assert.Equal(t, http.StatusNotFound, authRequest(router, http.MethodGet, "/uploads/media/"+media.ID+"/a.png", testAdminKey, "").Code)
+	assert.Equal(t, http.StatusOK, authRequest(router, http.MethodGet, file, testAdminKey, "").Code)
+
+	count := func(key string) int {
+		var list struct {
+			Media []models.Media `json:"media"`
+		}
+		w := authRequest(router, http.MethodGet, "/api/v1/media", key, "")
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+		return len(list.Media)
+	}
+	assert.Equal(t, 1, count(acme))
+	assert.Equal(t, 0, count(globex))
+	assert.Equal(t, 1, count(testAdminKey))
+
+	assert.Equal(t, http.StatusOK, authRequest(router, http.MethodDelete, target, acme, "").Code)
+	assert.Equal(t, http.StatusNotFound, authRequest(router, http.MethodGet, target, acme, "").Code)
+}
+
+func TestTenantLimits(t *testing.T) {
+	router := setupTenantTest(t)
+	tenant, key := createTestTenant(t, router,
+		`{"id":"small","name":"Small","max_file_size":16,"allowed_containers":["JPEG"],"encoding_profile":{"renditions":["360p"]}}`)
+	assert.Equal(t, []string{"jpeg"}, tenant.AllowedContainers)
+	assert.True(t, (&models.Tenant{AllowedContainers: []string{"JPEG"}}).AllowsContainer("jpeg"))
+	assert.False(t, (&models.Tenant{AllowedContainers: []string{"JPEG"}}).AllowsContainer("png"))
+	assert.Equal(t, []string{"360p"}, tenant.EncodingProfile.Renditions)
+
+	w := authRequest(router, http.MethodPost, "/api/v1/upload-stream?filename=a.png", key, "\x89PNG\r\n\x1a\n")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "png files are not allowed for this tenant")
+
+	w = authRequest(router, http.MethodPost, "/api/v1/upload-stream?filename=a.jpg", key, "\xff\xd8\xff"+strings.Repeat("x", 32))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "16 bytes")
+
+	w = authRequest(router, http.MethodPost, "/api/v1/upload-stream?filename=a.jpg", key, "\xff\xd8\xff-jpeg")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// Lifting the limit applies to the next upload
+	w = authRequest(router, http.MethodPut, "/api/v1/admin/tenants/small", testAdminKey, `{"name":"Small"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = authRequest(router, http.MethodPost, "/api/v1/upload-stream?filename=a.png", key, "\x89PNG\r\n\x1a\n"+strings.Repeat("x", 32))
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	for body, status := range map[string]int{
+		`{"id":"small","name":"Again"}`:                                    http.StatusConflict,
+		`{"id":"Not Valid","name":"x"}`:                                    http.StatusBadRequest,
+		`{"id":"exe","name":"x","allowed_containers":["exe"]}`:             http.StatusBadRequest,
+		`{"id":"uhd","name":"x","encoding_profile":{"renditions":["4k"]}}`: http.StatusBadRequest,
+	} {
+		assert.Equal(t, status, authRequest(router, http.MethodPost, "/api/v1/admin/tenants", testAdminKey, body).Code, body)
+	}
+
+	w = authRequest(router, http.MethodPost, "/api/v1/admin/keys", testAdminKey, `{"name":"x","scopes":["read"],"tenant_id":"missing"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Unknown tenant: missing")
+}
+
+func TestTenantStorageKeys(t *testing.T) {
+	assert.Equal(t, "media/m1/a.mp4", services.MediaKey("", "m1", "a.mp4"))
+	assert.Equal(t, "media/m1/a.mp4", services.MediaKey(models.DefaultTenantID, "m1", "a.mp4"))
+	assert.Equal(t, "tenants/acme/media/m1/a.mp4", services.MediaKey("acme", "m1", "../a.mp4"))
+	assert.Equal(t, "tenants/acme/media/m1/hls", services.HLSPrefix("acme", "m1"))
+	assert.Equal(t, "tenants/acme/media/m1/thumbnails/small.jpg", services.ThumbnailKey("acme", "m1", models.ThumbnailSmall))
+}
+
+func TestJWTTenantClaim(t *testing.T) {
+	rsaSigner, _ := newTestSigners(t)
+	setupJWTTest(t, rsaSigner)
+	config.AppConfig.JWTTenantClaim = "org.id"
+	verifier, err := services.NewJWTVerifier()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	claims := testClaims("read")
+	claims["org"] = map[string]any{"id": "acme"}
+	granted, err := verifier.Verify(context.Background(), rsaSigner.sign(t, claims))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "acme", granted.TenantID)
+	}
+
+	_, err = verifier.Verify(context.Background(), rsaSigner.sign(t, testClaims("read")))
+	assert.EqualError(t, err, "token has no valid org.id claim")
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"api-s3/config"
+	"api-s3/handlers"
+	"api-s3/models"
+	"api-s3/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThumbnailTimestamp(t *testing.T) {
+	loadTestConfig(t)
+	config.AppConfig.ThumbnailPosition = 10
+
+	assert.Equal(t, 0.0, services.ThumbnailTimestamp(0))
+	assert.InDelta(t, 0.4, services.ThumbnailTimestamp(4), 0.001) // shorter than the old fixed 10s
+	assert.InDelta(t, 360.0, services.ThumbnailTimestamp(3600), 0.001)
+}
+
+func TestGetThumbnailSizes(t *testing.T) {
+	loadTestConfig(t)
+	storage, err := services.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newTestRepository(t)
+	handler := handlers.NewMediaHandler(storage, nil, repo, nil, nil)
+	router := gin.New()
+	router.GET("/api/v1/media/:id/thumbnail", handler.GetThumbnail)
+
+	thumbnail := func(size models.ThumbnailSize, width, height int) models.Thumbnail {
+		key := services.ThumbnailKey(models.DefaultTenantID, "v1", size)
+		return models.Thumbnail{Size: size, Width: width, Height: height, URL: storage.URL(key), StorageKey: key}
+	}
+	repo.CreateMedia(&models.Media{ID: "v1", MediaType: models.MediaTypeVideo, Thumbnails: []models.Thumbnail{
+		thumbnail(models.ThumbnailSmall, 320, 136),
+		thumbnail(models.ThumbnailMedium, 640, 272),
+	}})
+	repo.CreateMedia(&models.Media{ID: "v2", MediaType: models.MediaTypeVideo})
+
+	stored, err := repo.GetMedia("v1")
+	assert.NoError(t, err)
+	assert.Len(t, stored.Thumbnails, 2)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	// Redirects go to presigned URLs
+	location := func(w *httptest.ResponseRecorder) string {
+		target, err := url.Parse(w.Header().Get("Location"))
+		if assert.NoError(t, err) {
+			assert.NotEmpty(t, target.Query().Get("signature"))
+		}
+		return target.Path
+	}
+
+	w := get("/api/v1/media/v1/thumbnail")
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "/uploads/media/v1/thumbnails/medium.jpg", location(w))
+
+	w = get("/api/v1/media/v1/thumbnail?size=small")
+	assert.Equal(t, "/uploads/media/v1/thumbnails/small.jpg", location(w))
+
+	// Large was not generated, medium is the closest
+	w = get("/api/v1/media/v1/thumbnail?size=large")
+	assert.Equal(t, "/uploads/media/v1/thumbnails/medium.jpg", location(w))
+
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/media/v1/thumbnail?size=huge").Code)
+	assert.Equal(t, http.StatusNotFound, get("/api/v1/media/v2/thumbnail").Code)
+	assert.Equal(t, http.StatusNotFound, get("/api/v1/media/missing/thumbnail").Code)
+}
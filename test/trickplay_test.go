@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"api-s3/handlers"
+	"api-s3/models"
+	"api-s3/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrickplayVTT(t *testing.T) {
+	layout := &models.Trickplay{Interval: 10, TileWidth: 160, TileHeight: 90, Columns: 2, Rows: 2, Count: 5}
+	vtt := services.TrickplayVTT(layout, 45, []string{"sprite_001.jpg", "sprite_002.jpg"})
+
+	assert.True(t, strings.HasPrefix(vtt, "WEBVTT\n"))
+	cues := strings.Split(strings.TrimSpace(vtt), "\n\n")[1:]
+	assert.Equal(t, []string{
+		"00:00:00.000 --> 00:00:10.000\nsprite_001.jpg#xywh=0,0,160,90",
+		"00:00:10.000 --> 00:00:20.000\nsprite_001.jpg#xywh=160,0,160,90",
+		"00:00:20.000 --> 00:00:30.000\nsprite_001.jpg#xywh=0,90,160,90",
+		"00:00:30.000 --> 00:00:40.000\nsprite_001.jpg#xywh=160,90,160,90",
+		"00:00:40.000 --> 00:00:45.000\nsprite_002.jpg#xywh=0,0,160,90", // the last cue ends with the video
+	}, cues)
+}
+
+func TestGetVideoStreamTrickplay(t *testing.T) {
+	repo := newTestRepository(t)
+	handler := handlers.NewMediaHandler(nil, nil, repo, nil, nil)
+	router := gin.New()
+	router.GET("/api/v1/media/:id/stream", handler.GetVideoStream)
+
+	trickplay := &models.Trickplay{
+		VTTURL:     "/uploads/media/v1/trickplay/thumbnails.vtt",
+		SpriteURLs: []string{"/uploads/media/v1/trickplay/sprite_001.jpg"},
+		Format:     "jpg",
+		Interval:   10,
+		TileWidth:  160,
+		TileHeight: 90,
+		Columns:    10,
+		Rows:       10,
+		Count:      12,
+	}
+	repo.CreateMedia(&models.Media{ID: "v1", MediaType: models.MediaTypeVideo, Trickplay: trickplay})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/media/v1/stream", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.VideoStreamResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, trickplay, response.Trickplay)
+}
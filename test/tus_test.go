@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"api-s3/config"
+	"api-s3/handlers"
+	"api-s3/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTusTest(t *testing.T) (*gin.Engine, *services.TusStore) {
+	loadTestConfig(t)
+	config.AppConfig.TusMaxSize = 1 << 20
+	config.AppConfig.EnableImageProcessing = false
+
+	storage, err := services.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newTestRepository(t)
+	store, err := services.NewTusStore(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	media := handlers.NewMediaHandler(storage, nil, repo, nil, nil)
+	tus := handlers.NewTusHandler(media, store)
+
+	router := gin.New()
+	files := router.Group("/api/v1/files", tus.Resumable)
+	files.OPTIONS("", tus.Options)
+	files.POST("", tus.CreateUpload)
+	files.HEAD("/:id", tus.GetUploadOffset)
+	files.PATCH("/:id", tus.PatchUpload)
+	files.DELETE("/:id", tus.DeleteUpload)
+	router.GET("/api/v1/media/:id", media.GetMediaInfo)
+	return router, store
+}
+
+func tusRequest(router *gin.Engine, method, url string, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, bytes.NewReader(body))
+	req.Header.Set("Tus-Resumable", handlers.TusVersion)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func createTusUpload(t *testing.T, router *gin.Engine, length string) string {
+	metadata := "filename " + base64.StdEncoding.EncodeToString([]byte("photo.jpg")) +
+		",filetype " + base64.StdEncoding.EncodeToString([]byte("image/jpeg"))
+	w := tusRequest(router, http.MethodPost, "/api/v1/files", nil, map[string]string{
+		"Upload-Length":   length,
+		"Upload-Metadata": metadata,
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Upload-Expires"))
+	location := w.Header().Get("Location")
+	assert.Contains(t, location, "/api/v1/files/")
+	return location
+}
+
+func TestTusResumableUpload(t *testing.T) {
+	router, _ := setupTusTest(t)
+	content := []byte("\xff\xd8\xff\xe0456789abcdefghij")
+	location := createTusUpload(t, router, "20")
+
+	chunk := map[string]string{"Content-Type": "application/offset+octet-stream", "Upload-Offset": "0"}
+	w := tusRequest(router, http.MethodPatch, location, content[:8], chunk)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "8", w.Header().Get("Upload-Offset"))
+	assert.Empty(t, w.Header().Get("X-Media-ID"))
+
+	// The client lost the response and resumes from the server offset
+	w = tusRequest(router, http.MethodHead, location, nil, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "8", w.Header().Get("Upload-Offset"))
+	assert.Equal(t, "20", w.Header().Get("Upload-Length"))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	chunk["Upload-Offset"] = "4"
+	w = tusRequest(router, http.MethodPatch, location, content[4:], chunk)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	chunk["Upload-Offset"] = "8"
+	w = tusRequest(router, http.MethodPatch, location, content[8:], chunk)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "20", w.Header().Get("Upload-Offset"))
+	mediaID := w.Header().Get("X-Media-ID")
+	assert.NotEmpty(t, mediaID)
+
+	w = tusRequest(router, http.MethodGet, "/api/v1/media/"+mediaID, nil, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"original_name":"photo.jpg"`)
+	assert.Contains(t, w.Body.String(), `"size":20`)
+}
+
+func TestTusProtocolErrors(t *testing.T) {
+	router, store := setupTusTest(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/files", nil)
+	req.Header.Set("Upload-Length", "10")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	w = tusRequest(router, http.MethodOptions, "/api/v1/files", nil, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Contains(t, w.Header().Get("Tus-Extension"), "termination")
+
+	// The declared type is only a hint, the content is checked once it arrives
+	w = tusRequest(router, http.MethodPost, "/api/v1/files", nil, map[string]string{
+		"Upload-Length":   "10",
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("notes.txt")),
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = tusRequest(router, http.MethodPatch, w.Header().Get("Location"), []byte("plain text"), map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": "0",
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = tusRequest(router, http.MethodPost, "/api/v1/files", nil, map[string]string{"Upload-Length": "2097152"})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	location := createTusUpload(t, router, "10")
+	w = tusRequest(router, http.MethodPatch, location, []byte("x"), map[string]string{"Upload-Offset": "0"})
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	w = tusRequest(router, http.MethodDelete, location, nil, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = tusRequest(router, http.MethodHead, location, nil, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	purged, err := store.PurgeExpired()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, purged)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"api-s3/config"
+	"api-s3/handlers"
+	"api-s3/models"
+	"api-s3/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupUploadSessionRouter(t *testing.T, storage services.Storage) *gin.Engine {
+	repo := newTestRepository(t)
+	media := handlers.NewMediaHandler(storage, nil, repo, nil, nil)
+	sessions := handlers.NewUploadSessionHandler(media, repo)
+
+	router := gin.New()
+	router.POST("/api/v1/upload-sessions", sessions.CreateSession)
+	router.POST("/api/v1/upload-sessions/:id/complete", sessions.CompleteSession)
+	router.DELETE("/api/v1/upload-sessions/:id", sessions.AbortSession)
+	return router
+}
+
+func sessionRequest(t *testing.T, router *gin.Engine, method, path string, body any) (int, models.UploadSessionResponse) {
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response models.UploadSessionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid response %q: %v", w.Body.String(), err)
+	}
+	return w.Code, response
+}
+
+// sendPresigned performs a presigned request the way a client would
+func sendPresigned(t *testing.T, request models.PresignedRequest, data []byte) *http.Response {
+	req, err := http.NewRequest(request.Method, request.URL, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range request.Headers {
+		if !strings.EqualFold(name, "Content-Length") {
+			req.Header.Set(name, value)
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestUploadSessionPut(t *testing.T) {
+	fake, s3Service := setupFakeS3(t)
+	config.AppConfig.EnableImageProcessing = false
+	router := setupUploadSessionRouter(t, s3Service)
+	data := []byte("\x89PNG\r\n\x1a\n")
+
+	code, created := sessionRequest(t, router, http.MethodPost, "/api/v1/upload-sessions", models.UploadSessionRequest{
+		Filename:    "photo.png",
+		ContentType: "image/png",
+		Size:        int64(len(data)),
+	})
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, models.UploadMethodPut, created.Session.Method)
+	assert.NotNil(t, created.Put)
+
+	// Completing before the upload fails
+	path := "/api/v1/upload-sessions/" + created.Session.ID + "/complete"
+	code, _ = sessionRequest(t, router, http.MethodPost, path, nil)
+	assert.Equal(t, http.StatusConflict, code)
+
+	resp := sendPresigned(t, *created.Put, data)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, data, fake.objects["/bucket/media/"+created.Session.MediaID+"/photo.png"])
+
+	code, completed := sessionRequest(t, router, http.MethodPost, path, nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, created.Session.MediaID, completed.Media.ID)
+	assert.Equal(t, int64(len(data)), completed.Media.Size)
+	assert.Equal(t, models.SessionStatusCompleted, completed.Session.Status)
+
+	code, _ = sessionRequest(t, router, http.MethodPost, path, nil)
+	assert.Equal(t, http.StatusGone, code)
+}
+
+func TestUploadSessionMultipart(t *testing.T) {
+	fake, s3Service := setupFakeS3(t)
+	config.AppConfig.EnableImageProcessing = false
+	router := setupUploadSessionRouter(t, s3Service)
+	data := bytes.Repeat([]byte("p"), 11*1024*1024)
+	copy(data, "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	code, created := sessionRequest(t, router, http.MethodPost, "/api/v1/upload-sessions", models.UploadSessionRequest{
+		Filename:    "poster.png",
+		ContentType: "image/png",
+		Size:        int64(len(data)),
+	})
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, models.UploadMethodMultipart, created.Session.Method)
+	assert.Len(t, created.Parts, 3)
+	assert.Equal(t, int64(1024*1024), created.Parts[2].Size)
+
+	var parts []models.CompletedPart
+	offset := int64(0)
+	for _, part := range created.Parts {
+		resp := sendPresigned(t, part.PresignedRequest, data[offset:offset+part.Size])
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		parts = append(parts, models.CompletedPart{PartNumber: part.PartNumber, ETag: resp.Header.Get("ETag")})
+		offset += part.Size
+	}
+
+	path := "/api/v1/upload-sessions/" + created.Session.ID + "/complete"
+	code, _ = sessionRequest(t, router, http.MethodPost, path, models.CompleteUploadRequest{Parts: parts[:2]})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, completed := sessionRequest(t, router, http.MethodPost, path, models.CompleteUploadRequest{Parts: parts})
+	if !assert.Equal(t, http.StatusOK, code) {
+		return
+	}
+	assert.Equal(t, int64(len(data)), completed.Media.Size)
+	assert.Equal(t, "image/png", completed.Media.MimeType)
+	assert.Equal(t, data, fake.objects[fmt.Sprintf("/bucket/media/%s/poster.png", created.Session.MediaID)])
+}
+
+func TestUploadSessionAbort(t *testing.T) {
+	fake, s3Service := setupFakeS3(t)
+	router := setupUploadSessionRouter(t, s3Service)
+
+	code, created := sessionRequest(t, router, http.MethodPost, "/api/v1/upload-sessions", models.UploadSessionRequest{
+		Filename:    "movie.mp4",
+		ContentType: "video/mp4",
+		Size:        6 * 1024 * 1024,
+	})
+	assert.Equal(t, http.StatusCreated, code)
+
+	code, _ = sessionRequest(t, router, http.MethodDelete, "/api/v1/upload-sessions/"+created.Session.ID, nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, fake.aborted)
+
+	code, _ = sessionRequest(t, router, http.MethodDelete, "/api/v1/upload-sessions/"+created.Session.ID, nil)
+	assert.Equal(t, http.StatusGone, code)
+	code, _ = sessionRequest(t, router, http.MethodDelete, "/api/v1/upload-sessions/missing", nil)
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestUploadSessionRequiresS3(t *testing.T) {
+	loadTestConfig(t)
+	storage, err := services.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := setupUploadSessionRouter(t, storage)
+
+	code, response := sessionRequest(t, router, http.MethodPost, "/api/v1/upload-sessions", models.UploadSessionRequest{
+		Filename: "photo.png",
+		Size:     10,
+	})
+	assert.Equal(t, http.StatusNotImplemented, code)
+	assert.False(t, response.Success)
+}
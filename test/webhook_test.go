@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"api-s3/config"
+	"api-s3/models"
+	"api-s3/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookDeliveryIsSignedAndRetried(t *testing.T) {
+	repo := setupJobQueueTest(t)
+	config.AppConfig.WebhookURL = ""
+	config.AppConfig.WebhookMaxAttempts = 3
+	config.AppConfig.WebhookRetryBackoff = 0
+
+	var mu sync.Mutex
+	calls := 0
+	received := make(chan *http.Request, 1)
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ = io.ReadAll(r.Body)
+		received <- r
+	}))
+	defer server.Close()
+
+	webhook := &models.Webhook{ID: "hook-1", URL: server.URL, Secret: "s3cret",
+		Events: []string{models.EventProcessingCompleted}, Active: true, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	assert.NoError(t, repo.SaveWebhook(webhook))
+
+	events := services.NewEventBroker()
+	dispatcher := services.NewWebhookDispatcher(repo, events)
+	assert.NoError(t, dispatcher.Start())
+	defer dispatcher.Stop()
+
+	// Not subscribed, must not be delivered
+	events.Publish(models.EventMediaUploaded, "media-1", nil, nil)
+	events.Publish(models.EventProcessingCompleted, "media-1", nil, nil)
+
+	select {
+	case r := <-received:
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, models.EventProcessingCompleted, r.Header.Get(services.WebhookEventHeader))
+		timestamp := r.Header.Get(services.WebhookTimestampHeader)
+		assert.Equal(t, services.SignWebhookPayload("s3cret", timestamp, body), r.Header.Get(services.WebhookSignatureHeader))
+		assert.Contains(t, string(body), `"media_id":"media-1"`)
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+
+	var deliveries []models.WebhookDelivery
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		deliveries, _ = repo.ListDeliveries("hook-1", 10)
+		if len(deliveries) == 1 && deliveries[0].Status == models.DeliveryStatusSucceeded {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if assert.Len(t, deliveries, 1) {
+		assert.Equal(t, models.DeliveryStatusSucceeded, deliveries[0].Status)
+		assert.Equal(t, 2, deliveries[0].Attempts)
+		assert.Equal(t, http.StatusOK, deliveries[0].ResponseStatus)
+	}
+}